@@ -6,11 +6,14 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"gitlab.com/lightmeter/controlcenter/dashboard"
 	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
 	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
 	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
 	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
 	"gitlab.com/lightmeter/controlcenter/util/httputil"
 	"gitlab.com/lightmeter/controlcenter/util/timeutil"
 	"gitlab.com/lightmeter/controlcenter/version"
@@ -52,10 +55,16 @@ func (h countByStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, err)
 	}
 
+	expired, err := h.dashboard.CountByStatus(r.Context(), parser.ExpiredStatus, interval)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, err)
+	}
+
 	return httputil.WriteJson(w, countByStatusResult{
 		"sent":     sent,
 		"deferred": deferred,
 		"bounced":  bounced,
+		"expired":  expired,
 	}, http.StatusOK)
 }
 
@@ -128,6 +137,382 @@ func (h deliveryStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	return servePairsFromTimeInterval(w, r, h.dashboard.DeliveryStatus, interval)
 }
 
+type deliveryStatusOverTimeHandler handler
+
+var timeSeriesGranularities = map[string]dashboard.Granularity{
+	"":     dashboard.GranularityDay,
+	"day":  dashboard.GranularityDay,
+	"hour": dashboard.GranularityHour,
+	"5m":   dashboard.GranularityFiveMinutes,
+}
+
+// @Summary Delivery Status over time, in buckets aligned to the server timezone
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param granularity query string false "5m, hour or day (default)"
+// @Param domain query string false "Count only deliveries to this recipient domain, after the domain mapping is applied"
+// @Param host query string false "Count only deliveries of messages received or delivered by this host"
+// @Param instance query string false "Count only deliveries of messages received or delivered by this postfix instance, as postfix-out"
+// @Produce json
+// @Success 200 {object} dashboard.DeliveryStatusTimeSeries
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/deliveryStatusOverTime [get]
+func (h deliveryStatusOverTimeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	granularity, ok := timeSeriesGranularities[r.Form.Get("granularity")]
+	if !ok {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("Invalid granularity: %v", r.Form.Get("granularity")))
+	}
+
+	series, err := h.dashboard.DeliveryStatusOverTime(r.Context(), dashboard.DeliveryStatusOverTimeOptions{
+		Interval:    httpmiddleware.GetIntervalFromContext(r),
+		Granularity: granularity,
+		Domain:      r.Form.Get("domain"),
+		Host:        r.Form.Get("host"),
+		Instance:    r.Form.Get("instance"),
+	})
+
+	if err != nil && errors.Is(err, dashboard.ErrTooManyBuckets) {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, err)
+	}
+
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, series, http.StatusOK)
+}
+
+type topBounceReasonsHandler handler
+
+// @Summary Top replies given by the remote servers for bounced messages
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param domain query string false "Only for messages to this recipient domain, after the domain mapping is applied"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topBounceReasons [get]
+func (h topBounceReasonsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	domain := r.Form.Get("domain")
+
+	return servePairsFromTimeInterval(w, r, func(ctx context.Context, interval timeutil.TimeInterval) (dashboard.Pairs, error) {
+		return h.dashboard.TopBounceReasons(ctx, interval, domain)
+	}, interval)
+}
+
+type topDeferralReasonsHandler handler
+
+// @Summary Top replies given by the remote servers for deferred messages
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param domain query string false "Only for messages to this recipient domain, after the domain mapping is applied"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topDeferralReasons [get]
+func (h topDeferralReasonsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	domain := r.Form.Get("domain")
+
+	return servePairsFromTimeInterval(w, r, func(ctx context.Context, interval timeutil.TimeInterval) (dashboard.Pairs, error) {
+		return h.dashboard.TopDeferralReasons(ctx, interval, domain)
+	}, interval)
+}
+
+type failureCategoriesHandler handler
+
+// @Summary Number of bounced or deferred messages by category, for instance invalid_recipient or rate_limited
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param domain query string false "Only for messages to this recipient domain, after the domain mapping is applied"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/failureCategories [get]
+func (h failureCategoriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	domain := r.Form.Get("domain")
+
+	return servePairsFromTimeInterval(w, r, func(ctx context.Context, interval timeutil.TimeInterval) (dashboard.Pairs, error) {
+		return h.dashboard.FailureCategories(ctx, interval, domain)
+	}, interval)
+}
+
+type topRejectionReasonsHandler handler
+
+// @Summary Top Rejection Reasons, for messages rejected by smtpd or milters
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topRejectionReasons [get]
+func (h topRejectionReasonsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopRejectionReasons, interval)
+}
+
+type topRejectedClientsHandler handler
+
+// @Summary Top Rejected Clients, by IP address
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topRejectedClients [get]
+func (h topRejectedClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopRejectedClients, interval)
+}
+
+type postscreenConnectionsHandler handler
+
+// @Summary Number of connections that passed the postscreen tests and that were blocked by it
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/postscreenConnections [get]
+func (h postscreenConnectionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.PostscreenConnections, interval)
+}
+
+type topPostscreenDNSBLClientsHandler handler
+
+// @Summary Top clients found by postscreen in DNS blocklists, by IP address
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topPostscreenDNSBLClients [get]
+func (h topPostscreenDNSBLClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopPostscreenDNSBLClients, interval)
+}
+
+type topPostscreenPregreetClientsHandler handler
+
+// @Summary Top clients that talked before the server greeting (PREGREET), by IP address
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topPostscreenPregreetClients [get]
+func (h topPostscreenPregreetClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopPostscreenPregreetClients, interval)
+}
+
+type topSaslFailedClientsHandler handler
+
+// @Summary Top clients failing to authenticate, by IP address
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topSaslFailedClients [get]
+func (h topSaslFailedClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopSaslFailedClients, interval)
+}
+
+type topSaslTargetedUsernamesHandler handler
+
+// @Summary Top usernames failing to authenticate, by the number of distinct clients trying them
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topSaslTargetedUsernames [get]
+func (h topSaslTargetedUsernamesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.TopSaslTargetedUsernames, interval)
+}
+
+type outboundTlsByDomainHandler handler
+
+// @Summary How many messages were sent to each recipient domain in cleartext and under each TLS protocol version
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.TlsUsageByDomain
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/outboundTlsByDomain [get]
+func (h outboundTlsByDomainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	usage, err := h.dashboard.OutboundTlsByDomain(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, usage, http.StatusOK)
+}
+
+type localDeliveryStatusHandler handler
+
+// @Summary Results of the deliveries into the local mailboxes, with the full mailboxes apart from the other failures
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/localDeliveryStatus [get]
+func (h localDeliveryStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+	return servePairsFromTimeInterval(w, r, h.dashboard.LocalDeliveryStatus, interval)
+}
+
+type systemMessagesHandler handler
+
+// @Summary Warnings and errors logged by postfix, grouped by their template
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.SystemMessages
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/systemMessages [get]
+func (h systemMessagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	messages, err := h.dashboard.SystemMessages(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, messages, http.StatusOK)
+}
+
+type remoteMXHealthHandler handler
+
+// @Summary Remote servers with the most connection failures, as timeouts or lost connections
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.RemoteMXHealth
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/remoteMXHealth [get]
+func (h remoteMXHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	health, err := h.dashboard.RemoteMXHealth(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, health, http.StatusOK)
+}
+
+type unreachableDomainsHandler handler
+
+// @Summary Recipient domains whose messages were only deferred due to network failures
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.UnreachableDomains
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/unreachableDomains [get]
+func (h unreachableDomainsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	domains, err := h.dashboard.UnreachableDomains(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, domains, http.StatusOK)
+}
+
+type topExpiredDomainsHandler handler
+
+// @Summary Recipient domains with the most messages returned to the sender after staying in the queue for too long
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.ExpiredDomains
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/topExpiredDomains [get]
+func (h topExpiredDomainsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	domains, err := h.dashboard.TopExpiredDomains(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, domains, http.StatusOK)
+}
+
+type contentFilterVerdictsHandler handler
+
+// @Summary How many deliveries amavis or SpamAssassin classified as clean, spam, infected, etc.
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.Pairs
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/contentFilterVerdicts [get]
+func (h contentFilterVerdictsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	verdicts, err := h.dashboard.ContentFilterVerdicts(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, verdicts, http.StatusOK)
+}
+
+type outboundDkimCoverageHandler handler
+
+// @Summary How many of the messages sent by each sender domain have been signed by OpenDKIM
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.DkimCoverageByDomain
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/outboundDkimCoverage [get]
+func (h outboundDkimCoverageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	coverage, err := h.dashboard.OutboundDkimCoverage(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, coverage, http.StatusOK)
+}
+
+type retryChainsHandler handler
+
+// @Summary How many deferred messages have eventually been delivered or bounced, and how long it took to deliver them
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.RetryChains
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/retryChains [get]
+func (h retryChainsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	chains, err := h.dashboard.RetryChains(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, chains, http.StatusOK)
+}
+
+type mailServersHandler handler
+
+// @Summary What each host and postfix instance has received and delivered
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Produce json
+// @Success 200 {object} dashboard.MailServers
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/mailServers [get]
+func (h mailServersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	servers, err := h.dashboard.MailServers(r.Context(), httpmiddleware.GetIntervalFromContext(r))
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, servers, http.StatusOK)
+}
+
 type appVersionHandler struct{}
 
 type appVersion struct {
@@ -151,5 +536,27 @@ func HttpDashboard(auth *auth.Authenticator, mux *http.ServeMux, timezone *time.
 	mux.Handle("/api/v0/topBouncedDomains", chain.WithEndpoint(topBouncedDomainsHandler{dashboard}))
 	mux.Handle("/api/v0/topDeferredDomains", chain.WithEndpoint(topDeferredDomainsHandler{dashboard}))
 	mux.Handle("/api/v0/deliveryStatus", chain.WithEndpoint(deliveryStatusHandler{dashboard}))
+	mux.Handle("/api/v0/deliveryStatusOverTime", chain.WithEndpoint(deliveryStatusOverTimeHandler{dashboard}))
+	mux.Handle("/api/v0/topBounceReasons", chain.WithEndpoint(topBounceReasonsHandler{dashboard}))
+	mux.Handle("/api/v0/topDeferralReasons", chain.WithEndpoint(topDeferralReasonsHandler{dashboard}))
+	mux.Handle("/api/v0/failureCategories", chain.WithEndpoint(failureCategoriesHandler{dashboard}))
+	mux.Handle("/api/v0/topRejectionReasons", chain.WithEndpoint(topRejectionReasonsHandler{dashboard}))
+	mux.Handle("/api/v0/topRejectedClients", chain.WithEndpoint(topRejectedClientsHandler{dashboard}))
+	mux.Handle("/api/v0/postscreenConnections", chain.WithEndpoint(postscreenConnectionsHandler{dashboard}))
+	mux.Handle("/api/v0/topPostscreenDNSBLClients", chain.WithEndpoint(topPostscreenDNSBLClientsHandler{dashboard}))
+	mux.Handle("/api/v0/topPostscreenPregreetClients", chain.WithEndpoint(topPostscreenPregreetClientsHandler{dashboard}))
+	mux.Handle("/api/v0/topSaslFailedClients", chain.WithEndpoint(topSaslFailedClientsHandler{dashboard}))
+	mux.Handle("/api/v0/topSaslTargetedUsernames", chain.WithEndpoint(topSaslTargetedUsernamesHandler{dashboard}))
+	mux.Handle("/api/v0/outboundTlsByDomain", chain.WithEndpoint(outboundTlsByDomainHandler{dashboard}))
+	mux.Handle("/api/v0/localDeliveryStatus", chain.WithEndpoint(localDeliveryStatusHandler{dashboard}))
+	mux.Handle("/api/v0/systemMessages", chain.WithEndpoint(systemMessagesHandler{dashboard}))
+	mux.Handle("/api/v0/remoteMXHealth", chain.WithEndpoint(remoteMXHealthHandler{dashboard}))
+	mux.Handle("/api/v0/unreachableDomains", chain.WithEndpoint(unreachableDomainsHandler{dashboard}))
+	mux.Handle("/api/v0/topExpiredDomains", chain.WithEndpoint(topExpiredDomainsHandler{dashboard}))
+	mux.Handle("/api/v0/contentFilterVerdicts", chain.WithEndpoint(contentFilterVerdictsHandler{dashboard}))
+	mux.Handle("/api/v0/outboundDkimCoverage", chain.WithEndpoint(outboundDkimCoverageHandler{dashboard}))
+	mux.Handle("/api/v0/retryChains", chain.WithEndpoint(retryChainsHandler{dashboard}))
+	mux.Handle("/api/v0/mailServers", chain.WithEndpoint(mailServersHandler{dashboard}))
+	mux.Handle("/api/v0/searchDeliveries", chain.WithEndpoint(searchDeliveriesHandler{dashboard}))
 	mux.Handle("/api/v0/appVersion", chain.WithError(appVersionHandler{}))
 }
@@ -52,6 +52,7 @@ func TestDashboard(t *testing.T) {
 			m.EXPECT().CountByStatus(gomock.Any(), parser.SentStatus, interval).Return(4, nil)
 			m.EXPECT().CountByStatus(gomock.Any(), parser.DeferredStatus, interval).Return(3, nil)
 			m.EXPECT().CountByStatus(gomock.Any(), parser.BouncedStatus, interval).Return(2, nil)
+			m.EXPECT().CountByStatus(gomock.Any(), parser.ExpiredStatus, interval).Return(1, nil)
 
 			s := httptest.NewServer(chain.WithEndpoint((countByStatusHandler{dashboard: m})))
 			r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31", s.URL))
@@ -64,7 +65,7 @@ func TestDashboard(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			// NOTE: all numbers are decoded into an interface{} as float64, so we want to have float64 here, too.
-			expected := map[string]interface{}{"bounced": float64(2), "deferred": float64(3), "sent": float64(4)}
+			expected := map[string]interface{}{"bounced": float64(2), "deferred": float64(3), "sent": float64(4), "expired": float64(1)}
 			So(body, ShouldResemble, expected)
 		})
 	})
@@ -113,5 +114,315 @@ func TestDashboard(t *testing.T) {
 		})
 	})
 
+	Convey("TopRejectionReasons", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(topRejectionReasonsHandler{dashboard: m}))
+
+		m.EXPECT().TopRejectionReasons(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-02 23:59:59 +0000`),
+		}).Return(dashboard.Pairs{
+			dashboard.Pair{Key: "Recipient address rejected: User unknown in virtual mailbox table", Value: 3},
+			dashboard.Pair{Key: "Spam message rejected", Value: 1},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		dec := json.NewDecoder(r.Body)
+		err = dec.Decode(&body)
+		So(err, ShouldBeNil)
+
+		expected := []interface{}{
+			map[string]interface{}{"key": "Recipient address rejected: User unknown in virtual mailbox table", "value": float64(3)},
+			map[string]interface{}{"key": "Spam message rejected", "value": float64(1)},
+		}
+
+		So(body, ShouldResemble, expected)
+	})
+
+	Convey("TopRejectedClients", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(topRejectedClientsHandler{dashboard: m}))
+
+		m.EXPECT().TopRejectedClients(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-02 23:59:59 +0000`),
+		}).Return(dashboard.Pairs{}, errors.New("Some Internal Dashboard Error"))
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("PostscreenConnections", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(postscreenConnectionsHandler{dashboard: m}))
+
+		m.EXPECT().PostscreenConnections(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-02 23:59:59 +0000`),
+		}).Return(dashboard.Pairs{
+			dashboard.Pair{Key: "passed", Value: 30},
+			dashboard.Pair{Key: "blocked", Value: 12},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		dec := json.NewDecoder(r.Body)
+		err = dec.Decode(&body)
+		So(err, ShouldBeNil)
+
+		expected := []interface{}{
+			map[string]interface{}{"key": "passed", "value": float64(30)},
+			map[string]interface{}{"key": "blocked", "value": float64(12)},
+		}
+
+		So(body, ShouldResemble, expected)
+	})
+
+	Convey("TopPostscreenDNSBLClients", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(topPostscreenDNSBLClientsHandler{dashboard: m}))
+
+		m.EXPECT().TopPostscreenDNSBLClients(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-02 23:59:59 +0000`),
+		}).Return(dashboard.Pairs{}, errors.New("Some Internal Dashboard Error"))
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("TopBounceReasons", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(topBounceReasonsHandler{dashboard: m}))
+
+		m.EXPECT().TopBounceReasons(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-02 23:59:59 +0000`),
+		}, "example.com").Return(dashboard.Pairs{
+			dashboard.Pair{Key: "550 5.1.1 <address> User unknown (in reply to RCPT TO command)", Value: 3},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02&domain=example.com", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		dec := json.NewDecoder(r.Body)
+		err = dec.Decode(&body)
+		So(err, ShouldBeNil)
+
+		expected := []interface{}{
+			map[string]interface{}{"key": "550 5.1.1 <address> User unknown (in reply to RCPT TO command)", "value": float64(3)},
+		}
+
+		So(body, ShouldResemble, expected)
+	})
+
+	Convey("TopDeferralReasons", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(topDeferralReasonsHandler{dashboard: m}))
+
+		m.EXPECT().TopDeferralReasons(gomock.Any(), gomock.Any(), "").Return(dashboard.Pairs{}, errors.New("Some Internal Dashboard Error"))
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("FailureCategories", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(failureCategoriesHandler{dashboard: m}))
+
+		m.EXPECT().FailureCategories(gomock.Any(), gomock.Any(), "grouped").Return(dashboard.Pairs{
+			dashboard.Pair{Key: "invalid_recipient", Value: 5},
+			dashboard.Pair{Key: "greylisting", Value: 2},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02&domain=grouped", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+
+		So(body, ShouldResemble, []interface{}{
+			map[string]interface{}{"key": "invalid_recipient", "value": float64(5)},
+			map[string]interface{}{"key": "greylisting", "value": float64(2)},
+		})
+	})
+
+	Convey("DeliveryStatusOverTime", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(deliveryStatusOverTimeHandler{dashboard: m}))
+
+		Convey("Invalid granularity", func() {
+			r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-02&granularity=week", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Too many buckets", func() {
+			m.EXPECT().DeliveryStatusOverTime(gomock.Any(), gomock.Any()).Return(nil, dashboard.ErrTooManyBuckets)
+
+			r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-12-31&granularity=5m", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Success", func() {
+			m.EXPECT().DeliveryStatusOverTime(gomock.Any(), dashboard.DeliveryStatusOverTimeOptions{
+				Interval: timeutil.TimeInterval{
+					From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+					To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+				},
+				Granularity: dashboard.GranularityHour,
+				Domain:      "example.com",
+			}).Return(dashboard.DeliveryStatusTimeSeries{
+				{Time: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`), Sent: 3, Bounced: 1},
+				{Time: testutil.MustParseTime(`2000-01-01 01:00:00 +0000`), Deferred: 2},
+			}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01&granularity=hour&domain=example.com", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+			var body []interface{}
+			dec := json.NewDecoder(r.Body)
+			err = dec.Decode(&body)
+			So(err, ShouldBeNil)
+
+			expected := []interface{}{
+				map[string]interface{}{"time": "2000-01-01T00:00:00Z", "sent": float64(3), "deferred": float64(0), "bounced": float64(1), "expired": float64(0)},
+				map[string]interface{}{"time": "2000-01-01T01:00:00Z", "sent": float64(0), "deferred": float64(2), "bounced": float64(0), "expired": float64(0)},
+			}
+
+			So(body, ShouldResemble, expected)
+		})
+
+		Convey("By mail server", func() {
+			m.EXPECT().DeliveryStatusOverTime(gomock.Any(), dashboard.DeliveryStatusOverTimeOptions{
+				Interval: timeutil.TimeInterval{
+					From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+					To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+				},
+				Granularity: dashboard.GranularityDay,
+				Host:        "mail1",
+				Instance:    "postfix-out",
+			}).Return(dashboard.DeliveryStatusTimeSeries{}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01&host=mail1&instance=postfix-out", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+		})
+	})
+
+	Convey("OutboundTlsByDomain", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(outboundTlsByDomainHandler{dashboard: m}))
+
+		m.EXPECT().OutboundTlsByDomain(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+		}).Return(dashboard.TlsUsageByDomain{
+			{Domain: "example.com", Total: 3, Protocols: dashboard.Pairs{{Key: "TLSv1.3", Value: 2}, {Key: "cleartext", Value: 1}}},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+
+		So(body, ShouldResemble, []interface{}{
+			map[string]interface{}{
+				"domain": "example.com",
+				"total":  float64(3),
+				"protocols": []interface{}{
+					map[string]interface{}{"key": "TLSv1.3", "value": float64(2)},
+					map[string]interface{}{"key": "cleartext", "value": float64(1)},
+				},
+			},
+		})
+	})
+
+	Convey("OutboundDkimCoverage", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(outboundDkimCoverageHandler{dashboard: m}))
+
+		m.EXPECT().OutboundDkimCoverage(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+		}).Return(dashboard.DkimCoverageByDomain{
+			{Domain: "example.com", Total: 4, Signed: 3, Aligned: 2},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+
+		So(body, ShouldResemble, []interface{}{
+			map[string]interface{}{"domain": "example.com", "total": float64(4), "signed": float64(3), "aligned": float64(2)},
+		})
+	})
+
+	Convey("RetryChains", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(retryChainsHandler{dashboard: m}))
+
+		m.EXPECT().RetryChains(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+		}).Return(dashboard.RetryChains{
+			DeferralAttempts:    9,
+			DeferredMessages:    3,
+			EventuallyDelivered: 2,
+			DeferredThenBounced: 1,
+			MedianTimeToRecover: 300,
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body map[string]interface{}
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+
+		So(body, ShouldResemble, map[string]interface{}{
+			"deferral_attempts":      float64(9),
+			"deferred_messages":      float64(3),
+			"eventually_delivered":   float64(2),
+			"deferred_then_bounced":  float64(1),
+			"median_time_to_recover": float64(300),
+		})
+	})
+
+	Convey("MailServers", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(mailServersHandler{dashboard: m}))
+
+		m.EXPECT().MailServers(gomock.Any(), timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2000-01-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2000-01-01 23:59:59 +0000`),
+		}).Return(dashboard.MailServers{
+			{Host: "mail1", Instance: "postfix-in", Received: 3},
+			{Host: "mail1", Instance: "postfix-out", Sent: 2, Deferred: 1},
+		}, nil)
+
+		r, err := http.Get(fmt.Sprintf("%s?from=2000-01-01&to=2000-01-01", s.URL))
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body []interface{}
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+
+		So(body, ShouldResemble, []interface{}{
+			map[string]interface{}{"host": "mail1", "instance": "postfix-in", "received": float64(3),
+				"sent": float64(0), "deferred": float64(0), "bounced": float64(0), "expired": float64(0)},
+			map[string]interface{}{"host": "mail1", "instance": "postfix-out", "received": float64(0),
+				"sent": float64(2), "deferred": float64(1), "bounced": float64(0), "expired": float64(0)},
+		})
+	})
+
 	ctrl.Finish()
 }
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type searchDeliveriesHandler handler
+
+var (
+	deliveriesSortKeys = map[string]dashboard.DeliverySortKey{
+		"":      dashboard.SortDeliveriesByTime,
+		"time":  dashboard.SortDeliveriesByTime,
+		"delay": dashboard.SortDeliveriesByDelay,
+		"size":  dashboard.SortDeliveriesBySize,
+	}
+
+	deliveriesSortOrders = map[string]dashboard.SortOrder{
+		"":     dashboard.SortDescending,
+		"desc": dashboard.SortDescending,
+		"asc":  dashboard.SortAscending,
+	}
+
+	deliveriesDirections = map[string]tracking.MessageDirection{
+		"outbound": tracking.MessageDirectionOutbound,
+		"inbound":  tracking.MessageDirectionIncoming,
+	}
+)
+
+func parseDeliveryFilter(form url.Values) (dashboard.DeliveryFilter, error) {
+	filter := dashboard.DeliveryFilter{
+		SenderLocalPart:     form.Get("sender_local_part"),
+		SenderDomainPart:    form.Get("sender_domain_part"),
+		RecipientLocalPart:  form.Get("recipient_local_part"),
+		RecipientDomainPart: form.Get("recipient_domain_part"),
+		NextRelay:           form.Get("next_relay"),
+		SaslUsername:        form.Get("sasl_username"),
+		Host:                form.Get("host"),
+		Instance:            form.Get("instance"),
+	}
+
+	if s := form.Get("status"); len(s) > 0 {
+		status, ok := parser.ParseSmtpStatus(s)
+		if !ok {
+			return dashboard.DeliveryFilter{}, fmt.Errorf("Invalid status: %v", s)
+		}
+
+		filter.Status = &status
+	}
+
+	if s := form.Get("direction"); len(s) > 0 {
+		direction, ok := deliveriesDirections[s]
+		if !ok {
+			return dashboard.DeliveryFilter{}, fmt.Errorf("Invalid direction: %v", s)
+		}
+
+		filter.Direction = &direction
+	}
+
+	if s := form.Get("dsn_class"); len(s) > 0 {
+		if s != "2" && s != "4" && s != "5" {
+			return dashboard.DeliveryFilter{}, fmt.Errorf("Invalid DSN class: %v", s)
+		}
+
+		filter.DsnClass = s
+	}
+
+	if s := form.Get("client_ip"); len(s) > 0 {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return dashboard.DeliveryFilter{}, fmt.Errorf("Invalid client IP: %v", s)
+		}
+
+		filter.ClientIP = ip
+	}
+
+	if s := form.Get("category"); len(s) > 0 {
+		category, ok := bounceclass.ParseCategory(s)
+		if !ok {
+			return dashboard.DeliveryFilter{}, fmt.Errorf("Invalid category: %v", s)
+		}
+
+		filter.Category = &category
+	}
+
+	return filter, nil
+}
+
+func parseDeliverySearchOptions(r *http.Request) (dashboard.DeliverySearchOptions, error) {
+	filter, err := parseDeliveryFilter(r.Form)
+	if err != nil {
+		return dashboard.DeliverySearchOptions{}, err
+	}
+
+	sortBy, ok := deliveriesSortKeys[r.Form.Get("sort")]
+	if !ok {
+		return dashboard.DeliverySearchOptions{}, fmt.Errorf("Invalid sort key: %v", r.Form.Get("sort"))
+	}
+
+	order, ok := deliveriesSortOrders[r.Form.Get("order")]
+	if !ok {
+		return dashboard.DeliverySearchOptions{}, fmt.Errorf("Invalid sort order: %v", r.Form.Get("order"))
+	}
+
+	limit := 0
+
+	if s := r.Form.Get("limit"); len(s) > 0 {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			return dashboard.DeliverySearchOptions{}, fmt.Errorf("Invalid limit: %v", s)
+		}
+	}
+
+	return dashboard.DeliverySearchOptions{
+		Interval: httpmiddleware.GetIntervalFromContext(r),
+		Filter:   filter,
+		SortBy:   sortBy,
+		Order:    order,
+		Cursor:   r.Form.Get("cursor"),
+		Limit:    limit,
+	}, nil
+}
+
+// @Summary Search deliveries
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param status query string false "sent, bounced or deferred"
+// @Param direction query string false "inbound or outbound. If not set, only the messages shown in the dashboard are returned"
+// @Param sender_local_part query string false "Sender local part"
+// @Param sender_domain_part query string false "Sender domain part"
+// @Param recipient_local_part query string false "Recipient local part"
+// @Param recipient_domain_part query string false "Recipient domain part"
+// @Param dsn_class query string false "First digit of the DSN: 2, 4 or 5"
+// @Param next_relay query string false "Hostname of the next relay"
+// @Param client_ip query string false "IP address of the client that sent the message"
+// @Param category query string false "Category of the failure, for instance invalid_recipient or rate_limited"
+// @Param sasl_username query string false "User the client authenticated as"
+// @Param host query string false "Host that received or delivered the message"
+// @Param instance query string false "Postfix instance that received or delivered the message, as postfix-out"
+// @Param sort query string false "time (default), delay or size"
+// @Param order query string false "desc (default) or asc"
+// @Param cursor query string false "The next_cursor value of the previous page"
+// @Param limit query int false "Maximum number of deliveries in the page"
+// @Produce json
+// @Success 200 {object} dashboard.DeliveriesPage
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/searchDeliveries [get]
+func (h searchDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	options, err := parseDeliverySearchOptions(r)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, err)
+	}
+
+	page, err := h.dashboard.SearchDeliveries(r.Context(), options)
+
+	if err != nil && errors.Is(err, dashboard.ErrInvalidCursor) {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, err)
+	}
+
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, page, http.StatusOK)
+}
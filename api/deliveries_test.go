@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	mock_dashboard "gitlab.com/lightmeter/controlcenter/dashboard/mock"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSearchDeliveries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	m := mock_dashboard.NewMockDashboard(ctrl)
+
+	chain := httpmiddleware.New(httpmiddleware.RequestWithInterval(time.UTC))
+
+	Convey("SearchDeliveries", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(searchDeliveriesHandler{dashboard: m}))
+
+		interval, err := timeutil.ParseTimeInterval("1999-01-01", "1999-12-31", time.UTC)
+		So(err, ShouldBeNil)
+
+		Convey("Invalid filters", func() {
+			for _, params := range []string{"status=lost", "direction=sideways", "dsn_class=3", "client_ip=1.2.3", "sort=name", "order=up", "limit=-1", "category=unknown"} {
+				r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31&%s", s.URL, params))
+				So(err, ShouldBeNil)
+				So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+			}
+		})
+
+		Convey("Invalid cursor", func() {
+			m.EXPECT().SearchDeliveries(gomock.Any(), gomock.Any()).Return(dashboard.DeliveriesPage{}, dashboard.ErrInvalidCursor)
+
+			r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31&cursor=lalala", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Success", func() {
+			status := parser.BouncedStatus
+			direction := tracking.MessageDirectionOutbound
+			category := bounceclass.CategoryInvalidRecipient
+
+			m.EXPECT().SearchDeliveries(gomock.Any(), dashboard.DeliverySearchOptions{
+				Interval: interval,
+				Filter: dashboard.DeliveryFilter{
+					Status:              &status,
+					Direction:           &direction,
+					RecipientDomainPart: "example.com",
+					DsnClass:            "5",
+					ClientIP:            net.ParseIP("11.22.33.44"),
+					Category:            &category,
+					Host:                "mail1",
+					Instance:            "postfix-out",
+				},
+				SortBy: dashboard.SortDeliveriesByDelay,
+				Order:  dashboard.SortAscending,
+				Cursor: "abc",
+				Limit:  10,
+			}).Return(dashboard.DeliveriesPage{
+				Deliveries: []dashboard.Delivery{{ID: 42, Queue: "AAAAAA", Status: "bounced"}},
+				NextCursor: "def",
+			}, nil)
+
+			//nolint:lll
+			r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31&status=bounced&direction=outbound&recipient_domain_part=example.com&dsn_class=5&client_ip=11.22.33.44&category=invalid_recipient&host=mail1&instance=postfix-out&sort=delay&order=asc&cursor=abc&limit=10", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+			var body dashboard.DeliveriesPage
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.NextCursor, ShouldEqual, "def")
+			So(len(body.Deliveries), ShouldEqual, 1)
+			So(body.Deliveries[0].Queue, ShouldEqual, "AAAAAA")
+		})
+	})
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var inFlightSortOrders = map[string]tracking.InFlightOrder{
+	"":     tracking.InFlightOldestFirst,
+	"asc":  tracking.InFlightOldestFirst,
+	"desc": tracking.InFlightNewestFirst,
+}
+
+type inFlightQueuesHandler struct {
+	fetcher tracking.InFlightFetcher
+}
+
+func parseInFlightOptions(r *http.Request) (tracking.InFlightOptions, error) {
+	if r.ParseForm() != nil {
+		return tracking.InFlightOptions{}, errors.New("Wrong Input")
+	}
+
+	order, ok := inFlightSortOrders[r.Form.Get("order")]
+	if !ok {
+		return tracking.InFlightOptions{}, fmt.Errorf("Invalid sort order: %v", r.Form.Get("order"))
+	}
+
+	limit := 0
+
+	if s := r.Form.Get("limit"); len(s) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			return tracking.InFlightOptions{}, fmt.Errorf("Invalid limit: %v", s)
+		}
+	}
+
+	return tracking.InFlightOptions{Order: order, Limit: limit}, nil
+}
+
+// @Summary Messages still in the postfix queue, either waiting for delivery or deferred, like mailq does
+// @Param order query string false "asc (default), for the oldest messages first, or desc"
+// @Param limit query int false "Maximum number of messages returned"
+// @Produce json
+// @Success 200 {object} tracking.InFlightQueues
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/inFlightQueues [get]
+func (h inFlightQueuesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	options, err := parseInFlightOptions(r)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, err)
+	}
+
+	queues, err := h.fetcher.InFlightQueues(r.Context(), time.Now(), options)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, queues, http.StatusOK)
+}
+
+func HttpInFlight(auth *auth.Authenticator, mux *http.ServeMux, fetcher tracking.InFlightFetcher) {
+	mux.Handle("/api/v0/inFlightQueues", httpmiddleware.WithDefaultStack(auth).WithEndpoint(inFlightQueuesHandler{fetcher}))
+}
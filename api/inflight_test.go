@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeInFlightFetcher struct {
+	options tracking.InFlightOptions
+}
+
+func (f *fakeInFlightFetcher) InFlightQueues(ctx context.Context, now time.Time, options tracking.InFlightOptions) (tracking.InFlightQueues, error) {
+	f.options = options
+
+	return tracking.InFlightQueues{
+		Total: 3,
+		Queues: []tracking.InFlightQueue{
+			{Queue: "AAAAAA", Sender: "sender@example.com", Recipients: []string{"recipient@example.com"}, Attempts: 2, LastDeferralReason: "Greylisted"},
+		},
+	}, nil
+}
+
+func (f *fakeInFlightFetcher) CountDeferredQueuedBefore(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+func TestInFlightQueues(t *testing.T) {
+	Convey("InFlightQueues", t, func() {
+		f := &fakeInFlightFetcher{}
+
+		s := httptest.NewServer(httpmiddleware.New().WithEndpoint(inFlightQueuesHandler{fetcher: f}))
+		defer s.Close()
+
+		Convey("Invalid options", func() {
+			for _, params := range []string{"order=up", "limit=0", "limit=lalala"} {
+				r, err := http.Get(fmt.Sprintf("%s?%s", s.URL, params))
+				So(err, ShouldBeNil)
+				So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+			}
+		})
+
+		Convey("Default options", func() {
+			r, err := http.Get(s.URL)
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.options, ShouldResemble, tracking.InFlightOptions{Order: tracking.InFlightOldestFirst})
+		})
+
+		Convey("Newest first", func() {
+			r, err := http.Get(fmt.Sprintf("%s?order=desc&limit=10", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.options, ShouldResemble, tracking.InFlightOptions{Order: tracking.InFlightNewestFirst, Limit: 10})
+
+			var body tracking.InFlightQueues
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.Total, ShouldEqual, 3)
+			So(body.Queues[0].Queue, ShouldEqual, "AAAAAA")
+			So(body.Queues[0].LastDeferralReason, ShouldEqual, "Greylisted")
+		})
+	})
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/logarchive"
+	"gitlab.com/lightmeter/controlcenter/messagelookup"
+	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type rawLogLinesHandler struct {
+	fetcher logarchive.Fetcher
+	lookup  messagelookup.Lookup
+}
+
+// the queues of a delivery are all the ones its message went through,
+// as when it's relayed to a content filter, and not only the one it was delivered from
+func (h rawLogLinesHandler) deliveryQueues(r *http.Request, deliveryID int64) ([]string, error) {
+	queue, err := h.lookup.DeliveryQueue(r.Context(), deliveryID)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	timeline, err := h.lookup.MessageTimeline(r.Context(), queue)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	for _, q := range timeline.Queues {
+		if q == queue {
+			return timeline.Queues, nil
+		}
+	}
+
+	return append([]string{queue}, timeline.Queues...), nil
+}
+
+// @Summary Original log lines, as archived, about a queue or about all the queues the message of a delivery went through
+// @Param queue       query string false "Queue id"
+// @Param delivery_id query int    false "Delivery id, as in the deliveries search. Used if no queue is passed"
+// @Produce json
+// @Success 200 {object} logarchive.RawLines
+// @Failure 404 {string} string "desc"
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/rawLogLines [get]
+func (h rawLogLinesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	if r.ParseForm() != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, errors.New("Wrong Input"))
+	}
+
+	queues := []string{}
+
+	if queue := strings.TrimSpace(r.Form.Get("queue")); len(queue) > 0 {
+		queues = append(queues, queue)
+	}
+
+	if s := r.Form.Get("delivery_id"); len(queues) == 0 && len(s) > 0 {
+		deliveryID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, fmt.Errorf("Invalid delivery id: %v", s))
+		}
+
+		queues, err = h.deliveryQueues(r, deliveryID)
+
+		if errors.Is(err, messagelookup.ErrNoSuchDelivery) {
+			return httperror.NewHTTPStatusCodeError(http.StatusNotFound, errors.New("Delivery not found"))
+		}
+
+		if err != nil {
+			return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+		}
+	}
+
+	if len(queues) == 0 {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, errors.New("Missing queue or delivery_id value"))
+	}
+
+	lines, err := h.fetcher.RawLines(r.Context(), queues)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	if len(lines.Lines) == 0 {
+		return httperror.NewHTTPStatusCodeError(http.StatusNotFound, errors.New("No archived log lines found"))
+	}
+
+	return httputil.WriteJson(w, lines, http.StatusOK)
+}
+
+func HttpLogArchive(auth *auth.Authenticator, mux *http.ServeMux, fetcher logarchive.Fetcher, lookup messagelookup.Lookup) {
+	mux.Handle("/api/v0/rawLogLines", httpmiddleware.WithDefaultStack(auth).WithEndpoint(rawLogLinesHandler{fetcher: fetcher, lookup: lookup}))
+}
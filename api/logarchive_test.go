@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/logarchive"
+	"gitlab.com/lightmeter/controlcenter/messagelookup"
+	mock_messagelookup "gitlab.com/lightmeter/controlcenter/messagelookup/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeLogArchiveFetcher struct {
+	queues []string
+}
+
+func (f *fakeLogArchiveFetcher) RawLines(ctx context.Context, queues []string) (logarchive.RawLines, error) {
+	f.queues = queues
+
+	lines := []string{}
+
+	for _, q := range queues {
+		if q != "CCCCCC" {
+			lines = append(lines, fmt.Sprintf("Jun  3 10:40:59 mail postfix/qmgr[1005]: %s: removed", q))
+		}
+	}
+
+	return logarchive.RawLines{Queues: queues, Lines: lines}, nil
+}
+
+func TestRawLogLines(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	m := mock_messagelookup.NewMockLookup(ctrl)
+
+	Convey("Raw log lines", t, func() {
+		f := &fakeLogArchiveFetcher{}
+
+		s := httptest.NewServer(httpmiddleware.New().WithEndpoint(rawLogLinesHandler{fetcher: f, lookup: m}))
+		defer s.Close()
+
+		Convey("Missing queue or delivery", func() {
+			r, err := http.Get(s.URL)
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Invalid delivery id", func() {
+			r, err := http.Get(fmt.Sprintf("%s?delivery_id=lalala", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Lines of a queue", func() {
+			r, err := http.Get(fmt.Sprintf("%s?queue=AAAAAA", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.queues, ShouldResemble, []string{"AAAAAA"})
+
+			var body logarchive.RawLines
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.Lines, ShouldResemble, []string{"Jun  3 10:40:59 mail postfix/qmgr[1005]: AAAAAA: removed"})
+		})
+
+		Convey("Nothing archived for a queue", func() {
+			r, err := http.Get(fmt.Sprintf("%s?queue=CCCCCC", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("Lines of all the queues of a delivery", func() {
+			m.EXPECT().DeliveryQueue(gomock.Any(), int64(42)).Return("AAAAAA", nil)
+			m.EXPECT().MessageTimeline(gomock.Any(), "AAAAAA").Return(messagelookup.Timeline{
+				Queues: []string{"AAAAAA", "BBBBBB"},
+			}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?delivery_id=42", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.queues, ShouldResemble, []string{"AAAAAA", "BBBBBB"})
+
+			var body logarchive.RawLines
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.Lines, ShouldHaveLength, 2)
+		})
+
+		Convey("Delivery without message events", func() {
+			m.EXPECT().DeliveryQueue(gomock.Any(), int64(43)).Return("AAAAAA", nil)
+			m.EXPECT().MessageTimeline(gomock.Any(), "AAAAAA").Return(messagelookup.Timeline{Queues: []string{}}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?delivery_id=43", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.queues, ShouldResemble, []string{"AAAAAA"})
+		})
+
+		Convey("Unknown delivery", func() {
+			m.EXPECT().DeliveryQueue(gomock.Any(), int64(44)).Return("", messagelookup.ErrNoSuchDelivery)
+
+			r, err := http.Get(fmt.Sprintf("%s?delivery_id=44", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
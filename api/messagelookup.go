@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/messagelookup"
+	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type searchMessagesHandler struct {
+	lookup messagelookup.Lookup
+}
+
+// @Summary Search messages by queue id, message-id, sender or recipient address
+// @Param from query string true "Initial date in the format 1999-12-23"
+// @Param to   query string true "Final date in the format 1999-12-23"
+// @Param query query string true "Queue id, message-id, sender or recipient address"
+// @Produce json
+// @Success 200 {object} []messagelookup.MessageSummary
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/searchMessages [get]
+func (h searchMessagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	interval := httpmiddleware.GetIntervalFromContext(r)
+
+	query := strings.TrimSpace(r.Form.Get("query"))
+
+	if len(query) == 0 {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, errors.New("Missing query value"))
+	}
+
+	messages, err := h.lookup.SearchMessages(r.Context(), query, interval)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, messages, http.StatusOK)
+}
+
+type fetchMessageTimelineHandler struct {
+	lookup messagelookup.Lookup
+}
+
+// @Summary Fetch the timeline of a message, following all the queues it went through
+// @Param queue query string true "Queue id"
+// @Produce json
+// @Success 200 {object} messagelookup.Timeline
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/fetchMessageTimeline [get]
+func (h fetchMessageTimelineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	if r.ParseForm() != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, errors.New("Wrong Input"))
+	}
+
+	queue := strings.TrimSpace(r.Form.Get("queue"))
+
+	if len(queue) == 0 {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, errors.New("Missing queue value"))
+	}
+
+	timeline, err := h.lookup.MessageTimeline(r.Context(), queue)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	if len(timeline.Events) == 0 {
+		return httperror.NewHTTPStatusCodeError(http.StatusNotFound, errors.New("Queue not found"))
+	}
+
+	return httputil.WriteJson(w, timeline, http.StatusOK)
+}
+
+func HttpMessageLookup(auth *auth.Authenticator, mux *http.ServeMux, timezone *time.Location, lookup messagelookup.Lookup) {
+	chain := httpmiddleware.WithDefaultStack(auth, httpmiddleware.RequestWithInterval(timezone))
+	mux.Handle("/api/v0/searchMessages", chain.WithEndpoint(searchMessagesHandler{lookup}))
+
+	mux.Handle("/api/v0/fetchMessageTimeline", httpmiddleware.WithDefaultStack(auth).WithEndpoint(fetchMessageTimelineHandler{lookup}))
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/messagelookup"
+	mock_messagelookup "gitlab.com/lightmeter/controlcenter/messagelookup/mock"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMessageLookup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	m := mock_messagelookup.NewMockLookup(ctrl)
+
+	chain := httpmiddleware.New(httpmiddleware.RequestWithInterval(time.UTC))
+
+	Convey("SearchMessages", t, func() {
+		s := httptest.NewServer(chain.WithEndpoint(searchMessagesHandler{lookup: m}))
+
+		Convey("Missing query", func() {
+			r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Success", func() {
+			interval, err := timeutil.ParseTimeInterval("1999-01-01", "1999-12-31", time.UTC)
+			So(err, ShouldBeNil)
+
+			m.EXPECT().SearchMessages(gomock.Any(), "user@example.com", interval).Return([]messagelookup.MessageSummary{
+				{Queue: "AAAAAA", Sender: "user@example.com", Recipients: []string{"other@example.com"}, LastStatus: "sent"},
+			}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?from=1999-01-01&to=1999-12-31&query=user@example.com", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+			var body []messagelookup.MessageSummary
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(len(body), ShouldEqual, 1)
+			So(body[0].Queue, ShouldEqual, "AAAAAA")
+		})
+	})
+
+	Convey("FetchMessageTimeline", t, func() {
+		s := httptest.NewServer(httpmiddleware.New().WithEndpoint(fetchMessageTimelineHandler{lookup: m}))
+
+		Convey("Missing queue", func() {
+			r, err := http.Get(s.URL)
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("Queue not found", func() {
+			m.EXPECT().MessageTimeline(gomock.Any(), "BBBBBB").Return(messagelookup.Timeline{}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?queue=BBBBBB", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("Success", func() {
+			m.EXPECT().MessageTimeline(gomock.Any(), "AAAAAA").Return(messagelookup.Timeline{
+				Queues: []string{"AAAAAA"},
+				Events: []messagelookup.Event{{Queue: "AAAAAA", Kind: "queued"}},
+			}, nil)
+
+			r, err := http.Get(fmt.Sprintf("%s?queue=AAAAAA", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+			var body messagelookup.Timeline
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.Queues, ShouldResemble, []string{"AAAAAA"})
+			So(body.Events[0].Kind, ShouldEqual, "queued")
+		})
+	})
+}
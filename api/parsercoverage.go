@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/parsercoverage"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net/http"
+)
+
+type parserCoverageHandler struct {
+	coverage *parsercoverage.Collector
+}
+
+// @Summary Number of log lines not understood by the parser, by process and daemon, with anonymized samples of them
+// @Produce json
+// @Success 200 {object} parsercoverage.Report
+// @Router /api/v0/parserCoverage [get]
+func (h parserCoverageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	return httputil.WriteJson(w, h.coverage.Report(), http.StatusOK)
+}
+
+func HttpParserCoverage(auth *auth.Authenticator, mux *http.ServeMux, coverage *parsercoverage.Collector) {
+	mux.Handle("/api/v0/parserCoverage", httpmiddleware.WithDefaultStack(auth).WithEndpoint(parserCoverageHandler{coverage}))
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/parsercoverage"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParserCoverage(t *testing.T) {
+	Convey("ParserCoverage", t, func() {
+		c := parsercoverage.New()
+
+		c.Observe(parser.Header{Process: "opendkim"}, []byte(`407032C4FF6A: DKIM-Signature field added (s=mail, d=lightmeter.io)`), parser.ErrUnsupportedLogLine)
+		c.Observe(parser.Header{Process: "postfix", Daemon: "smtpd"}, []byte(`connect from unknown[11.22.33.44]`), nil)
+
+		s := httptest.NewServer(httpmiddleware.New().WithEndpoint(parserCoverageHandler{coverage: c}))
+		defer s.Close()
+
+		r, err := http.Get(s.URL)
+		So(err, ShouldBeNil)
+		So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+		var body parsercoverage.Report
+		So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+		So(body, ShouldResemble, parsercoverage.Report{
+			Counts: []parsercoverage.Counts{
+				{Process: "opendkim", Unsupported: 1},
+				{Process: "postfix", Daemon: "smtpd", Parsed: 1},
+			},
+			Samples: []parsercoverage.Sample{
+				{Process: "opendkim", Line: `<queue>: DKIM-Signature field added (s=mail, d=<host>)`, Count: 1},
+			},
+		})
+	})
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/httpauth/auth"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/httputil"
+	"net/http"
+	"strconv"
+)
+
+type trackerGCStatsHandler struct {
+	fetcher tracking.GCStatsFetcher
+}
+
+func parseGCLastRuns(r *http.Request) (int, error) {
+	if r.ParseForm() != nil {
+		return 0, errors.New("Wrong Input")
+	}
+
+	s := r.Form.Get("runs")
+	if len(s) == 0 {
+		return tracking.DefaultGCLastRuns, nil
+	}
+
+	runs, err := strconv.Atoi(s)
+	if err != nil || runs <= 0 {
+		return 0, fmt.Errorf("Invalid number of runs: %v", s)
+	}
+
+	return runs, nil
+}
+
+// @Summary Connections, queues and results expired by the tracker, as the log lines about them have been lost
+// @Param runs query int false "Number of the most recent garbage collections returned, 10 by default"
+// @Produce json
+// @Success 200 {object} tracking.GCStats
+// @Failure 422 {string} string "desc"
+// @Router /api/v0/trackerGCStats [get]
+func (h trackerGCStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	runs, err := parseGCLastRuns(r)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusUnprocessableEntity, err)
+	}
+
+	stats, err := h.fetcher.GCStats(r.Context(), runs)
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return httputil.WriteJson(w, stats, http.StatusOK)
+}
+
+func HttpTrackerGC(auth *auth.Authenticator, mux *http.ServeMux, fetcher tracking.GCStatsFetcher) {
+	mux.Handle("/api/v0/trackerGCStats", httpmiddleware.WithDefaultStack(auth).WithEndpoint(trackerGCStatsHandler{fetcher}))
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/httpmiddleware"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeGCStatsFetcher struct {
+	lastRuns int
+}
+
+func (f *fakeGCStatsFetcher) GCStats(ctx context.Context, lastRuns int) (tracking.GCStats, error) {
+	f.lastRuns = lastRuns
+
+	return tracking.GCStats{
+		Runs:                 2,
+		Queues:               3,
+		IncompleteDeliveries: 1,
+		LastRuns: []tracking.GCRun{
+			{
+				Time:                 testutil.MustParseTime(`2020-01-08 10:00:00 +0000`),
+				Horizon:              testutil.MustParseTime(`2020-01-01 10:00:00 +0000`),
+				Queues:               3,
+				IncompleteDeliveries: 1,
+			},
+		},
+	}, nil
+}
+
+func TestTrackerGCStats(t *testing.T) {
+	Convey("Tracker GC stats", t, func() {
+		f := &fakeGCStatsFetcher{}
+
+		s := httptest.NewServer(httpmiddleware.New().WithEndpoint(trackerGCStatsHandler{fetcher: f}))
+		defer s.Close()
+
+		Convey("Invalid number of runs", func() {
+			for _, params := range []string{"runs=0", "runs=-1", "runs=lalala"} {
+				r, err := http.Get(fmt.Sprintf("%s?%s", s.URL, params))
+				So(err, ShouldBeNil)
+				So(r.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+			}
+		})
+
+		Convey("Default number of runs", func() {
+			r, err := http.Get(s.URL)
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.lastRuns, ShouldEqual, tracking.DefaultGCLastRuns)
+
+			var body tracking.GCStats
+			So(json.NewDecoder(r.Body).Decode(&body), ShouldBeNil)
+			So(body.Queues, ShouldEqual, 3)
+			So(body.IncompleteDeliveries, ShouldEqual, 1)
+			So(body.LastRuns[0].Horizon, ShouldResemble, testutil.MustParseTime(`2020-01-01 10:00:00 +0000`))
+		})
+
+		Convey("Chosen number of runs", func() {
+			r, err := http.Get(fmt.Sprintf("%s?runs=50", s.URL))
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+			So(f.lastRuns, ShouldEqual, 50)
+		})
+	})
+}
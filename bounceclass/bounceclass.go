@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package bounceclass assigns a category to the messages that could not be delivered,
+// telling apart, for instance, recipients that do not exist from servers rate limiting us.
+package bounceclass
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Category int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+	CategoryOther Category = iota
+	CategoryInvalidRecipient
+	CategoryMailboxFull
+	CategoryGreylisting
+	CategoryRateLimited
+	CategoryReputation
+	CategoryContent
+	CategoryAuthentication
+	CategoryNetwork
+)
+
+var categoryNames = map[Category]string{
+	CategoryOther:            "other",
+	CategoryInvalidRecipient: "invalid_recipient",
+	CategoryMailboxFull:      "mailbox_full",
+	CategoryGreylisting:      "greylisting",
+	CategoryRateLimited:      "rate_limited",
+	CategoryReputation:       "reputation",
+	CategoryContent:          "content",
+	CategoryAuthentication:   "authentication",
+	CategoryNetwork:          "network",
+}
+
+func (c Category) String() string {
+	if s, ok := categoryNames[c]; ok {
+		return s
+	}
+
+	return categoryNames[CategoryOther]
+}
+
+func ParseCategory(s string) (Category, bool) {
+	for k, v := range categoryNames {
+		if v == s {
+			return k, true
+		}
+	}
+
+	return CategoryOther, false
+}
+
+func (c Category) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *Category) UnmarshalJSON(b []byte) error {
+	var s string
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, ok := ParseCategory(s)
+	if !ok {
+		return fmt.Errorf("Invalid bounce category: %v", s)
+	}
+
+	*c = v
+
+	return nil
+}
+
+// Producer finds out the category of a non delivered message, given its DSN
+// and the reply given by the remote server, if it's able to do so
+type Producer interface {
+	Classify(dsn, message string) (Category, bool)
+}
+
+type Classifier struct {
+	producers []Producer
+}
+
+// New builds a classifier that asks each of the producers, in order, for the category of a message
+func New(producers ...Producer) *Classifier {
+	return &Classifier{producers: producers}
+}
+
+// Classify returns the category given by the first producer able to classify the message,
+// or CategoryOther if none is
+func (c *Classifier) Classify(dsn, message string) Category {
+	for _, p := range c.producers {
+		if category, ok := p.Classify(dsn, message); ok {
+			return category
+		}
+	}
+
+	return CategoryOther
+}
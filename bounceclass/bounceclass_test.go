@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bounceclass
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+type fakeProducer struct {
+	category Category
+	ok       bool
+}
+
+func (p fakeProducer) Classify(string, string) (Category, bool) {
+	return p.category, p.ok
+}
+
+func TestDefaultRules(t *testing.T) {
+	Convey("Default Rules", t, func() {
+		c := New(DefaultRules)
+
+		cases := []struct {
+			dsn      string
+			message  string
+			expected Category
+		}{
+			{"5.1.1", `(host mx.example.com[11.22.33.44] said: 550 5.1.1 <invalid.email@example.com> User unknown (in reply to RCPT TO command))`, CategoryInvalidRecipient},
+			{"5.0.0", `(host mx.example.com[11.22.33.44] said: 550 Requested action not taken: mailbox unavailable (in reply to RCPT TO command))`, CategoryInvalidRecipient},
+			{"5.2.2", `(host mx.example.com[11.22.33.44] said: 552 5.2.2 Mailbox full (in reply to RCPT TO command))`, CategoryMailboxFull},
+			{"4.2.2", `(host mx.example.com[11.22.33.44] said: 452 4.2.2 The email account that you tried to reach is over quota (in reply to RCPT TO command))`, CategoryMailboxFull},
+			{"4.7.1", `(host mx.example.com[11.22.33.44] said: 451 4.7.1 Greylisted, see http://postgrey.schweikert.ch/help/example.com.html (in reply to RCPT TO command))`, CategoryGreylisting},
+			{"4.7.1", `(host mx.example.com[11.22.33.44] said: 450 4.7.1 <recipient@example.com>: Recipient address rejected: Policy rejection, please try again later (in reply to RCPT TO command))`, CategoryGreylisting},
+			{"4.7.28", `(host gmail-smtp-in.l.google.com[11.22.33.44] said: 421-4.7.28 Our system has detected an unusual rate of unsolicited mail originating from your IP address (in reply to end of DATA command))`, CategoryRateLimited},
+			{"4.7.0", `(host mx.example.com[11.22.33.44] said: 421 4.7.0 Too many connections from your IP, try again later (in reply to MAIL FROM command))`, CategoryRateLimited},
+			{"5.7.1", `(host mx.example.com[11.22.33.44] said: 554 5.7.1 Service unavailable; Client host [1.2.3.4] blocked using zen.spamhaus.org (in reply to RCPT TO command))`, CategoryReputation},
+			{"5.7.26", `(host gmail-smtp-in.l.google.com[11.22.33.44] said: 550-5.7.26 This message does not have authentication information or fails to pass authentication checks (in reply to end of DATA command))`, CategoryAuthentication},
+			{"5.7.1", `(host mx.example.com[11.22.33.44] said: 550 5.7.1 SPF check failed (in reply to MAIL FROM command))`, CategoryAuthentication},
+			{"5.7.1", `(host mx.example.com[11.22.33.44] said: 554 5.7.1 Message rejected because of spam content (in reply to end of DATA command))`, CategoryContent},
+			{"5.3.4", `(host mx.example.com[11.22.33.44] said: 552 5.3.4 Message too big for system (in reply to end of DATA command))`, CategoryContent},
+			{"4.4.1", `(connect to mx.example.com[11.22.33.44]:25: Connection timed out)`, CategoryNetwork},
+			{"4.4.2", `(lost connection with mx.example.com[11.22.33.44] while receiving the initial server greeting)`, CategoryNetwork},
+			{"5.0.0", `(host mx.example.com[11.22.33.44] said: 550 Something strange happened (in reply to RCPT TO command))`, CategoryOther},
+			{"", "", CategoryOther},
+		}
+
+		for _, tc := range cases {
+			So(c.Classify(tc.dsn, tc.message), ShouldEqual, tc.expected)
+		}
+	})
+}
+
+func TestClassifier(t *testing.T) {
+	Convey("Classifier", t, func() {
+		Convey("First producer able to classify wins", func() {
+			c := New(fakeProducer{ok: false, category: CategoryNetwork}, fakeProducer{ok: true, category: CategoryContent}, DefaultRules)
+			So(c.Classify("5.1.1", "User unknown"), ShouldEqual, CategoryContent)
+		})
+
+		Convey("No producers", func() {
+			So(New().Classify("5.1.1", "User unknown"), ShouldEqual, CategoryOther)
+		})
+	})
+}
+
+func TestCategoryJSON(t *testing.T) {
+	Convey("Categories are encoded by name", t, func() {
+		b, err := json.Marshal([]Category{CategoryRateLimited, CategoryOther})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `["rate_limited","other"]`)
+
+		var categories []Category
+		So(json.Unmarshal(b, &categories), ShouldBeNil)
+		So(categories, ShouldResemble, []Category{CategoryRateLimited, CategoryOther})
+
+		So(json.Unmarshal([]byte(`["unknown"]`), &categories), ShouldNotBeNil)
+	})
+}
+
+func TestRules(t *testing.T) {
+	Convey("Rules", t, func() {
+		Convey("Invalid rules", func() {
+			for _, s := range []string{
+				`{`,
+				`{"version": 1, "rules": [{"category": "unknown", "dsn": "5.1.1"}]}`,
+				`{"version": 1, "rules": [{"category": "network"}]}`,
+				`{"version": 1, "rules": [{"category": "network", "pattern": "(unclosed"}]}`,
+			} {
+				_, err := ParseRules(strings.NewReader(s))
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("DSN prefix", func() {
+			rules, err := ParseRules(strings.NewReader(`{"version": 1, "rules": [{"category": "network", "dsn": "4.4.*"}]}`))
+			So(err, ShouldBeNil)
+
+			category, ok := rules.Classify("4.4.7", "")
+			So(ok, ShouldBeTrue)
+			So(category, ShouldEqual, CategoryNetwork)
+
+			_, ok = rules.Classify("4.7.4", "")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Load from workspace", func() {
+			dir, clearDir := testutil.TempDir(t)
+			defer clearDir()
+
+			Convey("Default rules are used when there's no file", func() {
+				rules, err := LoadRules(dir)
+				So(err, ShouldBeNil)
+				So(rules, ShouldEqual, DefaultRules)
+			})
+
+			Convey("Rules in the workspace replace the default ones", func() {
+				content := `{"version": 1, "rules": [{"category": "content", "pattern": "(?i)user unknown"}]}`
+				So(ioutil.WriteFile(path.Join(dir, RulesFilename), []byte(content), 0600), ShouldBeNil)
+
+				rules, err := LoadRules(dir)
+				So(err, ShouldBeNil)
+				So(rules.Version, ShouldEqual, 1)
+				So(New(rules).Classify("5.1.1", "550 5.1.1 User unknown"), ShouldEqual, CategoryContent)
+				So(New(rules).Classify("5.2.2", "552 5.2.2 Mailbox full"), ShouldEqual, CategoryOther)
+			})
+
+			Convey("Invalid file", func() {
+				So(ioutil.WriteFile(path.Join(dir, RulesFilename), []byte(`{"version": 1, "rules": [{"category": "network"}]}`), 0600), ShouldBeNil)
+
+				_, err := LoadRules(dir)
+				So(errors.Is(err, ErrEmptyRule), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bounceclass
+
+// The rules shipped with Control Center. They can be replaced by a file called
+// `bounce_classification_rules.json`, with the same format, in the workspace directory.
+// Please increase the version on every change, as custom rules older than it cause a warning on startup.
+// The order matters, as the first matching rule wins, therefore more specific rules must come first.
+const defaultRulesContent = `
+{
+  "version": 1,
+  "rules": [
+    {"category": "greylisting", "pattern": "(?i)gr[ea]y-?list"},
+    {"category": "greylisting", "dsn": "4.7.1", "pattern": "(?i)try again later|please retry"},
+
+    {"category": "authentication", "dsn": "5.7.20"},
+    {"category": "authentication", "dsn": "5.7.21"},
+    {"category": "authentication", "dsn": "5.7.22"},
+    {"category": "authentication", "dsn": "5.7.23"},
+    {"category": "authentication", "dsn": "5.7.24"},
+    {"category": "authentication", "dsn": "5.7.25"},
+    {"category": "authentication", "dsn": "5.7.26"},
+    {"category": "authentication", "pattern": "(?i)\\b(spf|dkim|dmarc)\\b|sender policy framework|not authenticated|authentication (failed|required)|reverse dns|ptr record"},
+
+    {"category": "reputation", "pattern": "(?i)block ?list|black ?list|blocked using|\\b(dnsbl|dnsrbl|rbl)\\b|spamhaus|spamcop|barracuda|reputation|listed (at|in|on|by)|banned sending ip|sender.*blocked|ip.*blocked"},
+
+    {"category": "rate_limited", "dsn": "4.7.28"},
+    {"category": "rate_limited", "dsn": "4.2.1"},
+    {"category": "rate_limited", "pattern": "(?i)rate.?limit|too many (messages|connections|recipients|emails|mails)|throttl|temporarily (deferred|rate)|exceeded.*(rate|limit|quota per)|unusual rate|try again in \\d+"},
+
+    {"category": "mailbox_full", "dsn": "5.2.2"},
+    {"category": "mailbox_full", "dsn": "4.2.2"},
+    {"category": "mailbox_full", "pattern": "(?i)mailbox (is )?full|over ?quota|quota exceeded|exceeded (the|its|his|her) (storage|quota)|insufficient (storage|space|system storage)"},
+
+    {"category": "invalid_recipient", "dsn": "5.1.1"},
+    {"category": "invalid_recipient", "dsn": "5.1.0"},
+    {"category": "invalid_recipient", "dsn": "5.1.2"},
+    {"category": "invalid_recipient", "dsn": "5.1.3"},
+    {"category": "invalid_recipient", "dsn": "5.1.6"},
+    {"category": "invalid_recipient", "dsn": "5.1.10"},
+    {"category": "invalid_recipient", "dsn": "5.2.1"},
+    {"category": "invalid_recipient", "pattern": "(?i)user unknown|unknown (user|recipient|address)|no such (user|mailbox|recipient)|does not exist|doesn't exist|invalid (recipient|mailbox|address)|recipient (address )?rejected|mailbox (not found|unavailable)|address rejected|account (is )?disabled|does not accept mail"},
+
+    {"category": "content", "dsn": "5.7.7"},
+    {"category": "content", "dsn": "5.6.*"},
+    {"category": "content", "pattern": "(?i)spam|virus|malware|phish|content|suspicious|message (was )?(rejected|refused|blocked) (due to|by|because of)|policy violation|message too (big|large)|size limit"},
+
+    {"category": "network", "dsn": "4.4.*"},
+    {"category": "network", "dsn": "5.4.*"},
+    {"category": "network", "pattern": "(?i)connection (timed out|refused|reset)|lost connection|conversation .* timed out|network is unreachable|no route to host|host not found|name service error|host or domain name not found|tls is required|cannot start tls|handshake"}
+  ]
+}
+`
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bounceclass
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RulesFilename is the name of the file, in the workspace directory,
+// that replaces the rules shipped with Control Center
+const RulesFilename = "bounce_classification_rules.json"
+
+type rawRule struct {
+	Category Category `json:"category"`
+
+	// If it ends with `*`, any DSN starting with the rest of it matches,
+	// for instance `4.4.*`
+	Dsn string `json:"dsn,omitempty"`
+
+	// Regular expression matched against the reply from the remote server
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type rawRules struct {
+	Version int       `json:"version"`
+	Rules   []rawRule `json:"rules"`
+}
+
+type rule struct {
+	category  Category
+	dsn       string
+	dsnPrefix bool
+	pattern   *regexp.Regexp
+}
+
+func (r rule) matches(dsn, message string) bool {
+	dsnMatches := len(r.dsn) == 0 ||
+		(r.dsnPrefix && strings.HasPrefix(dsn, r.dsn)) ||
+		(!r.dsnPrefix && dsn == r.dsn)
+
+	return dsnMatches && (r.pattern == nil || r.pattern.MatchString(message))
+}
+
+// Rules is an ordered list of rules, where the first one matching the message defines its category
+type Rules struct {
+	Version int
+	rules   []rule
+}
+
+var ErrEmptyRule = errors.New("A rule must have a DSN or a pattern")
+
+func ParseRules(reader io.Reader) (*Rules, error) {
+	var raw rawRules
+
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	rules := &Rules{Version: raw.Version, rules: make([]rule, 0, len(raw.Rules))}
+
+	for i, r := range raw.Rules {
+		if len(r.Dsn) == 0 && len(r.Pattern) == 0 {
+			return nil, fmt.Errorf("Rule %d: %w", i, ErrEmptyRule)
+		}
+
+		rule := rule{
+			category:  r.Category,
+			dsn:       strings.TrimSuffix(r.Dsn, "*"),
+			dsnPrefix: strings.HasSuffix(r.Dsn, "*"),
+		}
+
+		if len(r.Pattern) > 0 {
+			pattern, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, errorutil.Wrap(err, "rule: ", i)
+			}
+
+			rule.pattern = pattern
+		}
+
+		rules.rules = append(rules.rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (r *Rules) Classify(dsn, message string) (Category, bool) {
+	for _, rule := range r.rules {
+		if rule.matches(dsn, message) {
+			return rule.category, true
+		}
+	}
+
+	return CategoryOther, false
+}
+
+// DefaultRules are the rules shipped with Control Center
+var DefaultRules = mustParseDefaultRules()
+
+func mustParseDefaultRules() *Rules {
+	rules, err := ParseRules(strings.NewReader(defaultRulesContent))
+	errorutil.MustSucceed(err, "Invalid default bounce classification rules")
+
+	return rules
+}
+
+// LoadRules returns the rules in the workspace directory, if they exist,
+// otherwise the default ones
+func LoadRules(workspaceDirectory string) (*Rules, error) {
+	filename := path.Join(workspaceDirectory, RulesFilename)
+
+	f, err := os.Open(filename)
+
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return DefaultRules, nil
+	}
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(f.Close()) }()
+
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, errorutil.Wrap(err, "file: ", filename)
+	}
+
+	if rules.Version < DefaultRules.Version {
+		log.Warn().Msgf("The bounce classification rules in %s (version %d) are older than the ones shipped with Control Center (version %d)",
+			filename, rules.Version, DefaultRules.Version)
+	}
+
+	return rules, nil
+}
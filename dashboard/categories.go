@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+func setupCategoriesQueries(db *dbconn.RoPooledConn) (err error) {
+	failureCategories, err := db.Prepare(`
+	select
+		category, count(*) as c
+	from
+		deliveries
+	where
+		category is not null and delivery_ts between @from and @to` + directionQueryFragment + `
+	group by
+		category
+	order by
+		c desc, category asc
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(failureCategories.Close(), "Closing failureCategories")
+		}
+	}()
+
+	failureCategoriesByDomain, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		category, count(*) as c
+	from
+		resolve_domain_mapping_view
+	where
+		domain = @domain collate nocase and category is not null and delivery_ts between @from and @to` + directionQueryFragment + `
+	group by
+		category
+	order by
+		c desc, category asc
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(failureCategoriesByDomain.Close(), "Closing failureCategoriesByDomain")
+		}
+	}()
+
+	db.Closers.Add(failureCategories, failureCategoriesByDomain)
+
+	db.Stmts["failureCategories"] = failureCategories
+	db.Stmts["failureCategoriesByDomain"] = failureCategoriesByDomain
+
+	return nil
+}
+
+// FailureCategories returns how many bounced or deferred messages there are in each category
+// (as defined by the bounceclass package)
+func (d sqlDashboard) FailureCategories(ctx context.Context, interval timeutil.TimeInterval, domain string) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	args := []interface{}{
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+	}
+
+	if len(domain) == 0 {
+		return listCategoryAndCount(ctx, conn.Stmts["failureCategories"], args...)
+	}
+
+	return listCategoryAndCount(ctx, conn.Stmts["failureCategoriesByDomain"], append(args, sql.Named("domain", domain))...)
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listCategoryAndCount(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (Pairs, error) {
+	r := Pairs{}
+
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			category   bounceclass.Category
+			countValue int
+		)
+
+		if err := query.Scan(&category, &countValue); err != nil {
+			return Pairs{}, errorutil.Wrap(err)
+		}
+
+		r = append(r, Pair{category.String(), countValue})
+	}
+
+	if err := query.Err(); err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
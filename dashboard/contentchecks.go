@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+// DomainDkimCoverage tells how many of the messages sent by a domain have been signed by OpenDKIM
+type DomainDkimCoverage struct {
+	Domain string `json:"domain"`
+	Total  int    `json:"total"`
+	Signed int    `json:"signed"`
+
+	// Signed by the sender domain itself, rather than by another one, as the one of a relay
+	Aligned int `json:"aligned"`
+}
+
+type DkimCoverageByDomain []DomainDkimCoverage
+
+func setupContentChecksQueries(db *dbconn.RoPooledConn) (err error) {
+	contentFilterVerdicts, err := db.Prepare(`
+	select
+		content_filter_verdict, count(*)
+	from
+		deliveries
+	where
+		content_filter_verdict is not null and delivery_ts between ? and ?
+	group by
+		content_filter_verdict
+	order by
+		content_filter_verdict
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(contentFilterVerdicts.Close(), "Closing contentFilterVerdicts")
+		}
+	}()
+
+	// direction: 0 is outbound
+	outboundDkimCoverage, err := db.Prepare(`
+	select
+		remote_domains.domain,
+		count(*) as c,
+		count(deliveries.dkim_signing_domain_id),
+		total(deliveries.dkim_signing_domain_id = deliveries.sender_domain_part_id)
+	from
+		deliveries join remote_domains on deliveries.sender_domain_part_id = remote_domains.id
+	where
+		deliveries.direction = 0 and deliveries.delivery_ts between ? and ?
+	group by
+		remote_domains.domain
+	order by
+		c desc, remote_domains.domain asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(outboundDkimCoverage.Close(), "Closing outboundDkimCoverage")
+		}
+	}()
+
+	db.Closers.Add(contentFilterVerdicts)
+	db.Closers.Add(outboundDkimCoverage)
+
+	db.Stmts["contentFilterVerdicts"] = contentFilterVerdicts
+	db.Stmts["outboundDkimCoverage"] = outboundDkimCoverage
+
+	return nil
+}
+
+// ContentFilterVerdicts returns how many deliveries have been classified as clean, spam, infected, etc.
+// by amavis or SpamAssassin. Deliveries not checked by them are not counted.
+func (d sqlDashboard) ContentFilterVerdicts(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listContentFilterVerdicts(ctx, conn.Stmts["contentFilterVerdicts"], interval.From.Unix(), interval.To.Unix())
+}
+
+// OutboundDkimCoverage returns, for the sender domains with most outbound deliveries,
+// how many of their messages have been signed
+func (d sqlDashboard) OutboundDkimCoverage(ctx context.Context, interval timeutil.TimeInterval) (DkimCoverageByDomain, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listDkimCoverageByDomain(ctx, conn.Stmts["outboundDkimCoverage"], interval.From.Unix(), interval.To.Unix())
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listContentFilterVerdicts(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (Pairs, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	r := Pairs{}
+
+	for query.Next() {
+		var (
+			verdict parser.ContentFilterVerdict
+			value   int
+		)
+
+		if err := query.Scan(&verdict, &value); err != nil {
+			return Pairs{}, errorutil.Wrap(err)
+		}
+
+		r = append(r, Pair{verdict.String(), value})
+	}
+
+	if err := query.Err(); err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listDkimCoverageByDomain(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (DkimCoverageByDomain, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return DkimCoverageByDomain{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	r := DkimCoverageByDomain{}
+
+	for query.Next() {
+		var c DomainDkimCoverage
+
+		if err := query.Scan(&c.Domain, &c.Total, &c.Signed, &c.Aligned); err != nil {
+			return DkimCoverageByDomain{}, errorutil.Wrap(err)
+		}
+
+		r = append(r, c)
+	}
+
+	if err := query.Err(); err != nil {
+		return DkimCoverageByDomain{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
@@ -28,6 +28,29 @@ type Dashboard interface {
 	TopBouncedDomains(context.Context, timeutil.TimeInterval) (Pairs, error)
 	TopDeferredDomains(context.Context, timeutil.TimeInterval) (Pairs, error)
 	DeliveryStatus(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopRejectionReasons(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopRejectedClients(context.Context, timeutil.TimeInterval) (Pairs, error)
+	SearchDeliveries(context.Context, DeliverySearchOptions) (DeliveriesPage, error)
+	DeliveryStatusOverTime(context.Context, DeliveryStatusOverTimeOptions) (DeliveryStatusTimeSeries, error)
+	// the domain is optional, and refers to the (possibly mapped) recipient domain
+	TopBounceReasons(context.Context, timeutil.TimeInterval, string) (Pairs, error)
+	TopDeferralReasons(context.Context, timeutil.TimeInterval, string) (Pairs, error)
+	FailureCategories(context.Context, timeutil.TimeInterval, string) (Pairs, error)
+	PostscreenConnections(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopPostscreenDNSBLClients(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopPostscreenPregreetClients(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopSaslFailedClients(context.Context, timeutil.TimeInterval) (Pairs, error)
+	TopSaslTargetedUsernames(context.Context, timeutil.TimeInterval) (Pairs, error)
+	OutboundTlsByDomain(context.Context, timeutil.TimeInterval) (TlsUsageByDomain, error)
+	LocalDeliveryStatus(context.Context, timeutil.TimeInterval) (Pairs, error)
+	SystemMessages(context.Context, timeutil.TimeInterval) (SystemMessages, error)
+	RemoteMXHealth(context.Context, timeutil.TimeInterval) (RemoteMXHealth, error)
+	UnreachableDomains(context.Context, timeutil.TimeInterval) (UnreachableDomains, error)
+	TopExpiredDomains(context.Context, timeutil.TimeInterval) (ExpiredDomains, error)
+	ContentFilterVerdicts(context.Context, timeutil.TimeInterval) (Pairs, error)
+	OutboundDkimCoverage(context.Context, timeutil.TimeInterval) (DkimCoverageByDomain, error)
+	RetryChains(context.Context, timeutil.TimeInterval) (RetryChains, error)
+	MailServers(context.Context, timeutil.TimeInterval) (MailServers, error)
 }
 
 type sqlDashboard struct {
@@ -37,6 +60,32 @@ type sqlDashboard struct {
 // direction: 0 is outbound, 1 is inbound (as defined by the tracking package)
 const directionQueryFragment = ` and (direction = 0 || (direction = 1 and sender_domain_part_id = recipient_domain_part_id))`
 
+// resolves the recipient domain of each delivery according to the domain mapping
+const domainMappingByRecipientDomainPartStmtPart = `
+with resolve_domain_mapping_view(domain, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts, response_id, category, relay_tls_session_id, delay, deferral_attempts,
+	delivery_server_id, delivery_instance, receiving_server_id, receiving_instance)
+as
+(
+with
+	aux_domain_mapping(orig_domain, domain_mapped_to, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts, response_id, category, relay_tls_session_id, delay, deferral_attempts,
+	delivery_server_id, delivery_instance, receiving_server_id, receiving_instance)
+as (
+select
+	remote_domains.domain, temp_domain_mapping.mapped, deliveries.status,
+	deliveries.direction, deliveries.sender_domain_part_id, deliveries.recipient_domain_part_id, deliveries.delivery_ts,
+	deliveries.response_id, deliveries.category, deliveries.relay_tls_session_id, deliveries.delay, deliveries.deferral_attempts,
+	deliveries.delivery_server_id, deliveries.delivery_instance, deliveries.receiving_server_id, deliveries.receiving_instance
+from
+	deliveries join remote_domains on deliveries.recipient_domain_part_id = remote_domains.rowid
+	left join temp_domain_mapping on remote_domains.domain = temp_domain_mapping.orig
+) select
+	ifnull(domain_mapped_to, orig_domain) as domain, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts, response_id, category, relay_tls_session_id, delay, deferral_attempts,
+	delivery_server_id, delivery_instance, receiving_server_id, receiving_instance
+from
+	aux_domain_mapping
+)
+`
+
 func New(pool *dbconn.RoPool) (Dashboard, error) {
 	setup := func(db *dbconn.RoPooledConn) error {
 		countByStatus, err := db.Prepare(`
@@ -80,26 +129,6 @@ func New(pool *dbconn.RoPool) (Dashboard, error) {
 			}
 		}()
 
-		domainMappingByRecipientDomainPartStmtPart := `
-with resolve_domain_mapping_view(domain, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts)
-as
-(
-with
-	aux_domain_mapping(orig_domain, domain_mapped_to, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts)
-as (
-select
-	remote_domains.domain, temp_domain_mapping.mapped, deliveries.status,
-	deliveries.direction, deliveries.sender_domain_part_id, deliveries.recipient_domain_part_id, deliveries.delivery_ts
-from
-	deliveries join remote_domains on deliveries.recipient_domain_part_id = remote_domains.rowid
-	left join temp_domain_mapping on remote_domains.domain = temp_domain_mapping.orig
-) select
-	ifnull(domain_mapped_to, orig_domain) as domain, status, direction, sender_domain_part_id, recipient_domain_part_id, delivery_ts
-from
-	aux_domain_mapping
-)
-`
-
 		topDomainsByStatus, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
 				select
                 domain, count(domain) as c
@@ -155,6 +184,66 @@ from
 		db.Stmts["topBusiestDomains"] = topBusiestDomains
 		db.Stmts["topDomainsByStatus"] = topDomainsByStatus
 
+		if err := setupRejectionsQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupDeliveriesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupTimeSeriesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupResponsesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupCategoriesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupPostscreenQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupSaslQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupTlsQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupLocalDeliveryQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupSystemMessagesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupMXHealthQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupExpiredQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupContentChecksQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupRetriesQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := setupMailServersQueries(db); err != nil {
+			return errorutil.Wrap(err)
+		}
+
 		return nil
 	}
 
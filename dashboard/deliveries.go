@@ -0,0 +1,435 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net"
+	"time"
+)
+
+type DeliverySortKey int
+
+const (
+	SortDeliveriesByTime DeliverySortKey = iota
+	SortDeliveriesByDelay
+	SortDeliveriesBySize
+)
+
+type SortOrder int
+
+const (
+	SortDescending SortOrder = iota
+	SortAscending
+)
+
+const (
+	DefaultDeliveriesPageSize = 50
+	MaxDeliveriesPageSize     = 500
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// DeliveryFilter restricts the deliveries returned by SearchDeliveries.
+// Empty (or nil) values are not used for filtering.
+type DeliveryFilter struct {
+	Status              *parser.SmtpStatus
+	Direction           *tracking.MessageDirection
+	SenderLocalPart     string
+	SenderDomainPart    string
+	RecipientLocalPart  string
+	RecipientDomainPart string
+
+	// first digit of the DSN: 2 (success), 4 (persistent transient failure) or 5 (permanent failure)
+	DsnClass string
+
+	NextRelay string
+	ClientIP  net.IP
+
+	// only deliveries that did not succeed have a category
+	Category *bounceclass.Category
+
+	// the user the client authenticated as, when sending the message
+	SaslUsername string
+
+	// the host or postfix instance, or both, that received or delivered the message
+	Host     string
+	Instance string
+}
+
+type DeliverySearchOptions struct {
+	Interval timeutil.TimeInterval
+	Filter   DeliveryFilter
+	SortBy   DeliverySortKey
+	Order    SortOrder
+
+	// Cursor is the NextCursor of a previous page, obtained with the same sorting options
+	Cursor string
+
+	// Limit is the maximum number of deliveries in a page. Zero means DefaultDeliveriesPageSize
+	Limit int
+}
+
+type Delivery struct {
+	ID             int64     `json:"id"`
+	Time           time.Time `json:"time"`
+	Status         string    `json:"status"`
+	Direction      string    `json:"direction"`
+	Queue          string    `json:"queue"`
+	MessageId      string    `json:"message_id"`
+	Sender         string    `json:"sender"`
+	Recipient      string    `json:"recipient"`
+	OrigRecipient  string    `json:"orig_recipient,omitempty"`
+	ClientHostname string    `json:"client_hostname,omitempty"`
+	ClientIP       string    `json:"client_ip,omitempty"`
+	NextRelay      string    `json:"next_relay,omitempty"`
+	Dsn            string    `json:"dsn"`
+	Response       string    `json:"response,omitempty"`
+	Category       string    `json:"category,omitempty"`
+	SaslUsername   string    `json:"sasl_username,omitempty"`
+	Delay          float64   `json:"delay"`
+	ProcessedSize  int64     `json:"processed_size"`
+	DeliveryServer string    `json:"delivery_server"`
+
+	// the postfix instance that delivered the message, and the host and instance that received it,
+	// before it was relayed between them. Unknown for the deliveries stored before they were tracked
+	DeliveryInstance  string `json:"delivery_instance,omitempty"`
+	ReceivingServer   string `json:"receiving_server,omitempty"`
+	ReceivingInstance string `json:"receiving_instance,omitempty"`
+}
+
+type DeliveriesPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type deliveriesQueryKey struct {
+	sortBy DeliverySortKey
+	order  SortOrder
+}
+
+var deliveriesSortColumns = map[DeliverySortKey]string{
+	SortDeliveriesByTime:  `d.delivery_ts`,
+	SortDeliveriesByDelay: `d.delay`,
+	SortDeliveriesBySize:  `d.processed_msg_size`,
+}
+
+// when no direction is asked for, use the same semantics used by the counters in the dashboard,
+// so the user can drill down from them
+var deliveriesDirectionWhereClause = fmt.Sprintf(`((@direction is null and (d.direction = %d or (d.direction = %d and d.sender_domain_part_id = d.recipient_domain_part_id))) or d.direction = @direction)`,
+	tracking.MessageDirectionOutbound, tracking.MessageDirectionIncoming)
+
+func buildSearchDeliveriesStmt(key deliveriesQueryKey) string {
+	column := deliveriesSortColumns[key.sortBy]
+
+	order, cmp := func() (string, string) {
+		if key.order == SortAscending {
+			return "asc", ">"
+		}
+
+		return "desc", "<"
+	}()
+
+	return fmt.Sprintf(`
+	select
+		d.id, d.delivery_ts, d.status, d.direction, ifnull(d.queue, ''), messageids.value,
+		d.sender_local_part, sender_domain.domain, d.recipient_local_part, recipient_domain.domain,
+		ifnull(d.orig_recipient_local_part, ''), ifnull(orig_recipient_domain.domain, ''),
+		ifnull(d.client_hostname, ''), d.client_ip,
+		ifnull(next_relays.hostname, ''), next_relays.ip, ifnull(next_relays.port, 0),
+		d.dsn, ifnull(remote_responses.response, ''), d.category, ifnull(d.sasl_username, ''), d.delay, d.processed_msg_size, delivery_server.hostname,
+		ifnull(d.delivery_instance, ''), ifnull(receiving_server.hostname, ''), ifnull(d.receiving_instance, ''), %[1]s
+	from
+		deliveries d
+		join remote_domains sender_domain on d.sender_domain_part_id = sender_domain.id
+		join remote_domains recipient_domain on d.recipient_domain_part_id = recipient_domain.id
+		left join remote_domains orig_recipient_domain on d.orig_recipient_domain_part_id = orig_recipient_domain.id
+		join messageids on d.message_id = messageids.id
+		join delivery_server on d.delivery_server_id = delivery_server.id
+		left join delivery_server receiving_server on d.receiving_server_id = receiving_server.id
+		left join next_relays on d.next_relay_id = next_relays.id
+		left join remote_responses on d.response_id = remote_responses.id
+	where
+		d.delivery_ts between @start and @end
+		and %[4]s
+		and (@status is null or d.status = @status)
+		and (@sender_local_part is null or d.sender_local_part = @sender_local_part collate nocase)
+		and (@sender_domain_part is null or sender_domain.domain = @sender_domain_part collate nocase)
+		and (@recipient_local_part is null or d.recipient_local_part = @recipient_local_part collate nocase)
+		and (@recipient_domain_part is null or recipient_domain.domain = @recipient_domain_part collate nocase)
+		and (@dsn_class is null or substr(d.dsn, 1, 1) = @dsn_class)
+		and (@next_relay is null or next_relays.hostname = @next_relay collate nocase)
+		and (@client_ip is null or d.client_ip = @client_ip)
+		and (@category is null or d.category = @category)
+		and (@sasl_username is null or d.sasl_username = @sasl_username collate nocase)
+		%[5]s
+		and (@cursor_id is null or %[1]s %[3]s @cursor_value or (%[1]s = @cursor_value and d.id %[3]s @cursor_id))
+	order by
+		%[1]s %[2]s, d.id %[2]s
+	limit @limit
+	`, column, order, cmp, deliveriesDirectionWhereClause, mailServerQueryFragment)
+}
+
+func setupDeliveriesQueries(db *dbconn.RoPooledConn) error {
+	for sortBy := range deliveriesSortColumns {
+		for _, order := range []SortOrder{SortDescending, SortAscending} {
+			key := deliveriesQueryKey{sortBy: sortBy, order: order}
+
+			//nolint:sqlclosecheck
+			stmt, err := db.Prepare(buildSearchDeliveriesStmt(key))
+			if err != nil {
+				return errorutil.Wrap(err)
+			}
+
+			db.Closers.Add(stmt)
+
+			db.Stmts[key] = stmt
+		}
+	}
+
+	return nil
+}
+
+type deliveriesCursor struct {
+	SortBy DeliverySortKey `json:"s"`
+	Order  SortOrder       `json:"o"`
+	Value  float64         `json:"v"`
+	ID     int64           `json:"i"`
+}
+
+func encodeDeliveriesCursor(c deliveriesCursor) string {
+	b, err := json.Marshal(c)
+	errorutil.MustSucceed(err)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeDeliveriesCursor(s string, key deliveriesQueryKey) (deliveriesCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return deliveriesCursor{}, ErrInvalidCursor
+	}
+
+	var c deliveriesCursor
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return deliveriesCursor{}, ErrInvalidCursor
+	}
+
+	// a cursor is only meaningful for the ordering it was created with
+	if c.SortBy != key.sortBy || c.Order != key.order {
+		return deliveriesCursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func textOrNil(s string) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return s
+}
+
+func buildSearchDeliveriesArgs(options DeliverySearchOptions, cursor *deliveriesCursor, limit int) []interface{} {
+	f := options.Filter
+
+	args := []interface{}{
+		sql.Named("start", options.Interval.From.Unix()),
+		sql.Named("end", options.Interval.To.Unix()),
+		sql.Named("sender_local_part", textOrNil(f.SenderLocalPart)),
+		sql.Named("sender_domain_part", textOrNil(f.SenderDomainPart)),
+		sql.Named("recipient_local_part", textOrNil(f.RecipientLocalPart)),
+		sql.Named("recipient_domain_part", textOrNil(f.RecipientDomainPart)),
+		sql.Named("dsn_class", textOrNil(f.DsnClass)),
+		sql.Named("next_relay", textOrNil(f.NextRelay)),
+		sql.Named("sasl_username", textOrNil(f.SaslUsername)),
+		sql.Named("limit", limit),
+	}
+
+	args = append(args, mailServerQueryArgs(f.Host, f.Instance)...)
+
+	var status, direction, clientIP, category, cursorID, cursorValue interface{}
+
+	if f.Status != nil {
+		status = *f.Status
+	}
+
+	if f.Direction != nil {
+		direction = *f.Direction
+	}
+
+	if f.Category != nil {
+		category = *f.Category
+	}
+
+	// client ips are stored in their 16 bytes form
+	if f.ClientIP != nil {
+		clientIP = []byte(f.ClientIP.To16())
+	}
+
+	if cursor != nil {
+		cursorID, cursorValue = cursor.ID, cursor.Value
+	}
+
+	return append(args,
+		sql.Named("status", status),
+		sql.Named("direction", direction),
+		sql.Named("client_ip", clientIP),
+		sql.Named("category", category),
+		sql.Named("cursor_id", cursorID),
+		sql.Named("cursor_value", cursorValue),
+	)
+}
+
+func (d sqlDashboard) SearchDeliveries(ctx context.Context, options DeliverySearchOptions) (DeliveriesPage, error) {
+	key := deliveriesQueryKey{sortBy: options.SortBy, order: options.Order}
+
+	if _, ok := deliveriesSortColumns[key.sortBy]; !ok {
+		return DeliveriesPage{}, errorutil.Wrap(fmt.Errorf("Invalid sort key: %v", key.sortBy))
+	}
+
+	var cursor *deliveriesCursor
+
+	if len(options.Cursor) > 0 {
+		c, err := decodeDeliveriesCursor(options.Cursor, key)
+		if err != nil {
+			return DeliveriesPage{}, err
+		}
+
+		cursor = &c
+	}
+
+	limit := options.Limit
+
+	if limit <= 0 {
+		limit = DefaultDeliveriesPageSize
+	}
+
+	if limit > MaxDeliveriesPageSize {
+		limit = MaxDeliveriesPageSize
+	}
+
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	// fetches one extra row, to know whether there's a next page
+	return searchDeliveries(ctx, conn.Stmts[key], key, limit, buildSearchDeliveriesArgs(options, cursor, limit+1)...)
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func searchDeliveries(ctx context.Context, stmt *sql.Stmt, key deliveriesQueryKey, limit int, args ...interface{}) (DeliveriesPage, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return DeliveriesPage{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	page := DeliveriesPage{Deliveries: []Delivery{}}
+
+	var lastSortValue float64
+
+	for query.Next() {
+		var (
+			delivery                                 Delivery
+			ts                                       int64
+			status                                   parser.SmtpStatus
+			direction                                tracking.MessageDirection
+			senderLocalPart, senderDomainPart        string
+			recipientLocalPart, recipientDomainPart  string
+			origRecipientLocalPart, origRecipientDom string
+			clientIP                                 []byte
+			relayHostname                            string
+			relayIP                                  []byte
+			relayPort                                int
+			category                                 sql.NullInt64
+			sortValue                                float64
+		)
+
+		if err := query.Scan(&delivery.ID, &ts, &status, &direction, &delivery.Queue, &delivery.MessageId,
+			&senderLocalPart, &senderDomainPart, &recipientLocalPart, &recipientDomainPart,
+			&origRecipientLocalPart, &origRecipientDom,
+			&delivery.ClientHostname, &clientIP,
+			&relayHostname, &relayIP, &relayPort,
+			&delivery.Dsn, &delivery.Response, &category, &delivery.SaslUsername, &delivery.Delay, &delivery.ProcessedSize, &delivery.DeliveryServer,
+			&delivery.DeliveryInstance, &delivery.ReceivingServer, &delivery.ReceivingInstance, &sortValue); err != nil {
+			return DeliveriesPage{}, errorutil.Wrap(err)
+		}
+
+		if len(page.Deliveries) == limit {
+			page.NextCursor = encodeDeliveriesCursor(deliveriesCursor{
+				SortBy: key.sortBy,
+				Order:  key.order,
+				Value:  lastSortValue,
+				ID:     page.Deliveries[limit-1].ID,
+			})
+
+			break
+		}
+
+		delivery.Time = time.Unix(ts, 0).In(time.UTC)
+		delivery.Status = status.String()
+		delivery.Direction = directionName(direction)
+		delivery.Sender = emailAddress(senderLocalPart, senderDomainPart)
+		delivery.Recipient = emailAddress(recipientLocalPart, recipientDomainPart)
+		delivery.OrigRecipient = emailAddress(origRecipientLocalPart, origRecipientDom)
+
+		if len(clientIP) > 0 {
+			delivery.ClientIP = net.IP(clientIP).String()
+		}
+
+		if len(relayHostname) > 0 {
+			delivery.NextRelay = fmt.Sprintf("%s[%s]:%d", relayHostname, net.IP(relayIP).String(), relayPort)
+		}
+
+		if category.Valid {
+			delivery.Category = bounceclass.Category(category.Int64).String()
+		}
+
+		lastSortValue = sortValue
+
+		page.Deliveries = append(page.Deliveries, delivery)
+	}
+
+	if err := query.Err(); err != nil {
+		return DeliveriesPage{}, errorutil.Wrap(err)
+	}
+
+	return page, nil
+}
+
+func directionName(d tracking.MessageDirection) string {
+	if d == tracking.MessageDirectionIncoming {
+		return "inbound"
+	}
+
+	return "outbound"
+}
+
+func emailAddress(localPart, domainPart string) string {
+	if len(localPart) == 0 && len(domainPart) == 0 {
+		return ""
+	}
+
+	return localPart + "@" + domainPart
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+// ExpiredDomain summarizes the messages to a recipient domain returned to the sender
+// after being deferred for longer than the maximal queue lifetime
+type ExpiredDomain struct {
+	Domain  string `json:"domain"`
+	Expired int    `json:"expired"`
+
+	// On average, how many times each message has been deferred before expiring
+	AvgDeferralAttempts float64 `json:"avg_deferral_attempts"`
+
+	// On average, for how long, in seconds, each message stayed in the queue before expiring
+	AvgTimeInQueue float64 `json:"avg_time_in_queue"`
+
+	LastExpired time.Time `json:"last_expired"`
+}
+
+type ExpiredDomains []ExpiredDomain
+
+func setupExpiredQueries(db *dbconn.RoPooledConn) (err error) {
+	topExpiredDomains, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		domain, count(*) as c, avg(ifnull(deferral_attempts, 0)), avg(delay), max(delivery_ts)
+	from
+		resolve_domain_mapping_view
+	where
+		status = ? and delivery_ts between ? and ?` + directionQueryFragment + `
+	group by
+		domain collate nocase
+	order by
+		c desc, domain collate nocase asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topExpiredDomains.Close(), "Closing topExpiredDomains")
+		}
+	}()
+
+	db.Closers.Add(topExpiredDomains)
+
+	db.Stmts["topExpiredDomains"] = topExpiredDomains
+
+	return nil
+}
+
+// TopExpiredDomains returns the recipient domains with the most expired messages
+func (d sqlDashboard) TopExpiredDomains(ctx context.Context, interval timeutil.TimeInterval) (ExpiredDomains, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listExpiredDomains(ctx, conn.Stmts["topExpiredDomains"], parser.ExpiredStatus, interval.From.Unix(), interval.To.Unix())
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listExpiredDomains(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (ExpiredDomains, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return ExpiredDomains{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	r := ExpiredDomains{}
+
+	for query.Next() {
+		var (
+			e             ExpiredDomain
+			lastExpiredTs int64
+		)
+
+		if err := query.Scan(&e.Domain, &e.Expired, &e.AvgDeferralAttempts, &e.AvgTimeInQueue, &lastExpiredTs); err != nil {
+			return ExpiredDomains{}, errorutil.Wrap(err)
+		}
+
+		e.LastExpired = time.Unix(lastExpiredTs, 0).In(time.UTC)
+
+		r = append(r, e)
+	}
+
+	if err := query.Err(); err != nil {
+		return ExpiredDomains{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
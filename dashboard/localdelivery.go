@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+// Results of the deliveries into the local mailboxes, via local, virtual, lmtp or pipe
+const (
+	LocalDeliveryDelivered   = "delivered"
+	LocalDeliveryMailboxFull = "mailbox_full"
+	LocalDeliveryDeferred    = "deferred"
+	LocalDeliveryBounced     = "bounced"
+)
+
+func setupLocalDeliveryQueries(db *dbconn.RoPooledConn) (err error) {
+	// direction: 1 is inbound, and the mailbox full results are counted apart from the other failures
+	localDeliveryStatus, err := db.Prepare(`
+	select
+		case
+			when status = @sent then @delivered
+			when category = @mailboxFullCategory then @mailboxFull
+			when status = @deferredStatus then @deferred
+			else @bounced
+		end as result,
+		count(*) as c
+	from
+		deliveries
+	where
+		direction = 1 and delivery_ts between @from and @to
+	group by
+		result
+	order by
+		c desc, result asc
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(localDeliveryStatus.Close(), "Closing localDeliveryStatus")
+		}
+	}()
+
+	db.Closers.Add(localDeliveryStatus)
+
+	db.Stmts["localDeliveryStatus"] = localDeliveryStatus
+
+	return nil
+}
+
+// LocalDeliveryStatus returns how many inbound messages were delivered into the local mailboxes,
+// and how many could not be delivered, with the full mailboxes (or over quota) apart from the other failures
+func (d sqlDashboard) LocalDeliveryStatus(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listTextAndCount(ctx, conn.Stmts["localDeliveryStatus"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("sent", parser.SentStatus),
+		sql.Named("deferredStatus", parser.DeferredStatus),
+		sql.Named("mailboxFullCategory", bounceclass.CategoryMailboxFull),
+		sql.Named("delivered", LocalDeliveryDelivered),
+		sql.Named("mailboxFull", LocalDeliveryMailboxFull),
+		sql.Named("deferred", LocalDeliveryDeferred),
+		sql.Named("bounced", LocalDeliveryBounced),
+	)
+}
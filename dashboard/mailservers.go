@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"sort"
+)
+
+// deliveries of messages received or delivered by a mail server, given by its host (@host),
+// its postfix instance (@instance) or both. Null values are not used for filtering.
+// The deliveries stored before the instances were known match only by the host that delivered them
+const mailServerQueryFragment = ` and ((@host is null and @instance is null)
+	or ((@host is null or delivery_server_id in (select id from delivery_server where hostname = @host collate nocase))
+		and (@instance is null or delivery_instance = @instance))
+	or ((@host is null or receiving_server_id in (select id from delivery_server where hostname = @host collate nocase))
+		and (@instance is null or receiving_instance = @instance)))`
+
+func mailServerQueryArgs(host, instance string) []interface{} {
+	return []interface{}{
+		sql.Named("host", textOrNil(host)),
+		sql.Named("instance", textOrNil(instance)),
+	}
+}
+
+// MailServer is a postfix instance running on a host, as the ones managed by postmulti.
+// A message can be received by one of them and relayed to others, as when content filters
+// re-inject it, until it is delivered
+type MailServer struct {
+	Host string `json:"host"`
+
+	// Empty for the deliveries stored before the instances were known
+	Instance string `json:"instance"`
+
+	// Deliveries of the messages received by the mail server
+	Received int `json:"received"`
+
+	// Deliveries done by the mail server, by status
+	Sent     int `json:"sent"`
+	Deferred int `json:"deferred"`
+	Bounced  int `json:"bounced"`
+	Expired  int `json:"expired"`
+}
+
+// MailServers are sorted by host and instance
+type MailServers []MailServer
+
+func setupMailServersQueries(db *dbconn.RoPooledConn) (err error) {
+	deliveriesByMailServer, err := db.Prepare(`
+	select
+		delivery_server.hostname, ifnull(deliveries.delivery_instance, ''), deliveries.status, count(*)
+	from
+		deliveries join delivery_server on deliveries.delivery_server_id = delivery_server.id
+	where
+		delivery_ts between ? and ?` + directionQueryFragment + `
+	group by
+		delivery_server.hostname, deliveries.delivery_instance, deliveries.status
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(deliveriesByMailServer.Close(), "Closing deliveriesByMailServer")
+		}
+	}()
+
+	receivedByMailServer, err := db.Prepare(`
+	select
+		delivery_server.hostname, ifnull(deliveries.receiving_instance, ''), count(*)
+	from
+		deliveries join delivery_server on deliveries.receiving_server_id = delivery_server.id
+	where
+		delivery_ts between ? and ?` + directionQueryFragment + `
+	group by
+		delivery_server.hostname, deliveries.receiving_instance
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(receivedByMailServer.Close(), "Closing receivedByMailServer")
+		}
+	}()
+
+	db.Closers.Add(deliveriesByMailServer, receivedByMailServer)
+
+	db.Stmts["deliveriesByMailServer"] = deliveriesByMailServer
+	db.Stmts["receivedByMailServer"] = receivedByMailServer
+
+	return nil
+}
+
+type mailServerKey struct {
+	host     string
+	instance string
+}
+
+// MailServers returns what each host and postfix instance has received and delivered,
+// which are the values the deliveries can be filtered by
+func (d sqlDashboard) MailServers(ctx context.Context, interval timeutil.TimeInterval) (MailServers, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	servers := map[mailServerKey]*MailServer{}
+
+	server := func(host, instance string) *MailServer {
+		key := mailServerKey{host: host, instance: instance}
+
+		if s, ok := servers[key]; ok {
+			return s
+		}
+
+		s := &MailServer{Host: host, Instance: instance}
+		servers[key] = s
+
+		return s
+	}
+
+	if err := queryMailServers(ctx, conn.Stmts["deliveriesByMailServer"], interval, func(rows *sql.Rows) error {
+		var (
+			host, instance string
+			status         parser.SmtpStatus
+			count          int
+		)
+
+		if err := rows.Scan(&host, &instance, &status, &count); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		s := server(host, instance)
+
+		switch status {
+		case parser.SentStatus:
+			s.Sent += count
+		case parser.DeferredStatus:
+			s.Deferred += count
+		case parser.BouncedStatus:
+			s.Bounced += count
+		case parser.ExpiredStatus:
+			s.Expired += count
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	if err := queryMailServers(ctx, conn.Stmts["receivedByMailServer"], interval, func(rows *sql.Rows) error {
+		var (
+			host, instance string
+			count          int
+		)
+
+		if err := rows.Scan(&host, &instance, &count); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		server(host, instance).Received += count
+
+		return nil
+	}); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	result := make(MailServers, 0, len(servers))
+
+	for _, s := range servers {
+		result = append(result, *s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+
+		return result[i].Instance < result[j].Instance
+	})
+
+	return result, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func queryMailServers(ctx context.Context, stmt *sql.Stmt, interval timeutil.TimeInterval, scan func(*sql.Rows) error) error {
+	query, err := stmt.QueryContext(ctx, interval.From.Unix(), interval.To.Unix())
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		if err := scan(query); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	if err := query.Err(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net"
+	"sort"
+	"time"
+)
+
+// MXHealth summarizes how well a remote server, by hostname and IP address, could be talked to
+type MXHealth struct {
+	Host string `json:"host"`
+	IP   string `json:"ip"`
+
+	// Number of connection failures, and how many of them of each kind, as timeouts or lost connections
+	Failures       int   `json:"failures"`
+	FailuresByKind Pairs `json:"failures_by_kind"`
+
+	// Number of messages successfully sent to the server
+	Delivered int `json:"delivered"`
+
+	LastFailure time.Time `json:"last_failure"`
+	LastReason  string    `json:"last_reason"`
+}
+
+type RemoteMXHealth []MXHealth
+
+// UnreachableDomain is a recipient domain none of whose MXs accepted messages,
+// which were deferred due to network failures instead
+type UnreachableDomain struct {
+	Domain string `json:"domain"`
+
+	// Number of deliveries deferred due to network failures
+	Deferred int `json:"deferred"`
+
+	FirstFailure time.Time `json:"first_failure"`
+	LastFailure  time.Time `json:"last_failure"`
+}
+
+type UnreachableDomains []UnreachableDomain
+
+const maxRemoteMXHealthEntries = 20
+
+func setupMXHealthQueries(db *dbconn.RoPooledConn) (err error) {
+	mxConnectionFailures, err := db.Prepare(`
+	select
+		f.mx_hostname, f.mx_ip, f.kind, count(*), max(f.failure_ts),
+		(select l.reason from connection_failures l
+			where l.mx_hostname = f.mx_hostname and l.mx_ip is f.mx_ip and l.failure_ts between @from and @to
+			order by l.failure_ts desc, l.id desc limit 1)
+	from
+		connection_failures f
+	where
+		f.failure_ts between @from and @to
+	group by
+		f.mx_hostname, f.mx_ip, f.kind
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(mxConnectionFailures.Close(), "Closing mxConnectionFailures")
+		}
+	}()
+
+	// direction: 0 is outbound
+	mxDeliveries, err := db.Prepare(`
+	select
+		n.hostname, n.ip, count(*)
+	from
+		deliveries d join next_relays n on d.next_relay_id = n.id
+	where
+		d.direction = 0 and d.status = @sent and d.delivery_ts between @from and @to
+	group by
+		n.hostname, n.ip
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(mxDeliveries.Close(), "Closing mxDeliveries")
+		}
+	}()
+
+	// a domain is unreachable if all its deliveries in the interval failed due to network issues
+	unreachableDomains, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		domain,
+		sum(status = @deferred and category = @network) as failures,
+		min(case when status = @deferred and category = @network then delivery_ts end),
+		max(case when status = @deferred and category = @network then delivery_ts end)
+	from
+		resolve_domain_mapping_view
+	where
+		direction = 0 and delivery_ts between @from and @to
+	group by
+		domain
+	having
+		failures > 0 and sum(status = @sent) = 0
+	order by
+		failures desc, domain asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(unreachableDomains.Close(), "Closing unreachableDomains")
+		}
+	}()
+
+	db.Closers.Add(mxConnectionFailures, mxDeliveries, unreachableDomains)
+
+	db.Stmts["mxConnectionFailures"] = mxConnectionFailures
+	db.Stmts["mxDeliveries"] = mxDeliveries
+	db.Stmts["unreachableDomains"] = unreachableDomains
+
+	return nil
+}
+
+// RemoteMXHealth returns the remote servers with the most connection failures,
+// along with how many messages they accepted
+func (d sqlDashboard) RemoteMXHealth(ctx context.Context, interval timeutil.TimeInterval) (RemoteMXHealth, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	r, err := listMXConnectionFailures(ctx, conn.Stmts["mxConnectionFailures"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+	)
+
+	if err != nil {
+		return RemoteMXHealth{}, errorutil.Wrap(err)
+	}
+
+	if err := countMXDeliveries(ctx, conn.Stmts["mxDeliveries"], r,
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("sent", parser.SentStatus),
+	); err != nil {
+		return RemoteMXHealth{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
+
+// UnreachableDomains returns the recipient domains with messages deferred due to network failures,
+// and no message sent to them in the interval
+func (d sqlDashboard) UnreachableDomains(ctx context.Context, interval timeutil.TimeInterval) (UnreachableDomains, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listUnreachableDomains(ctx, conn.Stmts["unreachableDomains"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("sent", parser.SentStatus),
+		sql.Named("deferred", parser.DeferredStatus),
+		sql.Named("network", bounceclass.CategoryNetwork),
+	)
+}
+
+// the IP address is not known on DNS failures
+func mxIPString(ip []byte) string {
+	if len(ip) == 0 {
+		return ""
+	}
+
+	return net.IP(ip).String()
+}
+
+func mxHealthKey(host string, ip []byte) string {
+	return host + "[" + mxIPString(ip) + "]"
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listMXConnectionFailures(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (RemoteMXHealth, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return RemoteMXHealth{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	indexes := map[string]int{}
+
+	r := RemoteMXHealth{}
+
+	for query.Next() {
+		var (
+			host          string
+			ip            []byte
+			kind          parser.SmtpConnectionFailureKind
+			count         int
+			lastFailureTs int64
+			lastReason    string
+		)
+
+		if err := query.Scan(&host, &ip, &kind, &count, &lastFailureTs, &lastReason); err != nil {
+			return RemoteMXHealth{}, errorutil.Wrap(err)
+		}
+
+		key := mxHealthKey(host, ip)
+
+		index, ok := indexes[key]
+		if !ok {
+			index = len(r)
+			indexes[key] = index
+			r = append(r, MXHealth{Host: host, IP: mxIPString(ip), FailuresByKind: Pairs{}, LastReason: lastReason})
+		}
+
+		lastFailure := time.Unix(lastFailureTs, 0).In(time.UTC)
+
+		if lastFailure.After(r[index].LastFailure) {
+			r[index].LastFailure = lastFailure
+		}
+
+		r[index].Failures += count
+		r[index].FailuresByKind = append(r[index].FailuresByKind, Pair{Key: kind.String(), Value: count})
+	}
+
+	if err := query.Err(); err != nil {
+		return RemoteMXHealth{}, errorutil.Wrap(err)
+	}
+
+	for _, h := range r {
+		kinds := h.FailuresByKind
+
+		sort.SliceStable(kinds, func(i, j int) bool {
+			ci, cj := kinds[i].Value.(int), kinds[j].Value.(int)
+			return ci > cj || (ci == cj && kinds[i].Key.(string) < kinds[j].Key.(string))
+		})
+	}
+
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Failures > r[j].Failures || (r[i].Failures == r[j].Failures && r[i].Host < r[j].Host)
+	})
+
+	if len(r) > maxRemoteMXHealthEntries {
+		r = r[:maxRemoteMXHealthEntries]
+	}
+
+	return r, nil
+}
+
+// fills the number of delivered messages of servers already in r
+//nolint:rowserrcheck
+func countMXDeliveries(ctx context.Context, stmt *sql.Stmt, r RemoteMXHealth, args ...interface{}) error {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	indexes := map[string]int{}
+
+	for i, h := range r {
+		indexes[mxHealthKey(h.Host, net.ParseIP(h.IP))] = i
+	}
+
+	for query.Next() {
+		var (
+			host  string
+			ip    []byte
+			count int
+		)
+
+		if err := query.Scan(&host, &ip, &count); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if index, ok := indexes[mxHealthKey(host, ip)]; ok {
+			r[index].Delivered = count
+		}
+	}
+
+	if err := query.Err(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+//nolint:rowserrcheck
+func listUnreachableDomains(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (UnreachableDomains, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return UnreachableDomains{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	r := UnreachableDomains{}
+
+	for query.Next() {
+		var (
+			d              UnreachableDomain
+			firstFailureTs int64
+			lastFailureTs  int64
+		)
+
+		if err := query.Scan(&d.Domain, &d.Deferred, &firstFailureTs, &lastFailureTs); err != nil {
+			return UnreachableDomains{}, errorutil.Wrap(err)
+		}
+
+		d.FirstFailure = time.Unix(firstFailureTs, 0).In(time.UTC)
+		d.LastFailure = time.Unix(lastFailureTs, 0).In(time.UTC)
+
+		r = append(r, d)
+	}
+
+	if err := query.Err(); err != nil {
+		return UnreachableDomains{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+func setupPostscreenQueries(db *dbconn.RoPooledConn) (err error) {
+	// A client passes when it's allowed to talk to smtpd, and it's blocked when postscreen rejects it,
+	// which might be logged several times in the same connection, once per recipient
+	postscreenConnections, err := db.Prepare(`
+	select
+		'passed', count(*)
+	from
+		postscreen_events
+	where
+		event in (@passNew, @passOld, @whitelisted) and event_ts between @from and @to
+	union all
+	select
+		'blocked', count(*)
+	from
+		(
+			select distinct
+				client_ip, client_port
+			from
+				postscreen_events
+			where
+				event in (@reject, @blacklisted) and event_ts between @from and @to
+		)
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(postscreenConnections.Close(), "Closing postscreenConnections")
+		}
+	}()
+
+	topPostscreenClientsByEvent, err := db.Prepare(`
+	select
+		client_ip, count(*) as c
+	from
+		postscreen_events
+	where
+		event = @event and event_ts between @from and @to
+	group by
+		client_ip
+	order by
+		c desc, client_ip asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topPostscreenClientsByEvent.Close(), "Closing topPostscreenClientsByEvent")
+		}
+	}()
+
+	db.Closers.Add(postscreenConnections, topPostscreenClientsByEvent)
+
+	db.Stmts["postscreenConnections"] = postscreenConnections
+	db.Stmts["topPostscreenClientsByEvent"] = topPostscreenClientsByEvent
+
+	return nil
+}
+
+// PostscreenConnections returns how many connections passed the postscreen tests
+// (or were allowlisted) and how many were blocked by it
+func (d sqlDashboard) PostscreenConnections(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listTextAndCount(ctx, conn.Stmts["postscreenConnections"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("passNew", parser.PostscreenPassNew),
+		sql.Named("passOld", parser.PostscreenPassOld),
+		sql.Named("whitelisted", parser.PostscreenWhitelisted),
+		sql.Named("reject", parser.PostscreenReject),
+		sql.Named("blacklisted", parser.PostscreenBlacklisted),
+	)
+}
+
+func (d sqlDashboard) topPostscreenClientsByEvent(ctx context.Context, interval timeutil.TimeInterval, event parser.PostscreenEvent) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listClientsAndCount(ctx, conn.Stmts["topPostscreenClientsByEvent"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("event", event),
+	)
+}
+
+// TopPostscreenDNSBLClients returns the clients most often found in the DNS blocklists checked by postscreen
+func (d sqlDashboard) TopPostscreenDNSBLClients(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	return d.topPostscreenClientsByEvent(ctx, interval, parser.PostscreenDNSBL)
+}
+
+// TopPostscreenPregreetClients returns the clients that most often talked before the server greeting
+func (d sqlDashboard) TopPostscreenPregreetClients(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	return d.topPostscreenClientsByEvent(ctx, interval, parser.PostscreenPregreet)
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net"
+)
+
+func setupRejectionsQueries(db *dbconn.RoPooledConn) (err error) {
+	topRejectionReasons, err := db.Prepare(`
+	select
+		reason, count(*) as c
+	from
+		rejections
+	where
+		reject_ts between ? and ?
+	group by
+		reason
+	order by
+		c desc, reason asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topRejectionReasons.Close(), "Closing topRejectionReasons")
+		}
+	}()
+
+	topRejectedClients, err := db.Prepare(`
+	select
+		client_ip, count(*) as c
+	from
+		rejections
+	where
+		reject_ts between ? and ?
+	group by
+		client_ip
+	order by
+		c desc, client_ip asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topRejectedClients.Close(), "Closing topRejectedClients")
+		}
+	}()
+
+	db.Closers.Add(topRejectionReasons, topRejectedClients)
+
+	db.Stmts["topRejectionReasons"] = topRejectionReasons
+	db.Stmts["topRejectedClients"] = topRejectedClients
+
+	return nil
+}
+
+func (d sqlDashboard) TopRejectionReasons(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listTextAndCount(ctx, conn.Stmts["topRejectionReasons"], interval.From.Unix(), interval.To.Unix())
+}
+
+func (d sqlDashboard) TopRejectedClients(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listClientsAndCount(ctx, conn.Stmts["topRejectedClients"], interval.From.Unix(), interval.To.Unix())
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listTextAndCount(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (Pairs, error) {
+	r := Pairs{}
+
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			text       string
+			countValue int
+		)
+
+		if err := query.Scan(&text, &countValue); err != nil {
+			return Pairs{}, errorutil.Wrap(err)
+		}
+
+		r = append(r, Pair{text, countValue})
+	}
+
+	if err := query.Err(); err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listClientsAndCount(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (Pairs, error) {
+	r := Pairs{}
+
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			ip         []byte
+			countValue int
+		)
+
+		if err := query.Scan(&ip, &countValue); err != nil {
+			return Pairs{}, errorutil.Wrap(err)
+		}
+
+		// The client address is not always present in the rejection message
+		client := func() string {
+			if len(ip) == 0 {
+				return "<none>"
+			}
+
+			return net.IP(ip).String()
+		}()
+
+		r = append(r, Pair{client, countValue})
+	}
+
+	if err := query.Err(); err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+func setupResponsesQueries(db *dbconn.RoPooledConn) (err error) {
+	topResponsesByStatus, err := db.Prepare(`
+	select
+		remote_responses.response, count(*) as c
+	from
+		deliveries join remote_responses on deliveries.response_id = remote_responses.id
+	where
+		status = @status and delivery_ts between @from and @to` + directionQueryFragment + `
+	group by
+		remote_responses.id
+	order by
+		c desc, remote_responses.response asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topResponsesByStatus.Close(), "Closing topResponsesByStatus")
+		}
+	}()
+
+	topResponsesByStatusAndDomain, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		remote_responses.response, count(*) as c
+	from
+		resolve_domain_mapping_view join remote_responses on resolve_domain_mapping_view.response_id = remote_responses.id
+	where
+		domain = @domain collate nocase and status = @status and delivery_ts between @from and @to` + directionQueryFragment + `
+	group by
+		remote_responses.id
+	order by
+		c desc, remote_responses.response asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topResponsesByStatusAndDomain.Close(), "Closing topResponsesByStatusAndDomain")
+		}
+	}()
+
+	db.Closers.Add(topResponsesByStatus, topResponsesByStatusAndDomain)
+
+	db.Stmts["topResponsesByStatus"] = topResponsesByStatus
+	db.Stmts["topResponsesByStatusAndDomain"] = topResponsesByStatusAndDomain
+
+	return nil
+}
+
+func (d sqlDashboard) topResponses(ctx context.Context, status parser.SmtpStatus, interval timeutil.TimeInterval, domain string) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	args := []interface{}{
+		sql.Named("status", status),
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+	}
+
+	if len(domain) == 0 {
+		return listResponseAndCount(ctx, conn.Stmts["topResponsesByStatus"], args...)
+	}
+
+	return listResponseAndCount(ctx, conn.Stmts["topResponsesByStatusAndDomain"], append(args, sql.Named("domain", domain))...)
+}
+
+// TopBounceReasons returns the most common replies of the remote servers for bounced messages
+func (d sqlDashboard) TopBounceReasons(ctx context.Context, interval timeutil.TimeInterval, domain string) (Pairs, error) {
+	return d.topResponses(ctx, parser.BouncedStatus, interval, domain)
+}
+
+// TopDeferralReasons returns the most common replies of the remote servers for deferred messages
+func (d sqlDashboard) TopDeferralReasons(ctx context.Context, interval timeutil.TimeInterval, domain string) (Pairs, error) {
+	return d.topResponses(ctx, parser.DeferredStatus, interval, domain)
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listResponseAndCount(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (Pairs, error) {
+	r := Pairs{}
+
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			response   string
+			countValue int
+		)
+
+		if err := query.Scan(&response, &countValue); err != nil {
+			return Pairs{}, errorutil.Wrap(err)
+		}
+
+		r = append(r, Pair{response, countValue})
+	}
+
+	if err := query.Err(); err != nil {
+		return Pairs{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
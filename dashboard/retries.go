@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+// RetryChains tells what happens to the messages after they are deferred.
+// Each retry of a deferred message is a delivery on its own, so DeferralAttempts
+// counts a message greylisted three times three times, whereas DeferredMessages counts it once
+type RetryChains struct {
+	DeferralAttempts int `json:"deferral_attempts"`
+
+	// Deferred for the first time. Deliveries stored before retries were tracked count on each attempt
+	DeferredMessages int `json:"deferred_messages"`
+
+	EventuallyDelivered int `json:"eventually_delivered"`
+
+	// Bounced or expired after being deferred
+	DeferredThenBounced int `json:"deferred_then_bounced"`
+
+	// Median time, in seconds, between the first deferral and the delivery of the eventually delivered messages
+	MedianTimeToRecover float64 `json:"median_time_to_recover"`
+}
+
+func setupRetriesQueries(db *dbconn.RoPooledConn) (err error) {
+	retryChains, err := db.Prepare(`
+	select
+		count(case when status = ? then 1 end),
+		count(case when status = ? and ifnull(attempt, 1) = 1 then 1 end),
+		count(case when status = ? and first_deferral_ts is not null then 1 end),
+		count(case when status in (?, ?) and first_deferral_ts is not null then 1 end)
+	from
+		deliveries
+	where
+		delivery_ts between ? and ?` + directionQueryFragment)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(retryChains.Close(), "Closing retryChains")
+		}
+	}()
+
+	// the middle values of the sorted recovery times
+	medianTimeToRecover, err := db.Prepare(`
+	select
+		avg(t)
+	from
+		(
+			select
+				delivery_ts - first_deferral_ts as t
+			from
+				deliveries
+			where
+				status = ? and first_deferral_ts is not null and delivery_ts between ? and ?` + directionQueryFragment + `
+			order by
+				t
+			limit ? offset ?
+		)`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(medianTimeToRecover.Close(), "Closing medianTimeToRecover")
+		}
+	}()
+
+	db.Closers.Add(retryChains)
+	db.Closers.Add(medianTimeToRecover)
+
+	db.Stmts["retryChains"] = retryChains
+	db.Stmts["medianTimeToRecover"] = medianTimeToRecover
+
+	return nil
+}
+
+// RetryChains returns how many deferred messages have eventually been delivered or bounced,
+// and how long it took for them to be delivered
+func (d sqlDashboard) RetryChains(ctx context.Context, interval timeutil.TimeInterval) (RetryChains, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	var r RetryChains
+
+	if err := conn.Stmts["retryChains"].QueryRowContext(ctx,
+		parser.DeferredStatus,
+		parser.DeferredStatus,
+		parser.SentStatus,
+		parser.BouncedStatus, parser.ExpiredStatus,
+		interval.From.Unix(), interval.To.Unix(),
+	).Scan(&r.DeferralAttempts, &r.DeferredMessages, &r.EventuallyDelivered, &r.DeferredThenBounced); err != nil {
+		return RetryChains{}, errorutil.Wrap(err)
+	}
+
+	if r.EventuallyDelivered == 0 {
+		return r, nil
+	}
+
+	// with an even number of values, the median is the average of the two in the middle
+	limit, offset := 2-r.EventuallyDelivered%2, (r.EventuallyDelivered-1)/2
+
+	if err := conn.Stmts["medianTimeToRecover"].QueryRowContext(ctx,
+		parser.SentStatus, interval.From.Unix(), interval.To.Unix(), limit, offset,
+	).Scan(&r.MedianTimeToRecover); err != nil {
+		return RetryChains{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
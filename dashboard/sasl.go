@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+func setupSaslQueries(db *dbconn.RoPooledConn) (err error) {
+	topSaslFailedClients, err := db.Prepare(`
+	select
+		client_ip, count(*) as c
+	from
+		sasl_auth_failures
+	where
+		failure_ts between ? and ?
+	group by
+		client_ip
+	order by
+		c desc, client_ip asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topSaslFailedClients.Close(), "Closing topSaslFailedClients")
+		}
+	}()
+
+	// older postfix versions do not log the username on failures
+	topSaslTargetedUsernames, err := db.Prepare(`
+	select
+		username, count(distinct client_ip) as c
+	from
+		sasl_auth_failures
+	where
+		username is not null and failure_ts between ? and ?
+	group by
+		username
+	order by
+		c desc, username asc
+	limit 20
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(topSaslTargetedUsernames.Close(), "Closing topSaslTargetedUsernames")
+		}
+	}()
+
+	db.Closers.Add(topSaslFailedClients, topSaslTargetedUsernames)
+
+	db.Stmts["topSaslFailedClients"] = topSaslFailedClients
+	db.Stmts["topSaslTargetedUsernames"] = topSaslTargetedUsernames
+
+	return nil
+}
+
+// TopSaslFailedClients returns the clients with the most failed authentication attempts
+func (d sqlDashboard) TopSaslFailedClients(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listClientsAndCount(ctx, conn.Stmts["topSaslFailedClients"], interval.From.Unix(), interval.To.Unix())
+}
+
+// TopSaslTargetedUsernames returns the usernames that failed to authenticate from the most distinct clients
+func (d sqlDashboard) TopSaslTargetedUsernames(ctx context.Context, interval timeutil.TimeInterval) (Pairs, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listTextAndCount(ctx, conn.Stmts["topSaslTargetedUsernames"], interval.From.Unix(), interval.To.Unix())
+}
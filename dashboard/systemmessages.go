@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+// SystemMessage groups the warnings and errors logged by a postfix daemon with the same template
+type SystemMessage struct {
+	// warning, error, fatal or panic
+	Severity string `json:"severity"`
+	Daemon   string `json:"daemon"`
+
+	// The message with the variable parts replaced by placeholders, as `hostname <host> does not resolve to address <ip>`
+	Template string `json:"template"`
+
+	// Number of messages in the interval
+	Count int `json:"count"`
+
+	// The first time the message was ever logged, possibly before the interval
+	FirstSeen time.Time `json:"first_seen"`
+
+	LastSeen    time.Time `json:"last_seen"`
+	LastMessage string    `json:"last_message"`
+}
+
+type SystemMessages []SystemMessage
+
+func setupSystemMessagesQueries(db *dbconn.RoPooledConn) (err error) {
+	// the most severe messages first
+	systemMessages, err := db.Prepare(`
+	select
+		t.severity, t.daemon, t.template, count(*) as c,
+		(select min(f.message_ts) from system_messages f where f.template_id = t.id),
+		max(m.message_ts),
+		(select l.message from system_messages l where l.template_id = t.id and l.message_ts between @from and @to order by l.message_ts desc, l.id desc limit 1)
+	from
+		system_messages m join system_message_templates t on m.template_id = t.id
+	where
+		m.message_ts between @from and @to
+	group by
+		t.id
+	order by
+		t.severity desc, c desc, t.template asc
+	limit 50
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(systemMessages.Close(), "Closing systemMessages")
+		}
+	}()
+
+	db.Closers.Add(systemMessages)
+
+	db.Stmts["systemMessages"] = systemMessages
+
+	return nil
+}
+
+// SystemMessages returns the warnings and errors logged by postfix, grouped by template
+func (d sqlDashboard) SystemMessages(ctx context.Context, interval timeutil.TimeInterval) (SystemMessages, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listSystemMessages(ctx, conn.Stmts["systemMessages"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+	)
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listSystemMessages(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (SystemMessages, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return SystemMessages{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	r := SystemMessages{}
+
+	for query.Next() {
+		var (
+			severity    parser.SystemMessageSeverity
+			m           SystemMessage
+			firstSeenTs int64
+			lastSeenTs  int64
+		)
+
+		if err := query.Scan(&severity, &m.Daemon, &m.Template, &m.Count, &firstSeenTs, &lastSeenTs, &m.LastMessage); err != nil {
+			return SystemMessages{}, errorutil.Wrap(err)
+		}
+
+		m.Severity = severity.String()
+		m.FirstSeen = time.Unix(firstSeenTs, 0).In(time.UTC)
+		m.LastSeen = time.Unix(lastSeenTs, 0).In(time.UTC)
+
+		r = append(r, m)
+	}
+
+	if err := query.Err(); err != nil {
+		return SystemMessages{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"sort"
+	"time"
+)
+
+type Granularity int
+
+const (
+	GranularityFiveMinutes Granularity = iota
+	GranularityHour
+	GranularityDay
+)
+
+// Charts with more points than that are not useful, and expensive to compute
+const MaxTimeSeriesBuckets = 10000
+
+var ErrTooManyBuckets = errors.New("Too many buckets in the time series. Use a coarser granularity or a shorter interval")
+
+type DeliveryStatusOverTimeOptions struct {
+	// The buckets are aligned to the location of the interval
+	Interval    timeutil.TimeInterval
+	Granularity Granularity
+
+	// Optional. If set, only deliveries to this (possibly mapped) recipient domain are counted
+	Domain string
+
+	// Optional. If set, only deliveries of messages received or delivered by this host,
+	// postfix instance, or both, are counted
+	Host     string
+	Instance string
+}
+
+type DeliveryStatusBucket struct {
+	Time     time.Time `json:"time"`
+	Sent     int       `json:"sent"`
+	Deferred int       `json:"deferred"`
+	Bounced  int       `json:"bounced"`
+	Expired  int       `json:"expired"`
+}
+
+type DeliveryStatusTimeSeries []DeliveryStatusBucket
+
+// The database groups the deliveries in units of a fixed number of seconds, which are then
+// added to the buckets. As the offset of every timezone in use is a multiple of 15 minutes,
+// the units never cross bucket boundaries, including on days when the daylight saving time changes.
+func sqlUnitForGranularity(g Granularity) int64 {
+	if g == GranularityFiveMinutes {
+		return 5 * 60
+	}
+
+	return 15 * 60
+}
+
+func bucketStart(t time.Time, g Granularity) time.Time {
+	year, month, day := t.Date()
+
+	switch g {
+	case GranularityFiveMinutes:
+		return time.Date(year, month, day, t.Hour(), t.Minute()/5*5, 0, 0, t.Location())
+	case GranularityHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func nextBucketStart(t time.Time, g Granularity) time.Time {
+	switch g {
+	case GranularityFiveMinutes:
+		return t.Add(5 * time.Minute)
+	case GranularityHour:
+		return t.Add(time.Hour)
+	default:
+		// days might not have 24h when the daylight saving time changes
+		year, month, day := t.Date()
+		return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func buildEmptyTimeSeries(interval timeutil.TimeInterval, g Granularity) (DeliveryStatusTimeSeries, error) {
+	r := DeliveryStatusTimeSeries{}
+
+	for t := bucketStart(interval.From, g); !t.After(interval.To); t = nextBucketStart(t, g) {
+		if len(r) == MaxTimeSeriesBuckets {
+			return nil, ErrTooManyBuckets
+		}
+
+		r = append(r, DeliveryStatusBucket{Time: t})
+	}
+
+	return r, nil
+}
+
+func setupTimeSeriesQueries(db *dbconn.RoPooledConn) (err error) {
+	deliveryStatusOverTime, err := db.Prepare(`
+	select
+		(delivery_ts / @unit) * @unit as unit_ts, status, count(*)
+	from
+		deliveries
+	where
+		delivery_ts between @from and @to` + directionQueryFragment + mailServerQueryFragment + `
+	group by
+		unit_ts, status
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(deliveryStatusOverTime.Close(), "Closing deliveryStatusOverTime")
+		}
+	}()
+
+	deliveryStatusOverTimeByDomain, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		(delivery_ts / @unit) * @unit as unit_ts, status, count(*)
+	from
+		resolve_domain_mapping_view
+	where
+		domain = @domain collate nocase and delivery_ts between @from and @to` + directionQueryFragment + mailServerQueryFragment + `
+	group by
+		unit_ts, status
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(deliveryStatusOverTimeByDomain.Close(), "Closing deliveryStatusOverTimeByDomain")
+		}
+	}()
+
+	db.Closers.Add(deliveryStatusOverTime, deliveryStatusOverTimeByDomain)
+
+	db.Stmts["deliveryStatusOverTime"] = deliveryStatusOverTime
+	db.Stmts["deliveryStatusOverTimeByDomain"] = deliveryStatusOverTimeByDomain
+
+	return nil
+}
+
+func (d sqlDashboard) DeliveryStatusOverTime(ctx context.Context, options DeliveryStatusOverTimeOptions) (DeliveryStatusTimeSeries, error) {
+	series, err := buildEmptyTimeSeries(options.Interval, options.Granularity)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	stmt := conn.Stmts["deliveryStatusOverTime"]
+
+	if len(options.Domain) > 0 {
+		stmt = conn.Stmts["deliveryStatusOverTimeByDomain"]
+	}
+
+	if err := fillTimeSeries(ctx, stmt, series, options); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return series, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func fillTimeSeries(ctx context.Context, stmt *sql.Stmt, series DeliveryStatusTimeSeries, options DeliveryStatusOverTimeOptions) error {
+	args := []interface{}{
+		sql.Named("unit", sqlUnitForGranularity(options.Granularity)),
+		sql.Named("from", options.Interval.From.Unix()),
+		sql.Named("to", options.Interval.To.Unix()),
+	}
+
+	if len(options.Domain) > 0 {
+		args = append(args, sql.Named("domain", options.Domain))
+	}
+
+	args = append(args, mailServerQueryArgs(options.Host, options.Instance)...)
+
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			unitTs int64
+			status parser.SmtpStatus
+			count  int
+		)
+
+		if err := query.Scan(&unitTs, &status, &count); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		// the last bucket starting before the unit
+		i := sort.Search(len(series), func(i int) bool { return series[i].Time.Unix() > unitTs }) - 1
+
+		if i < 0 {
+			continue
+		}
+
+		switch status {
+		case parser.SentStatus:
+			series[i].Sent += count
+		case parser.DeferredStatus:
+			series[i].Deferred += count
+		case parser.BouncedStatus:
+			series[i].Bounced += count
+		case parser.ExpiredStatus:
+			series[i].Expired += count
+		}
+	}
+
+	if err := query.Err(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
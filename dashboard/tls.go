@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"sort"
+)
+
+// Used instead of the TLS protocol for messages sent without TLS
+const CleartextProtocol = "cleartext"
+
+type DomainTlsUsage struct {
+	Domain string `json:"domain"`
+
+	// Number of sent messages to the domain
+	Total int `json:"total"`
+
+	// How many of the sent messages were sent under each protocol, as TLSv1.3, or in cleartext
+	Protocols Pairs `json:"protocols"`
+}
+
+type TlsUsageByDomain []DomainTlsUsage
+
+func setupTlsQueries(db *dbconn.RoPooledConn) (err error) {
+	// direction: 0 is outbound
+	outboundTlsByDomain, err := db.Prepare(domainMappingByRecipientDomainPartStmtPart + `
+	select
+		domain, ifnull(tls_sessions.protocol, @cleartext) as protocol, count(*)
+	from
+		resolve_domain_mapping_view left join tls_sessions on resolve_domain_mapping_view.relay_tls_session_id = tls_sessions.id
+	where
+		direction = 0 and status = @sent and delivery_ts between @from and @to
+	group by
+		domain, protocol
+	`)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(outboundTlsByDomain.Close(), "Closing outboundTlsByDomain")
+		}
+	}()
+
+	db.Closers.Add(outboundTlsByDomain)
+
+	db.Stmts["outboundTlsByDomain"] = outboundTlsByDomain
+
+	return nil
+}
+
+// OutboundTlsByDomain returns, for each (possibly mapped) recipient domain, how many messages
+// were sent to it in cleartext and under each TLS protocol version.
+// The busiest domains come first, and the most used protocols first in each domain.
+func (d sqlDashboard) OutboundTlsByDomain(ctx context.Context, interval timeutil.TimeInterval) (TlsUsageByDomain, error) {
+	conn, release := d.pool.Acquire()
+
+	defer release()
+
+	return listTlsUsageByDomain(ctx, conn.Stmts["outboundTlsByDomain"],
+		sql.Named("from", interval.From.Unix()),
+		sql.Named("to", interval.To.Unix()),
+		sql.Named("sent", parser.SentStatus),
+		sql.Named("cleartext", CleartextProtocol),
+	)
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listTlsUsageByDomain(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (TlsUsageByDomain, error) {
+	query, err := stmt.QueryContext(ctx, args...)
+
+	if err != nil {
+		return TlsUsageByDomain{}, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	indexes := map[string]int{}
+
+	r := TlsUsageByDomain{}
+
+	for query.Next() {
+		var (
+			domain   string
+			protocol string
+			count    int
+		)
+
+		if err := query.Scan(&domain, &protocol, &count); err != nil {
+			return TlsUsageByDomain{}, errorutil.Wrap(err)
+		}
+
+		index, ok := indexes[domain]
+		if !ok {
+			index = len(r)
+			indexes[domain] = index
+			r = append(r, DomainTlsUsage{Domain: domain, Protocols: Pairs{}})
+		}
+
+		r[index].Total += count
+		r[index].Protocols = append(r[index].Protocols, Pair{Key: protocol, Value: count})
+	}
+
+	if err := query.Err(); err != nil {
+		return TlsUsageByDomain{}, errorutil.Wrap(err)
+	}
+
+	for _, u := range r {
+		protocols := u.Protocols
+
+		sort.SliceStable(protocols, func(i, j int) bool {
+			ci, cj := protocols[i].Value.(int), protocols[j].Value.(int)
+			return ci > cj || (ci == cj && protocols[i].Key.(string) < protocols[j].Key.(string))
+		})
+	}
+
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Total > r[j].Total || (r[i].Total == r[j].Total && r[i].Domain < r[j].Domain)
+	})
+
+	return r, nil
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+func buildConnectionFailureAction(t time.Time, host string, p parser.SmtpConnectionFailure) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		mxIP := func() interface{} {
+			if p.IP == nil {
+				return nil
+			}
+
+			return []byte(p.IP)
+		}()
+
+		stmt := tx.Stmt(stmts[insertConnectionFailure])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(
+			t.Unix(),
+			deliveryServerId,
+			p.Kind,
+			p.Host,
+			mxIP,
+			optionalInt(p.Port),
+			optionalText(p.Queue),
+			p.Reason,
+		); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+type connectionFailuresPublisher struct {
+	dbActions chan<- dbAction
+}
+
+func (p *connectionFailuresPublisher) Publish(r postfix.Record) {
+	if payload, ok := r.Payload.(parser.SmtpConnectionFailure); ok {
+		p.dbActions <- buildConnectionFailureAction(r.Time, r.Header.Host, payload)
+	}
+}
+
+// ConnectionFailuresPublisher stores the failures to talk to the remote servers
+func (db *DB) ConnectionFailuresPublisher() postfix.Publisher {
+	return &connectionFailuresPublisher{dbActions: db.dbActions}
+}
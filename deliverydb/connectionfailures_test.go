@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"net"
+	"testing"
+)
+
+func TestConnectionFailures(t *testing.T) {
+	Convey("Connection failures", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		failuresPub := db.ConnectionFailuresPublisher()
+
+		publish := func(line string, time string) {
+			failuresPub.Publish(rejectionRecord(`Feb  8 21:28:47 mx postfix/smtp[1036]: `+line, time))
+		}
+
+		//nolint:lll
+		{
+			// before the interval
+			publish(`connect to mx1.example.com[11.22.33.44]:25: Connection timed out`, `2019-12-31 10:00:00 +0000`)
+
+			publish(`connect to mx1.example.com[11.22.33.44]:25: Connection timed out`, `2020-01-01 10:00:00 +0000`)
+			publish(`connect to mx1.example.com[11.22.33.44]:25: Connection timed out`, `2020-01-01 10:10:00 +0000`)
+			publish(`4BCA2E0CBB: lost connection with mx1.example.com[11.22.33.44] while receiving the initial server greeting`, `2020-01-01 10:20:00 +0000`)
+			publish(`connect to mx2.example.com[22.33.44.55]:25: Connection refused`, `2020-01-01 10:05:00 +0000`)
+			publish(`SSL_connect error to mx.example.org[33.44.55.66]:25: lost connection`, `2020-01-01 11:00:00 +0000`)
+		}
+
+		resultsPub := db.ResultsPublisher()
+
+		result := func(status parser.SmtpStatus, ts string, domain, relayName, relayIP, dsn, response string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultMessageDirectionKey] = tracking.ResultEntryInt64(int64(tracking.MessageDirectionOutbound))
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(domain)
+			r[tracking.ResultRelayNameKey] = tracking.ResultEntryText(relayName)
+			r[tracking.ResultRelayIPKey] = tracking.ResultEntryBlob(net.ParseIP(relayIP))
+			r[tracking.ResultDSNKey] = tracking.ResultEntryText(dsn)
+			r[tracking.ResultExtraMessageKey] = tracking.ResultEntryText(response)
+
+			return r
+		}
+
+		//nolint:lll
+		{
+			resultsPub.Publish(result(parser.DeferredStatus, `2020-01-01 10:00:00 +0000`, "example.com", "mx1.example.com", "11.22.33.44", "4.4.1", `(connect to mx1.example.com[11.22.33.44]:25: Connection timed out)`))
+			resultsPub.Publish(result(parser.DeferredStatus, `2020-01-01 10:20:00 +0000`, "example.com", "mx1.example.com", "11.22.33.44", "4.4.2", `(lost connection with mx1.example.com[11.22.33.44] while receiving the initial server greeting)`))
+			resultsPub.Publish(result(parser.DeferredStatus, `2020-01-01 12:00:00 +0000`, "example.com", "mx1.example.com", "11.22.33.44", "4.4.1", `(connect to mx1.example.com[11.22.33.44]:25: Connection timed out)`))
+
+			// some messages could be sent after a TLS failure
+			resultsPub.Publish(result(parser.DeferredStatus, `2020-01-01 11:00:00 +0000`, "example.org", "mx.example.org", "33.44.55.66", "4.4.2", `(SSL_connect error to mx.example.org[33.44.55.66]:25: lost connection)`))
+			resultsPub.Publish(result(parser.SentStatus, `2020-01-01 11:10:00 +0000`, "example.org", "mx.example.org", "33.44.55.66", "2.0.0", `(250 2.0.0 OK)`))
+			resultsPub.Publish(result(parser.SentStatus, `2020-01-01 11:20:00 +0000`, "example.org", "mx.example.org", "33.44.55.66", "2.0.0", `(250 2.0.0 OK)`))
+
+			// deferred, but not due to network failures
+			resultsPub.Publish(result(parser.DeferredStatus, `2020-01-01 11:00:00 +0000`, "example.net", "mx.example.net", "44.55.66.77", "4.2.2", `(452 4.2.2 Mailbox full)`))
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		Convey("Remote MX health", func() {
+			health, err := d.RemoteMXHealth(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(health, ShouldResemble, dashboard.RemoteMXHealth{
+				{
+					Host:     "mx1.example.com",
+					IP:       "11.22.33.44",
+					Failures: 3,
+					FailuresByKind: dashboard.Pairs{
+						dashboard.Pair{Key: "connect", Value: 2},
+						dashboard.Pair{Key: "lost_connection", Value: 1},
+					},
+					Delivered:   0,
+					LastFailure: testutil.MustParseTime(`2020-01-01 10:20:00 +0000`),
+					LastReason:  "receiving the initial server greeting",
+				},
+				{
+					Host:     "mx.example.org",
+					IP:       "33.44.55.66",
+					Failures: 1,
+					FailuresByKind: dashboard.Pairs{
+						dashboard.Pair{Key: "tls", Value: 1},
+					},
+					Delivered:   2,
+					LastFailure: testutil.MustParseTime(`2020-01-01 11:00:00 +0000`),
+					LastReason:  "lost connection",
+				},
+				{
+					Host:     "mx2.example.com",
+					IP:       "22.33.44.55",
+					Failures: 1,
+					FailuresByKind: dashboard.Pairs{
+						dashboard.Pair{Key: "connect", Value: 1},
+					},
+					Delivered:   0,
+					LastFailure: testutil.MustParseTime(`2020-01-01 10:05:00 +0000`),
+					LastReason:  "Connection refused",
+				},
+			})
+		})
+
+		Convey("Unreachable domains", func() {
+			domains, err := d.UnreachableDomains(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(domains, ShouldResemble, dashboard.UnreachableDomains{
+				{
+					Domain:       "example.com",
+					Deferred:     3,
+					FirstFailure: testutil.MustParseTime(`2020-01-01 10:00:00 +0000`),
+					LastFailure:  testutil.MustParseTime(`2020-01-01 12:00:00 +0000`),
+				},
+			})
+		})
+	})
+}
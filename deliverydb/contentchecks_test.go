@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestContentChecks(t *testing.T) {
+	Convey("Content filters and milters", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(ts string, direction tracking.MessageDirection, senderDomain string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultMessageDirectionKey] = tracking.ResultEntryInt64(int64(direction))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+			r[tracking.QueueSenderDomainPartKey] = tracking.ResultEntryText(senderDomain)
+
+			return r
+		}
+
+		inbound := func(ts string, verdict parser.ContentFilterVerdict, score float64) tracking.Result {
+			r := result(ts, tracking.MessageDirectionIncoming, "example.org")
+			r[tracking.QueueContentFilterVerdictKey] = tracking.ResultEntryInt64(int64(verdict))
+			r[tracking.QueueContentFilterScoreKey] = tracking.ResultEntryFloat64(score)
+			r[tracking.QueueDmarcResultKey] = tracking.ResultEntryInt64(int64(parser.DmarcPass))
+
+			return r
+		}
+
+		signed := func(ts string, senderDomain, signingDomain string) tracking.Result {
+			r := result(ts, tracking.MessageDirectionOutbound, senderDomain)
+			r[tracking.QueueDkimSigningDomainKey] = tracking.ResultEntryText(signingDomain)
+
+			return r
+		}
+
+		pub.Publish(inbound(`2020-01-01 10:00:00 +0000`, parser.ContentFilterClean, -1))
+		pub.Publish(inbound(`2020-01-01 11:00:00 +0000`, parser.ContentFilterClean, 0.5))
+		pub.Publish(inbound(`2020-01-01 12:00:00 +0000`, parser.ContentFilterSpam, 15))
+		pub.Publish(inbound(`2020-01-01 13:00:00 +0000`, parser.ContentFilterInfected, 0))
+
+		pub.Publish(signed(`2020-01-02 10:00:00 +0000`, "example.com", "example.com"))
+		pub.Publish(signed(`2020-01-02 11:00:00 +0000`, "example.com", "example.com"))
+		pub.Publish(signed(`2020-01-02 12:00:00 +0000`, "example.com", "relay.example.net"))
+		pub.Publish(result(`2020-01-02 13:00:00 +0000`, tracking.MessageDirectionOutbound, "example.com"))
+		pub.Publish(result(`2020-01-02 14:00:00 +0000`, tracking.MessageDirectionOutbound, "unsigned.com"))
+
+		// outside of the interval
+		pub.Publish(inbound(`2020-02-01 10:00:00 +0000`, parser.ContentFilterSpam, 15))
+		pub.Publish(signed(`2020-02-02 10:00:00 +0000`, "unsigned.com", "unsigned.com"))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		Convey("Verdicts, only of checked deliveries", func() {
+			verdicts, err := d.ContentFilterVerdicts(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(verdicts, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "clean", Value: 2},
+				dashboard.Pair{Key: "spam", Value: 1},
+				dashboard.Pair{Key: "infected", Value: 1},
+			})
+		})
+
+		Convey("DKIM coverage by sender domain", func() {
+			coverage, err := d.OutboundDkimCoverage(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(coverage, ShouldResemble, dashboard.DkimCoverageByDomain{
+				{Domain: "example.com", Total: 4, Signed: 3, Aligned: 2},
+				{Domain: "unsigned.com", Total: 1, Signed: 0, Aligned: 0},
+			})
+		})
+	})
+}
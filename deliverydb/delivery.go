@@ -8,10 +8,12 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
 	_ "gitlab.com/lightmeter/controlcenter/deliverydb/migrations"
 	"gitlab.com/lightmeter/controlcenter/domainmapping"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
 	"gitlab.com/lightmeter/controlcenter/pkg/runner"
 	"gitlab.com/lightmeter/controlcenter/tracking"
 	"gitlab.com/lightmeter/controlcenter/util/closeutil"
@@ -26,9 +28,11 @@ type DB struct {
 	runner.CancelableRunner
 	closeutil.Closers
 
-	connPair  *dbconn.PooledPair
-	dbActions chan dbAction
-	stmts     preparedStmts
+	connPair   *dbconn.PooledPair
+	dbActions  chan dbAction
+	stmts      preparedStmts
+	gcCursor   gcCursor
+	classifier *bounceclass.Classifier
 }
 
 const (
@@ -49,6 +53,27 @@ const (
 	insertDelivery
 	updateDeliveryWithRelay
 	updateDeliveryWithOrigRecipient
+	insertRejection
+	insertMessageEvent
+	selectRemoteResponse
+	insertRemoteResponse
+	updateDeliveryWithResponse
+	insertPostscreenEvent
+	insertSaslAuthFailure
+	selectTlsSession
+	insertTlsSession
+	updateDeliveryWithClientTlsSession
+	updateDeliveryWithRelayTlsSession
+	selectLastQueueByMessageId
+	selectSystemMessageTemplate
+	insertSystemMessageTemplate
+	insertSystemMessage
+	insertConnectionFailure
+	updateDeliveryWithDeferralAttempts
+	updateDeliveryWithContentChecks
+	updateDeliveryWithAttempt
+	updateRetryChainWithFinalStatus
+	updateDeliveryWithMailServers
 
 	lastStmtKey
 )
@@ -87,10 +112,131 @@ insert into deliveries(
 	recipient_local_part,
 	client_hostname,
 	client_ip,
-	dsn)
-values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+	dsn,
+	queue,
+	category,
+	sasl_username)
+values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 	updateDeliveryWithRelay:         `update deliveries set next_relay_id = ? where id = ?`,
 	updateDeliveryWithOrigRecipient: `update deliveries set orig_recipient_domain_part_id = ? where id = ?`,
+	insertRejection: `
+insert into rejections(
+	reject_ts,
+	source,
+	stage,
+	queue,
+	delivery_server_id,
+	client_hostname,
+	client_ip,
+	sender_local_part,
+	sender_domain_part_id,
+	recipient_local_part,
+	recipient_domain_part_id,
+	reject_code,
+	dsn,
+	reason)
+values(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+	insertMessageEvent: `
+insert into message_events(
+	ts,
+	kind,
+	queue,
+	delivery_server_id,
+	filename,
+	line,
+	related_queue,
+	message_id,
+	sender,
+	recipient,
+	client_hostname,
+	client_ip,
+	status,
+	dsn,
+	relay,
+	description)
+values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+	selectRemoteResponse:       `select id from remote_responses where response = ?`,
+	insertRemoteResponse:       `insert into remote_responses(response) values(?)`,
+	updateDeliveryWithResponse: `update deliveries set response_id = ? where id = ?`,
+	insertPostscreenEvent: `
+insert into postscreen_events(
+	event_ts,
+	event,
+	delivery_server_id,
+	client_ip,
+	client_port,
+	dnsbl_rank,
+	pregreet_bytes,
+	stage,
+	detail,
+	blocklist)
+values(?,?,?,?,?,?,?,?,?,?)`,
+	insertSaslAuthFailure: `
+insert into sasl_auth_failures(
+	failure_ts,
+	delivery_server_id,
+	client_hostname,
+	client_ip,
+	method,
+	username,
+	reason)
+values(?,?,?,?,?,?,?)`,
+	selectTlsSession:                   `select id from tls_sessions where protocol = ? and cipher = ? and trust = ?`,
+	insertTlsSession:                   `insert into tls_sessions(protocol, cipher, trust) values(?, ?, ?)`,
+	updateDeliveryWithClientTlsSession: `update deliveries set client_tls_session_id = ? where id = ?`,
+	updateDeliveryWithRelayTlsSession:  `update deliveries set relay_tls_session_id = ? where id = ?`,
+	selectLastQueueByMessageId: `
+select
+	e.queue
+from
+	message_events e join messageids m on e.message_id = m.id
+where
+	m.value = ? and e.delivery_server_id = ? and e.kind = ?
+order by
+	e.ts desc, e.id desc
+limit 1`,
+	selectSystemMessageTemplate: `select id from system_message_templates where severity = ? and daemon = ? and template = ?`,
+	insertSystemMessageTemplate: `insert into system_message_templates(severity, daemon, template) values(?, ?, ?)`,
+	insertSystemMessage: `
+insert into system_messages(
+	message_ts,
+	delivery_server_id,
+	template_id,
+	message)
+values(?,?,?,?)`,
+	insertConnectionFailure: `
+insert into connection_failures(
+	failure_ts,
+	delivery_server_id,
+	kind,
+	mx_hostname,
+	mx_ip,
+	mx_port,
+	queue,
+	reason)
+values(?,?,?,?,?,?,?,?)`,
+	updateDeliveryWithDeferralAttempts: `update deliveries set deferral_attempts = ? where id = ?`,
+	updateDeliveryWithContentChecks: `
+update deliveries set
+	content_filter_verdict = ?,
+	content_filter_score = ?,
+	dkim_signing_domain_id = ?,
+	dmarc_result = ?
+where id = ?`,
+	updateDeliveryWithAttempt: `update deliveries set attempt = ?, first_deferral_ts = ? where id = ?`,
+	updateRetryChainWithFinalStatus: `
+update deliveries set
+	final_status = ?,
+	final_delivery_ts = ?
+where
+	queue = ? and delivery_server_id = ? and recipient_local_part = ? and recipient_domain_part_id = ?
+	and (status = ? or id = ?) and final_status is null`,
+	updateDeliveryWithMailServers: `
+update deliveries set
+	delivery_instance = ?,
+	receiving_server_id = ?,
+	receiving_instance = ?
+where id = ?`,
 }
 
 // TODO: close such statements when the tracker is deleted!!!
@@ -136,7 +282,7 @@ func setupDomainMapping(conn dbconn.RwConn, m *domainmapping.Mapper) error {
 	return nil
 }
 
-func New(workspace string, mapping *domainmapping.Mapper) (*DB, error) {
+func New(workspace string, mapping *domainmapping.Mapper, classifier *bounceclass.Classifier) (*DB, error) {
 	dbFilename := path.Join(workspace, filename)
 
 	connPair, err := dbconn.Open(dbFilename, 10)
@@ -171,10 +317,11 @@ func New(workspace string, mapping *domainmapping.Mapper) (*DB, error) {
 	dbActions := make(chan dbAction, 1024*1000)
 
 	db := DB{
-		connPair:  connPair,
-		dbActions: dbActions,
-		Closers:   closeutil.New(connPair),
-		stmts:     stmts,
+		connPair:   connPair,
+		dbActions:  dbActions,
+		Closers:    closeutil.New(connPair),
+		stmts:      stmts,
+		classifier: classifier,
 	}
 
 	db.CancelableRunner = runner.NewCancelableRunner(func(done runner.DoneChan, cancel runner.CancelChan) {
@@ -198,7 +345,8 @@ func New(workspace string, mapping *domainmapping.Mapper) (*DB, error) {
 }
 
 type resultsPublisher struct {
-	dbActions chan<- dbAction
+	dbActions  chan<- dbAction
+	classifier *bounceclass.Classifier
 }
 
 func getUniquePropertyFromAnotherTable(tx *sql.Tx, selectStmt, insertStmt *sql.Stmt, args ...interface{}) (int64, error) {
@@ -301,7 +449,155 @@ func getOptionalNextRelayId(tx *sql.Tx, stmts preparedStmts, relayName, relayIP
 	return id, true, nil
 }
 
-func insertMandatoryResultFields(tx *sql.Tx, stmts preparedStmts, tr tracking.Result) (sql.Result, error) {
+// Results obtained before the response was tracked do not have it
+func getOptionalRemoteResponseId(tx *sql.Tx, stmts preparedStmts, extraMessage tracking.ResultEntry) (int64, bool, error) {
+	if extraMessage.IsNone() {
+		return 0, false, nil
+	}
+
+	response := normalizeResponse(extraMessage.Text())
+
+	if len(response) == 0 {
+		return 0, false, nil
+	}
+
+	id, err := getUniquePropertyFromAnotherTable(tx, stmts[selectRemoteResponse], stmts[insertRemoteResponse], response)
+	if err != nil {
+		return 0, false, errorutil.Wrap(err)
+	}
+
+	return id, true, nil
+}
+
+func getOptionalTlsSessionId(tx *sql.Tx, stmts preparedStmts, protocol, cipher, trust tracking.ResultEntry) (int64, bool, error) {
+	if protocol.IsNone() || cipher.IsNone() || trust.IsNone() {
+		return 0, false, nil
+	}
+
+	id, err := getUniquePropertyFromAnotherTable(tx, stmts[selectTlsSession], stmts[insertTlsSession], protocol.Text(), cipher.Text(), trust.Int64())
+	if err != nil {
+		return 0, false, errorutil.Wrap(err)
+	}
+
+	return id, true, nil
+}
+
+func updateDeliveryWithTlsSession(tx *sql.Tx, stmts preparedStmts, updateStmt stmtKey, rowId int64, protocol, cipher, trust tracking.ResultEntry) error {
+	sessionId, sessionFound, err := getOptionalTlsSessionId(tx, stmts, protocol, cipher, trust)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !sessionFound {
+		return nil
+	}
+
+	stmt := tx.Stmt(stmts[updateStmt])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(sessionId, rowId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// set only when content filters or milters have checked the message
+func updateDeliveryWithContentCheckResults(tx *sql.Tx, stmts preparedStmts, rowId int64, tr tracking.Result) error {
+	verdict, score, dmarc := tr[tracking.QueueContentFilterVerdictKey], tr[tracking.QueueContentFilterScoreKey], tr[tracking.QueueDmarcResultKey]
+
+	dkimDomainId, dkimDomainFound, err := getOptionalUniqueRemoteDomainNameId(tx, stmts, tr[tracking.QueueDkimSigningDomainKey])
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if verdict.IsNone() && score.IsNone() && dmarc.IsNone() && !dkimDomainFound {
+		return nil
+	}
+
+	dkimDomain := func() interface{} {
+		if dkimDomainFound {
+			return dkimDomainId
+		}
+
+		return nil
+	}()
+
+	stmt := tx.Stmt(stmts[updateDeliveryWithContentChecks])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(verdict.ValueOrNil(), score.ValueOrNil(), dkimDomain, dmarc.ValueOrNil(), rowId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// Links a delivery to the retry chain of its recipient in the queue. Once the chain ends,
+// all the deferred attempts get the final status, so they can be told apart
+// from deliveries deferred forever or still in the queue
+func updateDeliveryWithRetryChain(tx *sql.Tx, stmts preparedStmts, rowId int64, tr tracking.Result) error {
+	attempt, firstDeferral := tr[tracking.ResultDeliveryAttemptKey], tr[tracking.ResultFirstDeferralTimeKey]
+
+	if attempt.IsNone() && firstDeferral.IsNone() {
+		return nil
+	}
+
+	stmt := tx.Stmt(stmts[updateDeliveryWithAttempt])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(attempt.ValueOrNil(), firstDeferral.ValueOrNil(), rowId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	status := parser.SmtpStatus(tr[tracking.ResultStatusKey].Int64())
+
+	if status == parser.DeferredStatus || tr[tracking.QueueDeliveryNameKey].IsNone() {
+		return nil
+	}
+
+	deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, tr[tracking.ResultDeliveryServerKey].Text())
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	recipientDomainPartId, err := getUniqueRemoteDomainNameId(tx, stmts, tr[tracking.ResultRecipientDomainPartKey].Text())
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	chainStmt := tx.Stmt(stmts[updateRetryChainWithFinalStatus])
+
+	defer func() {
+		errorutil.MustSucceed(chainStmt.Close())
+	}()
+
+	if _, err := chainStmt.Exec(
+		status,
+		tr[tracking.ResultDeliveryTimeKey].Int64(),
+		tr[tracking.QueueDeliveryNameKey].Text(),
+		deliveryServerId,
+		tr[tracking.ResultRecipientLocalPartKey].Text(),
+		recipientDomainPartId,
+		parser.DeferredStatus,
+		rowId,
+	); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func insertMandatoryResultFields(tx *sql.Tx, stmts preparedStmts, tr tracking.Result, category interface{}) (sql.Result, error) {
 	deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, tr[tracking.ResultDeliveryServerKey].Text())
 	if err != nil {
 		return nil, errorutil.Wrap(err)
@@ -355,6 +651,9 @@ func insertMandatoryResultFields(tx *sql.Tx, stmts preparedStmts, tr tracking.Re
 		valueOrNil(tr[tracking.ConnectionClientHostnameKey]),
 		valueOrNil(tr[tracking.ConnectionClientIPKey]),
 		tr[tracking.ResultDSNKey].Text(),
+		valueOrNil(tr[tracking.QueueDeliveryNameKey]),
+		category,
+		valueOrNil(tr[tracking.ConnectionSaslUsernameKey]),
 	)
 
 	if err != nil {
@@ -370,7 +669,7 @@ func valueOrNil(e tracking.ResultEntry) interface{} {
 	return e.ValueOrNil()
 }
 
-func buildAction(tr tracking.Result) func(*sql.Tx, preparedStmts) error {
+func buildAction(tr tracking.Result, category interface{}) func(*sql.Tx, preparedStmts) error {
 	return func(tx *sql.Tx, stmts preparedStmts) (err error) {
 		defer func() {
 			if r := recover(); r != nil {
@@ -383,7 +682,7 @@ func buildAction(tr tracking.Result) func(*sql.Tx, preparedStmts) error {
 			}
 		}()
 
-		result, err := insertMandatoryResultFields(tx, stmts, tr)
+		result, err := insertMandatoryResultFields(tx, stmts, tr, category)
 
 		port := func() int64 {
 			if tr[tracking.ResultRelayPortKey].IsNone() {
@@ -434,16 +733,128 @@ func buildAction(tr tracking.Result) func(*sql.Tx, preparedStmts) error {
 			}
 		}
 
+		responseId, responseFound, err := getOptionalRemoteResponseId(tx, stmts, tr[tracking.ResultExtraMessageKey])
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if responseFound {
+			stmt := tx.Stmt(stmts[updateDeliveryWithResponse])
+
+			defer func() {
+				errorutil.MustSucceed(stmt.Close())
+			}()
+
+			_, err = stmt.Exec(responseId, rowId)
+			if err != nil {
+				return errorutil.Wrap(err)
+			}
+		}
+
+		err = updateDeliveryWithTlsSession(tx, stmts, updateDeliveryWithClientTlsSession, rowId,
+			tr[tracking.ConnectionTlsProtocolKey], tr[tracking.ConnectionTlsCipherKey], tr[tracking.ConnectionTlsTrustKey])
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		err = updateDeliveryWithTlsSession(tx, stmts, updateDeliveryWithRelayTlsSession, rowId,
+			tr[tracking.ResultTlsProtocolKey], tr[tracking.ResultTlsCipherKey], tr[tracking.ResultTlsTrustKey])
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		// only expired deliveries know how many times they have been deferred
+		if !tr[tracking.ResultDeferralAttemptsKey].IsNone() {
+			stmt := tx.Stmt(stmts[updateDeliveryWithDeferralAttempts])
+
+			defer func() {
+				errorutil.MustSucceed(stmt.Close())
+			}()
+
+			_, err = stmt.Exec(tr[tracking.ResultDeferralAttemptsKey].Int64(), rowId)
+			if err != nil {
+				return errorutil.Wrap(err)
+			}
+		}
+
+		if err := updateDeliveryWithContentCheckResults(tx, stmts, rowId, tr); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := updateDeliveryWithRetryChain(tx, stmts, rowId, tr); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := updateDeliveryWithMailServerInstances(tx, stmts, rowId, tr); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+// The host and postfix instance the message has been received on, and the instance that delivered it,
+// which can differ from each other when the message is relayed between them.
+// The instances are empty for the messages not handled by postfix
+func updateDeliveryWithMailServerInstances(tx *sql.Tx, stmts preparedStmts, rowId int64, tr tracking.Result) error {
+	receivingServer := tr[tracking.ResultReceivingServerKey]
+
+	if receivingServer.IsNone() {
 		return nil
 	}
+
+	receivingServerId, err := getUniqueDeliveryServerID(tx, stmts, receivingServer.Text())
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	stmt := tx.Stmt(stmts[updateDeliveryWithMailServers])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(
+		textOrNil(tr[tracking.ResultDeliveryInstanceKey]),
+		receivingServerId,
+		textOrNil(tr[tracking.ResultReceivingInstanceKey]),
+		rowId,
+	); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func textOrNil(e tracking.ResultEntry) interface{} {
+	if e.IsNone() || len(e.Text()) == 0 {
+		return nil
+	}
+
+	return e.Text()
+}
+
+// Only messages not delivered have a category
+func (p *resultsPublisher) category(r tracking.Result) interface{} {
+	if parser.SmtpStatus(r[tracking.ResultStatusKey].Int64()) == parser.SentStatus {
+		return nil
+	}
+
+	extraMessage := ""
+
+	if !r[tracking.ResultExtraMessageKey].IsNone() {
+		extraMessage = r[tracking.ResultExtraMessageKey].Text()
+	}
+
+	return p.classifier.Classify(r[tracking.ResultDSNKey].Text(), extraMessage)
 }
 
 func (p *resultsPublisher) Publish(r tracking.Result) {
-	p.dbActions <- buildAction(r)
+	p.dbActions <- buildAction(r, p.category(r))
 }
 
 func (db *DB) ResultsPublisher() tracking.ResultPublisher {
-	return &resultsPublisher{dbActions: db.dbActions}
+	return &resultsPublisher{dbActions: db.dbActions, classifier: db.classifier}
 }
 
 func (db *DB) HasLogs() bool {
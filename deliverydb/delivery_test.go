@@ -7,6 +7,7 @@ package deliverydb
 import (
 	"context"
 	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
 	"gitlab.com/lightmeter/controlcenter/dashboard"
 	"gitlab.com/lightmeter/controlcenter/domainmapping"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
@@ -21,7 +22,10 @@ import (
 	"time"
 )
 
-var fakeMapping domainmapping.Mapper
+var (
+	fakeMapping    domainmapping.Mapper
+	fakeClassifier = bounceclass.New(bounceclass.DefaultRules)
+)
 
 func init() {
 	var err error
@@ -38,7 +42,7 @@ func TestDatabaseCreation(t *testing.T) {
 		log.Println("database name:", ws)
 
 		Convey("Insert some values", func() {
-			db, err := New(ws, &fakeMapping)
+			db, err := New(ws, &fakeMapping, fakeClassifier)
 			So(err, ShouldBeNil)
 
 			done, cancel := db.Run()
@@ -139,7 +143,7 @@ func TestEntriesInsertion(t *testing.T) {
 		defer clearDir()
 
 		buildWs := func() (*DB, func() error, func(), tracking.ResultPublisher, dashboard.Dashboard, func()) {
-			db, err := New(dir, &fakeMapping)
+			db, err := New(dir, &fakeMapping, fakeClassifier)
 			So(err, ShouldBeNil)
 			done, cancel := db.Run()
 			pub := db.ResultsPublisher()
@@ -0,0 +1,343 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// MessageEventKind identifies each step in the lifecycle of a message.
+// NOTE: those values are stored in the database, therefore never change their values.
+// New kinds can be added in the end of the list, though.
+type MessageEventKind int
+
+const (
+	ConnectEventKind          MessageEventKind = 0
+	QueueCreatedEventKind     MessageEventKind = 1
+	CleanupEventKind          MessageEventKind = 2
+	QueuedEventKind           MessageEventKind = 3
+	DeliveryAttemptEventKind  MessageEventKind = 4
+	BounceCreatedEventKind    MessageEventKind = 5
+	RemovedEventKind          MessageEventKind = 6
+	RejectedEventKind         MessageEventKind = 7
+	ReturnedToSenderEventKind MessageEventKind = 8
+	MailboxDeliveryEventKind  MessageEventKind = 9
+)
+
+var messageEventKindsHumanForm = map[MessageEventKind]string{
+	ConnectEventKind:          "connect",
+	QueueCreatedEventKind:     "queue_created",
+	CleanupEventKind:          "cleanup",
+	QueuedEventKind:           "queued",
+	DeliveryAttemptEventKind:  "delivery_attempt",
+	BounceCreatedEventKind:    "bounce_created",
+	RemovedEventKind:          "removed",
+	RejectedEventKind:         "rejected",
+	ReturnedToSenderEventKind: "returned_to_sender",
+	MailboxDeliveryEventKind:  "mailbox_delivery",
+}
+
+func (k MessageEventKind) String() string {
+	if s, ok := messageEventKindsHumanForm[k]; ok {
+		return s
+	}
+
+	return "unknown"
+}
+
+type messageEvent struct {
+	time         time.Time
+	kind         MessageEventKind
+	queue        string
+	host         string
+	location     postfix.RecordLocation
+	relatedQueue string
+	messageId    string
+	sender       string
+	recipient    string
+	clientHost   string
+	clientIP     net.IP
+	status       *parser.SmtpStatus
+	dsn          string
+	relay        string
+	description  string
+}
+
+func formatEmailAddress(localPart, domainPart string) string {
+	if len(localPart) == 0 && len(domainPart) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(localPart + "@" + domainPart)
+}
+
+func buildMessageEventAction(e messageEvent) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, e.host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		messageId, err := func() (interface{}, error) {
+			if len(e.messageId) == 0 {
+				return nil, nil
+			}
+
+			id, err := getUniqueMessageId(tx, stmts, e.messageId)
+			if err != nil {
+				return nil, errorutil.Wrap(err)
+			}
+
+			return id, nil
+		}()
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		clientIP := func() interface{} {
+			if e.clientIP == nil {
+				return nil
+			}
+
+			return []byte(e.clientIP)
+		}()
+
+		status := func() interface{} {
+			if e.status == nil {
+				return nil
+			}
+
+			return *e.status
+		}()
+
+		stmt := tx.Stmt(stmts[insertMessageEvent])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(
+			e.time.Unix(),
+			e.kind,
+			e.queue,
+			deliveryServerId,
+			e.location.Filename,
+			e.location.Line,
+			optionalText(e.relatedQueue),
+			messageId,
+			optionalText(e.sender),
+			optionalText(e.recipient),
+			optionalText(e.clientHost),
+			clientIP,
+			status,
+			optionalText(e.dsn),
+			optionalText(e.relay),
+			optionalText(e.description),
+		); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+// Dovecot does not know the postfix queue, so the message is found by the message-id
+// set on its last cleanup on the same server, which is the queue delivered via lmtp
+// in case the message passed through a content filter and got a new queue
+func buildMailboxDeliveryEventAction(e messageEvent) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, e.host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		stmt := tx.Stmt(stmts[selectLastQueueByMessageId])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		err = stmt.QueryRow(e.messageId, deliveryServerId, CleanupEventKind).Scan(&e.queue)
+
+		// a message not seen by postfix has no timeline to be attached to
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return buildMessageEventAction(e)(tx, stmts)
+	}
+}
+
+func mailboxDeliveryDescription(d parser.DovecotLmtpDelivery) string {
+	if d.Saved {
+		return fmt.Sprintf("saved mail to %s", d.Mailbox)
+	}
+
+	return fmt.Sprintf("save failed to %s: %s", d.Mailbox, d.Reason)
+}
+
+type connectionKey struct {
+	host string
+	pid  int
+}
+
+type messageEventsPublisher struct {
+	dbActions chan<- dbAction
+
+	// the "connect" line has no queue, so it's kept until the queue is known (on "client=")
+	connections map[connectionKey]messageEvent
+}
+
+func (p *messageEventsPublisher) publish(e messageEvent) {
+	p.dbActions <- buildMessageEventAction(e)
+}
+
+func relayDescription(s parser.SmtpSentStatus) string {
+	if len(s.RelayName) == 0 {
+		return ""
+	}
+
+	if s.RelayIP == nil {
+		return s.RelayName
+	}
+
+	return fmt.Sprintf("%s[%s]:%d", s.RelayName, s.RelayIP, s.RelayPort)
+}
+
+func (p *messageEventsPublisher) Publish(r postfix.Record) {
+	base := messageEvent{time: r.Time, host: r.Header.Host, location: r.Location}
+
+	connKey := connectionKey{host: r.Header.Host, pid: r.Header.PID}
+
+	switch payload := r.Payload.(type) {
+	case parser.SmtpdConnect:
+		e := base
+		e.kind = ConnectEventKind
+		e.clientHost = payload.Host
+		e.clientIP = payload.IP
+		p.connections[connKey] = e
+	case parser.SmtpdDisconnect:
+		delete(p.connections, connKey)
+	case parser.SmtpdMailAccepted:
+		if conn, ok := p.connections[connKey]; ok {
+			conn.queue = payload.Queue
+			p.publish(conn)
+		}
+
+		e := base
+		e.kind = QueueCreatedEventKind
+		e.queue = payload.Queue
+		e.clientHost = payload.Host
+		e.clientIP = payload.IP
+		p.publish(e)
+	case parser.Pickup:
+		e := base
+		e.kind = QueueCreatedEventKind
+		e.queue = payload.Queue
+		e.description = fmt.Sprintf("uid=%d from=<%s>", payload.Uid, payload.Sender)
+		p.publish(e)
+	case parser.CleanupMessageAccepted:
+		e := base
+		e.kind = CleanupEventKind
+		e.queue = payload.Queue
+		e.messageId = payload.MessageId
+		p.publish(e)
+	case parser.QmgrMailQueued:
+		e := base
+		e.kind = QueuedEventKind
+		e.queue = payload.Queue
+		e.sender = formatEmailAddress(payload.SenderLocalPart, payload.SenderDomainPart)
+		e.description = fmt.Sprintf("size=%d, nrcpt=%d", payload.Size, payload.Nrcpt)
+		p.publish(e)
+	case parser.SmtpSentStatus:
+		e := base
+		e.kind = DeliveryAttemptEventKind
+		e.queue = payload.Queue
+		e.recipient = formatEmailAddress(payload.RecipientLocalPart, payload.RecipientDomainPart)
+		e.status = &payload.Status
+		e.dsn = payload.Dsn
+		e.relay = relayDescription(payload)
+		e.description = payload.ExtraMessage
+
+		if queued, ok := payload.ExtraMessagePayload.(parser.SmtpStatusExtraMessageSentQueued); ok {
+			e.relatedQueue = queued.Queue
+		}
+
+		p.publish(e)
+	case parser.BounceCreated:
+		e := base
+		e.kind = BounceCreatedEventKind
+		e.queue = payload.Queue
+		e.relatedQueue = payload.ChildQueue
+		p.publish(e)
+	case parser.QmgrRemoved:
+		e := base
+		e.kind = RemovedEventKind
+		e.queue = payload.Queue
+		p.publish(e)
+	case parser.QmgrReturnedToSender:
+		e := base
+		e.kind = ReturnedToSenderEventKind
+		e.queue = payload.Queue
+		e.sender = formatEmailAddress(payload.SenderLocalPart, payload.SenderDomainPart)
+		p.publish(e)
+	case parser.SmtpdReject:
+		// the rejection happened before the message got a queue, and there's no timeline to attach it to
+		if payload.Queue == "NOQUEUE" {
+			return
+		}
+
+		p.publish(rejectedMessageEvent(base, payload.Queue, payload.ExtraMessage, payload.Info))
+	case parser.CleanupMilterReject:
+		p.publish(rejectedMessageEvent(base, payload.Queue, payload.ExtraMessage, payload.Info))
+	case parser.DovecotLmtpDelivery:
+		if len(payload.MessageId) == 0 {
+			return
+		}
+
+		e := base
+		e.kind = MailboxDeliveryEventKind
+		e.messageId = payload.MessageId
+		e.recipient = strings.ToLower(payload.User)
+		e.description = mailboxDeliveryDescription(payload)
+		p.dbActions <- buildMailboxDeliveryEventAction(e)
+	}
+}
+
+func rejectedMessageEvent(base messageEvent, queue, extraMessage string, info parser.RejectInfo) messageEvent {
+	e := base
+	e.kind = RejectedEventKind
+	e.queue = queue
+	e.sender = formatEmailAddress(info.SenderLocalPart, info.SenderDomainPart)
+	e.recipient = formatEmailAddress(info.RecipientLocalPart, info.RecipientDomainPart)
+	e.clientHost = info.Host
+	e.clientIP = info.IP
+	e.dsn = info.Dsn
+	e.description = extraMessage
+
+	return e
+}
+
+// MessageEventsPublisher stores every step in the lifecycle of the messages,
+// allowing a message to be followed via its queue, message-id or addresses.
+func (db *DB) MessageEventsPublisher() postfix.Publisher {
+	return &messageEventsPublisher{
+		dbActions:   db.dbActions,
+		connections: map[connectionKey]messageEvent{},
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestExpiredDeliveries(t *testing.T) {
+	Convey("Expired deliveries", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(status parser.SmtpStatus, ts string, domain string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultMessageDirectionKey] = tracking.ResultEntryInt64(int64(tracking.MessageDirectionOutbound))
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(domain)
+
+			return r
+		}
+
+		expired := func(ts string, domain string, attempts int64, timeInQueue float64) tracking.Result {
+			r := result(parser.ExpiredStatus, ts, domain)
+			r[tracking.ResultDSNKey] = tracking.ResultEntryText("4.4.1")
+			r[tracking.ResultExtraMessageKey] = tracking.ResultEntryText(`(connect to mx.example.com[11.22.33.44]:25: Connection timed out)`)
+			r[tracking.ResultDeferralAttemptsKey] = tracking.ResultEntryInt64(attempts)
+			r[tracking.ResultDelayKey] = tracking.ResultEntryFloat64(timeInQueue)
+
+			return r
+		}
+
+		pub.Publish(result(parser.SentStatus, `2020-01-01 10:00:00 +0000`, "example.com"))
+		pub.Publish(result(parser.DeferredStatus, `2020-01-01 10:00:00 +0000`, "example.com"))
+		pub.Publish(expired(`2020-01-05 10:00:00 +0000`, "example.com", 10, 432000))
+		pub.Publish(expired(`2020-01-06 10:00:00 +0000`, "example.com", 20, 432000*2))
+		pub.Publish(expired(`2020-01-07 10:00:00 +0000`, "example.org", 5, 432000))
+
+		// outside of the interval
+		pub.Publish(expired(`2020-02-07 10:00:00 +0000`, "example.org", 5, 432000))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		So(countByStatus(d, parser.ExpiredStatus, interval), ShouldEqual, 3)
+		So(countByStatus(d, parser.DeferredStatus, interval), ShouldEqual, 1)
+
+		status, err := d.DeliveryStatus(dummyContext, interval)
+		So(err, ShouldBeNil)
+		So(status, ShouldResemble, dashboard.Pairs{
+			dashboard.Pair{Key: "sent", Value: 1},
+			dashboard.Pair{Key: "deferred", Value: 1},
+			dashboard.Pair{Key: "expired", Value: 3},
+		})
+
+		domains, err := d.TopExpiredDomains(dummyContext, interval)
+		So(err, ShouldBeNil)
+		So(domains, ShouldResemble, dashboard.ExpiredDomains{
+			{
+				Domain:              "example.com",
+				Expired:             2,
+				AvgDeferralAttempts: 15,
+				AvgTimeInQueue:      432000 * 1.5,
+				LastExpired:         testutil.MustParseTime(`2020-01-06 10:00:00 +0000`),
+			},
+			{
+				Domain:              "example.org",
+				Expired:             1,
+				AvgDeferralAttempts: 5,
+				AvgTimeInQueue:      432000,
+				LastExpired:         testutil.MustParseTime(`2020-01-07 10:00:00 +0000`),
+			},
+		})
+	})
+}
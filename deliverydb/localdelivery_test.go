@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+	"time"
+)
+
+func TestLocalDeliveryStatus(t *testing.T) {
+	Convey("Local delivery status", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(direction tracking.MessageDirection, status parser.SmtpStatus, ts time.Time, dsn, response string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultMessageDirectionKey] = tracking.ResultEntryInt64(int64(direction))
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(ts.Unix())
+			r[tracking.ResultDSNKey] = tracking.ResultEntryText(dsn)
+			r[tracking.ResultExtraMessageKey] = tracking.ResultEntryText(response)
+
+			return r
+		}
+
+		incoming, outbound := tracking.MessageDirectionIncoming, tracking.MessageDirectionOutbound
+
+		ts := testutil.MustParseTime(`2020-01-01 10:00:00 +0000`)
+
+		pub.Publish(result(incoming, parser.SentStatus, ts, "2.0.0", `(delivered to mailbox)`))
+		pub.Publish(result(incoming, parser.SentStatus, ts, "2.0.0", `(delivered to maildir)`))
+		pub.Publish(result(incoming, parser.SentStatus, ts, "2.0.0", `(250 2.0.0 <user@example.com> hz3kESIo+1/dLgAAWP5Hkg Saved)`))
+		pub.Publish(result(incoming, parser.BouncedStatus, ts, "5.2.2", `(cannot update mailbox /var/mail/user for user user. error writing message: File too large)`))
+		pub.Publish(result(incoming, parser.DeferredStatus, ts, "4.2.2", `(452 4.2.2 <user@example.com> Quota exceeded (mailbox for user is full))`))
+		pub.Publish(result(incoming, parser.BouncedStatus, ts, "5.1.1", `(unknown user: "nobody")`))
+		pub.Publish(result(incoming, parser.DeferredStatus, ts, "4.3.0", `(temporary failure. Command output: local delivery failed)`))
+
+		// not delivered locally
+		pub.Publish(result(outbound, parser.SentStatus, ts, "2.0.0", `(250 2.0.0 OK)`))
+
+		// outside of the interval
+		pub.Publish(result(incoming, parser.SentStatus, testutil.MustParseTime(`2020-02-01 10:00:00 +0000`), "2.0.0", `(delivered to mailbox)`))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		status, err := d.LocalDeliveryStatus(dummyContext, parseTimeInterval("2020-01-01", "2020-01-31"))
+		So(err, ShouldBeNil)
+		So(status, ShouldResemble, dashboard.Pairs{
+			dashboard.Pair{Key: dashboard.LocalDeliveryDelivered, Value: 3},
+			dashboard.Pair{Key: dashboard.LocalDeliveryMailboxFull, Value: 2},
+			dashboard.Pair{Key: dashboard.LocalDeliveryBounced, Value: 1},
+			dashboard.Pair{Key: dashboard.LocalDeliveryDeferred, Value: 1},
+		})
+	})
+}
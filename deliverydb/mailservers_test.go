@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestMailServers(t *testing.T) {
+	Convey("Mail servers", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		delivery := func(status parser.SmtpStatus, recipient, ts, receivingHost, receivingInstance, deliveryHost, deliveryInstance string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultRecipientLocalPartKey] = tracking.ResultEntryText(recipient)
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+			r[tracking.ResultDeliveryServerKey] = tracking.ResultEntryText(deliveryHost)
+
+			if len(receivingHost) > 0 {
+				r[tracking.ResultDeliveryInstanceKey] = tracking.ResultEntryText(deliveryInstance)
+				r[tracking.ResultReceivingServerKey] = tracking.ResultEntryText(receivingHost)
+				r[tracking.ResultReceivingInstanceKey] = tracking.ResultEntryText(receivingInstance)
+			}
+
+			return r
+		}
+
+		// received by the inbound instance, and relayed to the outbound one via a content filter
+		pub.Publish(delivery(parser.SentStatus, "a", `2020-01-01 10:00:00 +0000`, "mail1", "postfix-in", "mail1", "postfix-out"))
+		pub.Publish(delivery(parser.DeferredStatus, "b", `2020-01-01 10:10:00 +0000`, "mail1", "postfix-in", "mail1", "postfix-out"))
+
+		// relayed to another host
+		pub.Publish(delivery(parser.BouncedStatus, "c", `2020-01-01 11:00:00 +0000`, "mail1", "postfix-in", "mail2", "postfix"))
+
+		// received and delivered by the same instance
+		pub.Publish(delivery(parser.SentStatus, "d", `2020-01-01 12:00:00 +0000`, "mail2", "postfix", "mail2", "postfix"))
+
+		// stored before the instances were known
+		pub.Publish(delivery(parser.SentStatus, "e", `2020-01-01 13:00:00 +0000`, "", "", "mail2", ""))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		Convey("What each mail server has received and delivered", func() {
+			servers, err := d.MailServers(dummyContext, interval)
+			So(err, ShouldBeNil)
+
+			So(servers, ShouldResemble, dashboard.MailServers{
+				{Host: "mail1", Instance: "postfix-in", Received: 3},
+				{Host: "mail1", Instance: "postfix-out", Sent: 1, Deferred: 1},
+				{Host: "mail2", Instance: "", Sent: 1},
+				{Host: "mail2", Instance: "postfix", Received: 1, Sent: 1, Bounced: 1},
+			})
+		})
+
+		search := func(filter dashboard.DeliveryFilter) []string {
+			page, err := d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{
+				Interval: interval,
+				Filter:   filter,
+				Order:    dashboard.SortAscending,
+			})
+
+			So(err, ShouldBeNil)
+
+			recipients := []string{}
+
+			for _, d := range page.Deliveries {
+				recipients = append(recipients, d.Recipient)
+			}
+
+			return recipients
+		}
+
+		Convey("Search deliveries by mail server", func() {
+			So(search(dashboard.DeliveryFilter{}), ShouldResemble, []string{"a@domain.name", "b@domain.name", "c@domain.name", "d@domain.name", "e@domain.name"})
+
+			// received or delivered by the host
+			So(search(dashboard.DeliveryFilter{Host: "mail1"}), ShouldResemble, []string{"a@domain.name", "b@domain.name", "c@domain.name"})
+			So(search(dashboard.DeliveryFilter{Host: "MAIL2"}), ShouldResemble, []string{"c@domain.name", "d@domain.name", "e@domain.name"})
+
+			So(search(dashboard.DeliveryFilter{Instance: "postfix-out"}), ShouldResemble, []string{"a@domain.name", "b@domain.name"})
+			So(search(dashboard.DeliveryFilter{Host: "mail2", Instance: "postfix"}), ShouldResemble, []string{"c@domain.name", "d@domain.name"})
+			So(search(dashboard.DeliveryFilter{Host: "mail2", Instance: "postfix-in"}), ShouldResemble, []string{})
+
+			bounced := parser.BouncedStatus
+
+			page, err := d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{
+				Interval: interval,
+				Filter:   dashboard.DeliveryFilter{Host: "mail2", Status: &bounced},
+			})
+
+			So(err, ShouldBeNil)
+			So(len(page.Deliveries), ShouldEqual, 1)
+
+			c := page.Deliveries[0]
+			So(c.DeliveryServer, ShouldEqual, "mail2")
+			So(c.DeliveryInstance, ShouldEqual, "postfix")
+			So(c.ReceivingServer, ShouldEqual, "mail1")
+			So(c.ReceivingInstance, ShouldEqual, "postfix-in")
+		})
+
+		Convey("Deliveries over time by mail server", func() {
+			series, err := d.DeliveryStatusOverTime(dummyContext, dashboard.DeliveryStatusOverTimeOptions{
+				Interval:    parseTimeInterval("2020-01-01", "2020-01-01"),
+				Granularity: dashboard.GranularityDay,
+				Instance:    "postfix-in",
+			})
+
+			So(err, ShouldBeNil)
+			So(series, ShouldHaveLength, 1)
+			So(series[0].Sent, ShouldEqual, 1)
+			So(series[0].Deferred, ShouldEqual, 1)
+			So(series[0].Bounced, ShouldEqual, 1)
+
+			series, err = d.DeliveryStatusOverTime(dummyContext, dashboard.DeliveryStatusOverTimeOptions{
+				Interval:    parseTimeInterval("2020-01-01", "2020-01-01"),
+				Granularity: dashboard.GranularityDay,
+				Domain:      "domain.name",
+				Host:        "mail2",
+			})
+
+			So(err, ShouldBeNil)
+			So(series, ShouldHaveLength, 1)
+			So(series[0].Sent, ShouldEqual, 2)
+			So(series[0].Bounced, ShouldEqual, 1)
+			So(series[0].Deferred, ShouldEqual, 0)
+		})
+	})
+}
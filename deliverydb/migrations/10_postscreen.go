@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "10_postscreen.go", upCreatePostscreenTable, downCreatePostscreenTable)
+}
+
+func upCreatePostscreenTable(tx *sql.Tx) error {
+	sql := `
+create table postscreen_events (
+	id integer primary key,
+	event_ts integer not null,
+	event integer not null, -- parser.PostscreenEvent
+	delivery_server_id integer not null,
+	client_ip blob,
+	client_port integer,
+	dnsbl_rank integer,
+	pregreet_bytes integer,
+	stage text,
+	detail text,
+	blocklist text
+);
+
+create index postscreen_events_event_index on postscreen_events(event, event_ts);
+create index postscreen_events_event_ts_index on postscreen_events(event_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreatePostscreenTable(tx *sql.Tx) error {
+	sql := `
+drop index postscreen_events_event_ts_index;
+drop index postscreen_events_event_index;
+drop table postscreen_events;
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
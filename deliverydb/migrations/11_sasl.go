@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "11_sasl.go", upAddSasl, downAddSasl)
+}
+
+// The user that sent each message, when the client authenticated,
+// and the failed authentication attempts
+func upAddSasl(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column sasl_username text; -- optional
+
+create index deliveries_sasl_username_index on deliveries(sasl_username, delivery_ts);
+
+create table sasl_auth_failures (
+	id integer primary key,
+	failure_ts integer not null,
+	delivery_server_id integer not null,
+	client_hostname text,
+	client_ip blob,
+	method text not null,
+	username text, -- not logged by older postfix versions
+	reason text not null
+);
+
+create index sasl_auth_failures_failure_ts_index on sasl_auth_failures(failure_ts);
+create index sasl_auth_failures_client_ip_index on sasl_auth_failures(client_ip, failure_ts);
+create index sasl_auth_failures_username_index on sasl_auth_failures(username, failure_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddSasl(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "12_tls_sessions.go", upCreateTlsSessions, downCreateTlsSessions)
+}
+
+// The TLS parameters negotiated with the client that sent the message and with the relay it was delivered to,
+// shared by many deliveries. The peers are the client and the next relay of each delivery.
+// A delivery with a relay but without a relay session has been sent in cleartext.
+func upCreateTlsSessions(tx *sql.Tx) error {
+	sql := `
+create table tls_sessions (
+	id integer primary key,
+	protocol text not null,
+	cipher text not null,
+	trust integer not null
+);
+
+create index tls_sessions_index on tls_sessions(protocol, cipher, trust);
+
+alter table deliveries add column client_tls_session_id integer; -- optional
+alter table deliveries add column relay_tls_session_id integer; -- optional
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateTlsSessions(tx *sql.Tx) error {
+	return nil
+}
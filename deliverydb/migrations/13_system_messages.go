@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "13_system_messages.go", upAddSystemMessages, downAddSystemMessages)
+}
+
+// Warnings and errors logged by postfix, grouped by their message with the variable parts,
+// as hostnames and addresses, replaced by placeholders
+func upAddSystemMessages(tx *sql.Tx) error {
+	sql := `
+create table system_message_templates (
+	id integer primary key,
+	severity integer not null,
+	daemon text not null,
+	template text not null
+);
+
+create unique index system_message_templates_index on system_message_templates(severity, daemon, template);
+
+create table system_messages (
+	id integer primary key,
+	message_ts integer not null,
+	delivery_server_id integer not null,
+	template_id integer not null,
+	message text not null
+);
+
+create index system_messages_message_ts_index on system_messages(message_ts);
+create index system_messages_template_id_index on system_messages(template_id, message_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddSystemMessages(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "14_connection_failures.go", upAddConnectionFailures, downAddConnectionFailures)
+}
+
+// Failures to connect, or keep connected, to remote servers, by MX host and IP
+func upAddConnectionFailures(tx *sql.Tx) error {
+	sql := `
+create table connection_failures (
+	id integer primary key,
+	failure_ts integer not null,
+	delivery_server_id integer not null,
+	kind integer not null,
+	mx_hostname text not null,
+	mx_ip blob, -- not known on DNS failures
+	mx_port integer,
+	queue text, -- only when a message was being delivered
+	reason text not null
+);
+
+create index connection_failures_failure_ts_index on connection_failures(failure_ts);
+create index connection_failures_mx_index on connection_failures(mx_hostname, mx_ip, failure_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddConnectionFailures(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "15_deferral_attempts.go", upAddDeferralAttempts, downAddDeferralAttempts)
+}
+
+// How many times an expired delivery has been deferred before being returned to the sender.
+// The time it spent in the queue is its delay
+func upAddDeferralAttempts(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column deferral_attempts integer; -- only on expired deliveries
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddDeferralAttempts(tx *sql.Tx) error {
+	return nil
+}
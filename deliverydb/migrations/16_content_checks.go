@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "16_content_checks.go", upAddContentChecks, downAddContentChecks)
+}
+
+// What content filters (amavis, SpamAssassin) and milters (OpenDKIM, OpenDMARC)
+// found about a delivered message, when they are used.
+// The DKIM signing domain is kept along with the other domains
+func upAddContentChecks(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column content_filter_verdict integer;
+alter table deliveries add column content_filter_score real;
+alter table deliveries add column dkim_signing_domain_id integer;
+alter table deliveries add column dmarc_result integer;
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddContentChecks(tx *sql.Tx) error {
+	return nil
+}
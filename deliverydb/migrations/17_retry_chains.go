@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "17_retry_chains.go", upAddRetryChains, downAddRetryChains)
+}
+
+// Deliveries to the same recipient of a queue are attempts of a retry chain, which ends
+// when the message is finally sent, bounced or expires. Each attempt knows its number,
+// and once the chain ends, every attempt gets its final status and time.
+// The first deferral time is set on the attempts after it.
+// All of them are null on the deliveries stored before this migration
+func upAddRetryChains(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column attempt integer;
+alter table deliveries add column first_deferral_ts integer;
+alter table deliveries add column final_status integer;
+alter table deliveries add column final_delivery_ts integer;
+
+create index deliveries_first_deferral_ts_index on deliveries(first_deferral_ts, delivery_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddRetryChains(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "18_mail_server_instances.go", upAddMailServerInstances, downAddMailServerInstances)
+}
+
+// A message can be received by a host and postfix instance (as the ones managed by postmulti)
+// and delivered by another, after being relayed between them, possibly via content filters.
+// The delivery server was already known, and the receiving one reuses the same table.
+// All of them are null on the deliveries stored before this migration
+func upAddMailServerInstances(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column delivery_instance text;
+alter table deliveries add column receiving_server_id integer;
+alter table deliveries add column receiving_instance text;
+
+create index deliveries_delivery_server_index on deliveries(delivery_server_id, delivery_ts);
+create index deliveries_receiving_server_index on deliveries(receiving_server_id, delivery_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddMailServerInstances(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "4_rejections.go", upCreateRejectionsTable, downCreateRejectionsTable)
+}
+
+func upCreateRejectionsTable(tx *sql.Tx) error {
+	sql := `
+create table rejections (
+	id integer primary key,
+	reject_ts integer not null,
+	source integer not null, -- 0: smtpd restriction, 1: milter
+	stage text not null, -- CONNECT, RCPT, END-OF-MESSAGE, etc.
+	queue text not null, -- NOQUEUE if rejected before the queue is created
+	delivery_server_id integer not null,
+	client_hostname text,
+	client_ip blob,
+	sender_local_part text,
+	sender_domain_part_id integer,
+	recipient_local_part text,
+	recipient_domain_part_id integer,
+	reject_code integer,
+	dsn text,
+	reason text not null
+);
+
+create index rejections_reject_ts_index on rejections(reject_ts);
+create index rejections_client_ip_index on rejections(client_ip, reject_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateRejectionsTable(tx *sql.Tx) error {
+	sql := `
+drop index rejections_client_ip_index;
+drop index rejections_reject_ts_index;
+drop table rejections;
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
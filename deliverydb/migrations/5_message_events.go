@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "5_message_events.go", upCreateMessageEventsTable, downCreateMessageEventsTable)
+}
+
+func upCreateMessageEventsTable(tx *sql.Tx) error {
+	sql := `
+create table message_events (
+	id integer primary key,
+	ts integer not null,
+	kind integer not null,
+	queue text not null,
+	delivery_server_id integer not null,
+	filename text not null,
+	line integer not null,
+	related_queue text, -- a bounce created from the queue, or the queue the message was relayed to
+	message_id integer,
+	sender text,
+	recipient text,
+	client_hostname text,
+	client_ip blob,
+	status integer,
+	dsn text,
+	relay text,
+	description text
+);
+
+create index message_events_ts_index on message_events(ts);
+create index message_events_queue_index on message_events(queue);
+create index message_events_related_queue_index on message_events(related_queue);
+create index message_events_message_id_index on message_events(message_id);
+create index message_events_sender_index on message_events(sender);
+create index message_events_recipient_index on message_events(recipient);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateMessageEventsTable(tx *sql.Tx) error {
+	if _, err := tx.Exec(`drop table message_events`); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "6_deliveries_queue.go", upAddQueueToDeliveries, downAddQueueToDeliveries)
+}
+
+func upAddQueueToDeliveries(tx *sql.Tx) error {
+	// the queue is optional as deliveries stored before this migration don't have it
+	sql := `
+alter table deliveries add column queue text;
+
+create index deliveries_queue_index on deliveries(queue);
+create index deliveries_sender_domain_ts_index on deliveries(sender_domain_part_id, delivery_ts);
+create index deliveries_recipient_domain_ts_index on deliveries(recipient_domain_part_id, delivery_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddQueueToDeliveries(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "7_retention_indexes.go", upCreateRetentionIndexes, downCreateRetentionIndexes)
+}
+
+// Indexes needed to find out efficiently whether rows in the lookup tables
+// (messageids, remote_domains and next_relays) are still referenced by anyone
+func upCreateRetentionIndexes(tx *sql.Tx) error {
+	sql := `
+create index deliveries_message_id_index on deliveries(message_id);
+create index deliveries_next_relay_id_index on deliveries(next_relay_id);
+create index deliveries_orig_recipient_domain_index on deliveries(orig_recipient_domain_part_id);
+create index rejections_sender_domain_index on rejections(sender_domain_part_id);
+create index rejections_recipient_domain_index on rejections(recipient_domain_part_id);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateRetentionIndexes(tx *sql.Tx) error {
+	sql := `
+drop index deliveries_message_id_index;
+drop index deliveries_next_relay_id_index;
+drop index deliveries_orig_recipient_domain_index;
+drop index rejections_sender_domain_index;
+drop index rejections_recipient_domain_index;
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "8_remote_responses.go", upCreateRemoteResponses, downCreateRemoteResponses)
+}
+
+// The normalized replies given by the remote servers, shared by many deliveries
+func upCreateRemoteResponses(tx *sql.Tx) error {
+	sql := `
+create table remote_responses (
+	id integer primary key,
+	response text not null
+);
+
+create index remote_responses_index on remote_responses(response);
+
+alter table deliveries add column response_id integer; -- optional
+
+create index deliveries_response_id_index on deliveries(response_id);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateRemoteResponses(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("deliverydb", "9_delivery_category.go", upAddDeliveryCategory, downAddDeliveryCategory)
+}
+
+// The category (see package bounceclass) of the deliveries that did not succeed.
+// Deliveries stored before this migration have no category.
+func upAddDeliveryCategory(tx *sql.Tx) error {
+	sql := `
+alter table deliveries add column category integer; -- optional
+
+create index deliveries_category_index on deliveries(category, delivery_ts);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downAddDeliveryCategory(tx *sql.Tx) error {
+	return nil
+}
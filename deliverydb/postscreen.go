@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+func optionalInt(v int) interface{} {
+	if v == 0 {
+		return nil
+	}
+
+	return v
+}
+
+func buildPostscreenAction(t time.Time, host string, p parser.Postscreen) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		clientIP := func() interface{} {
+			if p.IP == nil {
+				return nil
+			}
+
+			return []byte(p.IP)
+		}()
+
+		stmt := tx.Stmt(stmts[insertPostscreenEvent])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(
+			t.Unix(),
+			p.Event,
+			deliveryServerId,
+			clientIP,
+			optionalInt(p.Port),
+			optionalInt(p.Rank),
+			optionalInt(p.Bytes),
+			optionalText(p.Stage),
+			optionalText(p.Detail),
+			optionalText(p.Blocklist),
+		); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+type postscreenPublisher struct {
+	dbActions chan<- dbAction
+}
+
+func (p *postscreenPublisher) Publish(r postfix.Record) {
+	payload, ok := r.Payload.(parser.Postscreen)
+	if !ok {
+		return
+	}
+
+	// connects and disconnects happen for every client and tell nothing about them,
+	// but would easily be the majority of the stored events
+	if payload.Event == parser.PostscreenConnect || payload.Event == parser.PostscreenDisconnect {
+		return
+	}
+
+	p.dbActions <- buildPostscreenAction(r.Time, r.Header.Host, payload)
+}
+
+// PostscreenPublisher stores the results of the checks done by postscreen
+// on the clients, before they are allowed to talk to smtpd
+func (db *DB) PostscreenPublisher() postfix.Publisher {
+	return &postscreenPublisher{dbActions: db.dbActions}
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestPostscreen(t *testing.T) {
+	Convey("Postscreen", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.PostscreenPublisher()
+
+		publish := func(payload string, time string) {
+			pub.Publish(rejectionRecord(`Feb  8 21:28:47 mx postfix/postscreen[1036]: `+payload, time))
+		}
+
+		//nolint:lll
+		{
+			publish(`CONNECT from [11.22.33.44]:1000 to [10.0.0.1]:25`, `2020-02-08 21:28:47 +0000`)
+			publish(`PASS NEW [11.22.33.44]:1000`, `2020-02-08 21:28:53 +0000`)
+			publish(`PASS OLD [11.22.33.44]:1001`, `2020-02-08 21:29:00 +0000`)
+			publish(`WHITELISTED [11.22.33.45]:1000`, `2020-02-08 21:29:00 +0000`)
+
+			publish(`DNSBL rank 3 for [22.33.44.55]:2000`, `2020-02-08 21:30:00 +0000`)
+			publish(`NOQUEUE: reject: RCPT from [22.33.44.55]:2000: 550 5.7.1 Service unavailable; client [22.33.44.55] blocked using zen.spamhaus.org; from=<a@example.com>, to=<b@example.org>, proto=ESMTP, helo=<spammer>`, `2020-02-08 21:30:01 +0000`)
+			publish(`NOQUEUE: reject: RCPT from [22.33.44.55]:2000: 550 5.7.1 Service unavailable; client [22.33.44.55] blocked using zen.spamhaus.org; from=<a@example.com>, to=<c@example.org>, proto=ESMTP, helo=<spammer>`, `2020-02-08 21:30:01 +0000`)
+			publish(`DNSBL rank 3 for [22.33.44.55]:2001`, `2020-02-08 21:31:00 +0000`)
+			publish(`DNSBL rank 1 for [33.44.55.66]:2000`, `2020-02-08 21:31:00 +0000`)
+
+			publish(`PREGREET 11 after 0.15 from [33.44.55.66]:3000: EHLO spammer\r\n`, `2020-02-08 21:32:00 +0000`)
+			publish(`BLACKLISTED [44.55.66.77]:4000`, `2020-02-08 21:33:00 +0000`)
+			publish(`DISCONNECT [44.55.66.77]:4000`, `2020-02-08 21:33:00 +0000`)
+
+			// outside of the interval
+			publish(`PREGREET 11 after 0.15 from [22.33.44.55]:3000: EHLO spammer\r\n`, `2020-03-08 21:31:00 +0000`)
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-02-01", "2020-02-29")
+
+		Convey("Connect and disconnect are not stored", func() {
+			conn, release := db.ConnPool().Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from postscreen_events`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 11)
+		})
+
+		Convey("Passed and blocked connections", func() {
+			pairs, err := d.PostscreenConnections(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "passed", Value: 3},
+				dashboard.Pair{Key: "blocked", Value: 2},
+			})
+		})
+
+		Convey("DNSBL clients", func() {
+			pairs, err := d.TopPostscreenDNSBLClients(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "22.33.44.55", Value: 2},
+				dashboard.Pair{Key: "33.44.55.66", Value: 1},
+			})
+		})
+
+		Convey("Pregreet clients", func() {
+			pairs, err := d.TopPostscreenPregreetClients(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "33.44.55.66", Value: 1},
+			})
+		})
+	})
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+type RejectionSource int
+
+const (
+	// Rejected by some smtpd restriction (`reject:`)
+	SmtpdRejectionSource RejectionSource = 0
+
+	// Rejected by a milter (`milter-reject:`), either during the smtp session or by cleanup
+	MilterRejectionSource RejectionSource = 1
+)
+
+type rejection struct {
+	time   time.Time
+	host   string
+	source RejectionSource
+	queue  string
+
+	// used when the rejection message could not be parsed
+	extraMessage string
+
+	info parser.RejectInfo
+}
+
+func optionalText(s string) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return s
+}
+
+func getOptionalRemoteDomainNameIdFromText(tx *sql.Tx, stmts preparedStmts, localPart, domainPart string) (interface{}, error) {
+	if len(localPart) == 0 && len(domainPart) == 0 {
+		return nil, nil
+	}
+
+	id, err := getUniqueRemoteDomainNameId(tx, stmts, domainPart)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return id, nil
+}
+
+func buildRejectionAction(r rejection) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, r.host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		senderDomainPartId, err := getOptionalRemoteDomainNameIdFromText(tx, stmts, r.info.SenderLocalPart, r.info.SenderDomainPart)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		recipientDomainPartId, err := getOptionalRemoteDomainNameIdFromText(tx, stmts, r.info.RecipientLocalPart, r.info.RecipientDomainPart)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		clientIP := func() interface{} {
+			if r.info.IP == nil {
+				return nil
+			}
+
+			return []byte(r.info.IP)
+		}()
+
+		code := func() interface{} {
+			if r.info.Code == 0 {
+				return nil
+			}
+
+			return r.info.Code
+		}()
+
+		reason := func() string {
+			if len(r.info.Reason) == 0 {
+				return r.extraMessage
+			}
+
+			return r.info.Reason
+		}()
+
+		stmt := tx.Stmt(stmts[insertRejection])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(
+			r.time.Unix(),
+			r.source,
+			r.info.Stage,
+			r.queue,
+			deliveryServerId,
+			optionalText(r.info.Host),
+			clientIP,
+			optionalText(r.info.SenderLocalPart),
+			senderDomainPartId,
+			optionalText(r.info.RecipientLocalPart),
+			recipientDomainPartId,
+			code,
+			optionalText(r.info.Dsn),
+			reason,
+		); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+type rejectionsPublisher struct {
+	dbActions chan<- dbAction
+}
+
+func (p *rejectionsPublisher) Publish(r postfix.Record) {
+	switch payload := r.Payload.(type) {
+	case parser.SmtpdReject:
+		source := SmtpdRejectionSource
+
+		if payload.Milter {
+			source = MilterRejectionSource
+		}
+
+		p.dbActions <- buildRejectionAction(rejection{
+			time:         r.Time,
+			host:         r.Header.Host,
+			source:       source,
+			queue:        payload.Queue,
+			extraMessage: payload.ExtraMessage,
+			info:         payload.Info,
+		})
+	case parser.CleanupMilterReject:
+		p.dbActions <- buildRejectionAction(rejection{
+			time:         r.Time,
+			host:         r.Header.Host,
+			source:       MilterRejectionSource,
+			queue:        payload.Queue,
+			extraMessage: payload.ExtraMessage,
+			info:         payload.Info,
+		})
+	}
+}
+
+// RejectionsPublisher stores the messages rejected by postfix, either by smtpd or by milters.
+// Such messages are never delivered, and therefore not seen by the tracking.
+func (db *DB) RejectionsPublisher() postfix.Publisher {
+	return &rejectionsPublisher{dbActions: db.dbActions}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func rejectionRecord(line string, time string) postfix.Record {
+	h, p, err := parser.Parse([]byte(line))
+	So(err, ShouldBeNil)
+
+	return postfix.Record{
+		Time:    testutil.MustParseTime(time),
+		Header:  h,
+		Payload: p,
+	}
+}
+
+func TestRejections(t *testing.T) {
+	Convey("Rejections", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.RejectionsPublisher()
+
+		//nolint:lll
+		{
+			pub.Publish(rejectionRecord(`Feb  8 21:28:47 mx postfix/smtps/smtpd[1036]: DE81A2E2DAA: reject: RCPT from unknown[2a02:168:636a::15e2]: 550 5.1.1 <h-c715634009216@h-14dc4a6d.com>: Recipient address rejected: User unknown in virtual mailbox table; from=<h-d2315d@h-24e89d.com> to=<h-c715634009216@h-14dc4a6d.com> proto=ESMTP helo=<[IPv6:2a02:168:636a::15e2]>`, `2020-02-08 21:28:47 +0000`))
+			pub.Publish(rejectionRecord(`Feb  8 21:30:02 mx postfix/smtpd[1040]: NOQUEUE: reject: RCPT from unknown[11.22.33.44]: 550 5.1.1 <recipient@example.com>: Recipient address rejected: User unknown in virtual mailbox table; from=<sender@example.org> to=<recipient@example.com> proto=ESMTP helo=<spammer>`, `2020-02-08 21:30:02 +0000`))
+			pub.Publish(rejectionRecord(`Feb  8 21:30:03 mx postfix/smtpd[1040]: NOQUEUE: reject: CONNECT from unknown[11.22.33.44]: 554 5.7.1 <unknown[11.22.33.44]>: Client host rejected: Access denied; proto=SMTP`, `2020-02-08 21:30:03 +0000`))
+			pub.Publish(rejectionRecord(`Feb  8 21:31:00 mx postfix/cleanup[8966]: B37FD2E05B9: milter-reject: END-OF-MESSAGE from h-ca74a0a011076cd81347f8f11e[254.65.43.194]: 5.7.1 Spam message rejected; from=<sender@example.org> to=<h-7abde52c2@h-ffd2115d4f.com> proto=ESMTP helo=<h-ca74a0a011076cd81347f8f11e>`, `2020-02-08 21:31:00 +0000`))
+
+			// outside of the interval
+			pub.Publish(rejectionRecord(`Feb  8 21:31:00 mx postfix/cleanup[8966]: B37FD2E05B9: milter-reject: END-OF-MESSAGE from h-ca74a0a011076cd81347f8f11e[254.65.43.194]: 5.7.1 Spam message rejected; from=<sender@example.org> to=<h-7abde52c2@h-ffd2115d4f.com> proto=ESMTP helo=<h-ca74a0a011076cd81347f8f11e>`, `2020-03-08 21:31:00 +0000`))
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-02-01", "2020-02-29")
+
+		Convey("Reasons", func() {
+			reasons, err := d.TopRejectionReasons(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(reasons, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "Recipient address rejected: User unknown in virtual mailbox table", Value: 2},
+				dashboard.Pair{Key: "Client host rejected: Access denied", Value: 1},
+				dashboard.Pair{Key: "Spam message rejected", Value: 1},
+			})
+		})
+
+		Convey("Clients", func() {
+			clients, err := d.TopRejectedClients(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(clients, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "11.22.33.44", Value: 2},
+				dashboard.Pair{Key: "254.65.43.194", Value: 1},
+				dashboard.Pair{Key: "2a02:168:636a::15e2", Value: 1},
+			})
+		})
+
+		Convey("Milter rejections are distinguishable", func() {
+			conn, release := db.ConnPool().Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from rejections where source = ?`, MilterRejectionSource).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+	})
+}
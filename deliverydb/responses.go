@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Long responses are mostly explanations that are the same for all messages,
+// and there's no need to keep them in full
+const maxResponseLength = 512
+
+var (
+	responseAddressRegexp      = regexp.MustCompile(`<?[^\s<>()\[\]"',;]+@[^\s<>()\[\]"',;]+>?`)
+	responseHostWithIPRegexp   = regexp.MustCompile(`[^\s()\[\]]+\[[0-9a-fA-F.:]+\](:\d+)?`)
+	responseIPv4Regexp         = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	responseIPv6Regexp         = regexp.MustCompile(`\[(IPv6:)?[0-9a-fA-F]*:[0-9a-fA-F:.]+\]`)
+	responseTokenRegexp        = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9._+=/-]*`)
+	responseSmtpCodeRegexp     = regexp.MustCompile(`^[245]\d\d(-[245]\.\d{1,3}\.\d{1,3})?$`)
+	responseEnhancedCodeRegexp = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+)
+
+// Tokens like queue ids, timestamps or tracking codes
+func isVariableToken(t string) bool {
+	if responseSmtpCodeRegexp.MatchString(t) || responseEnhancedCodeRegexp.MatchString(t) {
+		return false
+	}
+
+	digits, letters := 0, 0
+
+	for _, c := range t {
+		switch {
+		case unicode.IsDigit(c):
+			digits++
+		case unicode.IsLetter(c):
+			letters++
+		}
+	}
+
+	return digits >= 5 || (digits >= 2 && letters > 0 && len(t) >= 8)
+}
+
+func normalizeResponseWord(w string) string {
+	// links usually point to an explanation of the problem, which is the same for all messages
+	if strings.Contains(w, "://") {
+		return w
+	}
+
+	return responseTokenRegexp.ReplaceAllStringFunc(w, func(t string) string {
+		if isVariableToken(strings.TrimRight(t, ".")) {
+			return "<id>"
+		}
+
+		return t
+	})
+}
+
+// normalizeResponse removes the parts of the remote server reply that change
+// on every message, so that equivalent replies can be grouped together.
+// For instance, `(host mx.example.com[1.2.3.4] said: 550 5.1.1 <user@example.com> User unknown (in reply to RCPT TO command))`
+// becomes `550 5.1.1 <address> User unknown (in reply to RCPT TO command)`
+func normalizeResponse(s string) string {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = s[1 : len(s)-1]
+	}
+
+	s = responseAddressRegexp.ReplaceAllString(s, "<address>")
+	s = responseHostWithIPRegexp.ReplaceAllString(s, "<host>")
+	s = responseIPv6Regexp.ReplaceAllString(s, "[<ip>]")
+	s = responseIPv4Regexp.ReplaceAllString(s, "<ip>")
+
+	// which server replied is already known from the relay
+	s = strings.TrimPrefix(s, "host <host> said: ")
+
+	words := strings.Fields(s)
+
+	for i, w := range words {
+		words[i] = normalizeResponseWord(w)
+	}
+
+	s = strings.Join(words, " ")
+
+	if len(s) > maxResponseLength {
+		s = strings.ToValidUTF8(s[:maxResponseLength], "")
+	}
+
+	return s
+}
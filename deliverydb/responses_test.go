@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestNormalizeResponse(t *testing.T) {
+	Convey("Normalize Response", t, func() {
+		Convey("Remote server and recipient are removed", func() {
+			So(normalizeResponse(`(host mx.example.com[11.22.33.44] said: 550 5.1.1 <invalid.email@example.com> User unknown (in reply to RCPT TO command))`),
+				ShouldEqual, `550 5.1.1 <address> User unknown (in reply to RCPT TO command)`)
+		})
+
+		Convey("Queue ids, tracking codes and IP addresses are removed", func() {
+			So(normalizeResponse(`(host aspmx.l.google.com[74.125.143.26] said: 550-5.1.1 The email account that you tried to reach does not exist. `+
+				`550 5.1.1 https://support.google.com/mail/?p=NoSuchUser a1si2383829wrb.123 - gsmtp (in reply to RCPT TO command))`),
+				ShouldEqual, `550-5.1.1 The email account that you tried to reach does not exist. `+
+					`550 5.1.1 https://support.google.com/mail/?p=NoSuchUser <id> - gsmtp (in reply to RCPT TO command)`)
+
+			So(normalizeResponse(`(250 2.0.0 Ok: queued as 4F9D195432)`), ShouldEqual, `250 2.0.0 Ok: queued as <id>`)
+
+			So(normalizeResponse(`(host hotmail-com.olc.protection.outlook.com[104.47.10.33] said: 550 5.7.1 Unfortunately, messages from [142.93.169.220] weren't sent.)`),
+				ShouldEqual, `550 5.7.1 Unfortunately, messages from [<ip>] weren't sent.`)
+
+			So(normalizeResponse(`(connect to mx.example.com[2001:db8::1]:25: Connection timed out)`),
+				ShouldEqual, `connect to <host>: Connection timed out`)
+		})
+
+		Convey("Equivalent responses are the same", func() {
+			So(normalizeResponse(`(host a.example.com[1.1.1.1] said: 452 4.2.2 <one@example.com> Mailbox full, try again in 3600 seconds (in reply to RCPT TO command))`),
+				ShouldEqual,
+				normalizeResponse(`(host b.example.com[2.2.2.2] said: 452 4.2.2 <two@example.com> Mailbox full, try again in 3600 seconds (in reply to RCPT TO command))`))
+		})
+
+		Convey("Long responses are truncated", func() {
+			long := ""
+
+			for i := 0; i < 100; i++ {
+				long += "blah blah "
+			}
+
+			So(len(normalizeResponse(long)), ShouldEqual, maxResponseLength)
+		})
+	})
+}
+
+func TestTopResponses(t *testing.T) {
+	Convey("Top Responses", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(status parser.SmtpStatus, recipientDomain, extraMessage string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(`2020-01-01 10:00:00 +0000`).Unix())
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(recipientDomain)
+			r[tracking.ResultExtraMessageKey] = tracking.ResultEntryText(extraMessage)
+			return r
+		}
+
+		userUnknown := func(host, recipient string) string {
+			return `(host ` + host + `[11.22.33.44] said: 550 5.1.1 <` + recipient + `> User unknown (in reply to RCPT TO command))`
+		}
+
+		greylisted := `(host mx.example.com[11.22.33.44] said: 451 4.7.1 Greylisted, try again later (in reply to RCPT TO command))`
+
+		pub.Publish(result(parser.BouncedStatus, "example.com", userUnknown("mx1.example.com", "a@example.com")))
+		pub.Publish(result(parser.BouncedStatus, "example.com", userUnknown("mx2.example.com", "b@example.com")))
+		pub.Publish(result(parser.BouncedStatus, "domaintobegrouped.com", userUnknown("mx.domaintobegrouped.com", "c@domaintobegrouped.com")))
+		pub.Publish(result(parser.BouncedStatus, "domaintobegrouped.de", `(host mx.domaintobegrouped.de[1.2.3.4] said: 554 5.7.1 Spam message rejected)`))
+		pub.Publish(result(parser.DeferredStatus, "example.com", greylisted))
+		pub.Publish(result(parser.DeferredStatus, "domaintobegrouped.de", greylisted))
+
+		{
+			// results obtained before the response was tracked
+			r := result(parser.BouncedStatus, "example.com", "")
+			r[tracking.ResultExtraMessageKey] = tracking.ResultEntryNone()
+			pub.Publish(r)
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-01")
+
+		Convey("Bounces, for all domains", func() {
+			pairs, err := d.TopBounceReasons(dummyContext, interval, "")
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: `550 5.1.1 <address> User unknown (in reply to RCPT TO command)`, Value: 3},
+				dashboard.Pair{Key: `554 5.7.1 Spam message rejected`, Value: 1},
+			})
+		})
+
+		Convey("Bounces, for a mapped domain", func() {
+			pairs, err := d.TopBounceReasons(dummyContext, interval, "grouped")
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: `550 5.1.1 <address> User unknown (in reply to RCPT TO command)`, Value: 1},
+				dashboard.Pair{Key: `554 5.7.1 Spam message rejected`, Value: 1},
+			})
+		})
+
+		Convey("Deferrals, for a single domain", func() {
+			pairs, err := d.TopDeferralReasons(dummyContext, interval, "Example.com")
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: `451 4.7.1 Greylisted, try again later (in reply to RCPT TO command)`, Value: 1},
+			})
+		})
+
+		Convey("Responses are stored only once", func() {
+			conn, release := db.ConnPool().Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from remote_responses`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("Failed deliveries are classified", func() {
+			pairs, err := d.FailureCategories(dummyContext, interval, "")
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "invalid_recipient", Value: 3},
+				dashboard.Pair{Key: "greylisting", Value: 2},
+				dashboard.Pair{Key: "other", Value: 1},
+				dashboard.Pair{Key: "content", Value: 1},
+			})
+		})
+
+		Convey("Failed deliveries are classified, for a mapped domain", func() {
+			pairs, err := d.FailureCategories(dummyContext, interval, "grouped")
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "invalid_recipient", Value: 1},
+				dashboard.Pair{Key: "greylisting", Value: 1},
+				dashboard.Pair{Key: "content", Value: 1},
+			})
+		})
+
+		Convey("Search deliveries by category", func() {
+			category := bounceclass.CategoryGreylisting
+			page, err := d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{
+				Interval: interval,
+				Filter:   dashboard.DeliveryFilter{Category: &category},
+			})
+			So(err, ShouldBeNil)
+			So(len(page.Deliveries), ShouldEqual, 2)
+
+			for _, delivery := range page.Deliveries {
+				So(delivery.Category, ShouldEqual, "greylisting")
+				So(delivery.Status, ShouldEqual, "deferred")
+			}
+		})
+
+		Convey("Deliveries found in the search contain the response", func() {
+			page, err := d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{Interval: interval, Limit: 1, Order: dashboard.SortAscending})
+			So(err, ShouldBeNil)
+			So(page.Deliveries[0].Response, ShouldEqual, `550 5.1.1 <address> User unknown (in reply to RCPT TO command)`)
+		})
+	})
+}
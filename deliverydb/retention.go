@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+// Tables with timestamped entries, removed once they are older than the retention period
+var purgeStmts = []string{
+	`delete from deliveries where id in (select id from deliveries where delivery_ts < ? order by delivery_ts limit ?)`,
+	`delete from rejections where id in (select id from rejections where reject_ts < ? order by reject_ts limit ?)`,
+	`delete from message_events where id in (select id from message_events where ts < ? order by ts limit ?)`,
+	`delete from postscreen_events where id in (select id from postscreen_events where event_ts < ? order by event_ts limit ?)`,
+	`delete from sasl_auth_failures where id in (select id from sasl_auth_failures where failure_ts < ? order by failure_ts limit ?)`,
+	`delete from system_messages where id in (select id from system_messages where message_ts < ? order by message_ts limit ?)`,
+	`delete from connection_failures where id in (select id from connection_failures where failure_ts < ? order by failure_ts limit ?)`,
+}
+
+type orphansTable struct {
+	name string
+
+	// condition, in terms of `t.id`, for a row to be still used
+	referenced string
+}
+
+// Lookup tables whose rows might become unused after old entries are purged
+var orphansTables = []orphansTable{
+	{
+		name: "messageids",
+		referenced: `exists (select 1 from deliveries where message_id = t.id) or
+			exists (select 1 from message_events where message_id = t.id)`,
+	},
+	{
+		name: "remote_domains",
+		referenced: `exists (select 1 from deliveries where sender_domain_part_id = t.id) or
+			exists (select 1 from deliveries where recipient_domain_part_id = t.id) or
+			exists (select 1 from deliveries where orig_recipient_domain_part_id = t.id) or
+			exists (select 1 from rejections where sender_domain_part_id = t.id) or
+			exists (select 1 from rejections where recipient_domain_part_id = t.id)`,
+	},
+	{
+		name:       "next_relays",
+		referenced: `exists (select 1 from deliveries where next_relay_id = t.id)`,
+	},
+	{
+		name:       "remote_responses",
+		referenced: `exists (select 1 from deliveries where response_id = t.id)`,
+	},
+	{
+		name:       "system_message_templates",
+		referenced: `exists (select 1 from system_messages where template_id = t.id)`,
+	},
+}
+
+// Where the garbage collector stopped. Only accessed by the goroutine running fillDatabase
+type gcCursor struct {
+	table  int
+	lastId int64
+}
+
+// runRetentionAction executes the action in the same goroutine that inserts new data,
+// so the writes are not blocked by long running transactions
+func (db *DB) runRetentionAction(ctx context.Context, action func(*sql.Tx) (int64, error)) (int64, error) {
+	type result struct {
+		value int64
+		err   error
+	}
+
+	resultChan := make(chan result, 1)
+
+	dbAction := func(tx *sql.Tx, _ preparedStmts) error {
+		v, err := action(tx)
+		resultChan <- result{value: v, err: err}
+
+		// errors are returned to the caller, and must not stop the insertion of new data
+		return nil
+	}
+
+	select {
+	case db.dbActions <- dbAction:
+	case <-ctx.Done():
+		return 0, errorutil.Wrap(ctx.Err())
+	}
+
+	select {
+	case r := <-resultChan:
+		if r.err != nil {
+			return 0, errorutil.Wrap(r.err)
+		}
+
+		return r.value, nil
+	case <-ctx.Done():
+		return 0, errorutil.Wrap(ctx.Err())
+	}
+}
+
+// PurgeBatch removes at most batchSize entries older than `before` from each of the tables
+// with timestamped entries, returning the number of removed entries
+func (db *DB) PurgeBatch(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return db.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		var total int64
+
+		for _, stmt := range purgeStmts {
+			result, err := tx.Exec(stmt, before.Unix(), batchSize)
+			if err != nil {
+				return 0, errorutil.Wrap(err)
+			}
+
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return 0, errorutil.Wrap(err)
+			}
+
+			total += affected
+		}
+
+		return total, nil
+	})
+}
+
+// CollectGarbageBatch checks at most batchSize rows of one of the lookup tables, removing the ones not
+// used anymore. It returns false once all the lookup tables have been fully checked.
+func (db *DB) CollectGarbageBatch(ctx context.Context, batchSize int) (bool, error) {
+	more, err := db.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		table := orphansTables[db.gcCursor.table]
+
+		var lastId sql.NullInt64
+
+		if err := tx.QueryRow(`select max(id) from (select id from `+table.name+` where id > ? order by id limit ?)`,
+			db.gcCursor.lastId, batchSize).Scan(&lastId); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		if !lastId.Valid {
+			// finished checking this table
+			db.gcCursor = gcCursor{table: (db.gcCursor.table + 1) % len(orphansTables)}
+
+			if db.gcCursor.table == 0 {
+				return 0, nil
+			}
+
+			return 1, nil
+		}
+
+		//nolint:gosec
+		if _, err := tx.Exec(`delete from `+table.name+` where id in (
+				select id from `+table.name+` t where id > ? and id <= ? and not (`+table.referenced+`))`,
+			db.gcCursor.lastId, lastId.Int64); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		db.gcCursor.lastId = lastId.Int64
+
+		return 1, nil
+	})
+
+	if err != nil {
+		return false, errorutil.Wrap(err)
+	}
+
+	return more != 0, nil
+}
+
+// IncrementalVacuum returns at most `pages` unused pages to the filesystem, returning how many were freed
+func (db *DB) IncrementalVacuum(ctx context.Context, pages int) (int, error) {
+	freed, err := db.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		freed, err := dbconn.IncrementalVacuum(tx, pages)
+		if err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		return int64(freed), nil
+	})
+
+	if err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	return int(freed), nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestRetention(t *testing.T) {
+	Convey("Retention", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		pub := db.ResultsPublisher()
+
+		result := func(time, messageId, recipientDomain string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(time).Unix())
+			r[tracking.QueueMessageIDKey] = tracking.ResultEntryText(messageId)
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(recipientDomain)
+			return r
+		}
+
+		pub.Publish(result(`2020-01-01 10:00:00 +0000`, "old1@example.com", "old.example.com"))
+		pub.Publish(result(`2020-01-02 10:00:00 +0000`, "old2@example.com", "old.example.com"))
+		pub.Publish(result(`2020-03-01 10:00:00 +0000`, "new@example.com", "new.example.com"))
+
+		// counts in the writer transaction, as the changes are committed only periodically
+		count := func(table string) int64 {
+			c, err := db.runRetentionAction(dummyContext, func(tx *sql.Tx) (int64, error) {
+				var c int64
+				err := tx.QueryRow(`select count(*) from ` + table).Scan(&c)
+				return c, err
+			})
+
+			So(err, ShouldBeNil)
+			return c
+		}
+
+		So(count("deliveries"), ShouldEqual, 3)
+		So(count("messageids"), ShouldEqual, 3)
+
+		before := testutil.MustParseTime(`2020-02-01 00:00:00 +0000`)
+
+		Convey("Old deliveries are removed in batches", func() {
+			removed, err := db.PurgeBatch(dummyContext, before, 1)
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 1)
+
+			removed, err = db.PurgeBatch(dummyContext, before, 10)
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 1)
+
+			removed, err = db.PurgeBatch(dummyContext, before, 10)
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 0)
+
+			So(count("deliveries"), ShouldEqual, 1)
+
+			Convey("Orphaned lookup rows are collected", func() {
+				for {
+					more, err := db.CollectGarbageBatch(dummyContext, 1)
+					So(err, ShouldBeNil)
+
+					if !more {
+						break
+					}
+				}
+
+				So(count("messageids"), ShouldEqual, 1)
+				So(count(`remote_domains where domain = 'old.example.com'`), ShouldEqual, 0)
+				So(count(`remote_domains where domain = 'new.example.com'`), ShouldEqual, 1)
+				So(count(`remote_domains where domain = 'sender.com'`), ShouldEqual, 1)
+				So(count("next_relays"), ShouldEqual, 1)
+
+				_, err := db.IncrementalVacuum(dummyContext, 100)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		cancel()
+		So(done(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestRetryChains(t *testing.T) {
+	Convey("Retry chains", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		attempt := func(status parser.SmtpStatus, queue, recipient, ts string, n int64, firstDeferral string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.QueueDeliveryNameKey] = tracking.ResultEntryText(queue)
+			r[tracking.ResultRecipientLocalPartKey] = tracking.ResultEntryText(recipient)
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+
+			if n != 0 {
+				r[tracking.ResultDeliveryAttemptKey] = tracking.ResultEntryInt64(n)
+			}
+
+			if len(firstDeferral) > 0 {
+				r[tracking.ResultFirstDeferralTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(firstDeferral).Unix())
+			}
+
+			return r
+		}
+
+		// greylisted twice, then delivered
+		pub.Publish(attempt(parser.DeferredStatus, "AAAAAA", "a", `2020-01-01 10:00:00 +0000`, 1, `2020-01-01 10:00:00 +0000`))
+		pub.Publish(attempt(parser.DeferredStatus, "AAAAAA", "a", `2020-01-01 10:10:00 +0000`, 2, `2020-01-01 10:00:00 +0000`))
+		pub.Publish(attempt(parser.SentStatus, "AAAAAA", "a", `2020-01-01 10:20:00 +0000`, 3, `2020-01-01 10:00:00 +0000`))
+
+		pub.Publish(attempt(parser.DeferredStatus, "BBBBBB", "b", `2020-01-01 11:00:00 +0000`, 1, `2020-01-01 11:00:00 +0000`))
+		pub.Publish(attempt(parser.SentStatus, "BBBBBB", "b", `2020-01-01 11:05:00 +0000`, 2, `2020-01-01 11:00:00 +0000`))
+
+		pub.Publish(attempt(parser.DeferredStatus, "EEEEEE", "e", `2020-01-01 11:00:00 +0000`, 1, `2020-01-01 11:00:00 +0000`))
+		pub.Publish(attempt(parser.SentStatus, "EEEEEE", "e", `2020-01-01 11:10:00 +0000`, 2, `2020-01-01 11:00:00 +0000`))
+
+		// expired results know only when they have been deferred for the first time
+		pub.Publish(attempt(parser.DeferredStatus, "CCCCCC", "c", `2020-01-01 12:00:00 +0000`, 1, `2020-01-01 12:00:00 +0000`))
+		pub.Publish(attempt(parser.ExpiredStatus, "CCCCCC", "c", `2020-01-06 12:00:00 +0000`, 0, `2020-01-01 12:00:00 +0000`))
+
+		// still in the queue
+		pub.Publish(attempt(parser.DeferredStatus, "DDDDDD", "d", `2020-01-01 13:00:00 +0000`, 1, `2020-01-01 13:00:00 +0000`))
+
+		// delivered at the first attempt
+		pub.Publish(attempt(parser.SentStatus, "FFFFFF", "f", `2020-01-01 14:00:00 +0000`, 1, ``))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		So(countByStatus(d, parser.DeferredStatus, interval), ShouldEqual, 6)
+
+		chains, err := d.RetryChains(dummyContext, interval)
+		So(err, ShouldBeNil)
+		So(chains, ShouldResemble, dashboard.RetryChains{
+			DeferralAttempts:    6,
+			DeferredMessages:    5,
+			EventuallyDelivered: 3,
+			DeferredThenBounced: 1,
+			MedianTimeToRecover: 600,
+		})
+
+		Convey("Deferred attempts get the final status of their chain", func() {
+			conn, release := db.ConnPool().Acquire()
+			defer release()
+
+			countDeferredByFinalStatus := func(status parser.SmtpStatus) int {
+				var count int
+				So(conn.QueryRow(`select count(*) from deliveries where status = ? and final_status = ?`, parser.DeferredStatus, status).Scan(&count), ShouldBeNil)
+				return count
+			}
+
+			So(countDeferredByFinalStatus(parser.SentStatus), ShouldEqual, 4)
+			So(countDeferredByFinalStatus(parser.ExpiredStatus), ShouldEqual, 1)
+
+			var pending int
+			So(conn.QueryRow(`select count(*) from deliveries where final_status is null`).Scan(&pending), ShouldBeNil)
+			So(pending, ShouldEqual, 1)
+		})
+
+		Convey("With an even number of recovered messages, the median is the average of the two in the middle", func() {
+			chains, err := d.RetryChains(dummyContext, parseTimeInterval("2020-01-01", "2020-01-01"))
+			So(err, ShouldBeNil)
+			So(chains.EventuallyDelivered, ShouldEqual, 3)
+
+			// only B and E, from 11h on
+			interval.From = testutil.MustParseTime(`2020-01-01 11:00:00 +0000`)
+
+			chains, err = d.RetryChains(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(chains.EventuallyDelivered, ShouldEqual, 2)
+			So(chains.MedianTimeToRecover, ShouldEqual, 450)
+		})
+	})
+}
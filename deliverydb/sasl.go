@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+func buildSaslAuthFailureAction(t time.Time, host string, p parser.SmtpdSaslAuthFailed) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		clientIP := func() interface{} {
+			if p.IP == nil {
+				return nil
+			}
+
+			return []byte(p.IP)
+		}()
+
+		stmt := tx.Stmt(stmts[insertSaslAuthFailure])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(
+			t.Unix(),
+			deliveryServerId,
+			optionalText(p.Host),
+			clientIP,
+			p.Method,
+			optionalText(p.Username),
+			p.Reason,
+		); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+type saslAuthFailuresPublisher struct {
+	dbActions chan<- dbAction
+}
+
+func (p *saslAuthFailuresPublisher) Publish(r postfix.Record) {
+	if payload, ok := r.Payload.(parser.SmtpdSaslAuthFailed); ok {
+		p.dbActions <- buildSaslAuthFailureAction(r.Time, r.Header.Host, payload)
+	}
+}
+
+// SaslAuthFailuresPublisher stores the failed authentication attempts by clients
+func (db *DB) SaslAuthFailuresPublisher() postfix.Publisher {
+	return &saslAuthFailuresPublisher{dbActions: db.dbActions}
+}
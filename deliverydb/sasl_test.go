@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestSaslAuthFailures(t *testing.T) {
+	Convey("SASL authentication failures", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.SaslAuthFailuresPublisher()
+
+		publish := func(payload string, time string) {
+			pub.Publish(rejectionRecord(`Feb  8 21:28:47 mx postfix/smtpd[1036]: warning: `+payload, time))
+		}
+
+		//nolint:lll
+		{
+			publish(`unknown[11.22.33.44]: SASL LOGIN authentication failed: UGFzc3dvcmQ6, sasl_username=admin@example.com`, `2020-02-08 21:28:47 +0000`)
+			publish(`unknown[11.22.33.44]: SASL LOGIN authentication failed: UGFzc3dvcmQ6, sasl_username=info@example.com`, `2020-02-08 21:28:50 +0000`)
+			publish(`unknown[11.22.33.44]: SASL LOGIN authentication failed: UGFzc3dvcmQ6, sasl_username=admin@example.com`, `2020-02-08 21:28:55 +0000`)
+			publish(`unknown[22.33.44.55]: SASL PLAIN authentication failed: authentication failure, sasl_username=admin@example.com`, `2020-02-08 21:30:00 +0000`)
+
+			// older postfix versions do not log the username
+			publish(`mail.example.net[33.44.55.66]: SASL LOGIN authentication failed: UGFzc3dvcmQ6`, `2020-02-08 21:31:00 +0000`)
+
+			// outside of the interval
+			publish(`unknown[44.55.66.77]: SASL LOGIN authentication failed: UGFzc3dvcmQ6, sasl_username=admin@example.com`, `2020-03-08 21:31:00 +0000`)
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-02-01", "2020-02-29")
+
+		Convey("Clients with most failures", func() {
+			pairs, err := d.TopSaslFailedClients(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "11.22.33.44", Value: 3},
+				dashboard.Pair{Key: "22.33.44.55", Value: 1},
+				dashboard.Pair{Key: "33.44.55.66", Value: 1},
+			})
+		})
+
+		Convey("Usernames targeted by most clients", func() {
+			pairs, err := d.TopSaslTargetedUsernames(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(pairs, ShouldResemble, dashboard.Pairs{
+				dashboard.Pair{Key: "admin@example.com", Value: 2},
+				dashboard.Pair{Key: "info@example.com", Value: 1},
+			})
+		})
+	})
+}
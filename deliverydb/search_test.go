@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func queuesOfDeliveries(page dashboard.DeliveriesPage) []string {
+	r := []string{}
+
+	for _, d := range page.Deliveries {
+		r = append(r, d.Queue)
+	}
+
+	return r
+}
+
+func TestSearchDeliveries(t *testing.T) {
+	Convey("Search Deliveries", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(queue string, status parser.SmtpStatus, ts time.Time, recipient, dsn string, delay float64) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.QueueDeliveryNameKey] = tracking.ResultEntryText(queue)
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(ts.Unix())
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(recipient)
+			r[tracking.ResultDSNKey] = tracking.ResultEntryText(dsn)
+			r[tracking.ResultDelayKey] = tracking.ResultEntryFloat64(delay)
+			return r
+		}
+
+		pub.Publish(result("AAAA1", parser.SentStatus, testutil.MustParseTime(`2020-01-01 10:00:00 +0000`), "example.com", "2.0.0", 1.0))
+		pub.Publish(result("AAAA2", parser.BouncedStatus, testutil.MustParseTime(`2020-01-01 11:00:00 +0000`), "example.com", "5.1.1", 3.0))
+		pub.Publish(result("AAAA3", parser.DeferredStatus, testutil.MustParseTime(`2020-01-01 12:00:00 +0000`), "Example.org", "4.4.1", 2.0))
+		pub.Publish(result("AAAA4", parser.BouncedStatus, testutil.MustParseTime(`2020-01-01 12:00:00 +0000`), "example.org", "5.7.1", 7.0))
+		pub.Publish(result("AAAA5", parser.BouncedStatus, testutil.MustParseTime(`2020-01-01 13:00:00 +0000`), "example.com", "5.1.1", 3.0))
+
+		{
+			// a different client and relay
+			r := result("AAAA6", parser.SentStatus, testutil.MustParseTime(`2020-01-01 14:00:00 +0000`), "example.net", "2.0.0", 0.5)
+			r[tracking.ConnectionClientIPKey] = tracking.ResultEntryBlob(net.ParseIP("11.22.33.44"))
+			r[tracking.ResultRelayNameKey] = tracking.ResultEntryText("mx.example.net")
+			r[tracking.ResultRelayIPKey] = tracking.ResultEntryBlob(net.ParseIP("55.66.77.88"))
+			r[tracking.ConnectionSaslUsernameKey] = tracking.ResultEntryText("user@sender.com")
+			pub.Publish(r)
+		}
+
+		{
+			// incoming from another domain is not shown by default
+			r := result("AAAA7", parser.SentStatus, testutil.MustParseTime(`2020-01-01 15:00:00 +0000`), "example.net", "2.0.0", 0.5)
+			r[tracking.ResultMessageDirectionKey] = tracking.ResultEntryInt64(int64(tracking.MessageDirectionIncoming))
+			pub.Publish(r)
+		}
+
+		// outside of the interval
+		pub.Publish(result("AAAA8", parser.BouncedStatus, testutil.MustParseTime(`2020-02-01 13:00:00 +0000`), "example.com", "5.1.1", 3.0))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		search := func(options dashboard.DeliverySearchOptions) dashboard.DeliveriesPage {
+			options.Interval = interval
+			page, err := d.SearchDeliveries(dummyContext, options)
+			So(err, ShouldBeNil)
+			return page
+		}
+
+		Convey("No filter, most recent first", func() {
+			page := search(dashboard.DeliverySearchOptions{})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA6", "AAAA5", "AAAA4", "AAAA3", "AAAA2", "AAAA1"})
+			So(page.NextCursor, ShouldEqual, "")
+
+			delivery := page.Deliveries[0]
+			So(delivery.Time, ShouldResemble, testutil.MustParseTime(`2020-01-01 14:00:00 +0000`))
+			So(delivery.Status, ShouldEqual, "sent")
+			So(delivery.Direction, ShouldEqual, "outbound")
+			So(delivery.MessageId, ShouldEqual, "lala@caca.com")
+			So(delivery.Sender, ShouldEqual, "sender@sender.com")
+			So(delivery.Recipient, ShouldEqual, "recipient@example.net")
+			So(delivery.ClientIP, ShouldEqual, "11.22.33.44")
+			So(delivery.NextRelay, ShouldEqual, "mx.example.net[55.66.77.88]:42")
+			So(delivery.ProcessedSize, ShouldEqual, 80)
+			So(delivery.DeliveryServer, ShouldEqual, "server")
+		})
+
+		Convey("Filter by status", func() {
+			status := parser.BouncedStatus
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{Status: &status}})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA5", "AAAA4", "AAAA2"})
+		})
+
+		Convey("Filter by direction", func() {
+			direction := tracking.MessageDirectionIncoming
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{Direction: &direction}})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA7"})
+			So(page.Deliveries[0].Direction, ShouldEqual, "inbound")
+		})
+
+		Convey("Filter by recipient domain, case insensitive, and dsn class", func() {
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{RecipientDomainPart: "EXAMPLE.ORG", DsnClass: "5"}})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA4"})
+		})
+
+		Convey("Filter by sender and recipient local parts", func() {
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{SenderLocalPart: "sender", SenderDomainPart: "sender.com", RecipientLocalPart: "nobody"}})
+			So(page.Deliveries, ShouldBeEmpty)
+		})
+
+		Convey("Filter by next relay and client ip", func() {
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{NextRelay: "mx.example.net", ClientIP: net.ParseIP("11.22.33.44")}})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA6"})
+		})
+
+		Convey("Filter by authenticated user", func() {
+			page := search(dashboard.DeliverySearchOptions{Filter: dashboard.DeliveryFilter{SaslUsername: "user@sender.com"}})
+			So(queuesOfDeliveries(page), ShouldResemble, []string{"AAAA6"})
+			So(page.Deliveries[0].SaslUsername, ShouldEqual, "user@sender.com")
+		})
+
+		Convey("Paginate sorting by delay", func() {
+			options := dashboard.DeliverySearchOptions{SortBy: dashboard.SortDeliveriesByDelay, Order: dashboard.SortAscending, Limit: 2}
+
+			queues := []string{}
+
+			for pages := 0; ; pages++ {
+				So(pages, ShouldBeLessThan, 4)
+
+				page := search(options)
+				So(len(page.Deliveries), ShouldBeLessThanOrEqualTo, 2)
+
+				queues = append(queues, queuesOfDeliveries(page)...)
+
+				if page.NextCursor == "" {
+					break
+				}
+
+				options.Cursor = page.NextCursor
+			}
+
+			// ties are broken by the order the deliveries were stored
+			So(queues, ShouldResemble, []string{"AAAA6", "AAAA1", "AAAA3", "AAAA2", "AAAA5", "AAAA4"})
+		})
+
+		Convey("Cursors are bound to the ordering", func() {
+			page := search(dashboard.DeliverySearchOptions{Limit: 1})
+			So(page.NextCursor, ShouldNotEqual, "")
+
+			_, err := d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{Interval: interval, Cursor: page.NextCursor, Order: dashboard.SortAscending})
+			So(err, ShouldEqual, dashboard.ErrInvalidCursor)
+
+			_, err = d.SearchDeliveries(dummyContext, dashboard.DeliverySearchOptions{Interval: interval, Cursor: "garbage"})
+			So(err, ShouldEqual, dashboard.ErrInvalidCursor)
+		})
+	})
+}
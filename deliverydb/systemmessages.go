@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"regexp"
+	"time"
+)
+
+type systemMessagePlaceholder struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Applied in order, so, for instance, addresses in brackets are not seen as hostnames
+var systemMessagePlaceholders = []systemMessagePlaceholder{
+	{regexp.MustCompile(`<[^<>\s]*@[^<>\s]*>`), `<address>`},
+	{regexp.MustCompile(`\[[0-9a-fA-F:.]+\]`), `[<ip>]`},
+	{regexp.MustCompile(`(^|[\s=(:])\.{0,2}/[^\s:,()]+`), `$1<path>`},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`), `<ip>`},
+	{regexp.MustCompile(`^[0-9A-F]{10,}:`), `<queue>:`},
+	{regexp.MustCompile(`\b([a-zA-Z0-9_-]+\.)+[a-zA-Z]{2,}\b`), `<host>`},
+	{regexp.MustCompile(`\b\d+(\.\d+)?\b`), `<n>`},
+}
+
+// normalizeSystemMessage replaces the variable parts of a message by placeholders,
+// so the same issue happening with different hosts, files or numbers gets the same template, as in
+// `hostname <host> does not resolve to address <ip>`
+func normalizeSystemMessage(message string) string {
+	for _, p := range systemMessagePlaceholders {
+		message = p.pattern.ReplaceAllString(message, p.replacement)
+	}
+
+	return message
+}
+
+func buildSystemMessageAction(t time.Time, host, daemon string, p parser.SystemMessage) func(*sql.Tx, preparedStmts) error {
+	return func(tx *sql.Tx, stmts preparedStmts) error {
+		deliveryServerId, err := getUniqueDeliveryServerID(tx, stmts, host)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		templateId, err := getUniquePropertyFromAnotherTable(tx,
+			stmts[selectSystemMessageTemplate], stmts[insertSystemMessageTemplate],
+			p.Severity, daemon, normalizeSystemMessage(p.Message))
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		stmt := tx.Stmt(stmts[insertSystemMessage])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(t.Unix(), deliveryServerId, templateId, p.Message); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+type systemMessagesPublisher struct {
+	dbActions chan<- dbAction
+}
+
+func (p *systemMessagesPublisher) Publish(r postfix.Record) {
+	if payload, ok := r.Payload.(parser.SystemMessage); ok {
+		p.dbActions <- buildSystemMessageAction(r.Time, r.Header.Host, r.Header.Daemon, payload)
+	}
+}
+
+// SystemMessagesPublisher stores the warnings and errors logged by postfix
+func (db *DB) SystemMessagesPublisher() postfix.Publisher {
+	return &systemMessagesPublisher{dbActions: db.dbActions}
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+func TestNormalizeSystemMessage(t *testing.T) {
+	Convey("Normalize system messages", t, func() {
+		for _, c := range []struct {
+			message  string
+			template string
+		}{
+			{`hostname mx.example.com does not resolve to address 11.22.33.44`, `hostname <host> does not resolve to address <ip>`},
+			{`hostname mx.example.com does not resolve to address 11.22.33.44: Name or service not known`, `hostname <host> does not resolve to address <ip>: Name or service not known`},
+			{`database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual`, `database <path> is older than source file <path>`},
+			{`open database /etc/postfix/virtual.db: No such file or directory`, `open database <path>: No such file or directory`},
+			{`TLS library problem: error:14094418:SSL routines:ssl3_read_bytes:tlsv1 alert unknown ca:../ssl/record/rec_layer_s3.c:1543:SSL alert number 48:`, `TLS library problem: error:<n>:SSL routines:ssl3_read_bytes:tlsv1 alert unknown ca:<path>:<n>:SSL alert number <n>:`},
+			{`unknown[2001:db8::1]: SASL PLAIN authentication failed: generic failure`, `unknown[<ip>]: SASL PLAIN authentication failed: generic failure`},
+			{`4AA091855DA0: queue file size limit exceeded`, `<queue>: queue file size limit exceeded`},
+			{`<user@example.com>: recipient address rejected`, `<address>: recipient address rejected`},
+			{`process /usr/lib/postfix/sbin/smtpd pid 1234 exit status 1`, `process <path> pid <n> exit status <n>`},
+		} {
+			So(normalizeSystemMessage(c.message), ShouldEqual, c.template)
+		}
+	})
+}
+
+func TestSystemMessages(t *testing.T) {
+	Convey("System messages", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.SystemMessagesPublisher()
+
+		publish := func(line string, time string) {
+			pub.Publish(rejectionRecord(`Feb  8 21:28:47 mx `+line, time))
+		}
+
+		//nolint:lll
+		{
+			// before the interval
+			publish(`postfix/smtpd[1036]: warning: hostname mx.example.com does not resolve to address 11.22.33.44`, `2020-01-08 21:28:47 +0000`)
+
+			publish(`postfix/smtpd[1036]: warning: hostname mx.example.org does not resolve to address 22.33.44.55`, `2020-02-08 21:28:47 +0000`)
+			publish(`postfix/smtpd[1036]: warning: hostname mx.example.net does not resolve to address 33.44.55.66`, `2020-02-08 21:29:47 +0000`)
+			publish(`postfix/trivial-rewrite[1037]: warning: database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual`, `2020-02-08 21:30:47 +0000`)
+			publish(`postfix/smtpd[1038]: fatal: open database /etc/postfix/virtual.db: No such file or directory`, `2020-02-08 21:31:47 +0000`)
+			publish(`postfix/smtpd[1039]: fatal: open database /etc/postfix/virtual.db: No such file or directory`, `2020-02-08 21:32:47 +0000`)
+
+			// same message by another daemon is a different template
+			publish(`postfix/cleanup[1040]: fatal: open database /etc/postfix/virtual.db: No such file or directory`, `2020-02-08 21:33:47 +0000`)
+
+			// understood by the daemon parser
+			publish(`postfix/smtpd[1036]: warning: unknown[11.22.33.44]: SASL LOGIN authentication failed: UGFzc3dvcmQ6`, `2020-02-08 21:34:47 +0000`)
+		}
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		messages, err := d.SystemMessages(dummyContext, parseTimeInterval("2020-02-01", "2020-02-29"))
+		So(err, ShouldBeNil)
+		So(messages, ShouldResemble, dashboard.SystemMessages{
+			{
+				Severity:    "fatal",
+				Daemon:      "smtpd",
+				Template:    "open database <path>: No such file or directory",
+				Count:       2,
+				FirstSeen:   testutil.MustParseTime(`2020-02-08 21:31:47 +0000`),
+				LastSeen:    testutil.MustParseTime(`2020-02-08 21:32:47 +0000`),
+				LastMessage: "open database /etc/postfix/virtual.db: No such file or directory",
+			},
+			{
+				Severity:    "fatal",
+				Daemon:      "cleanup",
+				Template:    "open database <path>: No such file or directory",
+				Count:       1,
+				FirstSeen:   testutil.MustParseTime(`2020-02-08 21:33:47 +0000`),
+				LastSeen:    testutil.MustParseTime(`2020-02-08 21:33:47 +0000`),
+				LastMessage: "open database /etc/postfix/virtual.db: No such file or directory",
+			},
+			{
+				Severity:    "warning",
+				Daemon:      "smtpd",
+				Template:    "hostname <host> does not resolve to address <ip>",
+				Count:       2,
+				FirstSeen:   testutil.MustParseTime(`2020-01-08 21:28:47 +0000`),
+				LastSeen:    testutil.MustParseTime(`2020-02-08 21:29:47 +0000`),
+				LastMessage: "hostname mx.example.net does not resolve to address 33.44.55.66",
+			},
+			{
+				Severity:    "warning",
+				Daemon:      "trivial-rewrite",
+				Template:    "database <path> is older than source file <path>",
+				Count:       1,
+				FirstSeen:   testutil.MustParseTime(`2020-02-08 21:30:47 +0000`),
+				LastSeen:    testutil.MustParseTime(`2020-02-08 21:30:47 +0000`),
+				LastMessage: "database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual",
+			},
+		})
+	})
+}
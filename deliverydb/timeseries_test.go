@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+func TestDeliveryStatusOverTime(t *testing.T) {
+	Convey("Delivery Status Over Time", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		// the daylight saving time starts on 2020-03-29 at 02:00, which becomes 03:00
+		location, err := time.LoadLocation("Europe/Berlin")
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(status parser.SmtpStatus, ts, recipientDomain string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(testutil.MustParseTime(ts).Unix())
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(recipientDomain)
+			return r
+		}
+
+		// 2020-03-28 23:55 local time
+		pub.Publish(result(parser.SentStatus, `2020-03-28 22:55:00 +0000`, "example.com"))
+
+		// 2020-03-29 00:30 local time
+		pub.Publish(result(parser.SentStatus, `2020-03-28 23:30:00 +0000`, "example.com"))
+		pub.Publish(result(parser.BouncedStatus, `2020-03-28 23:31:00 +0000`, "domaintobegrouped.com"))
+
+		// 2020-03-29 03:10 local time
+		pub.Publish(result(parser.DeferredStatus, `2020-03-29 01:10:00 +0000`, "domaintobegrouped.de"))
+
+		// 2020-03-29 23:59 local time
+		pub.Publish(result(parser.SentStatus, `2020-03-29 21:59:00 +0000`, "example.com"))
+
+		// 2020-03-30 00:05 local time
+		pub.Publish(result(parser.SentStatus, `2020-03-29 22:05:00 +0000`, "example.com"))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		overTime := func(from, to string, granularity dashboard.Granularity, domain string) dashboard.DeliveryStatusTimeSeries {
+			interval, err := timeutil.ParseTimeInterval(from, to, location)
+			So(err, ShouldBeNil)
+
+			series, err := d.DeliveryStatusOverTime(dummyContext, dashboard.DeliveryStatusOverTimeOptions{
+				Interval:    interval,
+				Granularity: granularity,
+				Domain:      domain,
+			})
+
+			So(err, ShouldBeNil)
+
+			return series
+		}
+
+		localTime := func(year int, month time.Month, day, hour, minute int) time.Time {
+			return time.Date(year, month, day, hour, minute, 0, 0, location)
+		}
+
+		Convey("Daily", func() {
+			series := overTime("2020-03-28", "2020-03-30", dashboard.GranularityDay, "")
+
+			So(series, ShouldResemble, dashboard.DeliveryStatusTimeSeries{
+				{Time: localTime(2020, time.March, 28, 0, 0), Sent: 1},
+				{Time: localTime(2020, time.March, 29, 0, 0), Sent: 2, Deferred: 1, Bounced: 1},
+				{Time: localTime(2020, time.March, 30, 0, 0), Sent: 1},
+			})
+		})
+
+		Convey("Hourly, on a day with 23 hours", func() {
+			series := overTime("2020-03-29", "2020-03-29", dashboard.GranularityHour, "")
+
+			So(len(series), ShouldEqual, 23)
+
+			So(series[0], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 0, 0), Sent: 1, Bounced: 1})
+			So(series[1], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 1, 0)})
+			So(series[2], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 3, 0), Deferred: 1})
+			So(series[22], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 23, 0), Sent: 1})
+		})
+
+		Convey("Every five minutes, for a mapped domain", func() {
+			series := overTime("2020-03-29", "2020-03-29", dashboard.GranularityFiveMinutes, "grouped")
+
+			So(len(series), ShouldEqual, 23*12)
+
+			So(series[6], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 0, 30), Bounced: 1})
+			So(series[26], ShouldResemble, dashboard.DeliveryStatusBucket{Time: localTime(2020, time.March, 29, 3, 10), Deferred: 1})
+
+			total := 0
+
+			for _, b := range series {
+				total += b.Sent + b.Deferred + b.Bounced
+			}
+
+			So(total, ShouldEqual, 2)
+		})
+
+		Convey("Too many buckets", func() {
+			interval, err := timeutil.ParseTimeInterval("2020-01-01", "2020-12-31", location)
+			So(err, ShouldBeNil)
+
+			_, err = d.DeliveryStatusOverTime(dummyContext, dashboard.DeliveryStatusOverTimeOptions{
+				Interval:    interval,
+				Granularity: dashboard.GranularityFiveMinutes,
+			})
+
+			So(errors.Is(err, dashboard.ErrTooManyBuckets), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package deliverydb
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+	"time"
+)
+
+func TestTlsSessions(t *testing.T) {
+	Convey("TLS sessions", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := New(dir, &fakeMapping, fakeClassifier)
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		d, err := dashboard.New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		pub := db.ResultsPublisher()
+
+		result := func(recipient string, status parser.SmtpStatus, ts time.Time, protocol string) tracking.Result {
+			r := buildDefaultResult()
+			r[tracking.ResultRecipientDomainPartKey] = tracking.ResultEntryText(recipient)
+			r[tracking.ResultStatusKey] = tracking.ResultEntryInt64(int64(status))
+			r[tracking.ResultDeliveryTimeKey] = tracking.ResultEntryInt64(ts.Unix())
+
+			// the client always uses TLS
+			r[tracking.ConnectionTlsProtocolKey] = tracking.ResultEntryText("TLSv1.3")
+			r[tracking.ConnectionTlsCipherKey] = tracking.ResultEntryText("TLS_AES_256_GCM_SHA384")
+			r[tracking.ConnectionTlsTrustKey] = tracking.ResultEntryInt64(int64(parser.TlsTrustAnonymous))
+
+			if len(protocol) > 0 {
+				r[tracking.ResultTlsProtocolKey] = tracking.ResultEntryText(protocol)
+				r[tracking.ResultTlsCipherKey] = tracking.ResultEntryText("TLS_AES_256_GCM_SHA384")
+				r[tracking.ResultTlsTrustKey] = tracking.ResultEntryInt64(int64(parser.TlsTrustVerified))
+			}
+
+			return r
+		}
+
+		pub.Publish(result("example.com", parser.SentStatus, testutil.MustParseTime(`2020-01-01 10:00:00 +0000`), "TLSv1.3"))
+		pub.Publish(result("example.com", parser.SentStatus, testutil.MustParseTime(`2020-01-01 11:00:00 +0000`), "TLSv1.3"))
+		pub.Publish(result("example.com", parser.SentStatus, testutil.MustParseTime(`2020-01-01 12:00:00 +0000`), ""))
+		pub.Publish(result("example.org", parser.SentStatus, testutil.MustParseTime(`2020-01-01 12:00:00 +0000`), "TLSv1.2"))
+		pub.Publish(result("example.org", parser.SentStatus, testutil.MustParseTime(`2020-01-01 12:00:00 +0000`), ""))
+		pub.Publish(result("example.net", parser.SentStatus, testutil.MustParseTime(`2020-01-01 13:00:00 +0000`), ""))
+
+		// not sent
+		pub.Publish(result("example.net", parser.DeferredStatus, testutil.MustParseTime(`2020-01-01 13:00:00 +0000`), "TLSv1.3"))
+
+		// outside of the interval
+		pub.Publish(result("example.net", parser.SentStatus, testutil.MustParseTime(`2020-02-01 13:00:00 +0000`), "TLSv1.3"))
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		interval := parseTimeInterval("2020-01-01", "2020-01-31")
+
+		Convey("Sessions are shared by the deliveries", func() {
+			conn, release := db.ConnPool().Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from tls_sessions`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 3)
+
+			So(conn.QueryRow(`select count(*) from deliveries where client_tls_session_id is not null`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 8)
+		})
+
+		Convey("Outbound messages by TLS protocol", func() {
+			usage, err := d.OutboundTlsByDomain(dummyContext, interval)
+			So(err, ShouldBeNil)
+			So(usage, ShouldResemble, dashboard.TlsUsageByDomain{
+				{Domain: "example.com", Total: 3, Protocols: dashboard.Pairs{
+					dashboard.Pair{Key: "TLSv1.3", Value: 2},
+					dashboard.Pair{Key: "cleartext", Value: 1},
+				}},
+				{Domain: "example.org", Total: 2, Protocols: dashboard.Pairs{
+					dashboard.Pair{Key: "TLSv1.2", Value: 1},
+					dashboard.Pair{Key: "cleartext", Value: 1},
+				}},
+				{Domain: "example.net", Total: 1, Protocols: dashboard.Pairs{
+					dashboard.Pair{Key: "cleartext", Value: 1},
+				}},
+			})
+		})
+	})
+}
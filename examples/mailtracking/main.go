@@ -96,7 +96,7 @@ func main() {
 
 	pub := publisher{}
 
-	t, err := tracking.New(workspace, &pub)
+	t, err := tracking.New(workspace, &pub, tracking.DefaultGCOptions)
 
 	defer func() {
 		errorutil.MustSucceed(t.Close())
@@ -72,7 +72,7 @@ func main() {
 	// ensure workspace exists
 	errorutil.MustSucceed(os.MkdirAll(workspaceDir, os.ModePerm))
 
-	ws, err := workspace.NewWorkspace(workspaceDir)
+	ws, err := workspace.NewWorkspace(workspaceDir, workspace.DefaultOptions)
 	errorutil.MustSucceed(err)
 
 	importAnnouncer := ws.ImportAnnouncer()
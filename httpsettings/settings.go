@@ -16,6 +16,7 @@ import (
 	"gitlab.com/lightmeter/controlcenter/notification/slack"
 	"gitlab.com/lightmeter/controlcenter/pkg/httperror"
 	"gitlab.com/lightmeter/controlcenter/po"
+	"gitlab.com/lightmeter/controlcenter/retention"
 	"gitlab.com/lightmeter/controlcenter/settings"
 	"gitlab.com/lightmeter/controlcenter/settings/globalsettings"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
@@ -51,6 +52,7 @@ func NewSettings(writer *meta.AsyncWriter,
 		"initSetup":    s.InitialSetupHandler,
 		"notification": s.NotificationSettingsHandler,
 		"general":      s.GeneralSettingsHandler,
+		"retention":    s.RetentionSettingsHandler,
 	}
 
 	return s
@@ -121,6 +123,7 @@ func (h *Settings) SettingsHandler(w http.ResponseWriter, r *http.Request) error
 		EmailNotification email.Settings          `json:"email_notifications"`
 		Notification      notification.Settings   `json:"notifications"`
 		General           globalsettings.Settings `json:"general"`
+		Retention         retention.Settings      `json:"retention"`
 	}{}
 
 	ctx := r.Context()
@@ -145,6 +148,11 @@ func (h *Settings) SettingsHandler(w http.ResponseWriter, r *http.Request) error
 		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
 	}
 
+	retentionSettings, err := retention.GetSettings(ctx, h.reader)
+	if err != nil && !errors.Is(err, meta.ErrNoSuchKey) {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
 	if slackSettings != nil {
 		allCurrentSettings.SlackNotification = *slackSettings
 	}
@@ -161,6 +169,10 @@ func (h *Settings) SettingsHandler(w http.ResponseWriter, r *http.Request) error
 		allCurrentSettings.General = *globalSettings
 	}
 
+	if retentionSettings != nil {
+		allCurrentSettings.Retention = *retentionSettings
+	}
+
 	return httputil.WriteJson(w, &allCurrentSettings, http.StatusOK)
 }
 
@@ -219,6 +231,46 @@ func (h *Settings) GeneralSettingsHandler(w http.ResponseWriter, r *http.Request
 	return nil
 }
 
+func parseRetentionDays(form url.Values, key string) (int, error) {
+	v := form.Get(key)
+
+	// not set means keeping the data forever
+	if v == "" {
+		return 0, nil
+	}
+
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("Invalid number of days for %v: %v", key, v)
+	}
+
+	return days, nil
+}
+
+func (h *Settings) RetentionSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := handleForm(w, r); err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	deliveriesDays, err := parseRetentionDays(r.Form, "deliveries_days")
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusBadRequest, errorutil.Wrap(err))
+	}
+
+	insightsDays, err := parseRetentionDays(r.Form, "insights_days")
+	if err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusBadRequest, errorutil.Wrap(err))
+	}
+
+	s := retention.Settings{DeliveriesDays: deliveriesDays, InsightsDays: insightsDays}
+
+	if err := retention.SetSettings(r.Context(), h.writer, s); err != nil {
+		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
+	}
+
+	return nil
+}
+
 func (h *Settings) InitialSetupHandler(w http.ResponseWriter, r *http.Request) error {
 	if err := handleForm(w, r); err != nil {
 		return httperror.NewHTTPStatusCodeError(http.StatusInternalServerError, errorutil.Wrap(err))
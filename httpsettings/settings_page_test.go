@@ -90,6 +90,10 @@ func TestSettingsPage(t *testing.T) {
 				"notifications": map[string]interface{}{
 					"language": "",
 				},
+				"retention": map[string]interface{}{
+					"deliveries_days": float64(0),
+					"insights_days":   float64(0),
+				},
 				"slack_notifications": map[string]interface{}{
 					"bearer_token": "",
 					"channel":      "",
@@ -153,6 +157,10 @@ func TestSettingsPage(t *testing.T) {
 				"notifications": map[string]interface{}{
 					"language": "en",
 				},
+				"retention": map[string]interface{}{
+					"deliveries_days": float64(0),
+					"insights_days":   float64(0),
+				},
 				"slack_notifications": map[string]interface{}{
 					"bearer_token": "some_token",
 					"channel":      "some_channel",
@@ -204,6 +212,10 @@ func TestSettingsPage(t *testing.T) {
 				"notifications": map[string]interface{}{
 					"language": "en",
 				},
+				"retention": map[string]interface{}{
+					"deliveries_days": float64(0),
+					"insights_days":   float64(0),
+				},
 				"slack_notifications": map[string]interface{}{
 					"bearer_token": "some_token",
 					"channel":      "some_channel",
@@ -296,6 +308,10 @@ func TestSettingsPage(t *testing.T) {
 					"notifications": map[string]interface{}{
 						"language": "de",
 					},
+					"retention": map[string]interface{}{
+						"deliveries_days": float64(0),
+						"insights_days":   float64(0),
+					},
 					"slack_notifications": map[string]interface{}{
 						"bearer_token": "",
 						"channel":      "",
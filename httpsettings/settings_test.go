@@ -19,6 +19,7 @@ import (
 	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
 	"gitlab.com/lightmeter/controlcenter/notification/email"
 	"gitlab.com/lightmeter/controlcenter/notification/slack"
+	"gitlab.com/lightmeter/controlcenter/retention"
 	"gitlab.com/lightmeter/controlcenter/settings"
 	"gitlab.com/lightmeter/controlcenter/settings/globalsettings"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
@@ -511,3 +512,35 @@ func TestEmailNotifications(t *testing.T) {
 		})
 	})
 }
+
+func TestRetentionSettings(t *testing.T) {
+	Convey("Retention Settings", t, func() {
+		setup, _, reader, _, _, clear := buildTestSetup(t)
+		defer clear()
+
+		chain := httpmiddleware.New()
+		handler := chain.WithError(httpmiddleware.CustomHTTPHandler(setup.SettingsForward))
+		s := httptest.NewServer(handler)
+
+		c := &http.Client{}
+
+		Convey("Invalid number of days", func() {
+			r, err := c.PostForm(s.URL+"?setting=retention", url.Values{"deliveries_days": {"-3"}})
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+			_, err = retention.GetSettings(context.Background(), reader)
+			So(errors.Is(err, meta.ErrNoSuchKey), ShouldBeTrue)
+		})
+
+		Convey("Insights are kept forever if not set", func() {
+			r, err := c.PostForm(s.URL+"?setting=retention", url.Values{"deliveries_days": {"90"}})
+			So(err, ShouldBeNil)
+			So(r.StatusCode, ShouldEqual, http.StatusOK)
+
+			settings, err := retention.GetSettings(context.Background(), reader)
+			So(err, ShouldBeNil)
+			So(*settings, ShouldResemble, retention.Settings{DeliveriesDays: 90, InsightsDays: 0})
+		})
+	})
+}
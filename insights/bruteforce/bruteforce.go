@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package bruteforceinsight detects credential stuffing attacks on the SMTP authentication,
+// either as many failed attempts from a single client, or as many clients failing on the same account.
+package bruteforceinsight
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/i18n/translator"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+type Options struct {
+	// How far in the past failed authentications are considered
+	LookupRange time.Duration
+
+	// A client with at least this number of failures in LookupRange is considered an attacker
+	FailuresPerClientThreshold int
+
+	// An account that failed to authenticate from at least this number of clients in LookupRange is considered under attack
+	ClientsPerUsernameThreshold int
+
+	MinTimeToGenerateNewInsight time.Duration
+}
+
+const (
+	ContentType   = "sasl_brute_force"
+	ContentTypeId = 8
+
+	// how often the failures are checked
+	checkInterval = time.Minute * 10
+
+	checkKind   = "sasl_brute_force_check"
+	insightKind = "sasl_brute_force"
+)
+
+func init() {
+	core.RegisterContentType(ContentType, ContentTypeId, core.DefaultContentTypeDecoder(&Content{}))
+}
+
+type Client struct {
+	Address  string `json:"address"`
+	Failures int    `json:"failures"`
+}
+
+type Username struct {
+	Username string `json:"username"`
+
+	// number of distinct addresses that failed to authenticate with this username
+	Clients int `json:"clients"`
+}
+
+type Content struct {
+	Interval  timeutil.TimeInterval `json:"interval"`
+	Clients   []Client              `json:"clients"`
+	Usernames []Username            `json:"usernames"`
+}
+
+func (c Content) Title() notificationCore.ContentComponent {
+	return &title{}
+}
+
+func (c Content) Description() notificationCore.ContentComponent {
+	return &description{c}
+}
+
+func (c Content) Metadata() notificationCore.ContentMetadata {
+	return nil
+}
+
+type title struct{}
+
+func (t title) String() string {
+	return translator.Stringfy(t)
+}
+
+func (title) TplString() string {
+	return translator.I18n("Possible credential stuffing attack")
+}
+
+func (title) Args() []interface{} {
+	return nil
+}
+
+type description struct {
+	c Content
+}
+
+func (d description) String() string {
+	return translator.Stringfy(d)
+}
+
+func (d description) TplString() string {
+	return translator.I18n("%v suspicious clients and %v targeted accounts failed to authenticate between %v and %v")
+}
+
+func (d description) Args() []interface{} {
+	return []interface{}{len(d.c.Clients), len(d.c.Usernames), d.c.Interval.From, d.c.Interval.To}
+}
+
+func (c Content) HelpLink(urlContainer core.URLContainer) string {
+	return urlContainer.Get(ContentType)
+}
+
+type detector struct {
+	options   Options
+	creator   core.Creator
+	dashboard dashboard.Dashboard
+}
+
+func (*detector) Close() error {
+	return nil
+}
+
+func NewDetector(creator core.Creator, options core.Options) core.Detector {
+	d, ok := options["dashboard"].(dashboard.Dashboard)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid dashboard"))
+	}
+
+	detectorOptions, ok := options["bruteforce"].(Options)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid detector options"))
+	}
+
+	return &detector{
+		options:   detectorOptions,
+		creator:   creator,
+		dashboard: d,
+	}
+}
+
+// calls f for each pair, as (key, value), with value of at least threshold
+func forEachPairAboveThreshold(pairs dashboard.Pairs, threshold int, f func(string, int)) {
+	for _, p := range pairs {
+		key, keyOk := p.Key.(string)
+		value, valueOk := p.Value.(int)
+
+		if keyOk && valueOk && value >= threshold {
+			f(key, value)
+		}
+	}
+}
+
+func (d *detector) Step(c core.Clock, tx *sql.Tx) error {
+	now := c.Now()
+
+	lastCheck, err := core.RetrieveLastDetectorExecution(tx, checkKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastCheck.IsZero() && now.Sub(lastCheck) < checkInterval {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, checkKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	lastInsight, err := core.RetrieveLastDetectorExecution(tx, insightKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	// not to flood the user with insights during a long attack
+	if !lastInsight.IsZero() && now.Sub(lastInsight) < d.options.MinTimeToGenerateNewInsight {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	interval := timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now}
+
+	clients, err := d.dashboard.TopSaslFailedClients(ctx, interval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	usernames, err := d.dashboard.TopSaslTargetedUsernames(ctx, interval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	content := Content{Interval: interval, Clients: []Client{}, Usernames: []Username{}}
+
+	forEachPairAboveThreshold(clients, d.options.FailuresPerClientThreshold, func(address string, failures int) {
+		content.Clients = append(content.Clients, Client{Address: address, Failures: failures})
+	})
+
+	forEachPairAboveThreshold(usernames, d.options.ClientsPerUsernameThreshold, func(username string, clients int) {
+		content.Usernames = append(content.Usernames, Username{Username: username, Clients: clients})
+	})
+
+	if len(content.Clients) == 0 && len(content.Usernames) == 0 {
+		return nil
+	}
+
+	if err := generateInsight(tx, c, d.creator, content); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, insightKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func generateInsight(tx *sql.Tx, c core.Clock, creator core.Creator, content Content) error {
+	properties := core.InsightProperties{
+		Time:        c.Now(),
+		Category:    core.LocalCategory,
+		Rating:      core.BadRating,
+		ContentType: ContentType,
+		Content:     content,
+	}
+
+	if err := creator.GenerateInsight(context.Background(), tx, properties); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bruteforceinsight
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	mock_dashboard "gitlab.com/lightmeter/controlcenter/dashboard/mock"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	_ "gitlab.com/lightmeter/controlcenter/insights/migrations"
+	insighttestsutil "gitlab.com/lightmeter/controlcenter/insights/testutil"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func TestBruteForceDetectorInsight(t *testing.T) {
+	Convey("Test Insights Generator", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		d := mock_dashboard.NewMockDashboard(ctrl)
+
+		accessor, clear := insighttestsutil.NewFakeAccessor(t)
+		defer clear()
+
+		baseTime := testutil.MustParseTime(`2000-01-01 00:00:00 +0000`)
+
+		detector := NewDetector(accessor, core.Options{"dashboard": d, "bruteforce": Options{
+			LookupRange:                 time.Hour,
+			FailuresPerClientThreshold:  10,
+			ClientsPerUsernameThreshold: 5,
+			MinTimeToGenerateNewInsight: time.Hour * 6,
+		}})
+
+		step := func(now time.Time) {
+			tx, err := accessor.ConnPair.RwConn.Begin()
+			So(err, ShouldBeNil)
+			So(detector.Step(&insighttestsutil.FakeClock{Time: now}, tx), ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		expect := func(now time.Time, clients, usernames dashboard.Pairs) {
+			interval := timeutil.TimeInterval{From: now.Add(-time.Hour), To: now}
+			d.EXPECT().TopSaslFailedClients(gomock.Any(), interval).Return(clients, nil)
+			d.EXPECT().TopSaslTargetedUsernames(gomock.Any(), interval).Return(usernames, nil)
+		}
+
+		Convey("Few failures do not generate insights", func() {
+			expect(baseTime, dashboard.Pairs{
+				dashboard.Pair{Key: "11.22.33.44", Value: 9},
+			}, dashboard.Pairs{
+				dashboard.Pair{Key: "user@example.com", Value: 1},
+			})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("Many failures from a client or on an account", func() {
+			expect(baseTime, dashboard.Pairs{
+				dashboard.Pair{Key: "11.22.33.44", Value: 30},
+				dashboard.Pair{Key: "22.33.44.55", Value: 3},
+			}, dashboard.Pairs{
+				dashboard.Pair{Key: "admin@example.com", Value: 7},
+				dashboard.Pair{Key: "user@example.com", Value: 1},
+			})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 1)
+
+			interval := timeutil.TimeInterval{From: baseTime.Add(-time.Hour), To: baseTime}
+
+			insights, err := accessor.FetchInsights(dummyContext, core.FetchOptions{Interval: interval})
+			So(err, ShouldBeNil)
+			So(len(insights), ShouldEqual, 1)
+			So(insights[0].ContentType(), ShouldEqual, ContentType)
+			So(insights[0].Content(), ShouldResemble, &Content{
+				Interval:  interval,
+				Clients:   []Client{{Address: "11.22.33.44", Failures: 30}},
+				Usernames: []Username{{Username: "admin@example.com", Clients: 7}},
+			})
+
+			Convey("The failures are not checked again too soon", func() {
+				step(baseTime.Add(time.Minute))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("No new insight while the attack continues", func() {
+				step(baseTime.Add(time.Hour))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("A new insight after some time", func() {
+				expect(baseTime.Add(time.Hour*7), dashboard.Pairs{
+					dashboard.Pair{Key: "11.22.33.44", Value: 10},
+				}, dashboard.Pairs{})
+
+				step(baseTime.Add(time.Hour * 7))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -6,12 +6,17 @@
 package insights
 
 import (
+	bruteforceinsight "gitlab.com/lightmeter/controlcenter/insights/bruteforce"
 	"gitlab.com/lightmeter/controlcenter/insights/core"
+	expireddomainsinsight "gitlab.com/lightmeter/controlcenter/insights/expireddomains"
 	"gitlab.com/lightmeter/controlcenter/insights/highrate"
 	"gitlab.com/lightmeter/controlcenter/insights/localrbl"
+	longdeferredinsight "gitlab.com/lightmeter/controlcenter/insights/longdeferred"
 	"gitlab.com/lightmeter/controlcenter/insights/mailinactivity"
 	"gitlab.com/lightmeter/controlcenter/insights/messagerbl"
 	"gitlab.com/lightmeter/controlcenter/insights/newsfeed"
+	systemhealthinsight "gitlab.com/lightmeter/controlcenter/insights/systemhealth"
+	unreachabledomaininsight "gitlab.com/lightmeter/controlcenter/insights/unreachabledomain"
 	"gitlab.com/lightmeter/controlcenter/insights/welcome"
 	"gitlab.com/lightmeter/controlcenter/notification"
 )
@@ -24,6 +29,11 @@ func defaultDetectors(creator *creator, options core.Options) []core.Detector {
 		localrblinsight.NewDetector(creator, options),
 		messagerblinsight.NewDetector(creator, options),
 		newsfeed.NewDetector(creator, options),
+		bruteforceinsight.NewDetector(creator, options),
+		systemhealthinsight.NewDetector(creator, options),
+		unreachabledomaininsight.NewDetector(creator, options),
+		expireddomainsinsight.NewDetector(creator, options),
+		longdeferredinsight.NewDetector(creator, options),
 	}
 }
 
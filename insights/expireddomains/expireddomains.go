@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package expireddomainsinsight warns when more messages than usual expire in the queue
+// for a recipient domain, being returned to their senders.
+package expireddomainsinsight
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/i18n/translator"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+type Options struct {
+	// Expired messages in this range are compared with the ones in the range just before it
+	LookupRange time.Duration
+
+	// Domains with fewer expired messages than this are never reported
+	MinExpired int
+
+	// How many times the expired messages must have grown compared to the previous range
+	GrowthFactor float64
+
+	// The same domain is not reported again before this time
+	MinTimeToGenerateNewInsight time.Duration
+}
+
+const (
+	ContentType   = "expired_domains"
+	ContentTypeId = 11
+
+	// how often the domains are checked
+	checkInterval = time.Minute * 10
+
+	checkKind = "expired_domains_check"
+
+	// followed by the reported domain
+	insightKindPrefix = "expired_domains:"
+)
+
+func init() {
+	core.RegisterContentType(ContentType, ContentTypeId, core.DefaultContentTypeDecoder(&Content{}))
+}
+
+type Content struct {
+	Domain   string                `json:"domain"`
+	Expired  int                   `json:"expired"`
+	Previous int                   `json:"previous"`
+	Interval timeutil.TimeInterval `json:"interval"`
+
+	AvgDeferralAttempts float64 `json:"avg_deferral_attempts"`
+}
+
+func (c Content) Title() notificationCore.ContentComponent {
+	return &title{c}
+}
+
+func (c Content) Description() notificationCore.ContentComponent {
+	return &description{c}
+}
+
+func (c Content) Metadata() notificationCore.ContentMetadata {
+	return nil
+}
+
+type title struct {
+	c Content
+}
+
+func (t title) String() string {
+	return translator.Stringfy(t)
+}
+
+func (title) TplString() string {
+	return translator.I18n("Rising number of expired messages to %v")
+}
+
+func (t title) Args() []interface{} {
+	return []interface{}{t.c.Domain}
+}
+
+type description struct {
+	c Content
+}
+
+func (d description) String() string {
+	return translator.Stringfy(d)
+}
+
+func (d description) TplString() string {
+	return translator.I18n("%v messages to %v expired in the queue between %v and %v, up from %v before, after %v delivery attempts on average")
+}
+
+func (d description) Args() []interface{} {
+	return []interface{}{d.c.Expired, d.c.Domain, d.c.Interval.From, d.c.Interval.To, d.c.Previous, d.c.AvgDeferralAttempts}
+}
+
+func (c Content) HelpLink(urlContainer core.URLContainer) string {
+	return urlContainer.Get(ContentType)
+}
+
+type detector struct {
+	options   Options
+	creator   core.Creator
+	dashboard dashboard.Dashboard
+}
+
+func (*detector) Close() error {
+	return nil
+}
+
+func NewDetector(creator core.Creator, options core.Options) core.Detector {
+	d, ok := options["dashboard"].(dashboard.Dashboard)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid dashboard"))
+	}
+
+	detectorOptions, ok := options["expireddomains"].(Options)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid detector options"))
+	}
+
+	return &detector{
+		options:   detectorOptions,
+		creator:   creator,
+		dashboard: d,
+	}
+}
+
+func (d *detector) Step(c core.Clock, tx *sql.Tx) error {
+	now := c.Now()
+
+	lastCheck, err := core.RetrieveLastDetectorExecution(tx, checkKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastCheck.IsZero() && now.Sub(lastCheck) < checkInterval {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, checkKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	interval := timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now}
+	previousInterval := timeutil.TimeInterval{From: interval.From.Add(-d.options.LookupRange), To: interval.From}
+
+	domains, err := d.dashboard.TopExpiredDomains(context.Background(), interval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	previousDomains, err := d.dashboard.TopExpiredDomains(context.Background(), previousInterval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	previous := map[string]int{}
+
+	for _, domain := range previousDomains {
+		previous[domain.Domain] = domain.Expired
+	}
+
+	for _, domain := range domains {
+		if domain.Expired < d.options.MinExpired {
+			continue
+		}
+
+		if float64(domain.Expired) < float64(previous[domain.Domain])*d.options.GrowthFactor {
+			continue
+		}
+
+		kind := insightKindPrefix + domain.Domain
+
+		lastReport, err := core.RetrieveLastDetectorExecution(tx, kind)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if !lastReport.IsZero() && now.Sub(lastReport) < d.options.MinTimeToGenerateNewInsight {
+			continue
+		}
+
+		if err := core.StoreLastDetectorExecution(tx, kind, now); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		content := Content{
+			Domain:              domain.Domain,
+			Expired:             domain.Expired,
+			Previous:            previous[domain.Domain],
+			Interval:            interval,
+			AvgDeferralAttempts: domain.AvgDeferralAttempts,
+		}
+
+		if err := generateInsight(tx, c, d.creator, content); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func generateInsight(tx *sql.Tx, c core.Clock, creator core.Creator, content Content) error {
+	properties := core.InsightProperties{
+		Time:        c.Now(),
+		Category:    core.LocalCategory,
+		Rating:      core.BadRating,
+		ContentType: ContentType,
+		Content:     content,
+	}
+
+	if err := creator.GenerateInsight(context.Background(), tx, properties); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// +build dev !release
+
+package expireddomainsinsight
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+// Executed only on development builds, for better developer experience
+func (d *detector) GenerateSampleInsight(tx *sql.Tx, c core.Clock) error {
+	now := c.Now()
+
+	if err := generateInsight(tx, c, d.creator, Content{
+		Domain:              "example.com",
+		Expired:             42,
+		Previous:            3,
+		Interval:            timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now},
+		AvgDeferralAttempts: 12.5,
+	}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
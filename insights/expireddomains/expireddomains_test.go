@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package expireddomainsinsight
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	mock_dashboard "gitlab.com/lightmeter/controlcenter/dashboard/mock"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	_ "gitlab.com/lightmeter/controlcenter/insights/migrations"
+	insighttestsutil "gitlab.com/lightmeter/controlcenter/insights/testutil"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func TestExpiredDomainsDetectorInsight(t *testing.T) {
+	Convey("Test Insights Generator", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		d := mock_dashboard.NewMockDashboard(ctrl)
+
+		accessor, clear := insighttestsutil.NewFakeAccessor(t)
+		defer clear()
+
+		baseTime := testutil.MustParseTime(`2000-01-01 00:00:00 +0000`)
+
+		detector := NewDetector(accessor, core.Options{"dashboard": d, "expireddomains": Options{
+			LookupRange:                 time.Hour * 24,
+			MinExpired:                  5,
+			GrowthFactor:                2,
+			MinTimeToGenerateNewInsight: time.Hour * 24,
+		}})
+
+		step := func(now time.Time) {
+			tx, err := accessor.ConnPair.RwConn.Begin()
+			So(err, ShouldBeNil)
+			So(detector.Step(&insighttestsutil.FakeClock{Time: now}, tx), ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		expect := func(now time.Time, current, previous dashboard.ExpiredDomains) {
+			interval := timeutil.TimeInterval{From: now.Add(-time.Hour * 24), To: now}
+			previousInterval := timeutil.TimeInterval{From: now.Add(-time.Hour * 48), To: now.Add(-time.Hour * 24)}
+			d.EXPECT().TopExpiredDomains(gomock.Any(), interval).Return(current, nil)
+			d.EXPECT().TopExpiredDomains(gomock.Any(), previousInterval).Return(previous, nil)
+		}
+
+		expired := func(domain string, count int) dashboard.ExpiredDomain {
+			return dashboard.ExpiredDomain{
+				Domain:              domain,
+				Expired:             count,
+				AvgDeferralAttempts: 10,
+				AvgTimeInQueue:      432000,
+				LastExpired:         baseTime.Add(-time.Hour),
+			}
+		}
+
+		Convey("Few expired messages do not generate insights", func() {
+			expect(baseTime, dashboard.ExpiredDomains{expired("example.com", 4)}, dashboard.ExpiredDomains{})
+			step(baseTime)
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("Expired messages not growing fast enough do not generate insights", func() {
+			expect(baseTime,
+				dashboard.ExpiredDomains{expired("example.com", 15)},
+				dashboard.ExpiredDomains{expired("example.com", 10)})
+
+			step(baseTime)
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("A domain with rising expired messages is reported", func() {
+			expect(baseTime,
+				dashboard.ExpiredDomains{expired("example.com", 20), expired("example.org", 6)},
+				dashboard.ExpiredDomains{expired("example.com", 10), expired("example.org", 5)})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 1)
+
+			interval := timeutil.TimeInterval{From: baseTime.Add(-time.Hour), To: baseTime}
+
+			insights, err := accessor.FetchInsights(dummyContext, core.FetchOptions{Interval: interval})
+			So(err, ShouldBeNil)
+			So(len(insights), ShouldEqual, 1)
+			So(insights[0].ContentType(), ShouldEqual, ContentType)
+			So(insights[0].Rating(), ShouldEqual, core.BadRating)
+
+			content, ok := insights[0].Content().(*Content)
+			So(ok, ShouldBeTrue)
+			So(content, ShouldResemble, &Content{
+				Domain:              "example.com",
+				Expired:             20,
+				Previous:            10,
+				Interval:            timeutil.TimeInterval{From: baseTime.Add(-time.Hour * 24), To: baseTime},
+				AvgDeferralAttempts: 10,
+			})
+
+			Convey("The domains are not checked again too soon", func() {
+				step(baseTime.Add(time.Minute))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("The same domain is not reported again too soon, but new domains are", func() {
+				expect(baseTime.Add(time.Hour),
+					dashboard.ExpiredDomains{expired("example.com", 30), expired("example.net", 5)},
+					dashboard.ExpiredDomains{expired("example.com", 10)})
+
+				step(baseTime.Add(time.Hour))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+
+			Convey("The same domain is reported again after some time", func() {
+				expect(baseTime.Add(time.Hour*25),
+					dashboard.ExpiredDomains{expired("example.com", 30)},
+					dashboard.ExpiredDomains{expired("example.com", 10)})
+
+				step(baseTime.Add(time.Hour * 25))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package longdeferredinsight warns when the number of messages stuck in the queue,
+// deferred for a long time, is growing.
+package longdeferredinsight
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/i18n/translator"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+// Counter is implemented by the tracker, which knows the messages still in the queue
+type Counter interface {
+	CountDeferredQueuedBefore(ctx context.Context, t time.Time) (int, error)
+}
+
+type Options struct {
+	Counter Counter
+
+	// Only messages deferred and queued for longer than this are counted
+	MinAge time.Duration
+
+	// Fewer messages than this are never reported
+	MinMessages int
+
+	// No new insight is generated before this time
+	MinTimeToGenerateNewInsight time.Duration
+}
+
+const (
+	ContentType   = "long_deferred_messages"
+	ContentTypeId = 12
+
+	// how often the queue is checked
+	checkInterval = time.Hour
+
+	checkKind = "long_deferred_messages_check"
+
+	insightKind = "long_deferred_messages"
+)
+
+func init() {
+	core.RegisterContentType(ContentType, ContentTypeId, core.DefaultContentTypeDecoder(&Content{}))
+}
+
+type Content struct {
+	Count    int `json:"count"`
+	Previous int `json:"previous"`
+
+	// In hours
+	MinAge float64 `json:"min_age"`
+}
+
+func (c Content) Title() notificationCore.ContentComponent {
+	return &title{c}
+}
+
+func (c Content) Description() notificationCore.ContentComponent {
+	return &description{c}
+}
+
+func (c Content) Metadata() notificationCore.ContentMetadata {
+	return nil
+}
+
+type title struct {
+	c Content
+}
+
+func (t title) String() string {
+	return translator.Stringfy(t)
+}
+
+func (title) TplString() string {
+	return translator.I18n("Rising number of messages stuck in the queue")
+}
+
+func (t title) Args() []interface{} {
+	return nil
+}
+
+type description struct {
+	c Content
+}
+
+func (d description) String() string {
+	return translator.Stringfy(d)
+}
+
+func (d description) TplString() string {
+	return translator.I18n("%v messages have been deferred and waiting in the queue for more than %v hours, up from %v in the previous check")
+}
+
+func (d description) Args() []interface{} {
+	return []interface{}{d.c.Count, d.c.MinAge, d.c.Previous}
+}
+
+func (c Content) HelpLink(urlContainer core.URLContainer) string {
+	return urlContainer.Get(ContentType)
+}
+
+type detector struct {
+	options Options
+	creator core.Creator
+
+	// count on the last check, kept only in memory, as the queue state changes constantly
+	previous *int
+}
+
+func (*detector) Close() error {
+	return nil
+}
+
+func NewDetector(creator core.Creator, options core.Options) core.Detector {
+	detectorOptions, ok := options["longdeferred"].(Options)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid detector options"))
+	}
+
+	if detectorOptions.Counter == nil {
+		errorutil.MustSucceed(errors.New("Invalid deferred messages counter"))
+	}
+
+	return &detector{
+		options: detectorOptions,
+		creator: creator,
+	}
+}
+
+func (d *detector) Step(c core.Clock, tx *sql.Tx) error {
+	now := c.Now()
+
+	lastCheck, err := core.RetrieveLastDetectorExecution(tx, checkKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastCheck.IsZero() && now.Sub(lastCheck) < checkInterval {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, checkKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	count, err := d.options.Counter.CountDeferredQueuedBefore(context.Background(), now.Add(-d.options.MinAge))
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	previous := d.previous
+
+	d.previous = &count
+
+	// the first check only sets the base to compare with
+	if previous == nil || count < d.options.MinMessages || count <= *previous {
+		return nil
+	}
+
+	lastReport, err := core.RetrieveLastDetectorExecution(tx, insightKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastReport.IsZero() && now.Sub(lastReport) < d.options.MinTimeToGenerateNewInsight {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, insightKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	content := Content{
+		Count:    count,
+		Previous: *previous,
+		MinAge:   d.options.MinAge.Hours(),
+	}
+
+	if err := generateInsight(tx, c, d.creator, content); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func generateInsight(tx *sql.Tx, c core.Clock, creator core.Creator, content Content) error {
+	properties := core.InsightProperties{
+		Time:        c.Now(),
+		Category:    core.LocalCategory,
+		Rating:      core.BadRating,
+		ContentType: ContentType,
+		Content:     content,
+	}
+
+	if err := creator.GenerateInsight(context.Background(), tx, properties); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package longdeferredinsight
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	_ "gitlab.com/lightmeter/controlcenter/insights/migrations"
+	insighttestsutil "gitlab.com/lightmeter/controlcenter/insights/testutil"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+type fakeCounter struct {
+	count  int
+	before time.Time
+}
+
+func (c *fakeCounter) CountDeferredQueuedBefore(ctx context.Context, before time.Time) (int, error) {
+	c.before = before
+	return c.count, nil
+}
+
+func TestLongDeferredDetectorInsight(t *testing.T) {
+	Convey("Test Insights Generator", t, func() {
+		counter := &fakeCounter{}
+
+		accessor, clear := insighttestsutil.NewFakeAccessor(t)
+		defer clear()
+
+		baseTime := testutil.MustParseTime(`2000-01-01 00:00:00 +0000`)
+
+		detector := NewDetector(accessor, core.Options{"longdeferred": Options{
+			Counter:                     counter,
+			MinAge:                      time.Hour * 6,
+			MinMessages:                 10,
+			MinTimeToGenerateNewInsight: time.Hour * 24,
+		}})
+
+		step := func(now time.Time, count int) {
+			counter.count = count
+			tx, err := accessor.ConnPair.RwConn.Begin()
+			So(err, ShouldBeNil)
+			So(detector.Step(&insighttestsutil.FakeClock{Time: now}, tx), ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		Convey("The first check only counts the messages", func() {
+			step(baseTime, 50)
+			So(counter.before, ShouldEqual, baseTime.Add(-time.Hour*6))
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("Few messages do not generate insights", func() {
+			step(baseTime, 2)
+			step(baseTime.Add(time.Hour), 9)
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("A stable number of messages does not generate insights", func() {
+			step(baseTime, 20)
+			step(baseTime.Add(time.Hour), 20)
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("A rising number of messages is reported", func() {
+			step(baseTime, 5)
+			step(baseTime.Add(time.Hour), 15)
+
+			So(len(accessor.Insights), ShouldEqual, 1)
+
+			interval := timeutil.TimeInterval{From: baseTime, To: baseTime.Add(time.Hour * 2)}
+
+			insights, err := accessor.FetchInsights(dummyContext, core.FetchOptions{Interval: interval})
+			So(err, ShouldBeNil)
+			So(len(insights), ShouldEqual, 1)
+			So(insights[0].ContentType(), ShouldEqual, ContentType)
+			So(insights[0].Rating(), ShouldEqual, core.BadRating)
+
+			content, ok := insights[0].Content().(*Content)
+			So(ok, ShouldBeTrue)
+			So(content, ShouldResemble, &Content{Count: 15, Previous: 5, MinAge: 6})
+
+			Convey("The queue is not checked again too soon", func() {
+				step(baseTime.Add(time.Hour+time.Minute), 100)
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("Not reported again too soon", func() {
+				step(baseTime.Add(time.Hour*2), 30)
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("Reported again after some time", func() {
+				step(baseTime.Add(time.Hour*26), 30)
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+		})
+	})
+}
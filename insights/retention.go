@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package insights
+
+import (
+	"context"
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+// runRetentionAction executes the action in the goroutine that owns the writing access to the database
+func (e *Engine) runRetentionAction(ctx context.Context, action func(*sql.Tx) (int64, error)) (int64, error) {
+	type result struct {
+		value int64
+		err   error
+	}
+
+	resultChan := make(chan result, 1)
+
+	txAction := func(tx *sql.Tx) error {
+		v, err := action(tx)
+		resultChan <- result{value: v, err: err}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+
+	select {
+	case e.txActions <- txAction:
+	case <-ctx.Done():
+		return 0, errorutil.Wrap(ctx.Err())
+	}
+
+	select {
+	case r := <-resultChan:
+		if r.err != nil {
+			return 0, errorutil.Wrap(r.err)
+		}
+
+		return r.value, nil
+	case <-ctx.Done():
+		return 0, errorutil.Wrap(ctx.Err())
+	}
+}
+
+// PurgeBatch removes at most batchSize insights older than `before`, returning how many were removed
+func (e *Engine) PurgeBatch(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	return e.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		const oldestInsights = `select rowid from insights where time < ? order by time, rowid limit ?`
+
+		if _, err := tx.Exec(`delete from insights_status where insight_id in (`+oldestInsights+`)`, before.Unix(), batchSize); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		result, err := tx.Exec(`delete from insights where rowid in (`+oldestInsights+`)`, before.Unix(), batchSize)
+		if err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		return affected, nil
+	})
+}
+
+// CollectGarbageBatch removes the status of insights that do not exist anymore.
+// The table is small enough to be checked at once, therefore there's never more work to do.
+func (e *Engine) CollectGarbageBatch(ctx context.Context, batchSize int) (bool, error) {
+	_, err := e.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		if _, err := tx.Exec(`delete from insights_status where not exists (select 1 from insights where rowid = insight_id)`); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		return 0, nil
+	})
+
+	if err != nil {
+		return false, errorutil.Wrap(err)
+	}
+
+	return false, nil
+}
+
+// IncrementalVacuum returns at most `pages` unused pages to the filesystem, returning how many were freed
+func (e *Engine) IncrementalVacuum(ctx context.Context, pages int) (int, error) {
+	freed, err := e.runRetentionAction(ctx, func(tx *sql.Tx) (int64, error) {
+		freed, err := dbconn.IncrementalVacuum(tx, pages)
+		if err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		return int64(freed), nil
+	})
+
+	if err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	return int(freed), nil
+}
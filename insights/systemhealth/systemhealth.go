@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package systemhealthinsight warns about errors and warnings logged by postfix,
+// which usually point to misconfigurations silently breaking the delivery of messages.
+package systemhealthinsight
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/i18n/translator"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+type Options struct {
+	// How far in the past messages are considered
+	LookupRange time.Duration
+
+	// A warning logged at least this number of times in LookupRange is reported,
+	// even if it has been seen before. Errors are always reported
+	RecurringWarningThreshold int
+
+	// The same message is not reported again before this time
+	MinTimeToGenerateNewInsight time.Duration
+}
+
+const (
+	ContentType   = "system_health"
+	ContentTypeId = 9
+
+	// how often the messages are checked
+	checkInterval = time.Minute * 10
+
+	checkKind = "system_health_check"
+
+	// followed by the severity, daemon and template of each reported message
+	insightKindPrefix = "system_health_message:"
+)
+
+func init() {
+	core.RegisterContentType(ContentType, ContentTypeId, core.DefaultContentTypeDecoder(&Content{}))
+}
+
+type Message struct {
+	Severity    string    `json:"severity"`
+	Daemon      string    `json:"daemon"`
+	Template    string    `json:"template"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastMessage string    `json:"last_message"`
+}
+
+type Content struct {
+	Interval timeutil.TimeInterval `json:"interval"`
+	Errors   []Message             `json:"errors"`
+	Warnings []Message             `json:"warnings"`
+}
+
+func (c Content) Title() notificationCore.ContentComponent {
+	return &title{}
+}
+
+func (c Content) Description() notificationCore.ContentComponent {
+	return &description{c}
+}
+
+func (c Content) Metadata() notificationCore.ContentMetadata {
+	return nil
+}
+
+type title struct{}
+
+func (t title) String() string {
+	return translator.Stringfy(t)
+}
+
+func (title) TplString() string {
+	return translator.I18n("Postfix is reporting problems")
+}
+
+func (title) Args() []interface{} {
+	return nil
+}
+
+type description struct {
+	c Content
+}
+
+func (d description) String() string {
+	return translator.Stringfy(d)
+}
+
+func (d description) TplString() string {
+	return translator.I18n("%v kinds of errors and %v kinds of warnings were logged between %v and %v")
+}
+
+func (d description) Args() []interface{} {
+	return []interface{}{len(d.c.Errors), len(d.c.Warnings), d.c.Interval.From, d.c.Interval.To}
+}
+
+func (c Content) HelpLink(urlContainer core.URLContainer) string {
+	return urlContainer.Get(ContentType)
+}
+
+type detector struct {
+	options   Options
+	creator   core.Creator
+	dashboard dashboard.Dashboard
+}
+
+func (*detector) Close() error {
+	return nil
+}
+
+func NewDetector(creator core.Creator, options core.Options) core.Detector {
+	d, ok := options["dashboard"].(dashboard.Dashboard)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid dashboard"))
+	}
+
+	detectorOptions, ok := options["systemhealth"].(Options)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid detector options"))
+	}
+
+	return &detector{
+		options:   detectorOptions,
+		creator:   creator,
+		dashboard: d,
+	}
+}
+
+func insightKind(m dashboard.SystemMessage) string {
+	return insightKindPrefix + m.Severity + ":" + m.Daemon + ":" + m.Template
+}
+
+// Errors are always worth reporting, but warnings only when they are new or keep happening
+func (d *detector) shouldReport(m dashboard.SystemMessage, interval timeutil.TimeInterval) bool {
+	if m.Severity != parser.SystemMessageWarning.String() {
+		return true
+	}
+
+	return !m.FirstSeen.Before(interval.From) || m.Count >= d.options.RecurringWarningThreshold
+}
+
+func (d *detector) Step(c core.Clock, tx *sql.Tx) error {
+	now := c.Now()
+
+	lastCheck, err := core.RetrieveLastDetectorExecution(tx, checkKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastCheck.IsZero() && now.Sub(lastCheck) < checkInterval {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, checkKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	interval := timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now}
+
+	messages, err := d.dashboard.SystemMessages(context.Background(), interval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	content := Content{Interval: interval, Errors: []Message{}, Warnings: []Message{}}
+
+	for _, m := range messages {
+		if !d.shouldReport(m, interval) {
+			continue
+		}
+
+		lastReport, err := core.RetrieveLastDetectorExecution(tx, insightKind(m))
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		// not to flood the user with insights about an issue that is not fixed yet
+		if !lastReport.IsZero() && now.Sub(lastReport) < d.options.MinTimeToGenerateNewInsight {
+			continue
+		}
+
+		if err := core.StoreLastDetectorExecution(tx, insightKind(m), now); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		message := Message{
+			Severity:    m.Severity,
+			Daemon:      m.Daemon,
+			Template:    m.Template,
+			Count:       m.Count,
+			FirstSeen:   m.FirstSeen,
+			LastMessage: m.LastMessage,
+		}
+
+		if m.Severity == parser.SystemMessageWarning.String() {
+			content.Warnings = append(content.Warnings, message)
+			continue
+		}
+
+		content.Errors = append(content.Errors, message)
+	}
+
+	if len(content.Errors) == 0 && len(content.Warnings) == 0 {
+		return nil
+	}
+
+	if err := generateInsight(tx, c, d.creator, content); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func generateInsight(tx *sql.Tx, c core.Clock, creator core.Creator, content Content) error {
+	rating := core.BadRating
+
+	if len(content.Errors) == 0 {
+		rating = core.OkRating
+	}
+
+	properties := core.InsightProperties{
+		Time:        c.Now(),
+		Category:    core.LocalCategory,
+		Rating:      rating,
+		ContentType: ContentType,
+		Content:     content,
+	}
+
+	if err := creator.GenerateInsight(context.Background(), tx, properties); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
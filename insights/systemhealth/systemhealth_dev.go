@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// +build dev !release
+
+package systemhealthinsight
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+)
+
+// Executed only on development builds, for better developer experience
+func (d *detector) GenerateSampleInsight(tx *sql.Tx, c core.Clock) error {
+	now := c.Now()
+
+	if err := generateInsight(tx, c, d.creator, Content{
+		Interval: timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now},
+		Errors: []Message{{
+			Severity:    "fatal",
+			Daemon:      "smtpd",
+			Template:    "open database <path>: No such file or directory",
+			Count:       12,
+			FirstSeen:   now.Add(-d.options.LookupRange / 2),
+			LastMessage: "open database /etc/postfix/virtual.db: No such file or directory",
+		}},
+		Warnings: []Message{{
+			Severity:    "warning",
+			Daemon:      "trivial-rewrite",
+			Template:    "database <path> is older than source file <path>",
+			Count:       3,
+			FirstSeen:   now.Add(-d.options.LookupRange / 2),
+			LastMessage: "database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual",
+		}},
+	}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
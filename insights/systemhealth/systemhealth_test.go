@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package systemhealthinsight
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	mock_dashboard "gitlab.com/lightmeter/controlcenter/dashboard/mock"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	_ "gitlab.com/lightmeter/controlcenter/insights/migrations"
+	insighttestsutil "gitlab.com/lightmeter/controlcenter/insights/testutil"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func TestSystemHealthDetectorInsight(t *testing.T) {
+	Convey("Test Insights Generator", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		d := mock_dashboard.NewMockDashboard(ctrl)
+
+		accessor, clear := insighttestsutil.NewFakeAccessor(t)
+		defer clear()
+
+		baseTime := testutil.MustParseTime(`2000-01-01 00:00:00 +0000`)
+
+		detector := NewDetector(accessor, core.Options{"dashboard": d, "systemhealth": Options{
+			LookupRange:                 time.Hour,
+			RecurringWarningThreshold:   10,
+			MinTimeToGenerateNewInsight: time.Hour * 6,
+		}})
+
+		step := func(now time.Time) {
+			tx, err := accessor.ConnPair.RwConn.Begin()
+			So(err, ShouldBeNil)
+			So(detector.Step(&insighttestsutil.FakeClock{Time: now}, tx), ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		expect := func(now time.Time, messages dashboard.SystemMessages) {
+			interval := timeutil.TimeInterval{From: now.Add(-time.Hour), To: now}
+			d.EXPECT().SystemMessages(gomock.Any(), interval).Return(messages, nil)
+		}
+
+		fatal := dashboard.SystemMessage{
+			Severity:    "fatal",
+			Daemon:      "smtpd",
+			Template:    "open database <path>: No such file or directory",
+			Count:       2,
+			FirstSeen:   baseTime.Add(-time.Minute * 30),
+			LastSeen:    baseTime.Add(-time.Minute),
+			LastMessage: "open database /etc/postfix/virtual.db: No such file or directory",
+		}
+
+		oldWarning := dashboard.SystemMessage{
+			Severity:    "warning",
+			Daemon:      "smtpd",
+			Template:    "hostname <host> does not resolve to address <ip>",
+			Count:       3,
+			FirstSeen:   baseTime.Add(-time.Hour * 24 * 10),
+			LastSeen:    baseTime.Add(-time.Minute),
+			LastMessage: "hostname mx.example.com does not resolve to address 11.22.33.44",
+		}
+
+		Convey("Old warnings that do not happen often do not generate insights", func() {
+			expect(baseTime, dashboard.SystemMessages{oldWarning})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("Errors, new warnings and recurring warnings", func() {
+			newWarning := dashboard.SystemMessage{
+				Severity:    "warning",
+				Daemon:      "trivial-rewrite",
+				Template:    "database <path> is older than source file <path>",
+				Count:       1,
+				FirstSeen:   baseTime.Add(-time.Minute * 10),
+				LastSeen:    baseTime.Add(-time.Minute * 10),
+				LastMessage: "database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual",
+			}
+
+			recurringWarning := oldWarning
+			recurringWarning.Count = 20
+
+			expect(baseTime, dashboard.SystemMessages{fatal, newWarning, recurringWarning})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 1)
+
+			interval := timeutil.TimeInterval{From: baseTime.Add(-time.Hour), To: baseTime}
+
+			insights, err := accessor.FetchInsights(dummyContext, core.FetchOptions{Interval: interval})
+			So(err, ShouldBeNil)
+			So(len(insights), ShouldEqual, 1)
+			So(insights[0].ContentType(), ShouldEqual, ContentType)
+			So(insights[0].Rating(), ShouldEqual, core.BadRating)
+
+			content, ok := insights[0].Content().(*Content)
+			So(ok, ShouldBeTrue)
+			So(content.Interval, ShouldResemble, interval)
+			So(len(content.Errors), ShouldEqual, 1)
+			So(content.Errors[0].Template, ShouldEqual, fatal.Template)
+			So(content.Errors[0].Count, ShouldEqual, 2)
+			So(len(content.Warnings), ShouldEqual, 2)
+			So(content.Warnings[0].Daemon, ShouldEqual, "trivial-rewrite")
+			So(content.Warnings[1].Count, ShouldEqual, 20)
+
+			Convey("The messages are not checked again too soon", func() {
+				step(baseTime.Add(time.Minute))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("Already reported messages are not reported again too soon", func() {
+				expect(baseTime.Add(time.Hour), dashboard.SystemMessages{fatal, recurringWarning})
+				step(baseTime.Add(time.Hour))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("A new error is reported, even after a recent insight", func() {
+				panicMessage := dashboard.SystemMessage{
+					Severity:    "panic",
+					Daemon:      "qmgr",
+					Template:    "myfree: corrupt or unallocated memory block",
+					Count:       1,
+					FirstSeen:   baseTime.Add(time.Minute * 50),
+					LastSeen:    baseTime.Add(time.Minute * 50),
+					LastMessage: "myfree: corrupt or unallocated memory block",
+				}
+
+				expect(baseTime.Add(time.Hour), dashboard.SystemMessages{panicMessage, fatal})
+				step(baseTime.Add(time.Hour))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+
+			Convey("The same error is reported again after some time", func() {
+				expect(baseTime.Add(time.Hour*7), dashboard.SystemMessages{fatal})
+				step(baseTime.Add(time.Hour * 7))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+		})
+	})
+}
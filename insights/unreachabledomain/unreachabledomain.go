@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package unreachabledomaininsight warns when none of the MXs of a recipient domain
+// can be reached for some time, long before the queued messages expire and bounce.
+package unreachabledomaininsight
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	"gitlab.com/lightmeter/controlcenter/i18n/translator"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	notificationCore "gitlab.com/lightmeter/controlcenter/notification/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+type Options struct {
+	// How far in the past deliveries are considered
+	LookupRange time.Duration
+
+	// For how long the domain must have been failing before it's reported
+	MinUnreachableTime time.Duration
+
+	// The same domain is not reported again before this time
+	MinTimeToGenerateNewInsight time.Duration
+}
+
+const (
+	ContentType   = "unreachable_domain"
+	ContentTypeId = 10
+
+	// how often the domains are checked
+	checkInterval = time.Minute * 10
+
+	checkKind = "unreachable_domain_check"
+
+	// followed by the reported domain
+	insightKindPrefix = "unreachable_domain:"
+)
+
+func init() {
+	core.RegisterContentType(ContentType, ContentTypeId, core.DefaultContentTypeDecoder(&Content{}))
+}
+
+type Content struct {
+	Domain       string    `json:"domain"`
+	Deferred     int       `json:"deferred"`
+	FirstFailure time.Time `json:"first_failure"`
+	LastFailure  time.Time `json:"last_failure"`
+}
+
+func (c Content) Title() notificationCore.ContentComponent {
+	return &title{c}
+}
+
+func (c Content) Description() notificationCore.ContentComponent {
+	return &description{c}
+}
+
+func (c Content) Metadata() notificationCore.ContentMetadata {
+	return nil
+}
+
+type title struct {
+	c Content
+}
+
+func (t title) String() string {
+	return translator.Stringfy(t)
+}
+
+func (title) TplString() string {
+	return translator.I18n("Mail servers of %v are unreachable")
+}
+
+func (t title) Args() []interface{} {
+	return []interface{}{t.c.Domain}
+}
+
+type description struct {
+	c Content
+}
+
+func (d description) String() string {
+	return translator.Stringfy(d)
+}
+
+func (d description) TplString() string {
+	return translator.I18n("%v messages to %v were deferred due to network failures between %v and %v, and none could be delivered")
+}
+
+func (d description) Args() []interface{} {
+	return []interface{}{d.c.Deferred, d.c.Domain, d.c.FirstFailure, d.c.LastFailure}
+}
+
+func (c Content) HelpLink(urlContainer core.URLContainer) string {
+	return urlContainer.Get(ContentType)
+}
+
+type detector struct {
+	options   Options
+	creator   core.Creator
+	dashboard dashboard.Dashboard
+}
+
+func (*detector) Close() error {
+	return nil
+}
+
+func NewDetector(creator core.Creator, options core.Options) core.Detector {
+	d, ok := options["dashboard"].(dashboard.Dashboard)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid dashboard"))
+	}
+
+	detectorOptions, ok := options["unreachabledomain"].(Options)
+
+	if !ok {
+		errorutil.MustSucceed(errors.New("Invalid detector options"))
+	}
+
+	return &detector{
+		options:   detectorOptions,
+		creator:   creator,
+		dashboard: d,
+	}
+}
+
+func (d *detector) Step(c core.Clock, tx *sql.Tx) error {
+	now := c.Now()
+
+	lastCheck, err := core.RetrieveLastDetectorExecution(tx, checkKind)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if !lastCheck.IsZero() && now.Sub(lastCheck) < checkInterval {
+		return nil
+	}
+
+	if err := core.StoreLastDetectorExecution(tx, checkKind, now); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	interval := timeutil.TimeInterval{From: now.Add(-d.options.LookupRange), To: now}
+
+	domains, err := d.dashboard.UnreachableDomains(context.Background(), interval)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	for _, domain := range domains {
+		// a few failures in a row are usual, as the remote server being restarted
+		if domain.LastFailure.Sub(domain.FirstFailure) < d.options.MinUnreachableTime {
+			continue
+		}
+
+		kind := insightKindPrefix + domain.Domain
+
+		lastReport, err := core.RetrieveLastDetectorExecution(tx, kind)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if !lastReport.IsZero() && now.Sub(lastReport) < d.options.MinTimeToGenerateNewInsight {
+			continue
+		}
+
+		if err := core.StoreLastDetectorExecution(tx, kind, now); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		content := Content{
+			Domain:       domain.Domain,
+			Deferred:     domain.Deferred,
+			FirstFailure: domain.FirstFailure,
+			LastFailure:  domain.LastFailure,
+		}
+
+		if err := generateInsight(tx, c, d.creator, content); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func generateInsight(tx *sql.Tx, c core.Clock, creator core.Creator, content Content) error {
+	properties := core.InsightProperties{
+		Time:        c.Now(),
+		Category:    core.LocalCategory,
+		Rating:      core.BadRating,
+		ContentType: ContentType,
+		Content:     content,
+	}
+
+	if err := creator.GenerateInsight(context.Background(), tx, properties); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
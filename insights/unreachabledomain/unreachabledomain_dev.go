@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// +build dev !release
+
+package unreachabledomaininsight
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+// Executed only on development builds, for better developer experience
+func (d *detector) GenerateSampleInsight(tx *sql.Tx, c core.Clock) error {
+	now := c.Now()
+
+	if err := generateInsight(tx, c, d.creator, Content{
+		Domain:       "example.com",
+		Deferred:     42,
+		FirstFailure: now.Add(-d.options.LookupRange),
+		LastFailure:  now,
+	}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
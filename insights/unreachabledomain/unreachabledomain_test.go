@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package unreachabledomaininsight
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/dashboard"
+	mock_dashboard "gitlab.com/lightmeter/controlcenter/dashboard/mock"
+	"gitlab.com/lightmeter/controlcenter/insights/core"
+	_ "gitlab.com/lightmeter/controlcenter/insights/migrations"
+	insighttestsutil "gitlab.com/lightmeter/controlcenter/insights/testutil"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func TestUnreachableDomainDetectorInsight(t *testing.T) {
+	Convey("Test Insights Generator", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		d := mock_dashboard.NewMockDashboard(ctrl)
+
+		accessor, clear := insighttestsutil.NewFakeAccessor(t)
+		defer clear()
+
+		baseTime := testutil.MustParseTime(`2000-01-01 00:00:00 +0000`)
+
+		detector := NewDetector(accessor, core.Options{"dashboard": d, "unreachabledomain": Options{
+			LookupRange:                 time.Hour * 6,
+			MinUnreachableTime:          time.Hour,
+			MinTimeToGenerateNewInsight: time.Hour * 24,
+		}})
+
+		step := func(now time.Time) {
+			tx, err := accessor.ConnPair.RwConn.Begin()
+			So(err, ShouldBeNil)
+			So(detector.Step(&insighttestsutil.FakeClock{Time: now}, tx), ShouldBeNil)
+			So(tx.Commit(), ShouldBeNil)
+		}
+
+		expect := func(now time.Time, domains dashboard.UnreachableDomains) {
+			interval := timeutil.TimeInterval{From: now.Add(-time.Hour * 6), To: now}
+			d.EXPECT().UnreachableDomains(gomock.Any(), interval).Return(domains, nil)
+		}
+
+		unreachable := dashboard.UnreachableDomain{
+			Domain:       "example.com",
+			Deferred:     5,
+			FirstFailure: baseTime.Add(-time.Hour * 2),
+			LastFailure:  baseTime.Add(-time.Minute),
+		}
+
+		Convey("Domains failing only for a short time do not generate insights", func() {
+			expect(baseTime, dashboard.UnreachableDomains{{
+				Domain:       "example.org",
+				Deferred:     2,
+				FirstFailure: baseTime.Add(-time.Minute * 20),
+				LastFailure:  baseTime.Add(-time.Minute),
+			}})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 0)
+		})
+
+		Convey("A domain unreachable for long is reported", func() {
+			expect(baseTime, dashboard.UnreachableDomains{unreachable})
+
+			step(baseTime)
+
+			So(len(accessor.Insights), ShouldEqual, 1)
+
+			interval := timeutil.TimeInterval{From: baseTime.Add(-time.Hour), To: baseTime}
+
+			insights, err := accessor.FetchInsights(dummyContext, core.FetchOptions{Interval: interval})
+			So(err, ShouldBeNil)
+			So(len(insights), ShouldEqual, 1)
+			So(insights[0].ContentType(), ShouldEqual, ContentType)
+			So(insights[0].Rating(), ShouldEqual, core.BadRating)
+
+			content, ok := insights[0].Content().(*Content)
+			So(ok, ShouldBeTrue)
+			So(content, ShouldResemble, &Content{
+				Domain:       "example.com",
+				Deferred:     5,
+				FirstFailure: unreachable.FirstFailure,
+				LastFailure:  unreachable.LastFailure,
+			})
+
+			Convey("The domains are not checked again too soon", func() {
+				step(baseTime.Add(time.Minute))
+				So(len(accessor.Insights), ShouldEqual, 1)
+			})
+
+			Convey("The same domain is not reported again too soon, but other domains are", func() {
+				other := unreachable
+				other.Domain = "example.net"
+
+				expect(baseTime.Add(time.Hour), dashboard.UnreachableDomains{unreachable, other})
+				step(baseTime.Add(time.Hour))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+
+			Convey("The same domain is reported again after some time", func() {
+				expect(baseTime.Add(time.Hour*25), dashboard.UnreachableDomains{unreachable})
+				step(baseTime.Add(time.Hour * 25))
+				So(len(accessor.Insights), ShouldEqual, 2)
+			})
+		})
+	})
+}
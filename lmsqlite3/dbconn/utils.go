@@ -90,7 +90,9 @@ type PooledPair struct {
 }
 
 func Open(filename string, poolSize int) (*PooledPair, error) {
-	writer, err := sql.Open("lm_sqlite3", `file:`+filename+`?mode=rwc&cache=private&_loc=auto&_journal=WAL&_sync=OFF&_mutex=no`)
+	// NOTE: auto_vacuum can only be changed on new databases, before any table is created.
+	// Databases created by older versions keep not having it, and incremental vacuum is a no-op on them.
+	writer, err := sql.Open("lm_sqlite3", `file:`+filename+`?mode=rwc&cache=private&_loc=auto&_journal=WAL&_sync=OFF&_mutex=no&_auto_vacuum=incremental`)
 
 	if err != nil {
 		return nil, errorutil.Wrap(err)
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+// IncrementalVacuum returns up to `pages` free pages to the filesystem, returning how many were freed.
+// It's a no-op on databases not created with auto_vacuum=incremental.
+//nolint:rowserrcheck
+func IncrementalVacuum(tx *sql.Tx, pages int) (int, error) {
+	// the pragma frees one page per step, so all the returned rows must be consumed
+	rows, err := tx.Query(fmt.Sprintf(`pragma incremental_vacuum(%d)`, pages))
+	if err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(rows.Close()) }()
+
+	freed := 0
+
+	for rows.Next() {
+		freed++
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	return freed, nil
+}
@@ -0,0 +1,604 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package logarchive keeps the log lines exactly as they have been read,
+// compressed and partitioned by time, so that the original evidence of what happened
+// to a message is still available after the log files are rotated and deleted.
+package logarchive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	_ "gitlab.com/lightmeter/controlcenter/logarchive/migrations"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	directoryName    = "logarchive"
+	databaseFilename = "logarchive.db"
+
+	partitionDuration = time.Hour
+	partitionLayout   = "2006-01-02T15"
+	partitionSuffix   = ".log.gz"
+
+	// how many queue partitions are indexed in a single transaction
+	maxPendingQueuePartitions = 1000
+
+	maxLineSize = 1024 * 1024
+)
+
+// MaxRawLines protects against queue ids reused over time, which can be in lots of partitions
+const MaxRawLines = 10000
+
+type Options struct {
+	// For how long the lines are kept, relative to the most recent archived one. Zero means forever
+	Retention time.Duration
+}
+
+var DefaultOptions = Options{
+	Retention: 90 * 24 * time.Hour,
+}
+
+type RawLines struct {
+	Queues []string `json:"queues"`
+
+	// As found in the logs, in the order they have been archived
+	Lines []string `json:"lines"`
+
+	// Whether there are more than MaxRawLines lines
+	Truncated bool `json:"truncated"`
+}
+
+type Fetcher interface {
+	// RawLines returns the archived lines about the given queues
+	RawLines(ctx context.Context, queues []string) (RawLines, error)
+}
+
+type queuePartition struct {
+	queue     string
+	partition int64
+}
+
+// Each time a partition is written, a new file is created for it, as appending to
+// a file left incomplete, when the application is not shutdown cleanly, would make it unreadable
+type partitionWriter struct {
+	partition time.Time
+	file      *os.File
+	writer    *gzip.Writer
+}
+
+type Archive struct {
+	dir      string
+	connPair *dbconn.PooledPair
+	options  Options
+
+	insertQueuePartition   *sql.Stmt
+	deletePartitionsBefore *sql.Stmt
+
+	mutex           sync.Mutex
+	current         *partitionWriter
+	newestPartition time.Time
+	pending         map[queuePartition]struct{}
+}
+
+func New(workspaceDir string, options Options) (archive *Archive, err error) {
+	dir := path.Join(workspaceDir, directoryName)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errorutil.Wrap(err, "Error creating log archive directory ", dir)
+	}
+
+	connPair, err := dbconn.Open(path.Join(workspaceDir, databaseFilename), 2)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			errorutil.MustSucceed(connPair.Close(), "Closing connection on error")
+		}
+	}()
+
+	if err := migrator.Run(connPair.RwConn.DB, "logarchive"); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	//nolint:sqlclosecheck
+	insertQueuePartition, err := connPair.RwConn.Prepare(`insert or ignore into queue_partitions(queue, partition) values(?, ?)`)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	connPair.Closers.Add(insertQueuePartition)
+
+	//nolint:sqlclosecheck
+	deletePartitionsBefore, err := connPair.RwConn.Prepare(`delete from queue_partitions where partition < ?`)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	connPair.Closers.Add(deletePartitionsBefore)
+
+	if err := connPair.RoConnPool.ForEach(func(db *dbconn.RoPooledConn) error {
+		//nolint:sqlclosecheck
+		stmt, err := db.Prepare(`select partition from queue_partitions where queue = ?`)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		db.Closers.Add(stmt)
+
+		db.Stmts["queuePartitions"] = stmt
+
+		return nil
+	}); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	files, err := partitionFiles(dir)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	archive = &Archive{
+		dir:                    dir,
+		connPair:               connPair,
+		options:                options,
+		insertQueuePartition:   insertQueuePartition,
+		deletePartitionsBefore: deletePartitionsBefore,
+		pending:                map[queuePartition]struct{}{},
+	}
+
+	for _, f := range files {
+		if f.partition.After(archive.newestPartition) {
+			archive.newestPartition = f.partition
+		}
+	}
+
+	return archive, nil
+}
+
+func (a *Archive) Close() error {
+	a.mutex.Lock()
+
+	defer a.mutex.Unlock()
+
+	if err := a.closeCurrent(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if err := a.connPair.Close(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+type publisher struct {
+	archive *Archive
+}
+
+func (p publisher) Publish(r postfix.Record) {
+	if err := p.archive.archive(r); err != nil {
+		errorutil.LogErrorf(err, "Archiving log line on %v", r.Location)
+	}
+}
+
+func (a *Archive) Publisher() postfix.Publisher {
+	return publisher{archive: a}
+}
+
+func (a *Archive) archive(r postfix.Record) error {
+	if len(r.RawLine) == 0 {
+		return nil
+	}
+
+	partition := r.Time.In(time.UTC).Truncate(partitionDuration)
+
+	a.mutex.Lock()
+
+	defer a.mutex.Unlock()
+
+	// when old logs are imported, there's no reason to archive what would be removed right away
+	if a.options.Retention != 0 && partition.Before(a.newestPartition.Add(-a.options.Retention)) {
+		return nil
+	}
+
+	if a.current == nil || !a.current.partition.Equal(partition) {
+		if err := a.switchPartition(partition); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	if _, err := a.current.writer.Write(r.RawLine); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if _, err := a.current.writer.Write([]byte{'\n'}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if queue := queueOfLine(r.RawLine); len(queue) > 0 {
+		a.pending[queuePartition{queue: queue, partition: partition.Unix()}] = struct{}{}
+	}
+
+	if len(a.pending) < maxPendingQueuePartitions {
+		return nil
+	}
+
+	if err := a.flush(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func (a *Archive) switchPartition(partition time.Time) error {
+	if err := a.closeCurrent(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	w, err := createPartitionWriter(a.dir, partition)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	a.current = w
+
+	if !partition.After(a.newestPartition) {
+		return nil
+	}
+
+	a.newestPartition = partition
+
+	if err := a.applyRetention(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func createPartitionWriter(dir string, partition time.Time) (*partitionWriter, error) {
+	for i := 0; ; i++ {
+		filename := path.Join(dir, fmt.Sprintf("%s.%d%s", partition.Format(partitionLayout), i, partitionSuffix))
+
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		return &partitionWriter{partition: partition, file: f, writer: gzip.NewWriter(f)}, nil
+	}
+}
+
+// the lines must reach the files before the index points to them
+func (a *Archive) flush() error {
+	if a.current != nil {
+		if err := a.current.writer.Flush(); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	return a.indexPending()
+}
+
+func (a *Archive) closeCurrent() error {
+	if a.current != nil {
+		if err := a.current.writer.Close(); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := a.current.file.Close(); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		a.current = nil
+	}
+
+	return a.indexPending()
+}
+
+func (a *Archive) indexPending() error {
+	if len(a.pending) == 0 {
+		return nil
+	}
+
+	if err := a.connPair.RwConn.Tx(func(tx *sql.Tx) error {
+		stmt := tx.Stmt(a.insertQueuePartition)
+
+		for k := range a.pending {
+			if _, err := stmt.Exec(k.queue, k.partition); err != nil {
+				return errorutil.Wrap(err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	a.pending = map[queuePartition]struct{}{}
+
+	return nil
+}
+
+// Removes the partitions older than the retention period, according to the time of the logs
+// instead of the current time, as otherwise importing old logs would remove them as they are archived
+func (a *Archive) applyRetention() error {
+	if a.options.Retention == 0 {
+		return nil
+	}
+
+	before := a.newestPartition.Add(-a.options.Retention)
+
+	files, err := partitionFiles(a.dir)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	for _, f := range files {
+		if !f.partition.Before(before) {
+			continue
+		}
+
+		if err := os.Remove(path.Join(a.dir, f.name)); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	if err := a.indexPending(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if _, err := a.deletePartitionsBefore.Exec(before.Unix()); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+type partitionFile struct {
+	name      string
+	partition time.Time
+	index     int
+}
+
+// partitionFiles returns the files in the archive, sorted by partition and by the order they were created
+func partitionFiles(dir string) ([]partitionFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	files := []partitionFile{}
+
+	for _, e := range entries {
+		// in the form 2006-01-02T15.0.log.gz
+		parts := strings.SplitN(strings.TrimSuffix(e.Name(), partitionSuffix), ".", 2)
+
+		if e.IsDir() || !strings.HasSuffix(e.Name(), partitionSuffix) || len(parts) != 2 {
+			continue
+		}
+
+		partition, err := time.ParseInLocation(partitionLayout, parts[0], time.UTC)
+		if err != nil {
+			continue
+		}
+
+		index, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+
+		files = append(files, partitionFile{name: e.Name(), partition: partition, index: index})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].partition.Equal(files[j].partition) {
+			return files[i].index < files[j].index
+		}
+
+		return files[i].partition.Before(files[j].partition)
+	})
+
+	return files, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+}
+
+// queueOfLine returns the queue a postfix line is about, which comes right after the process,
+// as in `mail postfix/smtp[9710]: 4AA091855DA0: to=<...>`, or an empty string
+// for the lines about no queue, as connections and warnings
+func queueOfLine(line []byte) string {
+	i := bytes.Index(line, []byte("]: "))
+	if i == -1 {
+		return ""
+	}
+
+	rest := line[i+len("]: "):]
+
+	end := bytes.IndexByte(rest, ':')
+	if end <= 0 {
+		return ""
+	}
+
+	for _, c := range rest[:end] {
+		if !isHexDigit(c) {
+			return ""
+		}
+	}
+
+	return string(rest[:end])
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func (a *Archive) partitionsOfQueues(ctx context.Context, queues []string) ([]time.Time, error) {
+	conn, release := a.connPair.RoConnPool.Acquire()
+
+	defer release()
+
+	found := map[int64]struct{}{}
+
+	for _, queue := range queues {
+		if err := func() error {
+			rows, err := conn.Stmts["queuePartitions"].QueryContext(ctx, queue)
+			if err != nil {
+				return errorutil.Wrap(err)
+			}
+
+			defer func() { errorutil.MustSucceed(rows.Close()) }()
+
+			for rows.Next() {
+				var partition int64
+
+				if err := rows.Scan(&partition); err != nil {
+					return errorutil.Wrap(err)
+				}
+
+				found[partition] = struct{}{}
+			}
+
+			if err := rows.Err(); err != nil {
+				return errorutil.Wrap(err)
+			}
+
+			return nil
+		}(); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
+	partitions := make([]time.Time, 0, len(found))
+
+	for p := range found {
+		partitions = append(partitions, time.Unix(p, 0).In(time.UTC))
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Before(partitions[j]) })
+
+	return partitions, nil
+}
+
+func (a *Archive) RawLines(ctx context.Context, queues []string) (RawLines, error) {
+	// makes the lines not yet flushed available for reading
+	if err := func() error {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		return a.flush()
+	}(); err != nil {
+		return RawLines{}, errorutil.Wrap(err)
+	}
+
+	partitions, err := a.partitionsOfQueues(ctx, queues)
+	if err != nil {
+		return RawLines{}, errorutil.Wrap(err)
+	}
+
+	files, err := partitionFiles(a.dir)
+	if err != nil {
+		return RawLines{}, errorutil.Wrap(err)
+	}
+
+	wanted := map[string]struct{}{}
+
+	for _, q := range queues {
+		wanted[q] = struct{}{}
+	}
+
+	result := RawLines{Queues: queues, Lines: []string{}}
+
+	for _, f := range files {
+		// both are sorted
+		i := sort.Search(len(partitions), func(i int) bool { return !partitions[i].Before(f.partition) })
+
+		if i == len(partitions) || !partitions[i].Equal(f.partition) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return RawLines{}, errorutil.Wrap(err)
+		}
+
+		if err := readLinesFromFile(path.Join(a.dir, f.name), wanted, &result); err != nil {
+			return RawLines{}, errorutil.Wrap(err, "file: ", f.name)
+		}
+
+		if result.Truncated {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func readLinesFromFile(filename string, wanted map[string]struct{}, result *RawLines) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(f.Close()) }()
+
+	reader, err := gzip.NewReader(f)
+
+	// nothing written to it yet
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		if _, ok := wanted[queueOfLine(scanner.Bytes())]; !ok {
+			continue
+		}
+
+		if len(result.Lines) == MaxRawLines {
+			result.Truncated = true
+			return nil
+		}
+
+		result.Lines = append(result.Lines, scanner.Text())
+	}
+
+	// the file is still being written, or was left incomplete by a crash,
+	// in both cases having all the lines flushed so far readable
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package logarchive
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/logeater/transform"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func readFromTestFile(name string, pub postfix.Publisher) {
+	f, err := os.Open(name)
+	So(err, ShouldBeNil)
+
+	defer f.Close()
+
+	builder, err := transform.Get("default", 2020)
+	So(err, ShouldBeNil)
+
+	So(transform.ReadFromReader(f, pub, builder), ShouldBeNil)
+}
+
+func record(ts, line string) postfix.Record {
+	return postfix.Record{Time: testutil.MustParseTime(ts), RawLine: []byte(line)}
+}
+
+func archivedFiles(dir string) []string {
+	files, err := partitionFiles(path.Join(dir, directoryName))
+	So(err, ShouldBeNil)
+
+	names := []string{}
+
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+
+	return names
+}
+
+func TestQueueOfLine(t *testing.T) {
+	Convey("Queue of a line", t, func() {
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/qmgr[1005]: 4AA091855DA0: removed`)), ShouldEqual, "4AA091855DA0")
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/submission/smtpd[9708]: 4AA091855DA0: client=some.domain.name[1.2.3.4]`)), ShouldEqual, "4AA091855DA0")
+		So(queueOfLine([]byte(`{"message": "postfix/qmgr[1005]: 4AA091855DA0: removed", "host": "mail"}`)), ShouldEqual, "4AA091855DA0")
+
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/smtpd[9715]: connect from localhost[127.0.0.1]`)), ShouldEqual, "")
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/smtpd[9715]: warning: hostname does not resolve`)), ShouldEqual, "")
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/smtpd[9715]: NOQUEUE: reject: RCPT from unknown[1.2.3.4]`)), ShouldEqual, "")
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail postfix/smtp[9890]: Trusted TLS connection established to mx.example.com[11.22.33.44]:25`)), ShouldEqual, "")
+		So(queueOfLine([]byte(`Jun  3 10:40:57 mail dovecot: lmtp(9956): Connect from local`)), ShouldEqual, "")
+	})
+}
+
+func TestLogArchive(t *testing.T) {
+	Convey("Log archive", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		ctx := context.Background()
+
+		Convey("Lines of queues, as in the original logs", func() {
+			archive, err := New(dir, DefaultOptions)
+			So(err, ShouldBeNil)
+
+			readFromTestFile("../tracking/test_files/1_bounce_simple.log", archive.Publisher())
+
+			// readable before being closed
+			lines, err := archive.RawLines(ctx, []string{"776E41855DB2"})
+			So(err, ShouldBeNil)
+			So(lines.Truncated, ShouldBeFalse)
+			So(lines.Queues, ShouldResemble, []string{"776E41855DB2"})
+			So(lines.Lines, ShouldResemble, []string{
+				`Jun  3 10:40:57 mail postfix/smtpd[9715]: 776E41855DB2: client=localhost[127.0.0.1]`,
+				`Jun  3 10:40:57 mail postfix/cleanup[9716]: 776E41855DB2: message-id=<ca10035e-2951-bfd5-ec7e-1a5773fce1cd@mail.sender.com>`,
+				`Jun  3 10:40:57 mail postfix/qmgr[1005]: 776E41855DB2: from=<user@sender.com>, size=1111, nrcpt=1 (queue active)`,
+				`Jun  3 10:40:59 mail postfix/smtp[9890]: 776E41855DB2: to=<invalid.email@example.com>, relay=mx.example.com[11.22.33.44]:25, delay=1.9, delays=0/0/1.5/0.37, dsn=5.1.1, status=bounced (host mx.example.com[11.22.33.44] said: 550 5.1.1 <invalid.email@example.com> User unknown (in reply to RCPT TO command))`,
+				`Jun  3 10:40:59 mail postfix/bounce[9719]: 776E41855DB2: sender non-delivery notification: A48191855DA0`,
+				`Jun  3 10:40:59 mail postfix/qmgr[1005]: 776E41855DB2: removed`,
+			})
+
+			lines, err = archive.RawLines(ctx, []string{"4AA091855DA0", "A48191855DA0"})
+			So(err, ShouldBeNil)
+			So(lines.Lines, ShouldHaveLength, 11)
+
+			lines, err = archive.RawLines(ctx, []string{"BBBBBBBBBB"})
+			So(err, ShouldBeNil)
+			So(lines.Lines, ShouldBeEmpty)
+
+			So(archive.Close(), ShouldBeNil)
+
+			Convey("Still there after reopening the archive, which writes to new files", func() {
+				archive, err := New(dir, DefaultOptions)
+				So(err, ShouldBeNil)
+
+				defer func() { So(archive.Close(), ShouldBeNil) }()
+
+				archive.Publisher().Publish(record(`2020-06-03 10:50:00 +0000`, `Jun  3 10:50:00 mail postfix/qmgr[1005]: 776E41855DB2: removed`))
+
+				lines, err := archive.RawLines(ctx, []string{"776E41855DB2"})
+				So(err, ShouldBeNil)
+				So(lines.Lines, ShouldHaveLength, 7)
+				So(lines.Lines[6], ShouldEqual, `Jun  3 10:50:00 mail postfix/qmgr[1005]: 776E41855DB2: removed`)
+
+				So(archivedFiles(dir), ShouldResemble, []string{"2020-06-03T10.0.log.gz", "2020-06-03T10.1.log.gz"})
+			})
+		})
+
+		Convey("Old partitions are removed, according to the time of the logs", func() {
+			archive, err := New(dir, Options{Retention: 2 * time.Hour})
+			So(err, ShouldBeNil)
+
+			defer func() { So(archive.Close(), ShouldBeNil) }()
+
+			pub := archive.Publisher()
+
+			pub.Publish(record(`2020-01-01 10:10:00 +0000`, `Jan  1 10:10:00 mail postfix/qmgr[1]: AAAAAAAAAA: removed`))
+			pub.Publish(record(`2020-01-01 11:10:00 +0000`, `Jan  1 11:10:00 mail postfix/qmgr[1]: BBBBBBBBBB: removed`))
+			pub.Publish(record(`2020-01-01 12:10:00 +0000`, `Jan  1 12:10:00 mail postfix/qmgr[1]: CCCCCCCCCC: removed`))
+
+			So(archivedFiles(dir), ShouldResemble, []string{"2020-01-01T10.0.log.gz", "2020-01-01T11.0.log.gz", "2020-01-01T12.0.log.gz"})
+
+			pub.Publish(record(`2020-01-01 13:10:00 +0000`, `Jan  1 13:10:00 mail postfix/qmgr[1]: AAAAAAAAAA: removed`))
+
+			So(archivedFiles(dir), ShouldResemble, []string{"2020-01-01T11.0.log.gz", "2020-01-01T12.0.log.gz", "2020-01-01T13.0.log.gz"})
+
+			lines, err := archive.RawLines(ctx, []string{"AAAAAAAAAA", "BBBBBBBBBB"})
+			So(err, ShouldBeNil)
+			So(lines.Lines, ShouldResemble, []string{
+				`Jan  1 11:10:00 mail postfix/qmgr[1]: BBBBBBBBBB: removed`,
+				`Jan  1 13:10:00 mail postfix/qmgr[1]: AAAAAAAAAA: removed`,
+			})
+
+			// too old to be archived
+			pub.Publish(record(`2020-01-01 09:10:00 +0000`, `Jan  1 09:10:00 mail postfix/qmgr[1]: AAAAAAAAAA: removed`))
+
+			So(archivedFiles(dir), ShouldResemble, []string{"2020-01-01T11.0.log.gz", "2020-01-01T12.0.log.gz", "2020-01-01T13.0.log.gz"})
+
+			conn, release := archive.connPair.RoConnPool.Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from queue_partitions`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+	})
+}
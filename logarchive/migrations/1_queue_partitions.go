@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logarchive", "1_queue_partitions.go", upQueuePartitions, downQueuePartitions)
+}
+
+// In which partitions of the archive the lines of each queue are, as unix timestamps of their beginning
+func upQueuePartitions(tx *sql.Tx) error {
+	sql := `
+	create table queue_partitions(
+		queue text not null,
+		partition integer not null,
+		unique(queue, partition)
+	);
+
+	create index queue_partitions_partition_index on queue_partitions(partition);
+	`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downQueuePartitions(tx *sql.Tx) error {
+	if _, err := tx.Exec(`drop table queue_partitions`); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
@@ -67,16 +67,18 @@ type localFileWatcher struct {
 	filename string
 }
 
-func (w *localFileWatcher) run(onNewRecord func(parser.Header, parser.Payload)) {
+func (w *localFileWatcher) run(onNewRecord func(parser.Header, parser.Payload, []byte)) {
 	for line := range w.t.Lines {
-		h, p, err := parser.Parse([]byte(line.Text))
+		rawLine := []byte(line.Text)
+
+		h, p, err := parser.Parse(rawLine)
 
 		if !parser.IsRecoverableError(err) {
 			log.Error().Msgf("parsing line on file: %v", w.filename)
 			continue
 		}
 
-		onNewRecord(h, p)
+		onNewRecord(h, p, rawLine)
 	}
 }
 
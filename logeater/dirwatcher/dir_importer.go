@@ -428,7 +428,8 @@ type fileReadSeeker interface {
 }
 
 type fileWatcher interface {
-	run(onNewRecord func(parser.Header, parser.Payload))
+	// the line passed to onNewRecord might be reused once it returns
+	run(onNewRecord func(parser.Header, parser.Payload, []byte))
 }
 
 type DirectoryContent interface {
@@ -745,7 +746,9 @@ func updateQueueProcessor(p *queueProcessor, content DirectoryContent, progressN
 		}
 
 		// Successfully read
-		header, payload, err := parser.Parse(scanner.Bytes())
+		line := scanner.Bytes()
+
+		header, payload, err := parser.Parse(line)
 
 		if !parser.IsRecoverableError(err) {
 			log.Warn().Msgf("Could not parse log line in %v", loc)
@@ -769,6 +772,8 @@ func updateQueueProcessor(p *queueProcessor, content DirectoryContent, progressN
 			Payload:  payload,
 			Time:     convertedTime,
 			Location: loc,
+			// the scanner reuses its buffer on the next line
+			RawLine: append([]byte(nil), line...),
 		}
 
 		return true, nil
@@ -965,6 +970,8 @@ type parsedRecord struct {
 	sequence   uint64
 
 	loc postfix.RecordLocation
+
+	line []byte
 }
 
 // responsible for watching for new logs added to a file
@@ -983,12 +990,13 @@ func startWatchingOnQueue(
 
 	sequence := uint64(0)
 
-	watcher.run(func(h parser.Header, p parser.Payload) {
+	watcher.run(func(h parser.Header, p parser.Payload, line []byte) {
 		record := parsedRecord{
 			header:     h,
 			payload:    p,
 			queueIndex: queueIndex,
 			sequence:   sequence,
+			line:       append([]byte(nil), line...),
 		}
 
 		outChan <- record
@@ -1087,7 +1095,7 @@ func publishNewLogsSorted(sortableRecordsChan <-chan sortableRecord, pub newLogs
 	flushHeap := func() {
 		for h.Len() > 0 {
 			s := heap.Pop(&h).(sortableRecord)
-			r := postfix.Record{Header: s.record.header, Payload: s.record.payload, Time: s.time, Location: s.record.loc}
+			r := postfix.Record{Header: s.record.header, Payload: s.record.payload, Time: s.time, Location: s.record.loc, RawLine: s.record.line}
 			pub.Publish(r)
 		}
 	}
@@ -22,7 +22,7 @@ import (
 
 func readFromReader(reader io.Reader,
 	filename string,
-	onNewRecord func(parser.Header, parser.Payload)) {
+	onNewRecord func(parser.Header, parser.Payload, []byte)) {
 	scanner := bufio.NewScanner(reader)
 
 	for scanner.Scan() {
@@ -31,7 +31,7 @@ func readFromReader(reader io.Reader,
 		h, p, err := parser.Parse(line)
 
 		if parser.IsRecoverableError(err) {
-			onNewRecord(h, p)
+			onNewRecord(h, p, line)
 		}
 	}
 }
@@ -225,7 +225,7 @@ type fakeFileWatcher struct {
 	reader   io.Reader
 }
 
-func (f fakeFileWatcher) run(onNewRecord func(parser.Header, parser.Payload)) {
+func (f fakeFileWatcher) run(onNewRecord func(parser.Header, parser.Payload, []byte)) {
 	readFromReader(f.reader, f.filename, onNewRecord)
 }
 
@@ -998,6 +998,11 @@ Aug 12 00:00:00 mail dovecot: Useless Payload`),
 			So(pub.logs[4].Time, ShouldEqual, testutil.MustParseTime(`2020-08-10 00:00:40 +0000`))
 			So(pub.logs[5].Header.Time, ShouldResemble, parser.Time{Month: time.August, Day: 12, Hour: 0, Minute: 0, Second: 0})
 			So(pub.logs[5].Time, ShouldEqual, testutil.MustParseTime(`2020-08-12 00:00:00 +0000`))
+
+			// both imported and watched lines are kept as read
+			So(string(pub.logs[0].RawLine), ShouldEqual, `Jun 18 08:29:33 mail dovecot: Useless Payload`)
+			So(string(pub.logs[4].RawLine), ShouldEqual, `Aug 10 00:00:40 mail postfix/postscreen[17274]: Useless Payload`)
+			So(string(pub.logs[5].RawLine), ShouldEqual, `Aug 12 00:00:00 mail dovecot: Useless Payload`)
 		})
 	})
 }
@@ -20,7 +20,7 @@ type rsyncedFileWatcher struct {
 
 type rsyncedFileWatcherRunner = runner.CancelableRunner
 
-func newRsyncedFileWatcherRunner(watcher *rsyncedFileWatcher, onRecord func(parser.Header, parser.Payload)) rsyncedFileWatcherRunner {
+func newRsyncedFileWatcherRunner(watcher *rsyncedFileWatcher, onRecord func(parser.Header, parser.Payload, []byte)) rsyncedFileWatcherRunner {
 	rw := rsyncwatcher.ReadWriter()
 
 	w, err := rsyncwatcher.New(watcher.filename, watcher.offset, rw)
@@ -46,7 +46,7 @@ func newRsyncedFileWatcherRunner(watcher *rsyncedFileWatcher, onRecord func(pars
 					continue
 				}
 
-				onRecord(h, p)
+				onRecord(h, p, line)
 			}
 
 			if err := scanner.Err(); err != nil {
@@ -59,7 +59,7 @@ func newRsyncedFileWatcherRunner(watcher *rsyncedFileWatcher, onRecord func(pars
 	})
 }
 
-func (watcher *rsyncedFileWatcher) run(onRecord func(parser.Header, parser.Payload)) {
+func (watcher *rsyncedFileWatcher) run(onRecord func(parser.Header, parser.Payload, []byte)) {
 	done, _ := newRsyncedFileWatcherRunner(watcher, onRecord).Run()
 
 	// never cancel, wait forever, no error handling
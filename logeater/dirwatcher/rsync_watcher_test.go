@@ -32,7 +32,7 @@ func TestWatchingDirectoryManagedByRsync(t *testing.T) {
 		logs := []parsedLog{}
 
 		newRunner := func(filename string, offset int64) rsyncedFileWatcherRunner {
-			return newRsyncedFileWatcherRunner(&rsyncedFileWatcher{filename: path.Join(dstDir, filename), offset: offset}, func(h parser.Header, p parser.Payload) {
+			return newRsyncedFileWatcherRunner(&rsyncedFileWatcher{filename: path.Join(dstDir, filename), offset: offset}, func(h parser.Header, p parser.Payload, _ []byte) {
 				logs = append(logs, parsedLog{h: h, p: p})
 			})
 		}
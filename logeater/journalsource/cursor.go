@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package journalsource
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/meta"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"strconv"
+	"strings"
+)
+
+// CursorStorage keeps the cursor of the last entry read from the journal,
+// so a restart resumes where it stopped
+type CursorStorage interface {
+	// returns an empty cursor if there's none stored
+	Cursor(context.Context) (string, error)
+	StoreCursor(context.Context, string) error
+}
+
+const cursorKey = "journal_cursor"
+
+type metaCursorStorage struct {
+	writer *meta.AsyncWriter
+	reader *meta.Reader
+}
+
+func NewMetaCursorStorage(writer *meta.AsyncWriter, reader *meta.Reader) CursorStorage {
+	return &metaCursorStorage{writer: writer, reader: reader}
+}
+
+func (s *metaCursorStorage) Cursor(ctx context.Context) (string, error) {
+	var cursor string
+
+	err := s.reader.RetrieveJson(ctx, cursorKey, &cursor)
+
+	if err != nil && errors.Is(err, meta.ErrNoSuchKey) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", errorutil.Wrap(err)
+	}
+
+	return cursor, nil
+}
+
+func (s *metaCursorStorage) StoreCursor(ctx context.Context, cursor string) error {
+	if err := s.writer.StoreJsonSync(ctx, cursorKey, cursor); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// The parts of a cursor needed to know whether an entry comes before it.
+// A cursor looks like `s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;b=6c7c6013a8094dd3bbc4b5c9d7c2e3e8;m=...;t=5b6b6a1c3d0b2;x=...`,
+// where `s` identifies the sequence of `i` (the entry number) and `t` is the realtime timestamp, all in hex.
+type parsedCursor struct {
+	seqnumID string
+	seqnum   uint64
+	realtime uint64
+}
+
+func parseCursor(c string) (parsedCursor, bool) {
+	var (
+		p               parsedCursor
+		hasSeq, hasTime bool
+	)
+
+	for _, part := range strings.Split(c, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "s":
+			p.seqnumID = kv[1]
+		case "i":
+			v, err := strconv.ParseUint(kv[1], 16, 64)
+			if err != nil {
+				return parsedCursor{}, false
+			}
+
+			p.seqnum, hasSeq = v, true
+		case "t":
+			v, err := strconv.ParseUint(kv[1], 16, 64)
+			if err != nil {
+				return parsedCursor{}, false
+			}
+
+			p.realtime, hasTime = v, true
+		}
+	}
+
+	return p, hasSeq && hasTime && len(p.seqnumID) > 0
+}
+
+// alreadyRead tells whether an entry with the given cursor and realtime timestamp (in microseconds)
+// was read before the entry with cursor `last`
+func (last parsedCursor) alreadyRead(cursor string, realtime uint64) bool {
+	if c, ok := parseCursor(cursor); ok && c.seqnumID == last.seqnumID {
+		return c.seqnum <= last.seqnum
+	}
+
+	return realtime <= last.realtime
+}
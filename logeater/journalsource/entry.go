@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package journalsource
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+)
+
+// Entry is a journal entry, with its fields and their (first) value
+type Entry map[string][]byte
+
+type entryReader interface {
+	// returns io.EOF when there are no more entries
+	ReadEntry() (Entry, error)
+}
+
+var ErrInvalidEntry = errors.New("Invalid journal entry")
+
+// newEntryReader detects whether the journal is in the export or JSON format
+// by looking at its first non blank character
+func newEntryReader(r io.Reader) (entryReader, error) {
+	reader := bufio.NewReader(r)
+
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if b[0] == ' ' || b[0] == '\n' || b[0] == '\r' || b[0] == '\t' {
+			if _, err := reader.ReadByte(); err != nil {
+				return nil, errorutil.Wrap(err)
+			}
+
+			continue
+		}
+
+		if b[0] == '{' {
+			return &jsonEntryReader{decoder: json.NewDecoder(reader)}, nil
+		}
+
+		return &exportEntryReader{reader: reader}, nil
+	}
+}
+
+// Reads the format generated by `journalctl -o export`, described at
+// https://systemd.io/JOURNAL_EXPORT_FORMATS/
+type exportEntryReader struct {
+	reader *bufio.Reader
+}
+
+func (r *exportEntryReader) ReadEntry() (Entry, error) {
+	entry := Entry{}
+
+	for {
+		line, err := r.reader.ReadBytes('\n')
+
+		if err != nil && errors.Is(err, io.EOF) && len(line) == 0 {
+			if len(entry) > 0 {
+				return entry, nil
+			}
+
+			return nil, io.EOF
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errorutil.Wrap(err)
+		}
+
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		// an empty line ends the entry
+		if len(line) == 0 {
+			if len(entry) > 0 {
+				return entry, nil
+			}
+
+			continue
+		}
+
+		if index := bytes.IndexByte(line, '='); index != -1 {
+			entry[string(line[:index])] = line[index+1:]
+			continue
+		}
+
+		// binary field: the name is followed by the size of the value, as a little endian 64 bit integer,
+		// the value itself and a new line
+		value, err := r.readBinaryValue()
+		if err != nil {
+			return nil, fmt.Errorf("Field %s: %w", line, err)
+		}
+
+		entry[string(line)] = value
+	}
+}
+
+func (r *exportEntryReader) readBinaryValue() ([]byte, error) {
+	var size uint64
+
+	if err := binary.Read(r.reader, binary.LittleEndian, &size); err != nil {
+		return nil, ErrInvalidEntry
+	}
+
+	value := make([]byte, size+1)
+
+	if _, err := io.ReadFull(r.reader, value); err != nil {
+		return nil, ErrInvalidEntry
+	}
+
+	if value[size] != '\n' {
+		return nil, ErrInvalidEntry
+	}
+
+	return value[:size], nil
+}
+
+// Reads the format generated by `journalctl -o json`, one object per entry.
+// Values are strings, arrays of bytes for binary values, or arrays of those
+// when a field has more than one value. Fields too large are null.
+type jsonEntryReader struct {
+	decoder *json.Decoder
+}
+
+func (r *jsonEntryReader) ReadEntry() (Entry, error) {
+	var raw map[string]json.RawMessage
+
+	if err := r.decoder.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+
+		return nil, errorutil.Wrap(err)
+	}
+
+	entry := Entry{}
+
+	for k, v := range raw {
+		value, ok := decodeJSONValue(v)
+		if ok {
+			entry[k] = value
+		}
+	}
+
+	return entry, nil
+}
+
+func decodeJSONValue(v json.RawMessage) ([]byte, bool) {
+	// unmarshalling null into a string succeeds, leaving it untouched
+	if bytes.Equal(v, []byte("null")) {
+		return nil, false
+	}
+
+	var s string
+
+	if err := json.Unmarshal(v, &s); err == nil {
+		return []byte(s), true
+	}
+
+	// a json array of numbers cannot be unmarshalled directly into a []byte,
+	// which expects base64
+	var numbers []uint16
+
+	if err := json.Unmarshal(v, &numbers); err == nil {
+		b := make([]byte, 0, len(numbers))
+
+		for _, n := range numbers {
+			b = append(b, byte(n))
+		}
+
+		return b, true
+	}
+
+	var values []json.RawMessage
+
+	if err := json.Unmarshal(v, &values); err == nil && len(values) > 0 {
+		return decodeJSONValue(values[0])
+	}
+
+	return nil, false
+}
@@ -0,0 +1,302 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package journalsource reads Postfix logs from systemd-journald, in the export
+// (`journalctl -o export`) or JSON (`journalctl -o json`) formats.
+package journalsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
+	"gitlab.com/lightmeter/controlcenter/logeater/transform"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often the cursor is stored while reading
+const cursorStoreInterval = time.Second
+
+// syslog facility used by Postfix
+const mailFacility = "2"
+
+type Source struct {
+	announcer announcer.ImportAnnouncer
+	cursors   CursorStorage
+
+	// returns io.EOF when there's nothing else to read
+	next func() (io.ReadCloser, error)
+
+	listener net.Listener
+
+	lastCursor    parsedCursor
+	hasLastCursor bool
+
+	pendingCursor  string
+	lastCursorSave time.Time
+
+	entriesCounter uint64
+}
+
+func newSource(next func() (io.ReadCloser, error), cursors CursorStorage, announcer announcer.ImportAnnouncer) (*Source, error) {
+	cursor, err := cursors.Cursor(context.Background())
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	s := &Source{
+		announcer: announcer,
+		cursors:   cursors,
+		next:      next,
+	}
+
+	if len(cursor) == 0 {
+		return s, nil
+	}
+
+	parsed, ok := parseCursor(cursor)
+	if !ok {
+		log.Warn().Msgf("Ignoring invalid stored journal cursor: %v", cursor)
+		return s, nil
+	}
+
+	log.Info().Msgf("Resuming reading the journal after the cursor %s. Entries before it will be skipped", cursor)
+
+	s.lastCursor, s.hasLastCursor = parsed, true
+
+	return s, nil
+}
+
+// New reads the journal from a file or stdin
+func New(reader io.Reader, cursors CursorStorage, announcer announcer.ImportAnnouncer) (*Source, error) {
+	read := false
+
+	return newSource(func() (io.ReadCloser, error) {
+		if read {
+			return nil, io.EOF
+		}
+
+		read = true
+
+		return ioutil.NopCloser(reader), nil
+	}, cursors, announcer)
+}
+
+// NewFromSocket reads the journal from the connections to a socket, one after the other.
+// socketDesc has the same format used by the socketsource package, "unix=/path/to/socket_file" or "tcp=:9999"
+func NewFromSocket(socketDesc string, cursors CursorStorage, announcer announcer.ImportAnnouncer) (*Source, error) {
+	c := strings.Split(socketDesc, "=")
+
+	if len(c) != 2 {
+		return nil, fmt.Errorf(`Invalid socket description: %v. It should have the form "unix=/path/to/socket_file" or "tcp=:9999"`, socketDesc)
+	}
+
+	network, address := c[0], c[1]
+
+	if network == "unix" {
+		if err := os.RemoveAll(address); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	s, err := newSource(func() (io.ReadCloser, error) {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		return conn, nil
+	}, cursors, announcer)
+
+	if err != nil {
+		errorutil.MustSucceed(l.Close())
+		return nil, errorutil.Wrap(err)
+	}
+
+	s.listener = l
+
+	return s, nil
+}
+
+func (s *Source) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+
+	if err := s.listener.Close(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *Source) PublishLogs(p postfix.Publisher) error {
+	announcer.Skip(s.announcer)
+
+	for {
+		reader, err := s.next()
+
+		if err != nil && errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		err = s.publishFromReader(reader, p)
+
+		errorutil.MustSucceed(reader.Close())
+
+		if storeErr := s.storePendingCursor(); storeErr != nil {
+			return errorutil.Wrap(storeErr)
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+}
+
+func (s *Source) publishFromReader(reader io.Reader, p postfix.Publisher) error {
+	entries, err := newEntryReader(reader)
+
+	// empty input
+	if err != nil && errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	for {
+		entry, err := entries.ReadEntry()
+
+		if err != nil && errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if err := s.handleEntry(entry, p); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+}
+
+func (s *Source) handleEntry(entry Entry, p postfix.Publisher) error {
+	realtime, err := strconv.ParseUint(string(entry["__REALTIME_TIMESTAMP"]), 10, 64)
+	if err != nil {
+		log.Warn().Msgf("Ignoring journal entry without a valid __REALTIME_TIMESTAMP: %v", entry["__CURSOR"])
+		return nil
+	}
+
+	cursor := string(entry["__CURSOR"])
+
+	if s.hasLastCursor && s.lastCursor.alreadyRead(cursor, realtime) {
+		return nil
+	}
+
+	s.entriesCounter++
+
+	if r, ok := buildRecord(entry, realtime, s.entriesCounter); ok {
+		p.Publish(r)
+	}
+
+	if len(cursor) == 0 {
+		return nil
+	}
+
+	s.pendingCursor = cursor
+
+	if time.Since(s.lastCursorSave) < cursorStoreInterval {
+		return nil
+	}
+
+	return s.storePendingCursor()
+}
+
+func (s *Source) storePendingCursor() error {
+	if len(s.pendingCursor) == 0 {
+		return nil
+	}
+
+	if err := s.cursors.StoreCursor(context.Background(), s.pendingCursor); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	s.pendingCursor = ""
+	s.lastCursorSave = time.Now()
+
+	return nil
+}
+
+func firstField(entry Entry, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := entry[k]; ok && len(v) > 0 {
+			return string(v)
+		}
+	}
+
+	return ""
+}
+
+// buildRecord builds the syslog line for the entry and parses it,
+// but using the real timestamp of the entry, not the one in the header
+func buildRecord(entry Entry, realtime uint64, counter uint64) (postfix.Record, bool) {
+	message, ok := entry["MESSAGE"]
+	if !ok {
+		return postfix.Record{}, false
+	}
+
+	if facility, ok := entry["SYSLOG_FACILITY"]; ok && string(facility) != mailFacility {
+		return postfix.Record{}, false
+	}
+
+	t := time.Unix(0, int64(realtime)*int64(time.Microsecond)).In(time.UTC)
+
+	host := firstField(entry, "_HOSTNAME")
+	if len(host) == 0 {
+		host = "localhost"
+	}
+
+	process := firstField(entry, "SYSLOG_IDENTIFIER", "_COMM")
+
+	if pid := firstField(entry, "SYSLOG_PID", "_PID"); len(pid) > 0 {
+		process += "[" + pid + "]"
+	}
+
+	line := fmt.Sprintf("%s %s %s: %s", t.Format(time.Stamp), host, process, message)
+
+	loc := postfix.RecordLocation{
+		Line:     counter,
+		Filename: "journal",
+	}
+
+	r, err := transform.ParseLine([]byte(line), func(parser.Header) time.Time { return t }, loc)
+	if err != nil {
+		log.Err(err).Msgf("Error parsing journal entry: %v", line)
+		return postfix.Record{}, false
+	}
+
+	return r, true
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package journalsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakePublisher struct {
+	records []postfix.Record
+}
+
+func (p *fakePublisher) Publish(r postfix.Record) {
+	p.records = append(p.records, r)
+}
+
+type fakeCursorStorage struct {
+	cursor string
+}
+
+func (s *fakeCursorStorage) Cursor(context.Context) (string, error) {
+	return s.cursor, nil
+}
+
+func (s *fakeCursorStorage) StoreCursor(_ context.Context, c string) error {
+	s.cursor = c
+	return nil
+}
+
+type fakeAnnouncer struct{}
+
+func (fakeAnnouncer) AnnounceStart(time.Time)             {}
+func (fakeAnnouncer) AnnounceProgress(announcer.Progress) {}
+
+const (
+	cursor1 = `s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;b=6c7c6013a8094dd3bbc4b5c9d7c2e3e8;m=1c2b0d8e;t=5b6b6a1c3d0b2;x=b1a5f4c9e4b7c7a1`
+	cursor2 = `s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece8;b=6c7c6013a8094dd3bbc4b5c9d7c2e3e8;m=1c2b0d8f;t=5b6b6a1c3d0b3;x=b1a5f4c9e4b7c7a2`
+	cursor3 = `s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece9;b=6c7c6013a8094dd3bbc4b5c9d7c2e3e8;m=1c2b0d90;t=5b6b6a1c3d0b4;x=b1a5f4c9e4b7c7a3`
+)
+
+func exportEntry(fields ...string) string {
+	return strings.Join(fields, "\n") + "\n\n"
+}
+
+func binaryField(name, value string) string {
+	var b bytes.Buffer
+
+	b.WriteString(name + "\n")
+	So(binary.Write(&b, binary.LittleEndian, uint64(len(value))), ShouldBeNil)
+	b.WriteString(value)
+
+	return b.String()
+}
+
+func TestJournalSource(t *testing.T) {
+	Convey("Journal Source", t, func() {
+		// 2021-03-06 06:09:00.798 UTC
+		const realtime = "1615010940798000"
+
+		expectedTime := testutil.MustParseTime(`2021-03-06 06:09:00 +0000`).Add(798 * time.Millisecond)
+
+		export := exportEntry(
+			"__CURSOR="+cursor1,
+			"__REALTIME_TIMESTAMP="+realtime,
+			"_HOSTNAME=mail",
+			"SYSLOG_FACILITY=2",
+			"SYSLOG_IDENTIFIER=postfix/qmgr",
+			"_PID=28829",
+			"MESSAGE=A1E1E1880093: removed",
+		) + exportEntry(
+			"__CURSOR="+cursor2,
+			"__REALTIME_TIMESTAMP="+realtime,
+			"_HOSTNAME=mail",
+			"SYSLOG_FACILITY=4",
+			"SYSLOG_IDENTIFIER=sshd",
+			"_PID=1234",
+			"MESSAGE=Accepted publickey for root",
+		) + exportEntry(
+			"__CURSOR="+cursor3,
+			"__REALTIME_TIMESTAMP="+realtime,
+			"_HOSTNAME=mail",
+			"SYSLOG_FACILITY=2",
+			"SYSLOG_IDENTIFIER=postfix/smtp",
+			"_PID=2000",
+			binaryField("MESSAGE", "B2A2F1880093: to=<recipient@example.com>, relay=mx.example.com[11.22.33.44]:25, delay=0.5, delays=0.1/0/0.2/0.2, dsn=2.0.0, status=sent (250 OK)\nwith a new line"),
+		)
+
+		pub := &fakePublisher{}
+		cursors := &fakeCursorStorage{}
+
+		Convey("Export format", func() {
+			s, err := New(strings.NewReader(export), cursors, fakeAnnouncer{})
+			So(err, ShouldBeNil)
+			So(s.PublishLogs(pub), ShouldBeNil)
+
+			// the sshd entry is ignored
+			So(len(pub.records), ShouldEqual, 2)
+
+			So(pub.records[0].Time, ShouldEqual, expectedTime)
+			So(pub.records[0].Header.Host, ShouldEqual, "mail")
+			So(pub.records[0].Header.Process, ShouldEqual, "postfix")
+			So(pub.records[0].Header.Daemon, ShouldEqual, "qmgr")
+			So(pub.records[0].Header.PID, ShouldEqual, 28829)
+			So(pub.records[0].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+			So(pub.records[0].Location, ShouldResemble, postfix.RecordLocation{Line: 1, Filename: "journal"})
+
+			sent, ok := pub.records[1].Payload.(parser.SmtpSentStatus)
+			So(ok, ShouldBeTrue)
+			So(sent.Queue, ShouldEqual, "B2A2F1880093")
+			So(sent.Status, ShouldEqual, parser.SentStatus)
+
+			So(cursors.cursor, ShouldEqual, cursor3)
+
+			Convey("Restarting resumes after the stored cursor", func() {
+				pub := &fakePublisher{}
+
+				more := export + exportEntry(
+					"__CURSOR=s=739ad463348b4ceca5a9e69c95a3c93f;i=4ecea;b=6c7c6013a8094dd3bbc4b5c9d7c2e3e8;m=1c2b0d91;t=5b6b6a1c3d0b5;x=b1a5f4c9e4b7c7a4",
+					"__REALTIME_TIMESTAMP="+realtime,
+					"_HOSTNAME=mail",
+					"SYSLOG_IDENTIFIER=postfix/qmgr",
+					"_PID=28829",
+					"MESSAGE=B2A2F1880093: removed",
+				)
+
+				s, err := New(strings.NewReader(more), cursors, fakeAnnouncer{})
+				So(err, ShouldBeNil)
+				So(s.PublishLogs(pub), ShouldBeNil)
+
+				So(len(pub.records), ShouldEqual, 1)
+				So(pub.records[0].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "B2A2F1880093"})
+			})
+		})
+
+		Convey("JSON format", func() {
+			json := `{"__CURSOR":"` + cursor1 + `","__REALTIME_TIMESTAMP":"` + realtime + `","_HOSTNAME":"mail","SYSLOG_IDENTIFIER":"postfix/qmgr","_PID":["28829","28830"],"MESSAGE":"A1E1E1880093: removed"}
+{"__CURSOR":"` + cursor2 + `","__REALTIME_TIMESTAMP":"` + realtime + `","_HOSTNAME":"mail","SYSLOG_IDENTIFIER":"postfix/qmgr","SYSLOG_PID":"28829","MESSAGE":[66,50,65,50,70,49,56,56,48,48,57,51,58,32,114,101,109,111,118,101,100]}
+{"__CURSOR":"` + cursor3 + `","__REALTIME_TIMESTAMP":"` + realtime + `","_HOSTNAME":"mail","SYSLOG_IDENTIFIER":"postfix/qmgr","MESSAGE":null}
+`
+
+			s, err := New(strings.NewReader(json), cursors, fakeAnnouncer{})
+			So(err, ShouldBeNil)
+			So(s.PublishLogs(pub), ShouldBeNil)
+
+			So(len(pub.records), ShouldEqual, 2)
+			So(pub.records[0].Time, ShouldEqual, expectedTime)
+			So(pub.records[0].Header.PID, ShouldEqual, 28829)
+			So(pub.records[0].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+			So(pub.records[1].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "B2A2F1880093"})
+			So(cursors.cursor, ShouldEqual, cursor3)
+		})
+
+		Convey("Invalid binary field", func() {
+			s, err := New(strings.NewReader("MESSAGE\n\x10\x00"), cursors, fakeAnnouncer{})
+			So(err, ShouldBeNil)
+			So(s.PublishLogs(pub), ShouldNotBeNil)
+		})
+
+		Convey("Empty input", func() {
+			s, err := New(strings.NewReader(""), cursors, fakeAnnouncer{})
+			So(err, ShouldBeNil)
+			So(s.PublishLogs(pub), ShouldBeNil)
+			So(len(pub.records), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestCursor(t *testing.T) {
+	Convey("Cursor", t, func() {
+		last, ok := parseCursor(cursor2)
+		So(ok, ShouldBeTrue)
+
+		_, ok = parseCursor("invalid")
+		So(ok, ShouldBeFalse)
+
+		Convey("Same sequence, compare by entry number", func() {
+			So(last.alreadyRead(cursor1, 0), ShouldBeTrue)
+			So(last.alreadyRead(cursor2, 0), ShouldBeTrue)
+			So(last.alreadyRead(cursor3, 0), ShouldBeFalse)
+		})
+
+		Convey("Other sequence, compare by time", func() {
+			other := `s=0000;i=1;b=1;m=1;t=1;x=1`
+			So(last.alreadyRead(other, 0x5b6b6a1c3d0b3), ShouldBeTrue)
+			So(last.alreadyRead(other, 0x5b6b6a1c3d0b4), ShouldBeFalse)
+		})
+	})
+}
@@ -113,6 +113,7 @@ Aug 22 05:03:04 mail apple: Useless Payload
 				},
 				Location: postfix.RecordLocation{Line: 1, Filename: "unknown"},
 				Payload:  nil,
+				RawLine:  []byte(`Aug 21 02:03:04 mail banana: Useless Payload`),
 			})
 		})
 	})
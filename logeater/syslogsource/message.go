@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package syslogsource
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Message is a syslog message, without the syslog envelope
+type Message struct {
+	Time     time.Time
+	Hostname string
+	AppName  string
+	ProcID   string
+	Content  []byte
+}
+
+var ErrInvalidMessage = errors.New("Invalid syslog message")
+
+// rfc3164TimeLayout is the timestamp in the BSD syslog protocol, which has no year
+const rfc3164TimeLayout = time.Stamp
+
+// ParseMessage parses a message in the RFC 5424 format, or the older RFC 3164 (BSD syslog).
+// As RFC 3164 timestamps have no year nor time zone, they are assumed to be in the time zone `loc`,
+// and in the year that makes them closest to `now`.
+func ParseMessage(b []byte, now time.Time, loc *time.Location) (Message, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+
+	rest, err := skipPriority(b)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if len(rest) >= 2 && rest[0] == '1' && rest[1] == ' ' {
+		return parseRFC5424(rest[2:])
+	}
+
+	return parseRFC3164(rest, now, loc)
+}
+
+// <PRI>, where PRI has from one to three digits
+func skipPriority(b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != '<' {
+		return nil, ErrInvalidMessage
+	}
+
+	end := bytes.IndexByte(b, '>')
+	if end < 2 || end > 4 {
+		return nil, ErrInvalidMessage
+	}
+
+	if _, err := strconv.Atoi(string(b[1:end])); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	return b[end+1:], nil
+}
+
+// splits the first space separated field
+func nextField(b []byte) ([]byte, []byte, bool) {
+	index := bytes.IndexByte(b, ' ')
+	if index == -1 {
+		return nil, nil, false
+	}
+
+	return b[:index], b[index+1:], true
+}
+
+func nilValue(b []byte) string {
+	if string(b) == "-" {
+		return ""
+	}
+
+	return string(b)
+}
+
+// VERSION (already consumed) SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+func parseRFC5424(b []byte) (Message, error) {
+	fields := make([][]byte, 5)
+
+	for i := range fields {
+		f, rest, ok := nextField(b)
+		if !ok {
+			return Message{}, ErrInvalidMessage
+		}
+
+		fields[i], b = f, rest
+	}
+
+	// a message without timestamp is useless for us
+	t, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return Message{}, ErrInvalidMessage
+	}
+
+	content, err := skipStructuredData(b)
+	if err != nil {
+		return Message{}, err
+	}
+
+	// the message might be prefixed by an UTF-8 BOM
+	content = bytes.TrimPrefix(content, []byte("\xEF\xBB\xBF"))
+
+	return Message{
+		Time:     t,
+		Hostname: nilValue(fields[1]),
+		AppName:  nilValue(fields[2]),
+		ProcID:   nilValue(fields[3]),
+		Content:  content,
+	}, nil
+}
+
+// structured data is either `-` or a sequence of elements like `[id param="value"]`,
+// where values can have escaped `"`, `\` and `]`
+func skipStructuredData(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	if b[0] == '-' {
+		return bytes.TrimPrefix(b[1:], []byte(" ")), nil
+	}
+
+	i := 0
+
+	for i < len(b) && b[i] == '[' {
+		inValue := false
+
+		for i++; ; i++ {
+			if i >= len(b) {
+				return nil, ErrInvalidMessage
+			}
+
+			if inValue && b[i] == '\\' {
+				i++
+				continue
+			}
+
+			if b[i] == '"' {
+				inValue = !inValue
+				continue
+			}
+
+			if !inValue && b[i] == ']' {
+				i++
+				break
+			}
+		}
+	}
+
+	if i == 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	return bytes.TrimPrefix(b[i:], []byte(" ")), nil
+}
+
+// TIMESTAMP SP HOSTNAME SP TAG[PID]: MSG
+// Some senders, like rsyslog with the RSYSLOG_ForwardFormat template, use RFC 3339 timestamps instead.
+func parseRFC3164(b []byte, now time.Time, loc *time.Location) (Message, error) {
+	t, rest, err := parseRFC3164Time(b, now, loc)
+	if err != nil {
+		return Message{}, err
+	}
+
+	hostname, rest, ok := nextField(rest)
+	if !ok {
+		return Message{}, ErrInvalidMessage
+	}
+
+	colon := bytes.Index(rest, []byte(": "))
+	if colon == -1 {
+		return Message{}, ErrInvalidMessage
+	}
+
+	tag, content := rest[:colon], rest[colon+2:]
+
+	appName, procID := tag, []byte{}
+
+	if open := bytes.IndexByte(tag, '['); open != -1 && tag[len(tag)-1] == ']' {
+		appName, procID = tag[:open], tag[open+1:len(tag)-1]
+	}
+
+	return Message{
+		Time:     t,
+		Hostname: string(hostname),
+		AppName:  string(appName),
+		ProcID:   string(procID),
+		Content:  content,
+	}, nil
+}
+
+func parseRFC3164Time(b []byte, now time.Time, loc *time.Location) (time.Time, []byte, error) {
+	if f, rest, ok := nextField(b); ok {
+		if t, err := time.Parse(time.RFC3339Nano, string(f)); err == nil {
+			return t, rest, nil
+		}
+	}
+
+	if len(b) < len(rfc3164TimeLayout)+1 {
+		return time.Time{}, nil, ErrInvalidMessage
+	}
+
+	t, err := time.ParseInLocation(rfc3164TimeLayout, string(b[:len(rfc3164TimeLayout)]), loc)
+	if err != nil {
+		return time.Time{}, nil, ErrInvalidMessage
+	}
+
+	return guessYear(t, now.In(loc)), b[len(rfc3164TimeLayout)+1:], nil
+}
+
+// guessYear assumes messages are not from the future, but allows some clock skew between the hosts
+func guessYear(t time.Time, now time.Time) time.Time {
+	withYear := func(year int) time.Time {
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	}
+
+	candidate := withYear(now.Year())
+
+	if candidate.After(now.Add(24 * time.Hour)) {
+		return withYear(now.Year() - 1)
+	}
+
+	return candidate
+}
@@ -0,0 +1,395 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package syslogsource makes Control Center a remote syslog server, receiving
+// RFC 5424 or RFC 3164 messages over UDP and TCP (with octet counting or new line framing).
+package syslogsource
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
+	"gitlab.com/lightmeter/controlcenter/logeater/transform"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxMessageSize is large enough for any postfix log line
+const maxMessageSize = 64 * 1024
+
+type Options struct {
+	// Addresses to listen to, like ":514". Empty means not listening on such protocol.
+	UDPAddress string
+	TCPAddress string
+
+	// If not empty, only messages from those networks are accepted
+	AllowedSenders []*net.IPNet
+
+	// Time zone of RFC 3164 timestamps. Defaults to the local one
+	Location *time.Location
+}
+
+// ParseAllowedSenders parses a comma separated list of IP addresses or networks in the CIDR notation
+func ParseAllowedSenders(s string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+
+		if len(v) == 0 {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address: %v", v)
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+type Source struct {
+	options   Options
+	announcer announcer.ImportAnnouncer
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+
+	lineCounter uint64
+}
+
+var ErrNoAddress = errors.New("No address to listen to")
+
+func New(options Options, announcer announcer.ImportAnnouncer) (*Source, error) {
+	if len(options.UDPAddress) == 0 && len(options.TCPAddress) == 0 {
+		return nil, ErrNoAddress
+	}
+
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+
+	s := &Source{options: options, announcer: announcer}
+
+	if len(options.UDPAddress) > 0 {
+		conn, err := net.ListenPacket("udp", options.UDPAddress)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		s.udpConn = conn
+	}
+
+	if len(options.TCPAddress) > 0 {
+		l, err := net.Listen("tcp", options.TCPAddress)
+		if err != nil {
+			if s.udpConn != nil {
+				errorutil.MustSucceed(s.udpConn.Close())
+			}
+
+			return nil, errorutil.Wrap(err)
+		}
+
+		s.tcpListener = l
+	}
+
+	return s, nil
+}
+
+func (s *Source) Close() error {
+	var udpErr, tcpErr error
+
+	if s.udpConn != nil {
+		udpErr = s.udpConn.Close()
+	}
+
+	if s.tcpListener != nil {
+		tcpErr = s.tcpListener.Close()
+	}
+
+	if udpErr != nil {
+		return errorutil.Wrap(udpErr)
+	}
+
+	if tcpErr != nil {
+		return errorutil.Wrap(tcpErr)
+	}
+
+	return nil
+}
+
+func (s *Source) isAllowed(addr net.Addr) bool {
+	if len(s.options.AllowedSenders) == 0 {
+		return true
+	}
+
+	var ip net.IP
+
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+
+	for _, n := range s.options.AllowedSenders {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublishLogs returns when all the listeners are closed
+func (s *Source) PublishLogs(p postfix.Publisher) error {
+	announcer.Skip(s.announcer)
+
+	// records are received concurrently, but published sequentially
+	records := make(chan postfix.Record, 1024)
+
+	publishingDone := make(chan struct{})
+
+	go func() {
+		for r := range records {
+			p.Publish(r)
+		}
+
+		close(publishingDone)
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 2)
+	)
+
+	if s.udpConn != nil {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- s.readUDP(records)
+		}()
+	}
+
+	if s.tcpListener != nil {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- s.acceptTCP(records)
+		}()
+	}
+
+	wg.Wait()
+
+	close(records)
+	close(errs)
+
+	<-publishingDone
+
+	for err := range errs {
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func isClosedError(err error) bool {
+	// net.ErrClosed is available only from Go 1.16 on
+	return err != nil && strings.Contains(err.Error(), "use of closed network connection")
+}
+
+func (s *Source) readUDP(records chan<- postfix.Record) error {
+	buffer := make([]byte, maxMessageSize)
+
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buffer)
+
+		if isClosedError(err) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if !s.isAllowed(addr) {
+			log.Debug().Msgf("Ignoring syslog message from not allowed address %v", addr)
+			continue
+		}
+
+		s.handleMessage(buffer[:n], records)
+	}
+}
+
+func (s *Source) acceptTCP(records chan<- postfix.Record) error {
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+
+		if isClosedError(err) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if !s.isAllowed(conn.RemoteAddr()) {
+			log.Warn().Msgf("Refusing syslog connection from not allowed address %v", conn.RemoteAddr())
+			errorutil.MustSucceed(conn.Close())
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			defer func() {
+				if err := conn.Close(); err != nil {
+					log.Warn().Msgf("Error closing syslog connection: %v", err)
+				}
+			}()
+
+			if err := s.readTCP(conn, records); err != nil {
+				log.Warn().Msgf("Error reading syslog connection from %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *Source) readTCP(conn io.Reader, records chan<- postfix.Record) error {
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+
+	for {
+		message, err := readFrame(reader)
+
+		if err != nil && (errors.Is(err, io.EOF) || isClosedError(err)) {
+			return nil
+		}
+
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		s.handleMessage(message, records)
+	}
+}
+
+var ErrInvalidFrame = errors.New("Invalid syslog frame")
+
+// readFrame reads a message using the octet counting framing (RFC 6587), where each message
+// is preceded by its length and a space, or, as used by default by rsyslog, ended by a new line
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	b, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if b[0] < '0' || b[0] > '9' {
+		line, err := reader.ReadSlice('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+			return nil, err
+		}
+
+		return line, nil
+	}
+
+	lenStr, err := reader.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+	if err != nil || size <= 0 || size > maxMessageSize {
+		return nil, ErrInvalidFrame
+	}
+
+	message := make([]byte, size)
+
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (s *Source) handleMessage(b []byte, records chan<- postfix.Record) {
+	m, err := ParseMessage(b, time.Now(), s.options.Location)
+	if err != nil {
+		log.Debug().Msgf("Ignoring invalid syslog message: %q", b)
+		return
+	}
+
+	r, err := buildRecord(m, atomic.AddUint64(&s.lineCounter, 1))
+	if err != nil {
+		log.Err(err).Msgf("Error parsing syslog message: %q", b)
+		return
+	}
+
+	records <- r
+}
+
+// buildRecord rebuilds the line as written by Postfix in its log files, for the parser,
+// but uses the timestamp from the syslog message
+func buildRecord(m Message, counter uint64) (postfix.Record, error) {
+	hostname := m.Hostname
+	if len(hostname) == 0 {
+		hostname = "localhost"
+	}
+
+	process := m.AppName
+
+	if len(m.ProcID) > 0 {
+		process += "[" + m.ProcID + "]"
+	}
+
+	line := fmt.Sprintf("%s %s %s: %s", m.Time.Format(time.Stamp), hostname, process, m.Content)
+
+	loc := postfix.RecordLocation{
+		Line:     counter,
+		Filename: "syslog",
+	}
+
+	r, err := transform.ParseLine([]byte(line), func(parser.Header) time.Time { return m.Time }, loc)
+	if err != nil {
+		return postfix.Record{}, errorutil.Wrap(err)
+	}
+
+	return r, nil
+}
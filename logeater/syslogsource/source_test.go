@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package syslogsource
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePublisher struct {
+	sync.Mutex
+	records []postfix.Record
+}
+
+func (p *fakePublisher) Publish(r postfix.Record) {
+	p.Lock()
+	defer p.Unlock()
+	p.records = append(p.records, r)
+}
+
+func (p *fakePublisher) count() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.records)
+}
+
+type fakeAnnouncer struct{}
+
+func (fakeAnnouncer) AnnounceStart(time.Time)             {}
+func (fakeAnnouncer) AnnounceProgress(announcer.Progress) {}
+
+func TestParseMessage(t *testing.T) {
+	Convey("Parse syslog messages", t, func() {
+		berlin, err := time.LoadLocation("Europe/Berlin")
+		So(err, ShouldBeNil)
+
+		now := testutil.MustParseTime(`2021-01-02 10:00:00 +0000`)
+
+		Convey("RFC 5424", func() {
+			m, err := ParseMessage([]byte(`<22>1 2021-03-06T07:08:59.123+01:00 mail.example.com postfix/qmgr 28829 - [exampleSDID@32473 iut="3" eventSource="App\]lication"] A1E1E1880093: removed`+"\n"), now, berlin)
+			So(err, ShouldBeNil)
+			So(m.Time.Equal(testutil.MustParseTime(`2021-03-06 06:08:59 +0000`).Add(123*time.Millisecond)), ShouldBeTrue)
+			So(m.Hostname, ShouldEqual, "mail.example.com")
+			So(m.AppName, ShouldEqual, "postfix/qmgr")
+			So(m.ProcID, ShouldEqual, "28829")
+			So(string(m.Content), ShouldEqual, "A1E1E1880093: removed")
+		})
+
+		Convey("RFC 5424, no structured data and nil values", func() {
+			m, err := ParseMessage([]byte("<22>1 2021-03-06T06:08:59Z - postfix/qmgr - - - \xEF\xBB\xBFA1E1E1880093: removed"), now, berlin)
+			So(err, ShouldBeNil)
+			So(m.Hostname, ShouldEqual, "")
+			So(m.ProcID, ShouldEqual, "")
+			So(string(m.Content), ShouldEqual, "A1E1E1880093: removed")
+		})
+
+		Convey("RFC 3164, in the past year", func() {
+			m, err := ParseMessage([]byte(`<22>Dec 31 23:59:58 mail postfix/qmgr[28829]: A1E1E1880093: removed`), now, berlin)
+			So(err, ShouldBeNil)
+			So(m.Time.Equal(testutil.MustParseTime(`2020-12-31 22:59:58 +0000`)), ShouldBeTrue)
+			So(m.Hostname, ShouldEqual, "mail")
+			So(m.AppName, ShouldEqual, "postfix/qmgr")
+			So(m.ProcID, ShouldEqual, "28829")
+			So(string(m.Content), ShouldEqual, "A1E1E1880093: removed")
+		})
+
+		Convey("RFC 3164, in the current year", func() {
+			m, err := ParseMessage([]byte(`<22>Jan  2 11:00:00 mail postfix/qmgr[28829]: A1E1E1880093: removed`), now, berlin)
+			So(err, ShouldBeNil)
+			So(m.Time.Equal(testutil.MustParseTime(`2021-01-02 10:00:00 +0000`)), ShouldBeTrue)
+		})
+
+		Convey("RFC 3164 with a RFC 3339 timestamp", func() {
+			m, err := ParseMessage([]byte(`<22>2021-03-06T07:08:59+01:00 mail postfix/qmgr[28829]: A1E1E1880093: removed`), now, berlin)
+			So(err, ShouldBeNil)
+			So(m.Time.Equal(testutil.MustParseTime(`2021-03-06 06:08:59 +0000`)), ShouldBeTrue)
+			So(m.Hostname, ShouldEqual, "mail")
+		})
+
+		Convey("Invalid messages", func() {
+			for _, s := range []string{
+				``,
+				`no priority`,
+				`<22222>1 2021-03-06T06:08:59Z - postfix/qmgr - - - removed`,
+				`<22>1 yesterday mail postfix/qmgr - - - removed`,
+				`<22>1 2021-03-06T06:08:59Z mail postfix/qmgr - - [unclosed removed`,
+				`<22>Dec 31 23:59:58 mail no tag`,
+			} {
+				_, err := ParseMessage([]byte(s), now, berlin)
+				So(err, ShouldEqual, ErrInvalidMessage)
+			}
+		})
+	})
+}
+
+func TestParseAllowedSenders(t *testing.T) {
+	Convey("Parse allowed senders", t, func() {
+		nets, err := ParseAllowedSenders("10.0.0.0/8, 192.168.0.3,2001:db8::1")
+		So(err, ShouldBeNil)
+		So(len(nets), ShouldEqual, 3)
+		So(nets[0].Contains(net.ParseIP("10.1.2.3")), ShouldBeTrue)
+		So(nets[1].Contains(net.ParseIP("192.168.0.3")), ShouldBeTrue)
+		So(nets[1].Contains(net.ParseIP("192.168.0.4")), ShouldBeFalse)
+		So(nets[2].Contains(net.ParseIP("2001:db8::1")), ShouldBeTrue)
+
+		_, err = ParseAllowedSenders("10.0.0.0/33")
+		So(err, ShouldNotBeNil)
+
+		_, err = ParseAllowedSenders("localhost")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func waitForRecords(pub *fakePublisher, n int) {
+	for i := 0; i < 100 && pub.count() < n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	Convey("Syslog Server", t, func() {
+		_, err := New(Options{}, fakeAnnouncer{})
+		So(err, ShouldEqual, ErrNoAddress)
+
+		line := func(queue string) string {
+			return fmt.Sprintf(`<22>1 2021-03-06T06:08:59Z mail postfix/qmgr 28829 - - %s: removed`, queue)
+		}
+
+		run := func(options Options) (*Source, *fakePublisher, func()) {
+			s, err := New(options, fakeAnnouncer{})
+			So(err, ShouldBeNil)
+
+			pub := &fakePublisher{}
+			done := make(chan error)
+
+			go func() {
+				done <- s.PublishLogs(pub)
+			}()
+
+			return s, pub, func() {
+				So(s.Close(), ShouldBeNil)
+				So(<-done, ShouldBeNil)
+			}
+		}
+
+		Convey("UDP", func() {
+			s, pub, stop := run(Options{UDPAddress: "127.0.0.1:0"})
+
+			conn, err := net.Dial("udp", s.udpConn.LocalAddr().String())
+			So(err, ShouldBeNil)
+
+			_, err = conn.Write([]byte(line("A1E1E1880093")))
+			So(err, ShouldBeNil)
+
+			So(conn.Close(), ShouldBeNil)
+
+			waitForRecords(pub, 1)
+
+			stop()
+
+			So(len(pub.records), ShouldEqual, 1)
+			So(pub.records[0].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+			So(pub.records[0].Time, ShouldEqual, testutil.MustParseTime(`2021-03-06 06:08:59 +0000`))
+			So(pub.records[0].Header.Host, ShouldEqual, "mail")
+			So(pub.records[0].Header.PID, ShouldEqual, 28829)
+		})
+
+		Convey("TCP, with octet counting and new line framing", func() {
+			s, pub, stop := run(Options{TCPAddress: "127.0.0.1:0"})
+
+			conn, err := net.Dial("tcp", s.tcpListener.Addr().String())
+			So(err, ShouldBeNil)
+
+			l1, l2, l3 := line("A1E1E1880093"), line("B1E1E1880093")+"\n", line("C1E1E1880093")
+			_, err = conn.Write([]byte(fmt.Sprintf("%d %s%d %s%s\n", len(l1), l1, len(l2), l2, l3)))
+			So(err, ShouldBeNil)
+
+			So(conn.Close(), ShouldBeNil)
+
+			waitForRecords(pub, 3)
+
+			stop()
+
+			So(len(pub.records), ShouldEqual, 3)
+			So(pub.records[0].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+			So(pub.records[1].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "B1E1E1880093"})
+			So(pub.records[2].Payload, ShouldResemble, parser.QmgrRemoved{Queue: "C1E1E1880093"})
+		})
+
+		Convey("Senders not allowed are ignored", func() {
+			allowed, err := ParseAllowedSenders("10.0.0.0/8")
+			So(err, ShouldBeNil)
+
+			s, pub, stop := run(Options{UDPAddress: "127.0.0.1:0", TCPAddress: "127.0.0.1:0", AllowedSenders: allowed})
+
+			udpConn, err := net.Dial("udp", s.udpConn.LocalAddr().String())
+			So(err, ShouldBeNil)
+
+			_, err = udpConn.Write([]byte(line("A1E1E1880093")))
+			So(err, ShouldBeNil)
+			So(udpConn.Close(), ShouldBeNil)
+
+			tcpConn, err := net.Dial("tcp", s.tcpListener.Addr().String())
+			So(err, ShouldBeNil)
+
+			// the connection is closed by the server
+			_, _ = tcpConn.Write([]byte(line("B1E1E1880093") + "\n"))
+			So(tcpConn.Close(), ShouldBeNil)
+
+			waitForRecords(pub, 1)
+
+			stop()
+
+			So(len(pub.records), ShouldEqual, 0)
+		})
+	})
+}
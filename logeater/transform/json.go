@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONFieldPaths are the paths, with the keys separated by dots, like `log.file.path`,
+// of the fields used from the JSON events sent by log shippers.
+// Only Time and Message are required.
+type JSONFieldPaths struct {
+	Time    string
+	Message string
+	Host    string
+
+	// Original file and byte offset of the line
+	File   string
+	Offset string
+}
+
+var jsonFormats = map[string]JSONFieldPaths{
+	// https://www.elastic.co/guide/en/beats/filebeat/current/exported-fields-log.html
+	"filebeat": {Time: "@timestamp", Message: "message", Host: "host.name", File: "log.file.path", Offset: "log.offset"},
+
+	// the file input plugin has no offset, but events coming from beats do
+	"logstash": {Time: "@timestamp", Message: "message", Host: "host", File: "path", Offset: "log.offset"},
+
+	// the tail input, with `Path_Key path`, and the file output, with `Format json_lines` or `Format plain`
+	"fluentbit": {Time: "date", Message: "log", Host: "hostname", File: "path", Offset: "offset"},
+
+	// https://vector.dev/docs/reference/configuration/sources/file/#output-data
+	"vector": {Time: "timestamp", Message: "message", Host: "host", File: "file", Offset: "offset"},
+
+	// https://docs.docker.com/config/containers/logging/json-file/
+	"docker-json": {Time: "time", Message: "log"},
+}
+
+// ParseJSONFieldPaths parses a comma separated list of field=path, where field is
+// one of time, message, host, file or offset, as in `time=@timestamp,message=event.original`
+func ParseJSONFieldPaths(s string) (JSONFieldPaths, error) {
+	paths := JSONFieldPaths{}
+
+	for _, kv := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(kv)) == 0 {
+			continue
+		}
+
+		c := strings.SplitN(kv, "=", 2)
+		if len(c) != 2 || len(strings.TrimSpace(c[1])) == 0 {
+			return JSONFieldPaths{}, fmt.Errorf("Invalid JSON field path: %v", kv)
+		}
+
+		field, path := strings.TrimSpace(c[0]), strings.TrimSpace(c[1])
+
+		switch field {
+		case "time":
+			paths.Time = path
+		case "message":
+			paths.Message = path
+		case "host":
+			paths.Host = path
+		case "file":
+			paths.File = path
+		case "offset":
+			paths.Offset = path
+		default:
+			return JSONFieldPaths{}, fmt.Errorf("Unknown JSON field: %v", field)
+		}
+	}
+
+	return paths, nil
+}
+
+// the non empty paths in `overrides` replace the ones in `p`
+func (p JSONFieldPaths) merge(overrides JSONFieldPaths) JSONFieldPaths {
+	replace := func(v *string, o string) {
+		if len(o) > 0 {
+			*v = o
+		}
+	}
+
+	replace(&p.Time, overrides.Time)
+	replace(&p.Message, overrides.Message)
+	replace(&p.Host, overrides.Host)
+	replace(&p.File, overrides.File)
+	replace(&p.Offset, overrides.Offset)
+
+	return p
+}
+
+// lookupJSONPath finds the value in path, where each key can also contain dots,
+// as some shippers use flattened keys, like `{"log.file.path": "/var/log/mail.log"}`
+func lookupJSONPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+
+	if v, ok := obj[path]; ok {
+		return v, true
+	}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+
+		if child, ok := obj[path[:i]].(map[string]interface{}); ok {
+			if v, ok := lookupJSONPath(child, path[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+var (
+	ErrMissingJSONField         = errors.New("Missing JSON field")
+	ErrIncompleteJSONFieldPaths = errors.New("The time and message JSON fields are required")
+)
+
+func jsonTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return time.Time{}, errorutil.Wrap(err)
+		}
+
+		return parsed, nil
+	case json.Number:
+		// seconds since the epoch, possibly with a fraction, as used by Fluent Bit
+		f, err := t.Float64()
+		if err != nil {
+			return time.Time{}, errorutil.Wrap(err)
+		}
+
+		sec, frac := math.Modf(f)
+
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*int64(time.Microsecond)).In(time.UTC), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid time: %v", v)
+}
+
+func jsonString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	case map[string]interface{}:
+		// logstash sometimes has the host as an object
+		if name, ok := s["name"].(string); ok {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+type jsonTransformer struct {
+	paths  JSONFieldPaths
+	lineNo uint64
+}
+
+func (t *jsonTransformer) Transform(line []byte) (postfix.Record, error) {
+	lineNo := t.lineNo
+	t.lineNo++
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	var obj map[string]interface{}
+
+	if err := decoder.Decode(&obj); err != nil {
+		return postfix.Record{}, errorutil.Wrap(err, "line: ", lineNo)
+	}
+
+	rawTime, ok := lookupJSONPath(obj, t.paths.Time)
+	if !ok {
+		return postfix.Record{}, fmt.Errorf("%s (%s) on line %d: %w", t.paths.Time, "time", lineNo, ErrMissingJSONField)
+	}
+
+	parsedTime, err := jsonTime(rawTime)
+	if err != nil {
+		return postfix.Record{}, errorutil.Wrap(err, "line: ", lineNo)
+	}
+
+	rawMessage, ok := lookupJSONPath(obj, t.paths.Message)
+	if !ok {
+		return postfix.Record{}, fmt.Errorf("%s (%s) on line %d: %w", t.paths.Message, "message", lineNo, ErrMissingJSONField)
+	}
+
+	message, ok := rawMessage.(string)
+	if !ok {
+		return postfix.Record{}, fmt.Errorf("Invalid message on line %d: %v", lineNo, rawMessage)
+	}
+
+	loc := postfix.RecordLocation{
+		Line:     lineNo,
+		Filename: "unknown",
+	}
+
+	if v, ok := lookupJSONPath(obj, t.paths.File); ok {
+		if filename, ok := jsonString(v); ok && len(filename) > 0 {
+			loc.Filename = filename
+		}
+	}
+
+	if v, ok := lookupJSONPath(obj, t.paths.Offset); ok {
+		if s, ok := jsonString(v); ok {
+			if offset, err := strconv.ParseUint(s, 10, 64); err == nil {
+				loc.Offset, loc.HasOffset = offset, true
+			}
+		}
+	}
+
+	// docker keeps the line break
+	r, err := ParseLine([]byte(strings.TrimRight(message, "\r\n")), func(parser.Header) time.Time {
+		return parsedTime
+	}, loc)
+	if err != nil {
+		return postfix.Record{}, errorutil.Wrap(err)
+	}
+
+	// the whole document is the original evidence, and not only the message in it
+	r.RawLine = append([]byte(nil), line...)
+
+	// the host known by the shipper is more reliable than the one in the line,
+	// which might be, for instance, the name of a container
+	if v, ok := lookupJSONPath(obj, t.paths.Host); ok {
+		if host, ok := jsonString(v); ok && len(host) > 0 {
+			r.Header.Host = host
+		}
+	}
+
+	return r, nil
+}
+
+// argument for the json formats, optionally replacing their default field paths
+func findJSONFieldPaths(args ...interface{}) ([]interface{}, error) {
+	for _, arg := range args {
+		if paths, ok := arg.(JSONFieldPaths); ok {
+			return []interface{}{paths}, nil
+		}
+	}
+
+	return []interface{}{JSONFieldPaths{}}, nil
+}
+
+func init() {
+	for name, defaultPaths := range jsonFormats {
+		defaultPaths := defaultPaths
+
+		Register(name, findJSONFieldPaths, func(args ...interface{}) (Transformer, error) {
+			paths := defaultPaths.merge(args[0].(JSONFieldPaths))
+			return &jsonTransformer{paths: paths, lineNo: 1}, nil
+		})
+	}
+
+	// no default paths, so at least time and message must be informed
+	Register("json", func(args ...interface{}) ([]interface{}, error) {
+		paths, err := findJSONFieldPaths(args...)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		if p := paths[0].(JSONFieldPaths); len(p.Time) == 0 || len(p.Message) == 0 {
+			return nil, ErrIncompleteJSONFieldPaths
+		}
+
+		return paths, nil
+	}, func(args ...interface{}) (Transformer, error) {
+		return &jsonTransformer{paths: args[0].(JSONFieldPaths), lineNo: 1}, nil
+	})
+}
@@ -46,6 +46,8 @@ func (t *rfc3399Transformer) Transform(line []byte) (postfix.Record, error) {
 		return postfix.Record{}, errorutil.Wrap(err)
 	}
 
+	r.RawLine = append([]byte(nil), line...)
+
 	return r, nil
 }
 
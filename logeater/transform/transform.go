@@ -69,6 +69,8 @@ func ParseLine(line []byte, timeBuilder func(parser.Header) time.Time, loc postf
 		Header:   h,
 		Payload:  p,
 		Location: loc,
+		// the line usually comes from a buffer reused by the reader
+		RawLine: append([]byte(nil), line...),
 	}, nil
 }
 
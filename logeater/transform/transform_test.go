@@ -5,7 +5,10 @@
 package transform
 
 import (
+	"errors"
 	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
 	"gitlab.com/lightmeter/controlcenter/util/testutil"
 	"testing"
 	"time"
@@ -32,6 +35,7 @@ func TestTransformers(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(r.Header.Host, ShouldEqual, "mail")
 			So(r.Time, ShouldResemble, time.Date(time.Now().Year(), time.August, 21, 3, 3, 4, 0, time.UTC))
+			So(string(r.RawLine), ShouldEqual, `Aug 21 03:03:04 mail dog: Useless Payload`)
 		})
 
 		Convey("Default, just return the line, unable to get a time from it", func() {
@@ -91,6 +95,9 @@ func TestRFC3339PrependFormat(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(r.Time, ShouldResemble, testutil.MustParseTime(`2021-03-06 06:09:00 +0000`))
 			So(r.Header.Host, ShouldEqual, "host")
+
+			// the time added to the line is part of it
+			So(string(r.RawLine), ShouldEqual, `2021-03-06T06:09:00.000Z Mar  6 07:08:59 host postfix/qmgr[28829]: A1E1E1880093: removed`)
 		})
 
 		Convey("Succeeds, docker logs default format", func() {
@@ -102,3 +109,103 @@ func TestRFC3339PrependFormat(t *testing.T) {
 
 	})
 }
+
+func TestJSONFormats(t *testing.T) {
+	Convey("JSON formats", t, func() {
+		build := func(name string, args ...interface{}) Transformer {
+			builder, err := Get(name, args...)
+			So(err, ShouldBeNil)
+
+			transformer, err := builder()
+			So(err, ShouldBeNil)
+
+			return transformer
+		}
+
+		expectedTime := testutil.MustParseTime(`2021-03-06 06:09:00 +0000`).Add(798 * time.Millisecond)
+
+		Convey("Filebeat", func() {
+			transformer := build("filebeat", 0)
+
+			r, err := transformer.Transform([]byte(`{"@timestamp":"2021-03-06T06:09:00.798Z","host":{"name":"mail.example.com"},` +
+				`"log":{"offset":4242,"file":{"path":"/var/log/mail.log"}},"message":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed"}`))
+			So(err, ShouldBeNil)
+			So(r.Time, ShouldResemble, expectedTime)
+			So(r.Header.Host, ShouldEqual, "mail.example.com")
+			So(r.Header.Daemon, ShouldEqual, "qmgr")
+			So(r.Location, ShouldResemble, postfix.RecordLocation{Line: 1, Filename: "/var/log/mail.log", Offset: 4242, HasOffset: true})
+
+			Convey("Missing fields", func() {
+				_, err := transformer.Transform([]byte(`{"@timestamp":"2021-03-06T06:09:00.798Z"}`))
+				So(errors.Is(err, ErrMissingJSONField), ShouldBeTrue)
+
+				_, err = transformer.Transform([]byte(`{"message":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed"}`))
+				So(errors.Is(err, ErrMissingJSONField), ShouldBeTrue)
+			})
+
+			Convey("Invalid JSON", func() {
+				_, err := transformer.Transform([]byte(`Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed`))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Logstash, with flattened keys and the host as a string", func() {
+			r, err := build("logstash").Transform([]byte(`{"@timestamp":"2021-03-06T06:09:00.798Z","host":"mail.example.com","log.offset":"12",` +
+				`"path":"/var/log/mail.log","message":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed"}`))
+			So(err, ShouldBeNil)
+			So(r.Header.Host, ShouldEqual, "mail.example.com")
+			So(r.Location, ShouldResemble, postfix.RecordLocation{Line: 1, Filename: "/var/log/mail.log", Offset: 12, HasOffset: true})
+		})
+
+		Convey("Fluent Bit, with the time as a number", func() {
+			r, err := build("fluentbit").Transform([]byte(`{"date":1615010940.798,"log":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed"}`))
+			So(err, ShouldBeNil)
+			So(r.Time, ShouldResemble, expectedTime)
+			So(r.Header.Host, ShouldEqual, "mail")
+			So(r.Location, ShouldResemble, postfix.RecordLocation{Line: 1, Filename: "unknown"})
+		})
+
+		Convey("Vector", func() {
+			r, err := build("vector").Transform([]byte(`{"timestamp":"2021-03-06T06:09:00.798Z","host":"mail.example.com","file":"/var/log/mail.log",` +
+				`"message":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed","source_type":"file"}`))
+			So(err, ShouldBeNil)
+			So(r.Header.Host, ShouldEqual, "mail.example.com")
+			So(r.Location, ShouldResemble, postfix.RecordLocation{Line: 1, Filename: "/var/log/mail.log"})
+		})
+
+		Convey("Docker json-file", func() {
+			r, err := build("docker-json").Transform([]byte(`{"log":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed\n","stream":"stdout","time":"2021-03-06T06:09:00.798Z"}`))
+			So(err, ShouldBeNil)
+			So(r.Time, ShouldResemble, expectedTime)
+			So(r.Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+
+			// the whole document, and not only the message in it
+			So(string(r.RawLine), ShouldEqual, `{"log":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed\n","stream":"stdout","time":"2021-03-06T06:09:00.798Z"}`)
+		})
+
+		Convey("Custom field paths", func() {
+			paths, err := ParseJSONFieldPaths("time=event.created, message=event.original")
+			So(err, ShouldBeNil)
+
+			line := []byte(`{"event":{"created":"2021-03-06T06:09:00.798Z","original":"Mar  6 07:08:59 mail postfix/qmgr[28829]: A1E1E1880093: removed"}}`)
+
+			r, err := build("filebeat", 0, paths).Transform(line)
+			So(err, ShouldBeNil)
+			So(r.Time, ShouldResemble, expectedTime)
+
+			r, err = build("json", paths).Transform(line)
+			So(err, ShouldBeNil)
+			So(r.Payload, ShouldResemble, parser.QmgrRemoved{Queue: "A1E1E1880093"})
+		})
+
+		Convey("Invalid field paths", func() {
+			for _, s := range []string{"time", "time=", "date=@timestamp"} {
+				_, err := ParseJSONFieldPaths(s)
+				So(err, ShouldNotBeNil)
+			}
+
+			_, err := Get("json", JSONFieldPaths{Time: "time"})
+			So(errors.Is(err, ErrIncompleteJSONFieldPaths), ShouldBeTrue)
+		})
+	})
+}
@@ -11,18 +11,23 @@ import (
 	"github.com/rs/zerolog/log"
 	uuid "github.com/satori/go.uuid"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/logarchive"
 	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
 	"gitlab.com/lightmeter/controlcenter/logeater/dirlogsource"
 	"gitlab.com/lightmeter/controlcenter/logeater/filelogsource"
+	"gitlab.com/lightmeter/controlcenter/logeater/journalsource"
 	"gitlab.com/lightmeter/controlcenter/logeater/logsource"
 	"gitlab.com/lightmeter/controlcenter/logeater/socketsource"
+	"gitlab.com/lightmeter/controlcenter/logeater/syslogsource"
 	"gitlab.com/lightmeter/controlcenter/logeater/transform"
 	"gitlab.com/lightmeter/controlcenter/server"
 	"gitlab.com/lightmeter/controlcenter/subcommand"
+	"gitlab.com/lightmeter/controlcenter/tracking"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
 	"gitlab.com/lightmeter/controlcenter/version"
 	"gitlab.com/lightmeter/controlcenter/workspace"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -45,6 +50,14 @@ func main() {
 		logYear                   int
 		socket                    string
 		logFormat                 string
+		journal                   string
+		syslogUDPAddress          string
+		syslogTCPAddress          string
+		syslogAllowedSenders      string
+		logFormatFields           string
+		trackerGCHorizon          time.Duration
+		archiveLogs               bool
+		logArchiveRetention       time.Duration
 	)
 
 	flag.BoolVar(&shouldWatchFromStdin, "stdin", false, "Read log lines from stdin")
@@ -64,7 +77,22 @@ func main() {
 	flag.StringVar(&emailToPasswdReset, "email_reset", "", "Reset password for user (implies -password and depends on -workspace)")
 	flag.StringVar(&passwordToReset, "password", "", "Password to reset (requires -email_reset)")
 	flag.StringVar(&socket, "socket", "", "Receive logs via a socket. E.g. unix=/tmp/lightemter.sock or tcp=localhost:9999")
-	flag.StringVar(&logFormat, "log_format", "default", "Expected log format from external sources (like logstash, etc.)")
+	flag.StringVar(&journal, "journal", "", "Read logs from systemd-journald, in the export or JSON formats (journalctl -o export or -o json). "+
+		"Either a file, - for stdin, or a socket, like unix=/tmp/journal.sock or tcp=localhost:9999")
+	flag.StringVar(&syslogUDPAddress, "syslog_udp", "", "Act as a remote syslog server (RFC 5424 or RFC 3164), listening on this UDP address, like :514")
+	flag.StringVar(&syslogTCPAddress, "syslog_tcp", "", "Act as a remote syslog server (RFC 5424 or RFC 3164), listening on this TCP address, like :514")
+	flag.StringVar(&syslogAllowedSenders, "syslog_allowed_senders", "", "Comma separated list of IP addresses or networks allowed to send syslog messages, like 10.0.0.0/8,192.168.0.3. Defaults to any")
+	flag.StringVar(&logFormat, "log_format", "default", "Expected log format from external sources (like logstash, etc.). "+
+		"One of default, prepend-rfc3339, filebeat, logstash, fluentbit, vector, docker-json or json")
+	flag.StringVar(&logFormatFields, "log_format_fields", "", "Paths of the fields used by the JSON log formats, replacing the default ones, "+
+		"as in time=@timestamp,message=message,host=host.name,file=log.file.path,offset=log.offset. Required by -log_format json")
+	flag.DurationVar(&trackerGCHorizon, "tracker_gc_horizon", tracking.DefaultGCOptions.Horizon,
+		"Messages and connections whose log lines stop for longer than it are considered lost, and expired. "+
+			"Must be longer than the maximal_queue_lifetime of postfix. 0 keeps them forever")
+	flag.BoolVar(&archiveLogs, "log_archive", false, "Keep a compressed copy of the log lines in the workspace, "+
+		"available via the API as the original evidence about deliveries and queues")
+	flag.DurationVar(&logArchiveRetention, "log_archive_retention", logarchive.DefaultOptions.Retention,
+		"For how long the archived log lines are kept, according to the time of the most recent one. 0 keeps them forever. Requires -log_archive")
 
 	flag.Usage = func() {
 		printVersion()
@@ -105,13 +133,21 @@ func main() {
 		return
 	}
 
-	ws, err := workspace.NewWorkspace(workspaceDirectory)
+	wsOptions := workspace.Options{
+		TrackerGC: tracking.GCOptions{Horizon: trackerGCHorizon, Interval: tracking.DefaultGCOptions.Interval},
+	}
+
+	if archiveLogs {
+		wsOptions.LogArchive = &logarchive.Options{Retention: logArchiveRetention}
+	}
+
+	ws, err := workspace.NewWorkspace(workspaceDirectory, wsOptions)
 
 	if err != nil {
 		errorutil.Dief(verbose, errorutil.Wrap(err), "Error creating / opening workspace directory for storing application files: %s. Try specifying a different directory (using -workspace), or check you have permission to write to the specified location.", workspaceDirectory)
 	}
 
-	logSource, err := buildLogSource(ws, dirToWatch, importOnly, rsyncedDir, logYear, logFormat, shouldWatchFromStdin, socket, verbose)
+	logSource, err := buildLogSource(ws, dirToWatch, importOnly, rsyncedDir, logYear, logFormat, shouldWatchFromStdin, socket, journal, syslogsource.Options{UDPAddress: syslogUDPAddress, TCPAddress: syslogTCPAddress}, syslogAllowedSenders, logFormatFields, verbose)
 
 	if err != nil {
 		errorutil.Dief(verbose, err, "Error setting up logs reading")
@@ -136,6 +172,8 @@ func main() {
 
 		errorutil.MustSucceed(err)
 
+		ws.ParserCoverage().LogSummary()
+
 		log.Info().Msg("Importing has finished. Bye!")
 
 		return
@@ -180,7 +218,7 @@ func importAnnouncerOnlyForFirstExecution(initialTime time.Time, a announcer.Imp
 	return announcer.Skipper(a)
 }
 
-func buildLogSource(ws *workspace.Workspace, dirToWatch string, importOnly bool, rsyncedDir bool, logYear int, logFormat string, shouldWatchFromStdin bool, socket string, verbose bool) (logsource.Source, error) {
+func buildLogSource(ws *workspace.Workspace, dirToWatch string, importOnly bool, rsyncedDir bool, logYear int, logFormat string, shouldWatchFromStdin bool, socket string, journal string, syslogOptions syslogsource.Options, syslogAllowedSenders string, logFormatFields string, verbose bool) (logsource.Source, error) {
 	mostRecentTime, err := ws.MostRecentLogTime()
 	if err != nil {
 		return nil, errorutil.Wrap(err)
@@ -197,7 +235,37 @@ func buildLogSource(ws *workspace.Workspace, dirToWatch string, importOnly bool,
 		return s, nil
 	}
 
-	builder, err := transform.Get(logFormat, logYear)
+	if len(journal) > 0 {
+		s, err := buildJournalLogSource(ws, journal, announcer)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		return s, nil
+	}
+
+	if len(syslogOptions.UDPAddress) > 0 || len(syslogOptions.TCPAddress) > 0 {
+		allowedSenders, err := syslogsource.ParseAllowedSenders(syslogAllowedSenders)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		syslogOptions.AllowedSenders = allowedSenders
+
+		s, err := syslogsource.New(syslogOptions, announcer)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		return s, nil
+	}
+
+	jsonFieldPaths, err := transform.ParseJSONFieldPaths(logFormatFields)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	builder, err := transform.Get(logFormat, logYear, jsonFieldPaths)
 	if err != nil {
 		return nil, errorutil.Wrap(err)
 	}
@@ -224,3 +292,30 @@ func buildLogSource(ws *workspace.Workspace, dirToWatch string, importOnly bool,
 
 	return nil, nil
 }
+
+func buildJournalLogSource(ws *workspace.Workspace, journal string, announcer announcer.ImportAnnouncer) (logsource.Source, error) {
+	cursors := journalsource.NewMetaCursorStorage(ws.SettingsAcessors())
+
+	s, err := func() (*journalsource.Source, error) {
+		if journal == "-" {
+			return journalsource.New(os.Stdin, cursors, announcer)
+		}
+
+		if strings.Contains(journal, "=") {
+			return journalsource.NewFromSocket(journal, cursors, announcer)
+		}
+
+		f, err := os.Open(journal)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		return journalsource.New(f, cursors, announcer)
+	}()
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return s, nil
+}
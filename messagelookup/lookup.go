@@ -0,0 +1,381 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package messagelookup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/deliverydb"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Event struct {
+	Time           time.Time `json:"time"`
+	Kind           string    `json:"kind"`
+	Queue          string    `json:"queue"`
+	Host           string    `json:"host"`
+	Filename       string    `json:"filename"`
+	Line           uint64    `json:"line"`
+	RelatedQueue   string    `json:"related_queue,omitempty"`
+	MessageId      string    `json:"message_id,omitempty"`
+	Sender         string    `json:"sender,omitempty"`
+	Recipient      string    `json:"recipient,omitempty"`
+	ClientHostname string    `json:"client_hostname,omitempty"`
+	ClientIP       string    `json:"client_ip,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	Dsn            string    `json:"dsn,omitempty"`
+	Relay          string    `json:"relay,omitempty"`
+	Description    string    `json:"description,omitempty"`
+}
+
+type Timeline struct {
+	// All the queues the message went through, as when it's relayed to a content filter
+	// or when a bounce notification is created for it
+	Queues []string `json:"queues"`
+	Events []Event  `json:"events"`
+}
+
+type MessageSummary struct {
+	Queue      string    `json:"queue"`
+	Host       string    `json:"host"`
+	MessageId  string    `json:"message_id"`
+	Sender     string    `json:"sender"`
+	Recipients []string  `json:"recipients"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	LastStatus string    `json:"last_status"`
+}
+
+type Lookup interface {
+	// SearchMessages finds messages by queue, message-id, sender or recipient address
+	SearchMessages(context.Context, string, timeutil.TimeInterval) ([]MessageSummary, error)
+	MessageTimeline(ctx context.Context, queue string) (Timeline, error)
+
+	// DeliveryQueue returns the queue a delivery has been done from
+	DeliveryQueue(ctx context.Context, deliveryID int64) (string, error)
+}
+
+var ErrNoSuchDelivery = errors.New("No such delivery")
+
+type stmtKey int
+
+const (
+	selectEventsByQueueKey stmtKey = iota
+	selectParentQueuesKey
+	selectEventsMatchingSearchKey
+	selectDeliveryQueueKey
+)
+
+const (
+	// limits how many queues a timeline can span, protecting against queue ids reused over time
+	maxQueuesInTimeline = 20
+
+	maxSearchResults = 100
+)
+
+const eventColumns = `
+	e.ts, e.kind, e.queue, delivery_server.hostname, e.filename, e.line, ifnull(e.related_queue, ''),
+	ifnull(messageids.value, ''), ifnull(e.sender, ''), ifnull(e.recipient, ''), ifnull(e.client_hostname, ''),
+	e.client_ip, e.status, ifnull(e.dsn, ''), ifnull(e.relay, ''), ifnull(e.description, '')
+from
+	message_events e
+	join delivery_server on e.delivery_server_id = delivery_server.id
+	left join messageids on e.message_id = messageids.id`
+
+var stmtsText = map[stmtKey]string{
+	selectEventsByQueueKey: `select` + eventColumns + `
+where
+	e.queue = ?
+order by
+	e.ts, e.id`,
+	selectParentQueuesKey: `select distinct queue from message_events where related_queue = ?`,
+	selectEventsMatchingSearchKey: `select` + eventColumns + `
+where
+	e.queue in (
+		select distinct queue from message_events
+		where
+			ts between ? and ? and (
+				queue = ? or sender = ? or recipient = ? or
+				message_id in (select id from messageids where value = ?)
+			)
+		limit ?
+	)
+order by
+	e.ts, e.id`,
+	selectDeliveryQueueKey: `select ifnull(queue, '') from deliveries where id = ?`,
+}
+
+type sqlLookup struct {
+	pool *dbconn.RoPool
+}
+
+func New(pool *dbconn.RoPool) (Lookup, error) {
+	setup := func(db *dbconn.RoPooledConn) error {
+		for k, v := range stmtsText {
+			//nolint:sqlclosecheck
+			stmt, err := db.Prepare(v)
+			if err != nil {
+				return errorutil.Wrap(err)
+			}
+
+			db.Closers.Add(stmt)
+
+			db.Stmts[k] = stmt
+		}
+
+		return nil
+	}
+
+	if err := pool.ForEach(setup); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return &sqlLookup{pool: pool}, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func queryEvents(ctx context.Context, stmt *sql.Stmt, args ...interface{}) ([]Event, error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(rows.Close()) }()
+
+	events := []Event{}
+
+	for rows.Next() {
+		var (
+			ts       int64
+			kind     deliverydb.MessageEventKind
+			clientIP []byte
+			status   sql.NullInt64
+			e        Event
+		)
+
+		if err := rows.Scan(&ts, &kind, &e.Queue, &e.Host, &e.Filename, &e.Line, &e.RelatedQueue,
+			&e.MessageId, &e.Sender, &e.Recipient, &e.ClientHostname,
+			&clientIP, &status, &e.Dsn, &e.Relay, &e.Description); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		e.Time = time.Unix(ts, 0).In(time.UTC)
+		e.Kind = kind.String()
+
+		if len(clientIP) > 0 {
+			e.ClientIP = net.IP(clientIP).String()
+		}
+
+		if status.Valid {
+			e.Status = parser.SmtpStatus(status.Int64).String()
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return events, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func queryParentQueues(ctx context.Context, stmt *sql.Stmt, queue string) ([]string, error) {
+	rows, err := stmt.QueryContext(ctx, queue)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(rows.Close()) }()
+
+	queues := []string{}
+
+	for rows.Next() {
+		var q string
+
+		if err := rows.Scan(&q); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		queues = append(queues, q)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return queues, nil
+}
+
+func (l *sqlLookup) MessageTimeline(ctx context.Context, queue string) (Timeline, error) {
+	conn, release := l.pool.Acquire()
+
+	defer release()
+
+	timeline := Timeline{Queues: []string{}, Events: []Event{}}
+
+	visited := map[string]bool{}
+	toVisit := []string{queue}
+
+	for len(toVisit) > 0 && len(timeline.Queues) < maxQueuesInTimeline {
+		q := toVisit[0]
+		toVisit = toVisit[1:]
+
+		if visited[q] {
+			continue
+		}
+
+		visited[q] = true
+
+		events, err := queryEvents(ctx, conn.Stmts[selectEventsByQueueKey], q)
+		if err != nil {
+			return Timeline{}, errorutil.Wrap(err)
+		}
+
+		if len(events) == 0 {
+			continue
+		}
+
+		timeline.Queues = append(timeline.Queues, q)
+		timeline.Events = append(timeline.Events, events...)
+
+		for _, e := range events {
+			if len(e.RelatedQueue) > 0 {
+				toVisit = append(toVisit, e.RelatedQueue)
+			}
+		}
+
+		parents, err := queryParentQueues(ctx, conn.Stmts[selectParentQueuesKey], q)
+		if err != nil {
+			return Timeline{}, errorutil.Wrap(err)
+		}
+
+		toVisit = append(toVisit, parents...)
+	}
+
+	// timestamps have a one second resolution, so within the same log file
+	// the line number is what really tells the order events happened
+	sort.SliceStable(timeline.Events, func(i, j int) bool {
+		a, b := timeline.Events[i], timeline.Events[j]
+
+		if a.Time.Equal(b.Time) && a.Filename == b.Filename {
+			return a.Line < b.Line
+		}
+
+		return a.Time.Before(b.Time)
+	})
+
+	return timeline, nil
+}
+
+func (l *sqlLookup) DeliveryQueue(ctx context.Context, deliveryID int64) (string, error) {
+	conn, release := l.pool.Acquire()
+
+	defer release()
+
+	var queue string
+
+	err := conn.Stmts[selectDeliveryQueueKey].QueryRowContext(ctx, deliveryID).Scan(&queue)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoSuchDelivery
+	}
+
+	if err != nil {
+		return "", errorutil.Wrap(err)
+	}
+
+	// deliveries stored before their queues were known
+	if len(queue) == 0 {
+		return "", ErrNoSuchDelivery
+	}
+
+	return queue, nil
+}
+
+func (l *sqlLookup) SearchMessages(ctx context.Context, query string, interval timeutil.TimeInterval) ([]MessageSummary, error) {
+	conn, release := l.pool.Acquire()
+
+	defer release()
+
+	query = strings.TrimSpace(query)
+	messageId := strings.TrimSuffix(strings.TrimPrefix(query, "<"), ">")
+	address := strings.ToLower(messageId)
+
+	events, err := queryEvents(ctx, conn.Stmts[selectEventsMatchingSearchKey],
+		interval.From.Unix(), interval.To.Unix(), query, address, address, messageId, maxSearchResults)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return summarize(events), nil
+}
+
+func summarize(events []Event) []MessageSummary {
+	summaries := map[string]*MessageSummary{}
+	recipients := map[string]map[string]bool{}
+
+	for _, e := range events {
+		s, ok := summaries[e.Queue]
+		if !ok {
+			s = &MessageSummary{Queue: e.Queue, Host: e.Host, Recipients: []string{}, FirstSeen: e.Time}
+			summaries[e.Queue] = s
+			recipients[e.Queue] = map[string]bool{}
+		}
+
+		s.LastSeen = e.Time
+
+		if len(e.MessageId) > 0 {
+			s.MessageId = e.MessageId
+		}
+
+		if len(e.Sender) > 0 {
+			s.Sender = e.Sender
+		}
+
+		if len(e.Recipient) > 0 && !recipients[e.Queue][e.Recipient] {
+			recipients[e.Queue][e.Recipient] = true
+			s.Recipients = append(s.Recipients, e.Recipient)
+		}
+
+		if len(e.Status) > 0 {
+			s.LastStatus = e.Status
+		}
+
+		if e.Kind == deliverydb.RejectedEventKind.String() {
+			s.LastStatus = e.Kind
+		}
+	}
+
+	result := make([]MessageSummary, 0, len(summaries))
+
+	for _, s := range summaries {
+		result = append(result, *s)
+	}
+
+	// most recent first
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].FirstSeen.Equal(result[j].FirstSeen) {
+			return result[i].Queue < result[j].Queue
+		}
+
+		return result[i].FirstSeen.After(result[j].FirstSeen)
+	})
+
+	return result
+}
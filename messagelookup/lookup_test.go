@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package messagelookup
+
+import (
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
+	"gitlab.com/lightmeter/controlcenter/deliverydb"
+	"gitlab.com/lightmeter/controlcenter/domainmapping"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/logeater/transform"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/tracking"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+func readFromTestFile(name string, db *deliverydb.DB) {
+	f, err := os.Open(name)
+	errorutil.MustSucceed(err)
+
+	defer f.Close()
+
+	builder, err := transform.Get("default", 2020)
+	errorutil.MustSucceed(err)
+
+	errorutil.MustSucceed(transform.ReadFromReader(f, db.MessageEventsPublisher(), builder))
+}
+
+func kinds(events []Event) []string {
+	r := []string{}
+
+	for _, e := range events {
+		r = append(r, e.Queue+":"+e.Kind)
+	}
+
+	return r
+}
+
+func TestMessageLookup(t *testing.T) {
+	Convey("Message Lookup", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		db, err := deliverydb.New(dir, &domainmapping.DefaultMapping, bounceclass.New(bounceclass.DefaultRules))
+		So(err, ShouldBeNil)
+
+		defer func() { So(db.Close(), ShouldBeNil) }()
+
+		done, cancel := db.Run()
+
+		readFromTestFile("../tracking/test_files/1_bounce_simple.log", db)
+
+		db.ResultsPublisher().Publish(tracking.Result{
+			tracking.QueueDeliveryNameKey:         tracking.ResultEntryText("776E41855DB2"),
+			tracking.QueueSenderLocalPartKey:      tracking.ResultEntryText("user"),
+			tracking.QueueSenderDomainPartKey:     tracking.ResultEntryText("sender.com"),
+			tracking.QueueMessageIDKey:            tracking.ResultEntryText("ca10035e-2951-bfd5-ec7e-1a5773fce1cd@mail.sender.com"),
+			tracking.ResultRecipientLocalPartKey:  tracking.ResultEntryText("invalid.email"),
+			tracking.ResultRecipientDomainPartKey: tracking.ResultEntryText("example.com"),
+			tracking.ResultDeliveryTimeKey:        tracking.ResultEntryInt64(testutil.MustParseTime(`2020-06-03 10:40:59 +0000`).Unix()),
+			tracking.ResultStatusKey:              tracking.ResultEntryInt64(int64(parser.BouncedStatus)),
+			tracking.ResultDSNKey:                 tracking.ResultEntryText("5.1.1"),
+			tracking.QueueBeginKey:                tracking.ResultEntryInt64(testutil.MustParseTime(`2020-06-03 10:40:57 +0000`).Unix()),
+			tracking.QueueOriginalMessageSizeKey:  tracking.ResultEntryInt64(1111),
+			tracking.QueueProcessedMessageSizeKey: tracking.ResultEntryInt64(1111),
+			tracking.QueueNRCPTKey:                tracking.ResultEntryInt64(1),
+			tracking.ResultDelayKey:               tracking.ResultEntryFloat64(1.9),
+			tracking.ResultDelaySMTPDKey:          tracking.ResultEntryFloat64(0),
+			tracking.ResultDelayCleanupKey:        tracking.ResultEntryFloat64(0),
+			tracking.ResultDelayQmgrKey:           tracking.ResultEntryFloat64(1.5),
+			tracking.ResultDelaySMTPKey:           tracking.ResultEntryFloat64(0.37),
+			tracking.ResultDeliveryServerKey:      tracking.ResultEntryText("mail"),
+			tracking.ResultMessageDirectionKey:    tracking.ResultEntryInt64(int64(tracking.MessageDirectionOutbound)),
+		})
+
+		cancel()
+		So(done(), ShouldBeNil)
+
+		lookup, err := New(db.ConnPool())
+		So(err, ShouldBeNil)
+
+		interval := timeutil.TimeInterval{
+			From: testutil.MustParseTime(`2020-06-01 00:00:00 +0000`),
+			To:   testutil.MustParseTime(`2020-06-30 00:00:00 +0000`),
+		}
+
+		ctx := context.Background()
+
+		Convey("Search by queue", func() {
+			messages, err := lookup.SearchMessages(ctx, "4AA091855DA0", interval)
+			So(err, ShouldBeNil)
+			So(messages, ShouldResemble, []MessageSummary{
+				{
+					Queue:      "4AA091855DA0",
+					Host:       "mail",
+					MessageId:  "ca10035e-2951-bfd5-ec7e-1a5773fce1cd@mail.sender.com",
+					Sender:     "user@sender.com",
+					Recipients: []string{"invalid.email@example.com"},
+					FirstSeen:  testutil.MustParseTime(`2020-06-03 10:40:57 +0000`),
+					LastSeen:   testutil.MustParseTime(`2020-06-03 10:40:57 +0000`),
+					LastStatus: "sent",
+				},
+			})
+		})
+
+		Convey("Search by message-id, including the angle brackets", func() {
+			messages, err := lookup.SearchMessages(ctx, "<ca10035e-2951-bfd5-ec7e-1a5773fce1cd@mail.sender.com>", interval)
+			So(err, ShouldBeNil)
+			So(len(messages), ShouldEqual, 2)
+			So(messages[0].Queue, ShouldEqual, "4AA091855DA0")
+			So(messages[1].Queue, ShouldEqual, "776E41855DB2")
+			So(messages[1].LastStatus, ShouldEqual, "bounced")
+		})
+
+		Convey("Search by address, case insensitive", func() {
+			messages, err := lookup.SearchMessages(ctx, "User@Sender.com", interval)
+			So(err, ShouldBeNil)
+			So(len(messages), ShouldEqual, 3)
+			So(messages[0].Queue, ShouldEqual, "A48191855DA0")
+			So(messages[0].Recipients, ShouldResemble, []string{"user@sender.com"})
+		})
+
+		Convey("Nothing found outside of the interval", func() {
+			messages, err := lookup.SearchMessages(ctx, "4AA091855DA0", timeutil.TimeInterval{
+				From: testutil.MustParseTime(`2020-07-01 00:00:00 +0000`),
+				To:   testutil.MustParseTime(`2020-07-30 00:00:00 +0000`),
+			})
+			So(err, ShouldBeNil)
+			So(messages, ShouldBeEmpty)
+		})
+
+		Convey("Timeline follows relayed and bounce queues", func() {
+			timeline, err := lookup.MessageTimeline(ctx, "776E41855DB2")
+			So(err, ShouldBeNil)
+			So(timeline.Queues, ShouldResemble, []string{"776E41855DB2", "A48191855DA0", "4AA091855DA0"})
+
+			So(kinds(timeline.Events), ShouldResemble, []string{
+				"4AA091855DA0:connect",
+				"4AA091855DA0:queue_created",
+				"4AA091855DA0:cleanup",
+				"4AA091855DA0:queued",
+				"776E41855DB2:connect",
+				"776E41855DB2:queue_created",
+				"776E41855DB2:cleanup",
+				"776E41855DB2:queued",
+				"4AA091855DA0:delivery_attempt",
+				"4AA091855DA0:removed",
+				"776E41855DB2:delivery_attempt",
+				"A48191855DA0:cleanup",
+				"A48191855DA0:queued",
+				"776E41855DB2:bounce_created",
+				"776E41855DB2:removed",
+				"A48191855DA0:mailbox_delivery",
+				"A48191855DA0:delivery_attempt",
+				"A48191855DA0:removed",
+			})
+
+			connect := timeline.Events[0]
+			So(connect.Line, ShouldEqual, 1)
+			So(connect.ClientIP, ShouldEqual, "1.2.3.4")
+			So(connect.Time, ShouldResemble, time.Date(2020, time.June, 3, 10, 40, 57, 0, time.UTC))
+
+			relayed := timeline.Events[8]
+			So(relayed.Line, ShouldEqual, 15)
+			So(relayed.RelatedQueue, ShouldEqual, "776E41855DB2")
+			So(relayed.Dsn, ShouldEqual, "2.0.0")
+			So(relayed.Relay, ShouldEqual, "127.0.0.1[127.0.0.1]:10024")
+
+			bounced := timeline.Events[10]
+			So(bounced.Status, ShouldEqual, "bounced")
+			So(bounced.Dsn, ShouldEqual, "5.1.1")
+			So(bounced.Recipient, ShouldEqual, "invalid.email@example.com")
+
+			// logged by dovecot, which does not know the queue
+			saved := timeline.Events[15]
+			So(saved.Line, ShouldEqual, 25)
+			So(saved.Recipient, ShouldEqual, "user@sender.com")
+			So(saved.Description, ShouldEqual, "saved mail to INBOX")
+		})
+
+		Convey("Queue of a delivery", func() {
+			conn, release := db.ConnPool().Acquire()
+
+			var id int64
+			err := conn.QueryRow(`select id from deliveries`).Scan(&id)
+
+			release()
+
+			So(err, ShouldBeNil)
+
+			queue, err := lookup.DeliveryQueue(ctx, id)
+			So(err, ShouldBeNil)
+			So(queue, ShouldEqual, "776E41855DB2")
+
+			_, err = lookup.DeliveryQueue(ctx, id+1)
+			So(errors.Is(err, ErrNoSuchDelivery), ShouldBeTrue)
+		})
+
+		Convey("Unknown queue has empty timeline", func() {
+			timeline, err := lookup.MessageTimeline(ctx, "AAAAAAAAAA")
+			So(err, ShouldBeNil)
+			So(timeline.Events, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,9 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// +build dev !release
+
+//go:generate go run github.com/golang/mock/mockgen -destination=mock/lookup_mock.go gitlab.com/lightmeter/controlcenter/messagelookup Lookup
+
+package messagelookup
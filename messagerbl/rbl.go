@@ -6,6 +6,7 @@ package messagerbl
 
 import (
 	"context"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
 	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
 	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
 	"gitlab.com/lightmeter/controlcenter/pkg/runner"
@@ -32,15 +33,40 @@ type matcher struct {
 }
 
 func (m matcher) match(r record) bool {
+	return m.matchText(r.payload.Dsn, r.payload.ExtraMessage)
+}
+
+func (m matcher) matchText(dsn, message string) bool {
 	// If dsn code is not available, ignore it
-	dsnMatches := (len(m.dsn) > 0 && r.payload.Dsn == m.dsn) || len(m.dsn) == 0
-	matches := dsnMatches && m.pattern.Match([]byte(r.payload.ExtraMessage))
+	dsnMatches := (len(m.dsn) > 0 && dsn == m.dsn) || len(m.dsn) == 0
+	matches := dsnMatches && m.pattern.MatchString(message)
 
 	return matches
 }
 
 type matchers []matcher
 
+type bounceClassifier struct {
+	matchers matchers
+}
+
+// Classify implements bounceclass.Producer, as messages blocked by
+// any of the known hosts are caused by the reputation of the sender
+func (c bounceClassifier) Classify(dsn, message string) (bounceclass.Category, bool) {
+	for _, m := range c.matchers {
+		if m.matchText(dsn, message) {
+			return bounceclass.CategoryReputation, true
+		}
+	}
+
+	return bounceclass.CategoryOther, false
+}
+
+// BounceClassifier classifies messages blocked by the known hosts
+func BounceClassifier() bounceclass.Producer {
+	return bounceClassifier{matchers: defaultMatchers}
+}
+
 func (p *Publisher) Publish(r postfix.Record) {
 	// NOTE: We do the filtering here as writing to the channel is potentially blocking,
 	// and this `if` is deterministic in behaviour, whereas the proper filtering
@@ -7,6 +7,7 @@ package messagerbl
 import (
 	"context"
 	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
 	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
 	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
 	"net"
@@ -105,3 +106,16 @@ func TestRBL(t *testing.T) {
 		})
 	})
 }
+
+func TestBounceClassifier(t *testing.T) {
+	Convey("Messages blocked by known hosts are caused by the sender reputation", t, func() {
+		c := BounceClassifier()
+
+		category, ok := c.Classify("5.0.0", `(host us-smtp-inbound-2.mimecast.com[11.22.33.44] said: 550 csi.mimecast.org Poor Reputation Sender. - https://community.mimecast.com/docs/DOC-1369#550 [EM-f6hnWN9maa42OLPquOA.us166] (in reply to RCPT TO command))`)
+		So(ok, ShouldBeTrue)
+		So(category, ShouldEqual, bounceclass.CategoryReputation)
+
+		_, ok = c.Classify("5.1.1", `(host mx.example.com[11.22.33.44] said: 550 5.1.1 <invalid.email@example.com> User unknown (in reply to RCPT TO command))`)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package parsercoverage collects statistics about which log lines could not be understood by the parser,
+// along with anonymized samples of them, for finding out which parts of the logs Control Center is blind to.
+package parsercoverage
+
+import (
+	"errors"
+	"github.com/rs/zerolog/log"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const (
+	// How many distinct line shapes are kept for each process/daemon
+	maxSamplesPerSource = 10
+
+	// Longer samples are truncated, as they are meant only to show the shape of a line
+	maxSampleLength = 300
+)
+
+type source struct {
+	process string
+	daemon  string
+}
+
+type sample struct {
+	line  string
+	count int
+}
+
+type counts struct {
+	parsed      int
+	unsupported int
+	invalid     int
+	samples     map[string]*sample
+}
+
+// Collector is safe to be used concurrently, as lines can be parsed by different log sources at the same time
+type Collector struct {
+	sync.Mutex
+	sources map[source]*counts
+}
+
+func New() *Collector {
+	return &Collector{sources: map[source]*counts{}}
+}
+
+// Observe can be used as a parser.Observer
+func (c *Collector) Observe(h parser.Header, content []byte, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	key := source{process: h.Process, daemon: h.Daemon}
+
+	s, ok := c.sources[key]
+	if !ok {
+		s = &counts{samples: map[string]*sample{}}
+		c.sources[key] = s
+	}
+
+	switch {
+	case err == nil:
+		s.parsed++
+		return
+	case errors.Is(err, parser.ErrUnsupportedLogLine):
+		s.unsupported++
+	default:
+		s.invalid++
+	}
+
+	line := anonymize(content)
+
+	if sample, ok := s.samples[line]; ok {
+		sample.count++
+		return
+	}
+
+	if len(s.samples) < maxSamplesPerSource {
+		s.samples[line] = &sample{line: line, count: 1}
+	}
+}
+
+// Counts are the number of lines logged by a process/daemon,
+// where invalid lines, without a header, have empty process and daemon
+type Counts struct {
+	Process     string `json:"process"`
+	Daemon      string `json:"daemon"`
+	Parsed      int    `json:"parsed"`
+	Unsupported int    `json:"unsupported"`
+	Invalid     int    `json:"invalid"`
+}
+
+// Sample is an anonymized line not understood by the parser, along with how many lines had the same shape
+type Sample struct {
+	Process string `json:"process"`
+	Daemon  string `json:"daemon"`
+	Line    string `json:"line"`
+	Count   int    `json:"count"`
+}
+
+type Report struct {
+	Counts  []Counts `json:"counts"`
+	Samples []Sample `json:"samples"`
+}
+
+// Report returns the sources with most lines not understood first
+func (c *Collector) Report() Report {
+	c.Lock()
+	defer c.Unlock()
+
+	r := Report{Counts: []Counts{}, Samples: []Sample{}}
+
+	for k, s := range c.sources {
+		r.Counts = append(r.Counts, Counts{
+			Process:     k.process,
+			Daemon:      k.daemon,
+			Parsed:      s.parsed,
+			Unsupported: s.unsupported,
+			Invalid:     s.invalid,
+		})
+
+		for _, sample := range s.samples {
+			r.Samples = append(r.Samples, Sample{Process: k.process, Daemon: k.daemon, Line: sample.line, Count: sample.count})
+		}
+	}
+
+	sort.Slice(r.Counts, func(i, j int) bool {
+		a, b := r.Counts[i], r.Counts[j]
+		if a.Unsupported+a.Invalid != b.Unsupported+b.Invalid {
+			return a.Unsupported+a.Invalid > b.Unsupported+b.Invalid
+		}
+
+		if a.Process != b.Process {
+			return a.Process < b.Process
+		}
+
+		return a.Daemon < b.Daemon
+	})
+
+	sort.Slice(r.Samples, func(i, j int) bool {
+		a, b := r.Samples[i], r.Samples[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+
+		return a.Line < b.Line
+	})
+
+	return r
+}
+
+// LogSummary logs how many lines of each process/daemon could not be understood
+func (c *Collector) LogSummary() {
+	for _, counts := range c.Report().Counts {
+		if counts.Unsupported == 0 && counts.Invalid == 0 {
+			continue
+		}
+
+		if len(counts.Process) == 0 {
+			log.Info().Msgf("Lines without a valid header: %d", counts.Invalid)
+			continue
+		}
+
+		log.Info().Msgf("Lines from %s/%s: %d parsed, %d unsupported, %d invalid",
+			counts.Process, counts.Daemon, counts.Parsed, counts.Unsupported, counts.Invalid)
+	}
+}
+
+type replacement struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// The order matters, as, for instance, emails contain hostnames, which contain numbers
+var replacements = []replacement{
+	{regexp.MustCompile(`[^\s<>()\[\]"',;=:]+@[A-Za-z0-9.-]+`), "<email>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)[0-9a-f:]*::[0-9a-f:]*|\b[0-9a-f]{1,4}(:[0-9a-f]{1,4}){3,7}\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b[a-z0-9-]+(\.[a-z0-9-]+)*\.[a-z]{2,}\b`), "<host>"},
+	{regexp.MustCompile(`\b[0-9A-F]{6,}\b`), "<queue>"},
+	{regexp.MustCompile(`\d+`), "<n>"},
+}
+
+// anonymize replaces any personal data in a line, as addresses, hostnames and numbers,
+// keeping only its shape
+func anonymize(content []byte) string {
+	if len(content) > maxSampleLength {
+		content = content[:maxSampleLength]
+	}
+
+	for _, r := range replacements {
+		content = r.pattern.ReplaceAll(content, []byte(r.replacement))
+	}
+
+	return string(content)
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parsercoverage
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"testing"
+)
+
+func TestAnonymization(t *testing.T) {
+	Convey("Anonymization", t, func() {
+		So(anonymize([]byte(`407032C4FF6A: DKIM-Signature field added (s=mail, d=lightmeter.io)`)),
+			ShouldEqual, `<queue>: DKIM-Signature field added (s=mail, d=<host>)`)
+
+		So(anonymize([]byte(`(12345-01) Passed CLEAN {RelayedInbound}, [11.22.33.44]:5678 <sender@example.com> -> <recipient@example.org>, Hits: -1.5`)),
+			ShouldEqual, `(<n>-<n>) Passed CLEAN {RelayedInbound}, [<ip>]:<n> <<email>> -> <<email>>, Hits: -<n>.<n>`)
+
+		So(anonymize([]byte(`connect from mail.example.com[2001:db8::1]`)),
+			ShouldEqual, `connect from <host>[<ip>]`)
+
+		So(anonymize([]byte(`connect from mail.example.com[2001:db8:0:0:0:0:0:1]`)),
+			ShouldEqual, `connect from <host>[<ip>]`)
+	})
+}
+
+func TestCollector(t *testing.T) {
+	Convey("Collector", t, func() {
+		c := New()
+
+		parse := func(line string) {
+			// the observer is notified by the parser itself
+			_, _, _ = parser.Parse([]byte(line))
+		}
+
+		parser.SetObserver(c.Observe)
+		defer parser.SetObserver(nil)
+
+		Convey("Nothing observed", func() {
+			So(c.Report(), ShouldResemble, Report{Counts: []Counts{}, Samples: []Sample{}})
+		})
+
+		Convey("Lines are counted and sampled", func() {
+			parse(`Sep 16 00:07:43 smtpnode07 postfix-10.20.30.40/smtpd[2342]: connect from unknown[11.22.33.44]`)
+			parse(`Apr  5 19:00:02 mail opendkim[195]: 407032C4FF6A: key retrieval failed (s=mail, d=lightmeter.io)`)
+			parse(`Apr  5 19:00:03 mail opendkim[195]: 507032C4FF6B: key retrieval failed (s=mail, d=example.com)`)
+			parse(`Apr  5 19:00:04 mail opendkim[195]: 607032C4FF6C: no signing table match for 'user@example.com'`)
+			parse(`Invalid Line`)
+
+			r := c.Report()
+
+			So(r.Counts, ShouldResemble, []Counts{
+				{Process: "opendkim", Daemon: "", Unsupported: 3},
+				{Process: "", Daemon: "", Invalid: 1},
+				{Process: "postfix", Daemon: "smtpd", Parsed: 1},
+			})
+
+			So(r.Samples, ShouldResemble, []Sample{
+				{Process: "opendkim", Line: `<queue>: key retrieval failed (s=mail, d=<host>)`, Count: 2},
+				{Process: "opendkim", Line: `<queue>: no signing table match for '<email>'`, Count: 1},
+				{Process: "", Line: `Invalid Line`, Count: 1},
+			})
+		})
+
+		Convey("Samples are bounded", func() {
+			for i := 0; i < maxSamplesPerSource*2; i++ {
+				parse(fmt.Sprintf(`Apr  5 19:00:02 mail myfilter[195]: shape number %c`, 'a'+i))
+			}
+
+			r := c.Report()
+
+			So(r.Counts, ShouldResemble, []Counts{{Process: "myfilter", Unsupported: maxSamplesPerSource * 2}})
+			So(len(r.Samples), ShouldEqual, maxSamplesPerSource)
+		})
+	})
+}
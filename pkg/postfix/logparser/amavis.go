@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"bytes"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeAmavisVerdict, convertAmavisVerdict)
+}
+
+// ContentFilterVerdict is the outcome of checking a message for spam and viruses,
+// by amavis or SpamAssassin
+type ContentFilterVerdict int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+
+	ContentFilterClean ContentFilterVerdict = iota
+	ContentFilterSpam
+	ContentFilterSpammy
+	ContentFilterInfected
+	ContentFilterBanned
+	ContentFilterBadHeader
+	ContentFilterUnchecked
+	ContentFilterOversized
+	ContentFilterOther
+)
+
+var amavisCategories = map[string]ContentFilterVerdict{
+	"CLEAN":       ContentFilterClean,
+	"SPAM":        ContentFilterSpam,
+	"SPAMMY":      ContentFilterSpammy,
+	"INFECTED":    ContentFilterInfected,
+	"VIRUS":       ContentFilterInfected,
+	"BANNED":      ContentFilterBanned,
+	"BAD-HEADER":  ContentFilterBadHeader,
+	"UNCHECKED":   ContentFilterUnchecked,
+	"OVERSIZED":   ContentFilterOversized,
+	"MTA-BLOCKED": ContentFilterOther,
+	"OTHER":       ContentFilterOther,
+}
+
+func (v ContentFilterVerdict) String() string {
+	switch v {
+	case ContentFilterClean:
+		return "clean"
+	case ContentFilterSpam:
+		return "spam"
+	case ContentFilterSpammy:
+		return "spammy"
+	case ContentFilterInfected:
+		return "infected"
+	case ContentFilterBanned:
+		return "banned"
+	case ContentFilterBadHeader:
+		return "bad_header"
+	case ContentFilterUnchecked:
+		return "unchecked"
+	case ContentFilterOversized:
+		return "oversized"
+	case ContentFilterOther:
+		return "other"
+	}
+
+	return "unknown"
+}
+
+// AmavisVerdict is logged by amavis once it checks a message, which is then either
+// passed on to postfix or blocked
+type AmavisVerdict struct {
+	// Empty when amavis is not configured to log it
+	Queue     string
+	MessageId string
+
+	Blocked bool
+	Verdict ContentFilterVerdict
+
+	// As the name of the virus found
+	Details string
+
+	// The SpamAssassin score, only when HasScore is true
+	Score    float32
+	HasScore bool
+}
+
+func (AmavisVerdict) isPayload() {
+	// required by Payload interface
+}
+
+// amavis appends a number to some categories, as in `BAD-HEADER-0`
+func amavisCategory(c []byte) ContentFilterVerdict {
+	if v, ok := amavisCategories[string(c)]; ok {
+		return v
+	}
+
+	if index := bytes.LastIndexByte(c, '-'); index != -1 {
+		if _, err := atoi(c[index+1:]); err == nil {
+			return amavisCategory(c[:index])
+		}
+	}
+
+	return ContentFilterOther
+}
+
+func convertAmavisVerdict(r rawparser.RawPayload) (Payload, error) {
+	p := r.AmavisVerdict
+
+	v := AmavisVerdict{
+		Queue:     string(p.Queue),
+		MessageId: string(p.MessageId),
+		Blocked:   string(p.Action) == "Blocked",
+		Verdict:   amavisCategory(p.Category),
+		Details:   string(p.Details),
+	}
+
+	if len(p.Hits) > 0 && string(p.Hits) != "-" {
+		score, err := atof(p.Hits)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		v.Score, v.HasScore = score, true
+	}
+
+	return v, nil
+}
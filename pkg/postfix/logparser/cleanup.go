@@ -36,6 +36,7 @@ func convertCleanupMessageAccepted(r rawparser.RawPayload) (Payload, error) {
 type CleanupMilterReject struct {
 	Queue        string
 	ExtraMessage string
+	Info         RejectInfo
 }
 
 func (CleanupMilterReject) isPayload() {
@@ -45,8 +46,13 @@ func (CleanupMilterReject) isPayload() {
 func convertCleanupMilterReject(r rawparser.RawPayload) (Payload, error) {
 	p := r.CleanupMilterReject
 
+	extraMessage := string(p.ExtraMessage)
+
+	info, _ := ParseRejectInfo(extraMessage)
+
 	return CleanupMilterReject{
 		Queue:        string(p.Queue),
-		ExtraMessage: string(p.ExtraMessage),
+		ExtraMessage: extraMessage,
+		Info:         info,
 	}, nil
 }
@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"io"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+)
+
+// CustomRulesFilename is the name of the file, in the workspace directory,
+// describing how to parse lines from daemons not supported by the parser,
+// as custom milters, content filters or policy daemons
+const CustomRulesFilename = "parser_rules.json"
+
+type CustomFieldType int
+
+const (
+	CustomFieldText CustomFieldType = iota
+	CustomFieldInt
+	CustomFieldFloat
+	CustomFieldIP
+)
+
+var customFieldTypes = map[string]CustomFieldType{
+	"text":  CustomFieldText,
+	"int":   CustomFieldInt,
+	"float": CustomFieldFloat,
+	"ip":    CustomFieldIP,
+}
+
+func (t CustomFieldType) String() string {
+	for k, v := range customFieldTypes {
+		if v == t {
+			return k
+		}
+	}
+
+	return "unknown"
+}
+
+var ErrUnknownCustomFieldType = errors.New("Unknown field type")
+
+func (t CustomFieldType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *CustomFieldType) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	v, ok := customFieldTypes[s]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCustomFieldType, s)
+	}
+
+	*t = v
+
+	return nil
+}
+
+// CustomPayload is a line matched by one of the rules in the workspace.
+// Each field is a named capture of the rule pattern, whose value is a string, int64, float64 or net.IP,
+// according to the type declared in the rule. Captures that do not take part in the match are left out
+type CustomPayload struct {
+	Rule   string
+	Fields map[string]interface{}
+}
+
+func (CustomPayload) isPayload() {
+	// required by Payload interface
+}
+
+type rawCustomRule struct {
+	// Identifies the records matched by this rule
+	Name string `json:"name"`
+
+	Process string `json:"process"`
+
+	// If empty, lines logged by any daemon of the process match
+	Daemon string `json:"daemon,omitempty"`
+
+	// Regular expression with named captures matched against what comes after the header
+	Pattern string `json:"pattern"`
+
+	// Type of the named captures. The ones not listed here are text
+	Fields map[string]CustomFieldType `json:"fields,omitempty"`
+}
+
+type rawCustomRules struct {
+	Rules []rawCustomRule `json:"rules"`
+}
+
+type customRule struct {
+	name    string
+	process string
+	daemon  string
+	pattern *regexp.Regexp
+	fields  map[string]CustomFieldType
+}
+
+// CustomRules is an ordered list of rules, where the first one matching a line defines its payload
+type CustomRules struct {
+	rules []customRule
+}
+
+func (r *CustomRules) Len() int {
+	return len(r.rules)
+}
+
+var (
+	ErrInvalidCustomRule  = errors.New("A rule must have a name, a process and a pattern")
+	ErrUnknownCustomField = errors.New("Field is not a named capture of the pattern")
+)
+
+func ParseCustomRules(reader io.Reader) (*CustomRules, error) {
+	var raw rawCustomRules
+
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	rules := &CustomRules{rules: make([]customRule, 0, len(raw.Rules))}
+
+	for i, r := range raw.Rules {
+		if len(r.Name) == 0 || len(r.Process) == 0 || len(r.Pattern) == 0 {
+			return nil, fmt.Errorf("Rule %d: %w", i, ErrInvalidCustomRule)
+		}
+
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, errorutil.Wrap(err, "rule: ", r.Name)
+		}
+
+		fields := map[string]CustomFieldType{}
+
+		for _, name := range pattern.SubexpNames() {
+			if len(name) > 0 {
+				fields[name] = CustomFieldText
+			}
+		}
+
+		for name, t := range r.Fields {
+			if _, ok := fields[name]; !ok {
+				return nil, fmt.Errorf("Rule %s, field %s: %w", r.Name, name, ErrUnknownCustomField)
+			}
+
+			fields[name] = t
+		}
+
+		rules.rules = append(rules.rules, customRule{
+			name:    r.Name,
+			process: r.Process,
+			daemon:  r.Daemon,
+			pattern: pattern,
+			fields:  fields,
+		})
+	}
+
+	return rules, nil
+}
+
+// LoadCustomRules returns the rules in the workspace directory, if they exist,
+// otherwise no rules at all
+func LoadCustomRules(workspaceDirectory string) (*CustomRules, error) {
+	filename := path.Join(workspaceDirectory, CustomRulesFilename)
+
+	f, err := os.Open(filename)
+
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return &CustomRules{}, nil
+	}
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(f.Close()) }()
+
+	rules, err := ParseCustomRules(f)
+	if err != nil {
+		return nil, errorutil.Wrap(err, "file: ", filename)
+	}
+
+	return rules, nil
+}
+
+func convertCustomField(t CustomFieldType, value string) (interface{}, bool) {
+	switch t {
+	case CustomFieldText:
+		return value, true
+	case CustomFieldInt:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return v, err == nil
+	case CustomFieldFloat:
+		v, err := strconv.ParseFloat(value, 64)
+		return v, err == nil
+	case CustomFieldIP:
+		v := net.ParseIP(value)
+		return v, v != nil
+	}
+
+	return nil, false
+}
+
+func (r customRule) match(h Header, content []byte) (CustomPayload, bool) {
+	if h.Process != r.process || (len(r.daemon) > 0 && h.Daemon != r.daemon) {
+		return CustomPayload{}, false
+	}
+
+	indexes := r.pattern.FindSubmatchIndex(content)
+	if indexes == nil {
+		return CustomPayload{}, false
+	}
+
+	p := CustomPayload{Rule: r.name, Fields: map[string]interface{}{}}
+
+	for i, name := range r.pattern.SubexpNames() {
+		// unnamed captures, or ones not taking part in the match
+		if len(name) == 0 || indexes[2*i] == -1 {
+			continue
+		}
+
+		v, ok := convertCustomField(r.fields[name], string(content[indexes[2*i]:indexes[2*i+1]]))
+
+		// a value that cannot be converted means the line is not what the rule expects
+		if !ok {
+			return CustomPayload{}, false
+		}
+
+		p.Fields[name] = v
+	}
+
+	return p, true
+}
+
+func (r *CustomRules) Match(h Header, content []byte) (CustomPayload, bool) {
+	for _, rule := range r.rules {
+		if p, ok := rule.match(h, content); ok {
+			return p, true
+		}
+	}
+
+	return CustomPayload{}, false
+}
+
+var customRules atomic.Value
+
+func init() {
+	customRules.Store(&CustomRules{})
+}
+
+// SetCustomRules replaces the rules used by Parse on lines it does not support otherwise
+func SetCustomRules(rules *CustomRules) {
+	customRules.Store(rules)
+}
+
+func matchCustomRules(h Header, content []byte) (CustomPayload, bool) {
+	return customRules.Load().(*CustomRules).Match(h, content)
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const customRulesContent = `
+{
+  "rules": [
+    {
+      "name": "spf_policy",
+      "process": "policyd-spf",
+      "pattern": "^prepend Received-SPF: (?P<result>\\w+) .*client-ip=(?P<client_ip>[^;]+); .*envelope-from=\"?(?P<sender>[^\";]+)",
+      "fields": {"client_ip": "ip"}
+    },
+    {
+      "name": "filter_score",
+      "process": "postfix",
+      "daemon": "filter",
+      "pattern": "^(?P<queue>[0-9A-F]+): score=(?P<score>[0-9.]+)( tests=(?P<tests>\\S+))?( size=(?P<size>\\d+))?",
+      "fields": {"score": "float", "size": "int"}
+    }
+  ]
+}
+`
+
+func TestCustomRules(t *testing.T) {
+	Convey("Custom Rules", t, func() {
+		Convey("Invalid rules", func() {
+			for _, s := range []string{
+				`not json`,
+				`{"rules": [{"process": "p", "pattern": "a"}]}`,
+				`{"rules": [{"name": "n", "pattern": "a"}]}`,
+				`{"rules": [{"name": "n", "process": "p"}]}`,
+				`{"rules": [{"name": "n", "process": "p", "pattern": "(("}]}`,
+				`{"rules": [{"name": "n", "process": "p", "pattern": "(?P<a>.*)", "fields": {"a": "date"}}]}`,
+				`{"rules": [{"name": "n", "process": "p", "pattern": "(?P<a>.*)", "fields": {"b": "int"}}]}`,
+			} {
+				_, err := ParseCustomRules(strings.NewReader(s))
+				So(err, ShouldNotBeNil)
+			}
+
+			_, err := ParseCustomRules(strings.NewReader(`{"rules": [{"name": "n", "process": "p", "pattern": "(?P<a>.*)", "fields": {"b": "int"}}]}`))
+			So(errors.Is(err, ErrUnknownCustomField), ShouldBeTrue)
+		})
+
+		rules, err := ParseCustomRules(strings.NewReader(customRulesContent))
+		So(err, ShouldBeNil)
+		So(rules.Len(), ShouldEqual, 2)
+
+		SetCustomRules(rules)
+		defer SetCustomRules(&CustomRules{})
+
+		Convey("Lines from other daemons are matched", func() {
+			h, p, err := Parse([]byte(`Apr  5 19:00:02 mail policyd-spf[1234]: prepend Received-SPF: Pass (mailfrom) identity=mailfrom; ` +
+				`client-ip=11.22.33.44; helo=mx.example.com; envelope-from=sender@example.com; receiver=<UNKNOWN>`))
+
+			So(err, ShouldBeNil)
+			So(h.Process, ShouldEqual, "policyd-spf")
+			So(p, ShouldResemble, CustomPayload{
+				Rule: "spf_policy",
+				Fields: map[string]interface{}{
+					"result":    "Pass",
+					"client_ip": net.ParseIP("11.22.33.44"),
+					"sender":    "sender@example.com",
+				},
+			})
+		})
+
+		Convey("Optional captures are left out when not matched", func() {
+			_, p, err := Parse([]byte(`Apr  5 19:00:02 mail postfix/filter[1234]: 407032C4FF6A: score=4.5 size=1024`))
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, CustomPayload{
+				Rule: "filter_score",
+				Fields: map[string]interface{}{
+					"queue": "407032C4FF6A",
+					"score": float64(4.5),
+					"size":  int64(1024),
+				},
+			})
+		})
+
+		Convey("Lines from other daemons of the same process are not matched", func() {
+			_, p, err := Parse([]byte(`Apr  5 19:00:02 mail postfix/otherfilter[1234]: 407032C4FF6A: score=4.5 size=1024`))
+			So(p, ShouldBeNil)
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+
+		Convey("Values that cannot be converted do not match", func() {
+			_, p, err := Parse([]byte(`Apr  5 19:00:02 mail policyd-spf[1234]: prepend Received-SPF: Pass (mailfrom) identity=mailfrom; ` +
+				`client-ip=not-an-ip; helo=mx.example.com; envelope-from=sender@example.com; receiver=<UNKNOWN>`))
+			So(p, ShouldBeNil)
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+
+		Convey("Lines supported by the parser are not affected", func() {
+			_, p, err := Parse([]byte(`Sep 16 00:07:43 smtpnode07 postfix-10.20.30.40/smtpd[2342]: connect from unknown[11.22.33.44]`))
+			So(err, ShouldBeNil)
+			_, ok := p.(SmtpdConnect)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("Load from workspace", func() {
+			dir, err := ioutil.TempDir("", "")
+			So(err, ShouldBeNil)
+
+			defer os.RemoveAll(dir)
+
+			Convey("No rules when there's no file", func() {
+				rules, err := LoadCustomRules(dir)
+				So(err, ShouldBeNil)
+				So(rules.Len(), ShouldEqual, 0)
+			})
+
+			Convey("Rules in the workspace", func() {
+				So(ioutil.WriteFile(path.Join(dir, CustomRulesFilename), []byte(customRulesContent), 0600), ShouldBeNil)
+				rules, err := LoadCustomRules(dir)
+				So(err, ShouldBeNil)
+				So(rules.Len(), ShouldEqual, 2)
+			})
+
+			Convey("Invalid file", func() {
+				So(ioutil.WriteFile(path.Join(dir, CustomRulesFilename), []byte(`{"rules": [{"name": "n"}]}`), 0600), ShouldBeNil)
+				_, err := LoadCustomRules(dir)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
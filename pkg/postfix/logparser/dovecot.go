@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeDovecotLmtpDelivery, convertDovecotLmtpDelivery)
+}
+
+// DovecotLmtpDelivery is logged by Dovecot when a message received from postfix/lmtp
+// is stored into a mailbox, or fails to be, for instance, when the mailbox is full
+type DovecotLmtpDelivery struct {
+	User      string
+	Session   string
+	MessageId string
+	Mailbox   string
+	Saved     bool
+
+	// Why the message could not be saved
+	Reason string
+}
+
+func (DovecotLmtpDelivery) isPayload() {
+	// required by Payload interface
+}
+
+func convertDovecotLmtpDelivery(r rawparser.RawPayload) (Payload, error) {
+	p := r.DovecotLmtpDelivery
+
+	return DovecotLmtpDelivery{
+		User:      string(p.User),
+		Session:   string(p.Session),
+		MessageId: string(p.MessageId),
+		Mailbox:   string(p.Mailbox),
+		Saved:     len(p.Reason) == 0,
+		Reason:    string(p.Reason),
+	}, nil
+}
@@ -71,6 +71,17 @@ type Header struct {
 	ProcessIP net.IP
 }
 
+// Instance is the postfix instance that logged the line, which is the process name,
+// as "postfix", or "postfix-in" for an instance managed by postmulti.
+// It's empty for lines not logged by postfix
+func (h Header) Instance() string {
+	if !rawparser.IsPostfixInstance(h.Process) {
+		return ""
+	}
+
+	return h.Process
+}
+
 func parseHeader(h rawparser.RawHeader) (Header, error) {
 	day, err := atoi(bytes.TrimLeft(h.Day, ` `))
 
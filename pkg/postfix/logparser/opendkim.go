@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeOpenDkimSignature, convertOpenDkimSignature)
+}
+
+// OpenDkimSignature is logged by OpenDKIM when it adds a DKIM signature to a message,
+// usually an outbound one
+type OpenDkimSignature struct {
+	Queue    string
+	Selector string
+	Domain   string
+}
+
+func (OpenDkimSignature) isPayload() {
+	// required by Payload interface
+}
+
+func convertOpenDkimSignature(r rawparser.RawPayload) (Payload, error) {
+	p := r.OpenDkimSignature
+
+	return OpenDkimSignature{
+		Queue:    string(p.Queue),
+		Selector: string(p.Selector),
+		Domain:   string(p.Domain),
+	}, nil
+}
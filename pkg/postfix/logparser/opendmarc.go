@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeOpenDmarcResult, convertOpenDmarcResult)
+}
+
+type DmarcResult int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+
+	// The domain has no DMARC policy
+	DmarcNone DmarcResult = iota
+
+	DmarcPass
+	DmarcFail
+
+	// The domain has no DMARC policy, but the message would pass it
+	DmarcBestGuessPass
+)
+
+var dmarcResults = map[string]DmarcResult{
+	"none":          DmarcNone,
+	"pass":          DmarcPass,
+	"fail":          DmarcFail,
+	"bestguesspass": DmarcBestGuessPass,
+}
+
+func (r DmarcResult) String() string {
+	switch r {
+	case DmarcNone:
+		return "none"
+	case DmarcPass:
+		return "pass"
+	case DmarcFail:
+		return "fail"
+	case DmarcBestGuessPass:
+		return "bestguesspass"
+	}
+
+	return "unknown"
+}
+
+// OpenDmarcResult is logged by OpenDMARC once it evaluates the DMARC policy
+// of the domain in the From header of a message, usually an inbound one
+type OpenDmarcResult struct {
+	Queue  string
+	Domain string
+	Result DmarcResult
+}
+
+func (OpenDmarcResult) isPayload() {
+	// required by Payload interface
+}
+
+var ErrUnknownDmarcResult = errors.New("Unknown DMARC result")
+
+func convertOpenDmarcResult(r rawparser.RawPayload) (Payload, error) {
+	p := r.OpenDmarcResult
+
+	result, ok := dmarcResults[string(p.Result)]
+	if !ok {
+		return nil, ErrUnknownDmarcResult
+	}
+
+	return OpenDmarcResult{
+		Queue:  string(p.Queue),
+		Domain: string(p.Domain),
+		Result: result,
+	}, nil
+}
@@ -9,6 +9,7 @@ import (
 	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
 	"strconv"
+	"sync/atomic"
 )
 
 type Payload interface {
@@ -55,30 +56,67 @@ func registerHandler(payloadType rawparser.PayloadType, handler func(rawparser.R
 	handlers[payloadType] = handler
 }
 
+// Observer is notified about the outcome of parsing every line, as for collecting statistics.
+// content is what comes after the header, or the whole line if the header is invalid
+type Observer func(h Header, content []byte, err error)
+
+var observer atomic.Value
+
+func init() {
+	observer.Store(Observer(nil))
+}
+
+// SetObserver replaces the observer of the lines passed to Parse. nil disables it
+func SetObserver(o Observer) {
+	observer.Store(o)
+}
+
 func Parse(line []byte) (Header, Payload, error) {
+	h, p, content, err := parse(line)
+
+	if o := observer.Load().(Observer); o != nil {
+		o(h, content, err)
+	}
+
+	return h, p, err
+}
+
+func parse(line []byte) (Header, Payload, []byte, error) {
 	rawHeader, p, err := rawparser.Parse(line)
 
+	if errors.Is(err, rawparser.ErrInvalidHeaderLine) {
+		return Header{}, nil, line, err
+	}
+
 	if err != nil {
-		return tryToParserHeaderOnly(rawHeader, err)
+		h, _, err := tryToParserHeaderOnly(rawHeader, err)
+
+		if errors.Is(err, ErrUnsupportedLogLine) {
+			if custom, matched := matchCustomRules(h, p.Content); matched {
+				return h, custom, p.Content, nil
+			}
+		}
+
+		return h, nil, p.Content, err
 	}
 
 	h, err := parseHeader(rawHeader)
 
 	if err != nil {
-		return Header{}, nil, err
+		return Header{}, nil, line, err
 	}
 
 	handler, found := handlers[p.PayloadType]
 
 	if !found {
-		return h, nil, rawparser.ErrUnsupportedLogLine
+		return h, nil, p.Content, rawparser.ErrUnsupportedLogLine
 	}
 
 	parsed, err := handler(p)
 
 	if err != nil {
-		return h, nil, err
+		return h, nil, p.Content, err
 	}
 
-	return h, parsed, nil
+	return h, parsed, p.Content, nil
 }
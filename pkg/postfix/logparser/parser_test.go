@@ -124,7 +124,7 @@ func TestParsingUnsupportedGeneralMessage(t *testing.T) {
 	})
 
 	Convey("Unsupported opendkim line, but time is okay", t, func() {
-		h, p, err := Parse([]byte(`Apr  5 19:00:02 mail opendkim[195]: 407032C4FF6A: DKIM-Signature field added (s=mail, d=lightmeter.io)`))
+		h, p, err := Parse([]byte(`Apr  5 19:00:02 mail opendkim[195]: 407032C4FF6A: no signing table match for 'user@lightmeter.io'`))
 		So(err, ShouldEqual, ErrUnsupportedLogLine)
 		So(p, ShouldBeNil)
 		So(h.Process, ShouldEqual, "opendkim")
@@ -578,6 +578,26 @@ func TestSmtpdMailAccepted(t *testing.T) {
 			So(cast, ShouldBeTrue)
 			So(p.IP, ShouldEqual, net.ParseIP(`::1`))
 		})
+
+		Convey("Authenticated client", func() {
+			_, payload, err := Parse([]byte(`Jun  3 10:40:57 mail postfix/submission/smtpd[9708]: 4AA091855DA0: client=some.domain.name[1.2.3.4], sasl_method=PLAIN, sasl_username=user@sender.com`))
+			So(err, ShouldBeNil)
+			p, cast := payload.(SmtpdMailAccepted)
+			So(cast, ShouldBeTrue)
+			So(p.IP, ShouldEqual, net.ParseIP(`1.2.3.4`))
+			So(p.Queue, ShouldEqual, "4AA091855DA0")
+			So(p.SaslMethod, ShouldEqual, "PLAIN")
+			So(p.SaslUsername, ShouldEqual, "user@sender.com")
+		})
+
+		Convey("Authenticated client, with sender", func() {
+			_, payload, err := Parse([]byte(`Jun  3 10:40:57 mail postfix/submission/smtpd[9708]: 4AA091855DA0: client=unknown[1.2.3.4], sasl_method=LOGIN, sasl_username=user, sasl_sender=other@sender.com`))
+			So(err, ShouldBeNil)
+			p, cast := payload.(SmtpdMailAccepted)
+			So(cast, ShouldBeTrue)
+			So(p.SaslMethod, ShouldEqual, "LOGIN")
+			So(p.SaslUsername, ShouldEqual, "user")
+		})
 	})
 }
 
@@ -589,6 +609,19 @@ func TestCleanupMilterReject(t *testing.T) {
 		So(cast, ShouldBeTrue)
 		So(p.Queue, ShouldEqual, "B37FD2E05B9")
 		So(p.ExtraMessage, ShouldEqual, `END-OF-MESSAGE from h-ca74a0a011076cd81347f8f11e[254.65.43.194]: 4.7.1 Try again later; from=<bounce+1b6a63.922c68-user=h-ffd2115d4f@h-79b594737831a5d176dabf9.com> to=<h-7abde52c2@h-ffd2115d4f.com> proto=ESMTP helo=<h-ca74a0a011076cd81347f8f11e>`)
+		So(p.Info, ShouldResemble, RejectInfo{
+			Stage:               "END-OF-MESSAGE",
+			Host:                "h-ca74a0a011076cd81347f8f11e",
+			IP:                  net.ParseIP("254.65.43.194"),
+			Code:                0,
+			Dsn:                 "4.7.1",
+			Reason:              "Try again later",
+			SenderLocalPart:     "bounce+1b6a63.922c68-user=h-ffd2115d4f",
+			SenderDomainPart:    "h-79b594737831a5d176dabf9.com",
+			RecipientLocalPart:  "h-7abde52c2",
+			RecipientDomainPart: "h-ffd2115d4f.com",
+			Helo:                "h-ca74a0a011076cd81347f8f11e",
+		})
 	})
 }
 
@@ -600,5 +633,684 @@ func TestSmtpdReject(t *testing.T) {
 		So(cast, ShouldBeTrue)
 		So(p.Queue, ShouldEqual, "DE81A2E2DAA")
 		So(p.ExtraMessage, ShouldEqual, `RCPT from unknown[2a02:168:636a::15e2]: 550 5.1.1 <h-c715634009216@h-14dc4a6d.com>: Recipient address rejected: User unknown in virtual mailbox table; from=<h-d2315d@h-24e89d.com> to=<h-c715634009216@h-14dc4a6d.com> proto=ESMTP helo=<[IPv6:2a02:168:636a::15e2]>`)
+		So(p.Milter, ShouldBeFalse)
+		So(p.Info, ShouldResemble, RejectInfo{
+			Stage:               "RCPT",
+			Host:                "unknown",
+			IP:                  net.ParseIP("2a02:168:636a::15e2"),
+			Code:                550,
+			Dsn:                 "5.1.1",
+			Reason:              "Recipient address rejected: User unknown in virtual mailbox table",
+			SenderLocalPart:     "h-d2315d",
+			SenderDomainPart:    "h-24e89d.com",
+			RecipientLocalPart:  "h-c715634009216",
+			RecipientDomainPart: "h-14dc4a6d.com",
+			Helo:                "[IPv6:2a02:168:636a::15e2]",
+		})
+	})
+
+	Convey("Smtpd reject without queue", t, func() {
+		_, payload, err := Parse([]byte(`Feb  8 21:28:47 mx postfix/smtpd[1036]: NOQUEUE: reject: RCPT from unknown[11.22.33.44]: 554 5.7.1 Service unavailable; Client host [11.22.33.44] blocked using zen.spamhaus.org; from=<sender@example.com> to=<recipient@example.org> proto=ESMTP helo=<spammer>`))
+		So(err, ShouldBeNil)
+		p, cast := payload.(SmtpdReject)
+		So(cast, ShouldBeTrue)
+		So(p.Queue, ShouldEqual, "NOQUEUE")
+		So(p.Milter, ShouldBeFalse)
+		So(p.Info.Stage, ShouldEqual, "RCPT")
+		So(p.Info.IP, ShouldResemble, net.ParseIP("11.22.33.44"))
+		So(p.Info.Code, ShouldEqual, 554)
+		So(p.Info.Dsn, ShouldEqual, "5.7.1")
+		So(p.Info.Reason, ShouldEqual, "Service unavailable; Client host [11.22.33.44] blocked using zen.spamhaus.org")
+		So(p.Info.SenderDomainPart, ShouldEqual, "example.com")
+		So(p.Info.RecipientLocalPart, ShouldEqual, "recipient")
+	})
+
+	Convey("Smtpd reject on connect, without sender and recipient", t, func() {
+		_, payload, err := Parse([]byte(`Feb  8 21:28:47 mx postfix/smtpd[1036]: NOQUEUE: reject: CONNECT from unknown[11.22.33.44]: 554 5.7.1 <unknown[11.22.33.44]>: Client host rejected: Access denied; proto=SMTP`))
+		So(err, ShouldBeNil)
+		p, cast := payload.(SmtpdReject)
+		So(cast, ShouldBeTrue)
+		So(p.Info.Stage, ShouldEqual, "CONNECT")
+		So(p.Info.Reason, ShouldEqual, "Client host rejected: Access denied")
+		So(p.Info.SenderLocalPart, ShouldEqual, "")
+		So(p.Info.RecipientDomainPart, ShouldEqual, "")
+	})
+
+	Convey("Smtpd milter reject", t, func() {
+		_, payload, err := Parse([]byte(`Feb  8 21:28:47 mx postfix/smtpd[1036]: NOQUEUE: milter-reject: RCPT from unknown[11.22.33.44]: 451 4.7.1 Greylisting in action, please come back later; from=<sender@example.com> to=<recipient@example.org> proto=ESMTP helo=<spammer>`))
+		So(err, ShouldBeNil)
+		p, cast := payload.(SmtpdReject)
+		So(cast, ShouldBeTrue)
+		So(p.Queue, ShouldEqual, "NOQUEUE")
+		So(p.Milter, ShouldBeTrue)
+		So(p.Info.Code, ShouldEqual, 451)
+		So(p.Info.Reason, ShouldEqual, "Greylisting in action, please come back later")
+	})
+}
+
+func TestPostscreen(t *testing.T) {
+	Convey("Postscreen", t, func() {
+		parse := func(line string) Postscreen {
+			_, payload, err := Parse([]byte(`Jan 25 18:54:51 mx postfix/postscreen[8966]: ` + line))
+			So(err, ShouldBeNil)
+			p, cast := payload.(Postscreen)
+			So(cast, ShouldBeTrue)
+			return p
+		}
+
+		Convey("Connect", func() {
+			So(parse(`CONNECT from [18.88.247.65]:50082 to [170.68.1.1]:25`), ShouldResemble, Postscreen{
+				Event: PostscreenConnect,
+				IP:    net.ParseIP("18.88.247.65"),
+				Port:  50082,
+			})
+		})
+
+		Convey("Pass new and old, ipv6", func() {
+			p := parse(`PASS NEW [2001:db8::1]:50082`)
+			So(p.Event, ShouldEqual, PostscreenPassNew)
+			So(p.IP, ShouldResemble, net.ParseIP("2001:db8::1"))
+			So(p.Port, ShouldEqual, 50082)
+
+			So(parse(`PASS OLD [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenPassOld)
+		})
+
+		Convey("Allow and deny lists, with old and new names", func() {
+			So(parse(`WHITELISTED [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenWhitelisted)
+			So(parse(`ALLOWLISTED [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenWhitelisted)
+			So(parse(`WHITELIST VETO [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenWhitelistVeto)
+			So(parse(`BLACKLISTED [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenBlacklisted)
+			So(parse(`DENYLISTED [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenBlacklisted)
+		})
+
+		Convey("DNSBL", func() {
+			p := parse(`DNSBL rank 3 for [18.88.247.65]:50082`)
+			So(p.Event, ShouldEqual, PostscreenDNSBL)
+			So(p.Rank, ShouldEqual, 3)
+			So(p.IP, ShouldResemble, net.ParseIP("18.88.247.65"))
+		})
+
+		Convey("Pregreet", func() {
+			So(parse(`PREGREET 11 after 0.15 from [18.88.247.65]:50082: EHLO spammer\r\n`), ShouldResemble, Postscreen{
+				Event:  PostscreenPregreet,
+				IP:     net.ParseIP("18.88.247.65"),
+				Port:   50082,
+				Bytes:  11,
+				Delay:  0.15,
+				Detail: "EHLO spammer",
+			})
+		})
+
+		Convey("Hangup", func() {
+			p := parse(`HANGUP after 1.2 from [18.88.247.65]:50082 in tests after SMTP handshake`)
+			So(p.Event, ShouldEqual, PostscreenHangup)
+			So(p.Delay, ShouldAlmostEqual, 1.2, 0.001)
+			So(p.Detail, ShouldEqual, "tests after SMTP handshake")
+		})
+
+		Convey("Command tests", func() {
+			p := parse(`COMMAND PIPELINING from [18.88.247.65]:50082 after EHLO: QUIT\r\n`)
+			So(p.Event, ShouldEqual, PostscreenCommandPipelining)
+			So(p.Stage, ShouldEqual, "EHLO")
+			So(p.Detail, ShouldEqual, "QUIT")
+
+			p = parse(`NON-SMTP COMMAND from [18.88.247.65]:50082 after CONNECT: GET / HTTP/1.1`)
+			So(p.Event, ShouldEqual, PostscreenNonSmtpCommand)
+			So(p.Stage, ShouldEqual, "CONNECT")
+			So(p.Detail, ShouldEqual, "GET / HTTP/1.1")
+
+			p = parse(`COMMAND TIME LIMIT from [18.88.247.65]:50082 after RCPT`)
+			So(p.Event, ShouldEqual, PostscreenCommandTimeLimit)
+			So(p.Stage, ShouldEqual, "RCPT")
+
+			So(parse(`BARE NEWLINE from [18.88.247.65]:50082 after DATA`).Event, ShouldEqual, PostscreenBareNewline)
+		})
+
+		Convey("Reject by DNSBL", func() {
+			So(parse(`NOQUEUE: reject: RCPT from [18.88.247.65]:50082: 550 5.7.1 Service unavailable; client [18.88.247.65] blocked using zen.spamhaus.org; from=<sender@example.com>, to=<recipient@example.org>, proto=ESMTP, helo=<spammer>`), ShouldResemble, Postscreen{
+				Event:     PostscreenReject,
+				IP:        net.ParseIP("18.88.247.65"),
+				Port:      50082,
+				Stage:     "RCPT",
+				Detail:    "550 5.7.1 Service unavailable; client [18.88.247.65] blocked using zen.spamhaus.org",
+				Blocklist: "zen.spamhaus.org",
+			})
+		})
+
+		Convey("Reject on connect", func() {
+			p := parse(`NOQUEUE: reject: CONNECT from [18.88.247.65]:50082: too many connections`)
+			So(p.Stage, ShouldEqual, "CONNECT")
+			So(p.Detail, ShouldEqual, "too many connections")
+			So(p.Blocklist, ShouldEqual, "")
+		})
+
+		Convey("Disconnect", func() {
+			So(parse(`DISCONNECT [18.88.247.65]:50082`).Event, ShouldEqual, PostscreenDisconnect)
+		})
+
+		Convey("Unsupported lines", func() {
+			for _, line := range []string{
+				`Useless Payload`,
+				`cache btree:/var/lib/postfix/postscreen_cache full cleanup: retained=1 dropped=0 entries`,
+				`DNSBL rank three for [18.88.247.65]:50082`,
+				`PASS NEW 18.88.247.65:50082`,
+			} {
+				_, _, err := Parse([]byte(`Jan 25 18:54:51 mx postfix/postscreen[8966]: ` + line))
+				So(err, ShouldEqual, ErrUnsupportedLogLine)
+			}
+		})
+	})
+}
+
+func TestSmtpdSaslAuthFailed(t *testing.T) {
+	Convey("SASL authentication failed", t, func() {
+		Convey("Without username", func() {
+			_, payload, err := Parse([]byte(`Oct 25 02:59:46 ucs postfix/smtpd[24944]: warning: h-2dc03ed8c98dd0.h-038860858e95dc[209.170.217.165]: SASL LOGIN authentication failed: UGFzc3dvcmQ6`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpdSaslAuthFailed{
+				Host:   "h-2dc03ed8c98dd0.h-038860858e95dc",
+				IP:     net.ParseIP("209.170.217.165"),
+				Method: "LOGIN",
+				Reason: "UGFzc3dvcmQ6",
+			})
+		})
+
+		Convey("With username", func() {
+			_, payload, err := Parse([]byte(`Oct 25 02:59:46 ucs postfix/submission/smtpd[24944]: warning: unknown[2001:db8::1]: SASL PLAIN authentication failed: authentication failure, sasl_username=admin@example.com`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpdSaslAuthFailed{
+				Host:     "unknown",
+				IP:       net.ParseIP("2001:db8::1"),
+				Method:   "PLAIN",
+				Reason:   "authentication failure",
+				Username: "admin@example.com",
+			})
+		})
+
+		Convey("Other SASL warnings are generic system messages", func() {
+			_, payload, err := Parse([]byte(`Oct 25 02:59:46 ucs postfix/smtpd[24944]: warning: SASL authentication failure: cannot connect to saslauthd server: Connection refused`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessageWarning,
+				Message:  "SASL authentication failure: cannot connect to saslauthd server: Connection refused",
+			})
+		})
+	})
+}
+
+func TestTlsConnectionEstablished(t *testing.T) {
+	Convey("TLS connection established", t, func() {
+		Convey("Outbound, by smtp", func() {
+			//nolint:lll
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: Verified TLS connection established to mx.example.com[11.22.33.44]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits) key-exchange X25519 server-signature RSA-PSS (2048 bits) server-digest SHA256`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, TlsConnectionEstablished{
+				Outbound: true,
+				Trust:    TlsTrustVerified,
+				Host:     "mx.example.com",
+				IP:       net.ParseIP("11.22.33.44"),
+				Port:     25,
+				Protocol: "TLSv1.3",
+				Cipher:   "TLS_AES_256_GCM_SHA384",
+			})
+		})
+
+		Convey("Outbound to an IPv6 address", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: Untrusted TLS connection established to mx.example.com[2001:db8::1]:25: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, TlsConnectionEstablished{
+				Outbound: true,
+				Trust:    TlsTrustUntrusted,
+				Host:     "mx.example.com",
+				IP:       net.ParseIP("2001:db8::1"),
+				Port:     25,
+				Protocol: "TLSv1.2",
+				Cipher:   "ECDHE-RSA-AES256-GCM-SHA384",
+			})
+		})
+
+		Convey("Inbound, by smtpd", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtpd[9708]: Anonymous TLS connection established from unknown[11.22.33.44]: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, TlsConnectionEstablished{
+				Outbound: false,
+				Trust:    TlsTrustAnonymous,
+				Host:     "unknown",
+				IP:       net.ParseIP("11.22.33.44"),
+				Protocol: "TLSv1.2",
+				Cipher:   "ECDHE-RSA-AES256-GCM-SHA384",
+			})
+		})
+
+		Convey("Unknown trust level", func() {
+			_, _, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtpd[9708]: Weird TLS connection established from unknown[11.22.33.44]: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)`))
+			So(err, ShouldEqual, ErrUnknownTlsTrust)
+		})
+
+		Convey("Other TLS lines are not supported", func() {
+			_, _, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: server certificate verification failed for mx.example.com[11.22.33.44]:25: num=10:certificate has expired`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+}
+
+func TestLocalAndVirtualDelivery(t *testing.T) {
+	Convey("Local and virtual use the same struct as SmtpSentStatus", t, func() {
+		Convey("Delivered to mailbox by local", func() {
+			header, parsed, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/local[9708]: 4BCA2E0CBB: to=<user@example.com>, orig_to=<root>, relay=local, delay=0.05, delays=0.02/0.01/0/0.02, dsn=2.0.0, status=sent (delivered to mailbox)`))
+			So(err, ShouldBeNil)
+			So(header.Daemon, ShouldEqual, "local")
+
+			p, cast := parsed.(SmtpSentStatus)
+			So(cast, ShouldBeTrue)
+			So(p.Queue, ShouldEqual, "4BCA2E0CBB")
+			So(p.RecipientLocalPart, ShouldEqual, "user")
+			So(p.RecipientDomainPart, ShouldEqual, "example.com")
+			So(p.RelayName, ShouldEqual, "local")
+			So(p.Status, ShouldEqual, SentStatus)
+			So(p.ExtraMessage, ShouldEqual, `(delivered to mailbox)`)
+		})
+
+		Convey("Delivered to command by local", func() {
+			_, parsed, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/local[9708]: 4BCA2E0CBB: to=<user@example.com>, relay=local, delay=0.05, delays=0.02/0.01/0/0.02, dsn=2.0.0, status=sent (delivered to command: procmail -a "$EXTENSION")`))
+			So(err, ShouldBeNil)
+
+			p, cast := parsed.(SmtpSentStatus)
+			So(cast, ShouldBeTrue)
+			So(p.Status, ShouldEqual, SentStatus)
+			So(p.ExtraMessage, ShouldEqual, `(delivered to command: procmail -a "$EXTENSION")`)
+		})
+
+		Convey("Delivered to maildir by virtual", func() {
+			header, parsed, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/virtual[9708]: 4BCA2E0CBB: to=<user@example.com>, relay=virtual, delay=0.05, delays=0.02/0.01/0/0.02, dsn=2.0.0, status=sent (delivered to maildir)`))
+			So(err, ShouldBeNil)
+			So(header.Daemon, ShouldEqual, "virtual")
+
+			p, cast := parsed.(SmtpSentStatus)
+			So(cast, ShouldBeTrue)
+			So(p.RelayName, ShouldEqual, "virtual")
+			So(p.Status, ShouldEqual, SentStatus)
+		})
+
+		Convey("Mailbox over quota on virtual", func() {
+			_, parsed, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/virtual[9708]: 4BCA2E0CBB: to=<user@example.com>, relay=virtual, delay=0.05, delays=0.02/0.01/0/0.02, dsn=5.2.2, status=bounced (cannot update mailbox /var/mail/vhosts/example.com/user for user user@example.com. error writing message: File too large)`))
+			So(err, ShouldBeNil)
+
+			p, cast := parsed.(SmtpSentStatus)
+			So(cast, ShouldBeTrue)
+			So(p.Dsn, ShouldEqual, "5.2.2")
+			So(p.Status, ShouldEqual, BouncedStatus)
+		})
+	})
+}
+
+func TestDovecotLmtpDelivery(t *testing.T) {
+	Convey("Dovecot LMTP delivery", t, func() {
+		Convey("Saved to INBOX", func() {
+			header, payload, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(user@example.com)<28699><wArTL0TxF2AccAAAYr7Zvw>: msgid=<abc.123@sender.com>: saved mail to INBOX`))
+			So(err, ShouldBeNil)
+			So(header.Process, ShouldEqual, "dovecot")
+			So(payload, ShouldResemble, DovecotLmtpDelivery{
+				User:      "user@example.com",
+				Session:   "wArTL0TxF2AccAAAYr7Zvw",
+				MessageId: "abc.123@sender.com",
+				Mailbox:   "INBOX",
+				Saved:     true,
+			})
+		})
+
+		Convey("Saved by an older Dovecot version", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(28699, user@example.com): wArTL0TxF2AccAAAYr7Zvw: msgid=<abc.123@sender.com>: saved mail to INBOX`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, DovecotLmtpDelivery{
+				User:      "user@example.com",
+				Session:   "wArTL0TxF2AccAAAYr7Zvw",
+				MessageId: "abc.123@sender.com",
+				Mailbox:   "INBOX",
+				Saved:     true,
+			})
+		})
+
+		Convey("Stored by sieve", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(user@example.com)<28699><wArTL0TxF2AccAAAYr7Zvw>: sieve: msgid=<abc.123@sender.com>: stored mail into mailbox 'Lists/Postfix'`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, DovecotLmtpDelivery{
+				User:      "user@example.com",
+				Session:   "wArTL0TxF2AccAAAYr7Zvw",
+				MessageId: "abc.123@sender.com",
+				Mailbox:   "Lists/Postfix",
+				Saved:     true,
+			})
+		})
+
+		Convey("Quota exceeded", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(user@example.com)<28699><wArTL0TxF2AccAAAYr7Zvw>: Error: msgid=<abc.123@sender.com>: save failed to INBOX: Quota exceeded (mailbox for user is full)`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, DovecotLmtpDelivery{
+				User:      "user@example.com",
+				Session:   "wArTL0TxF2AccAAAYr7Zvw",
+				MessageId: "abc.123@sender.com",
+				Mailbox:   "INBOX",
+				Saved:     false,
+				Reason:    "Quota exceeded (mailbox for user is full)",
+			})
+		})
+
+		Convey("Quota exceeded on sieve", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(user@example.com)<28699><wArTL0TxF2AccAAAYr7Zvw>: sieve: msgid=<abc.123@sender.com>: failed to store into mailbox 'INBOX': Quota exceeded (mailbox for user is full)`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, DovecotLmtpDelivery{
+				User:      "user@example.com",
+				Session:   "wArTL0TxF2AccAAAYr7Zvw",
+				MessageId: "abc.123@sender.com",
+				Mailbox:   "INBOX",
+				Saved:     false,
+				Reason:    "Quota exceeded (mailbox for user is full)",
+			})
+		})
+
+		Convey("Other lmtp lines are not supported", func() {
+			_, _, err := Parse([]byte(`Feb  3 02:55:42 mail dovecot: lmtp(28699): Connect from local`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+}
+
+func TestSystemMessage(t *testing.T) {
+	Convey("System messages", t, func() {
+		Convey("Warning by a daemon with its own parser", func() {
+			header, payload, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/smtpd[18568]: warning: hostname mx.example.com does not resolve to address 11.22.33.44`))
+			So(err, ShouldBeNil)
+			So(header.Daemon, ShouldEqual, "smtpd")
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessageWarning,
+				Message:  "hostname mx.example.com does not resolve to address 11.22.33.44",
+			})
+		})
+
+		Convey("Warning by a daemon without its own parser", func() {
+			header, payload, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/trivial-rewrite[18568]: warning: database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual`))
+			So(err, ShouldBeNil)
+			So(header.Daemon, ShouldEqual, "trivial-rewrite")
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessageWarning,
+				Message:  "database /etc/postfix/virtual.db is older than source file /etc/postfix/virtual",
+			})
+		})
+
+		Convey("Fatal", func() {
+			_, payload, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/smtpd[18568]: fatal: open database /etc/postfix/virtual.db: No such file or directory`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessageFatal,
+				Message:  "open database /etc/postfix/virtual.db: No such file or directory",
+			})
+		})
+
+		Convey("Panic", func() {
+			_, payload, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/qmgr[18568]: panic: myfree: corrupt or unallocated memory block`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessagePanic,
+				Message:  "myfree: corrupt or unallocated memory block",
+			})
+		})
+
+		Convey("Error", func() {
+			_, payload, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/smtp[18568]: error: open database /etc/postfix/transport.db: No such file or directory`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SystemMessage{
+				Severity: SystemMessageError,
+				Message:  "open database /etc/postfix/transport.db: No such file or directory",
+			})
+		})
+
+		Convey("Only postfix lines are considered", func() {
+			_, _, err := Parse([]byte(`Oct 13 16:40:39 ucs opendkim[195]: warning: key data is not secure`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+
+		Convey("Lines without severity are still unsupported", func() {
+			_, _, err := Parse([]byte(`Oct 13 16:40:39 ucs postfix/master[18568]: daemon started -- version 3.4.13, configuration /etc/postfix`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+}
+
+func TestSmtpConnectionFailure(t *testing.T) {
+	Convey("SMTP connection failures", t, func() {
+		Convey("Connection timed out", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: connect to mx.example.com[11.22.33.44]:25: Connection timed out`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Kind:   SmtpConnectFailure,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("11.22.33.44"),
+				Port:   25,
+				Reason: "Connection timed out",
+			})
+		})
+
+		Convey("Network unreachable on IPv6", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: connect to mx.example.com[2001:db8::1]:25: Network is unreachable`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Kind:   SmtpConnectFailure,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("2001:db8::1"),
+				Port:   25,
+				Reason: "Network is unreachable",
+			})
+		})
+
+		Convey("Lost connection during a delivery", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: 4BCA2E0CBB: lost connection with mx.example.com[11.22.33.44] while receiving the initial server greeting`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Queue:  "4BCA2E0CBB",
+				Kind:   SmtpLostConnection,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("11.22.33.44"),
+				Reason: "receiving the initial server greeting",
+			})
+		})
+
+		Convey("Lost connection without a queue", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: lost connection with mx.example.com[11.22.33.44] while performing the EHLO handshake`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Kind:   SmtpLostConnection,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("11.22.33.44"),
+				Reason: "performing the EHLO handshake",
+			})
+		})
+
+		Convey("Conversation timed out", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: 4BCA2E0CBB: conversation with mx.example.com[11.22.33.44] timed out while sending end of data -- message may be sent more than once`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Queue:  "4BCA2E0CBB",
+				Kind:   SmtpConversationTimeout,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("11.22.33.44"),
+				Reason: "sending end of data -- message may be sent more than once",
+			})
+		})
+
+		Convey("TLS handshake failure", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: SSL_connect error to mx.example.com[11.22.33.44]:25: lost connection`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SmtpConnectionFailure{
+				Kind:   SmtpTlsFailure,
+				Host:   "mx.example.com",
+				IP:     net.ParseIP("11.22.33.44"),
+				Port:   25,
+				Reason: "lost connection",
+			})
+		})
+
+		Convey("Delivery statuses are still parsed as such", func() {
+			_, payload, err := Parse([]byte(`Feb  3 02:55:42 mail postfix/smtp[9708]: 4BCA2E0CBB: to=<user@example.com>, relay=none, delay=30, delays=0.01/0/30/0, dsn=4.4.1, status=deferred (connect to mx.example.com[11.22.33.44]:25: Connection timed out)`))
+			So(err, ShouldBeNil)
+
+			p, ok := payload.(SmtpSentStatus)
+			So(ok, ShouldBeTrue)
+			So(p.Status, ShouldEqual, DeferredStatus)
+		})
+	})
+}
+
+func TestContentFilters(t *testing.T) {
+	Convey("Amavis verdicts", t, func() {
+		Convey("Passed clean message", func() {
+			h, payload, err := Parse([]byte(`Apr  5 19:00:02 mail amavis[13720]: (13720-05) Passed CLEAN {RelayedOutbound}, ORIGINATING LOCAL [11.22.33.44]:61810 [11.22.33.44] ` +
+				`<sender@example.com> -> <recipient@example.org>, Queue-ID: D4280DC299D, Message-ID: <id@example.com>, mail_id: 1PuXuLcNJCsB, ` +
+				`Hits: -, size: 55031, queued_as: E6E98DC28ED, 277 ms`))
+			So(err, ShouldBeNil)
+			So(h.Process, ShouldEqual, "amavis")
+			So(payload, ShouldResemble, AmavisVerdict{
+				Queue:     "D4280DC299D",
+				MessageId: "id@example.com",
+				Verdict:   ContentFilterClean,
+			})
+		})
+
+		Convey("Blocked spam, by amavisd", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail amavisd[13720]: (13720-06) Blocked SPAM {DiscardedInbound,Quarantined}, [11.22.33.44]:61810 [11.22.33.44] ` +
+				`<sender@example.com> -> <recipient@example.org>, quarantine: spam-xyz, Queue-ID: D4280DC299D, Message-ID: <id@example.com>, ` +
+				`mail_id: xyz, Hits: 15.312, size: 1234, 312 ms`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, AmavisVerdict{
+				Queue:     "D4280DC299D",
+				MessageId: "id@example.com",
+				Blocked:   true,
+				Verdict:   ContentFilterSpam,
+				Score:     15.312,
+				HasScore:  true,
+			})
+		})
+
+		Convey("Blocked virus, without queue", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail amavis[13720]: (03224-01) Blocked INFECTED (Eicar-Test-Signature) {DiscardedInbound,Quarantined}, ` +
+				`[11.22.33.44]:61810 <sender@example.com> -> <recipient@example.org>, Message-ID: <id@example.com>, mail_id: xyz, Hits: -, size: 1234, 312 ms`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, AmavisVerdict{
+				MessageId: "id@example.com",
+				Blocked:   true,
+				Verdict:   ContentFilterInfected,
+				Details:   "Eicar-Test-Signature",
+			})
+		})
+
+		Convey("Numbered categories", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail amavis[13720]: (03224-01) Passed BAD-HEADER-0 {RelayedInbound}, ` +
+				`[11.22.33.44]:61810 <sender@example.com> -> <recipient@example.org>, Queue-ID: D4280DC299D, mail_id: xyz, Hits: 2.1, size: 1234, 312 ms`))
+			So(err, ShouldBeNil)
+			So(payload.(AmavisVerdict).Verdict, ShouldEqual, ContentFilterBadHeader)
+		})
+
+		Convey("Other amavis lines are not supported", func() {
+			_, _, err := Parse([]byte(`Apr  5 19:00:02 mail amavis[13720]: (13720-05) Checking: 1PuXuLcNJCsB ORIGINATING [11.22.33.44]:61810 <sender@example.com> -> <recipient@example.org>`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+
+	Convey("SpamAssassin results", t, func() {
+		Convey("Spam", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail spamd[1234]: spamd: result: Y 15 - BAYES_99,HTML_MESSAGE scantime=0.5,size=1234,user=amavis,` +
+				`uid=110,required_score=5.0,rhost=localhost,raddr=127.0.0.1,rport=45418,mid=<id@example.com>,autolearn=no`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SpamdResult{MessageId: "id@example.com", Verdict: ContentFilterSpam, Score: 15})
+		})
+
+		Convey("Ham", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail spamd[1234]: spamd: result: . -1 - ALL_TRUSTED scantime=0.1,size=1234,user=amavis,` +
+				`uid=110,required_score=5.0,rhost=localhost,raddr=127.0.0.1,rport=45418,mid=<id@example.com>,autolearn=ham`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, SpamdResult{MessageId: "id@example.com", Verdict: ContentFilterClean, Score: -1})
+		})
+
+		Convey("Other lines are not supported", func() {
+			_, _, err := Parse([]byte(`Apr  5 19:00:02 mail spamd[1234]: spamd: identified spam (15.0/5.0) for amavis:110 in 0.5 seconds, 1234 bytes.`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+}
+
+func TestMilters(t *testing.T) {
+	Convey("OpenDKIM", t, func() {
+		Convey("Signature added", func() {
+			h, payload, err := Parse([]byte(`Apr  5 19:00:02 mail opendkim[195]: 407032C4FF6A: DKIM-Signature field added (s=mail, d=example.com)`))
+			So(err, ShouldBeNil)
+			So(h.Process, ShouldEqual, "opendkim")
+			So(payload, ShouldResemble, OpenDkimSignature{Queue: "407032C4FF6A", Selector: "mail", Domain: "example.com"})
+		})
+
+		Convey("Other lines are not supported", func() {
+			_, _, err := Parse([]byte(`Apr  5 19:00:04 mail opendkim[195]: 607032C4FF6C: no signing table match for 'user@example.com'`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+
+	Convey("OpenDMARC", t, func() {
+		Convey("Results", func() {
+			_, payload, err := Parse([]byte(`Apr  5 19:00:02 mail opendmarc[196]: 407032C4FF6A: example.com pass`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, OpenDmarcResult{Queue: "407032C4FF6A", Domain: "example.com", Result: DmarcPass})
+
+			_, payload, err = Parse([]byte(`Apr  5 19:00:02 mail opendmarc[196]: 407032C4FF6A: example.com bestguesspass`))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, OpenDmarcResult{Queue: "407032C4FF6A", Domain: "example.com", Result: DmarcBestGuessPass})
+		})
+
+		Convey("Other lines are not supported", func() {
+			_, _, err := Parse([]byte(`Apr  5 19:00:02 mail opendmarc[196]: 407032C4FF6A: ignoring connection from localhost`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+
+			_, _, err = Parse([]byte(`Apr  5 19:00:02 mail opendmarc[196]: 407032C4FF6A: example.com temperror`))
+			So(err, ShouldEqual, ErrUnsupportedLogLine)
+		})
+	})
+}
+
+func TestPostmultiInstances(t *testing.T) {
+	Convey("Lines logged by postfix instances managed by postmulti", t, func() {
+		Convey("An instance is parsed just as the default one", func() {
+			h, payload, err := Parse([]byte(`Jan 14 12:01:20 mail postfix-out/smtp[9635]: D298F2C60812: to=<user@example.com>, ` +
+				`relay=mx.example.com[17.178.97.79]:25, delay=1.2, delays=0.01/0/0.6/0.6, dsn=2.0.0, status=sent (250 2.0.0 Ok: queued as 3BC3C2C60C00)`))
+			So(err, ShouldBeNil)
+			So(h.Process, ShouldEqual, "postfix-out")
+			So(h.Daemon, ShouldEqual, "smtp")
+			So(h.Instance(), ShouldEqual, "postfix-out")
+
+			p, cast := payload.(SmtpSentStatus)
+			So(cast, ShouldBeTrue)
+			So(p.Queue, ShouldEqual, "D298F2C60812")
+
+			e, cast := p.ExtraMessagePayload.(SmtpStatusExtraMessageSentQueued)
+			So(cast, ShouldBeTrue)
+			So(e.Queue, ShouldEqual, "3BC3C2C60C00")
+		})
+
+		Convey("The default instance", func() {
+			h, _, err := Parse([]byte(`Jan 14 12:01:20 mail postfix/smtpd[1234]: connect from unknown[11.22.33.44]`))
+			So(err, ShouldBeNil)
+			So(h.Instance(), ShouldEqual, "postfix")
+		})
+
+		Convey("System messages from an instance", func() {
+			h, payload, err := Parse([]byte(`Jan 14 12:01:20 mail postfix-in/qmgr[1234]: warning: this is a warning`))
+			So(err, ShouldBeNil)
+			So(h.Instance(), ShouldEqual, "postfix-in")
+			_, cast := payload.(SystemMessage)
+			So(cast, ShouldBeTrue)
+		})
+
+		Convey("Other processes are no instances", func() {
+			h, _, err := Parse([]byte(`Apr  5 19:00:02 mail opendmarc[196]: 407032C4FF6A: example.com pass`))
+			So(err, ShouldBeNil)
+			So(h.Instance(), ShouldEqual, "")
+		})
 	})
 }
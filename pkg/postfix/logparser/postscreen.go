@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"net"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypePostscreen, convertPostscreen)
+}
+
+type PostscreenEvent int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+	PostscreenConnect PostscreenEvent = iota
+	PostscreenPassNew
+	PostscreenPassOld
+	PostscreenWhitelisted
+	PostscreenWhitelistVeto
+	PostscreenBlacklisted
+	PostscreenDisconnect
+	PostscreenDNSBL
+	PostscreenPregreet
+	PostscreenHangup
+	PostscreenCommandPipelining
+	PostscreenCommandTimeLimit
+	PostscreenCommandCountLimit
+	PostscreenCommandLengthLimit
+	PostscreenNonSmtpCommand
+	PostscreenBareNewline
+	PostscreenReject
+)
+
+var postscreenEvents = map[string]PostscreenEvent{
+	"CONNECT":              PostscreenConnect,
+	"PASS NEW":             PostscreenPassNew,
+	"PASS OLD":             PostscreenPassOld,
+	"WHITELISTED":          PostscreenWhitelisted,
+	"ALLOWLISTED":          PostscreenWhitelisted,
+	"WHITELIST VETO":       PostscreenWhitelistVeto,
+	"ALLOWLIST VETO":       PostscreenWhitelistVeto,
+	"BLACKLISTED":          PostscreenBlacklisted,
+	"DENYLISTED":           PostscreenBlacklisted,
+	"DISCONNECT":           PostscreenDisconnect,
+	"DNSBL":                PostscreenDNSBL,
+	"PREGREET":             PostscreenPregreet,
+	"HANGUP":               PostscreenHangup,
+	"COMMAND PIPELINING":   PostscreenCommandPipelining,
+	"COMMAND TIME LIMIT":   PostscreenCommandTimeLimit,
+	"COMMAND COUNT LIMIT":  PostscreenCommandCountLimit,
+	"COMMAND LENGTH LIMIT": PostscreenCommandLengthLimit,
+	"NON-SMTP COMMAND":     PostscreenNonSmtpCommand,
+	"BARE NEWLINE":         PostscreenBareNewline,
+	"NOQUEUE: reject:":     PostscreenReject,
+}
+
+// Postscreen is any event logged by postscreen, which checks the clients
+// before they are allowed to talk to smtpd
+type Postscreen struct {
+	Event PostscreenEvent
+	IP    net.IP
+	Port  int
+
+	// Set on DNSBL, as the combined score of all the lists that know the client
+	Rank int
+
+	// Set on PREGREET, as the number of bytes sent by the client before the greeting
+	Bytes int
+
+	// Seconds since the client connected, on PREGREET and HANGUP
+	Delay float32
+
+	// SMTP stage of a rejection, or command after which a command test failed
+	Stage string
+
+	// The data sent by the client on PREGREET and command tests,
+	// the tests being run on HANGUP, or the reply on rejections
+	Detail string
+
+	// On rejections caused by a DNSBL, the list that caused it
+	Blocklist string
+}
+
+func (Postscreen) isPayload() {
+	// required by interface Payload
+}
+
+var (
+	ErrUnknownPostscreenEvent = errors.New("Unknown postscreen event")
+
+	// Service unavailable; client [1.2.3.4] blocked using zen.spamhaus.org
+	postscreenBlocklistRegexp = regexp.MustCompile(`blocked using ([^\s;,]+)`)
+)
+
+func convertPostscreen(r rawparser.RawPayload) (Payload, error) {
+	p := r.Postscreen
+
+	event, ok := postscreenEvents[string(p.Event)]
+	if !ok {
+		return nil, ErrUnknownPostscreenEvent
+	}
+
+	ip, err := parseIP(p.IP)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	port, err := atoi(p.Port)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	s := Postscreen{
+		Event: event,
+		IP:    ip,
+		Port:  port,
+		Stage: string(p.Stage),
+	}
+
+	// the data sent by the client is logged with escaped line breaks
+	s.Detail = strings.TrimSuffix(string(p.Detail), `\r\n`)
+
+	if len(p.Delay) > 0 {
+		if s.Delay, err = atof(p.Delay); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
+	if len(p.Value) > 0 {
+		value, err := atoi(p.Value)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		switch event {
+		case PostscreenDNSBL:
+			s.Rank = value
+		case PostscreenPregreet:
+			s.Bytes = value
+		}
+	}
+
+	if event == PostscreenReject {
+		// the sender, recipient and helo are not relevant, as the message is never accepted
+		if index := strings.Index(s.Detail, rejectMetadataSeparator); index != -1 {
+			s.Detail = s.Detail[:index]
+		}
+
+		if m := postscreenBlocklistRegexp.FindStringSubmatch(s.Detail); m != nil {
+			s.Blocklist = m[1]
+		}
+	}
+
+	return s, nil
+}
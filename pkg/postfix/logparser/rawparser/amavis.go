@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("amavis", "", parseAmavisPayload)
+	registerHandler("amavisd", "", parseAmavisPayload)
+}
+
+// AmavisVerdict is logged by amavisd-new once it checks a message, as in
+// `(13720-05) Passed CLEAN {RelayedOutbound}, [1.2.3.4]:61810 [1.2.3.4] <sender@example.com> -> <recipient@example.com>, ` +
+// `Queue-ID: D4280DC299D, Message-ID: <id@example.com>, mail_id: 1PuXuLcNJCsB, Hits: -, size: 55031, queued_as: E6E98DC28ED, 277 ms`
+// or `(03224-01) Blocked INFECTED (Eicar-Test-Signature) {DiscardedInbound,Quarantined}, ...`
+type AmavisVerdict struct {
+	// `Passed` or `Blocked`
+	Action []byte
+
+	// As `CLEAN`, `SPAM` or `INFECTED`
+	Category []byte
+
+	// Optional, as the name of the virus found
+	Details []byte
+
+	// The queue the message was received on, logged only by newer versions of amavis
+	Queue []byte
+
+	// Without the angle brackets
+	MessageId []byte
+
+	// SpamAssassin score, or `-` if it was not checked
+	Hits []byte
+}
+
+func parseAmavisPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parseAmavisVerdict(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:   PayloadTypeAmavisVerdict,
+			AmavisVerdict: s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+// the value of a `Name: value` field, until the next comma
+func amavisField(data []byte, name string) []byte {
+	index := bytes.Index(data, []byte(", "+name+": "))
+	if index == -1 {
+		return nil
+	}
+
+	value := data[index+len(", "+name+": "):]
+
+	if end := bytes.IndexByte(value, ','); end != -1 {
+		value = value[:end]
+	}
+
+	return value
+}
+
+// Amavis lines are simple enough to not need a ragel grammar
+func parseAmavisVerdict(data []byte) (AmavisVerdict, bool) {
+	l := postscreenLine(data)
+
+	// the amavis process and message numbers, as `(13720-05)`
+	l, ok := l.literal("(")
+	if !ok {
+		return AmavisVerdict{}, false
+	}
+
+	end := bytes.Index(l, []byte(") "))
+	if end == -1 {
+		return AmavisVerdict{}, false
+	}
+
+	l = l[end+len(") "):]
+
+	r := AmavisVerdict{}
+
+	for _, action := range []string{"Passed", "Blocked"} {
+		if rest, ok := l.literal(action + " "); ok {
+			r.Action, l = []byte(action), rest
+			break
+		}
+	}
+
+	if r.Action == nil {
+		return AmavisVerdict{}, false
+	}
+
+	end = bytes.IndexAny(l, " ,")
+	if end <= 0 {
+		return AmavisVerdict{}, false
+	}
+
+	r.Category, l = l[:end], l[end:]
+
+	if rest, ok := l.literal(" ("); ok {
+		end := bytes.IndexByte(rest, ')')
+		if end == -1 {
+			return AmavisVerdict{}, false
+		}
+
+		r.Details, l = rest[:end], rest[end+1:]
+	}
+
+	r.Queue = amavisField(l, "Queue-ID")
+	r.Hits = amavisField(l, "Hits")
+
+	if messageId := amavisField(l, "Message-ID"); len(messageId) > 0 {
+		r.MessageId = bytes.TrimSuffix(bytes.TrimPrefix(messageId, []byte("<")), []byte(">"))
+	}
+
+	// without any of them, the verdict cannot be related to a message
+	if len(r.Queue) == 0 && len(r.MessageId) == 0 {
+		return AmavisVerdict{}, false
+	}
+
+	return r, true
+}
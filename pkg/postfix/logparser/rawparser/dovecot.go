@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("dovecot", "", parseDovecotPayload)
+}
+
+// DovecotLmtpDelivery is logged by Dovecot's lmtp service once it stores (or fails to store) a message in a mailbox, as in
+// `lmtp(user@example.com)<12345><hz3kESIo+1/dLgAAWP5Hkg>: msgid=<id@example.com>: saved mail to INBOX`
+// or, on versions older than 2.3, `lmtp(12345, user@example.com): hz3kESIo+1/dLgAAWP5Hkg: msgid=<id@example.com>: saved mail to INBOX`
+type DovecotLmtpDelivery struct {
+	User []byte
+
+	// Also present in the reply sent to postfix/lmtp, as in `250 2.0.0 <user@example.com> hz3kESIo+1/dLgAAWP5Hkg Saved`
+	Session []byte
+
+	// Without the angle brackets. Optional
+	MessageId []byte
+
+	Mailbox []byte
+
+	// Set only when the message could not be saved, as `Quota exceeded (mailbox for user is full)`
+	Reason []byte
+}
+
+func parseDovecotPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parseDovecotLmtpDelivery(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:         PayloadTypeDovecotLmtpDelivery,
+			DovecotLmtpDelivery: s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+// `<12345><hz3kESIo+1/dLgAAWP5Hkg>`, returning the last value (the session)
+func dovecotSessionInBrackets(l postscreenLine) ([]byte, postscreenLine, bool) {
+	var value []byte
+
+	for len(l) > 0 && l[0] == '<' {
+		end := bytes.IndexByte(l, '>')
+		if end == -1 {
+			return nil, nil, false
+		}
+
+		value, l = l[1:end], l[end+1:]
+	}
+
+	return value, l, value != nil
+}
+
+// everything until `: `
+func dovecotField(l postscreenLine) ([]byte, postscreenLine, bool) {
+	end := bytes.Index(l, []byte(": "))
+	if end == -1 {
+		return nil, nil, false
+	}
+
+	return l[:end], l[end+len(": "):], true
+}
+
+// `lmtp(user)<pid><session>: ` or `lmtp(pid, user): session: `
+func parseDovecotLmtpPrefix(l postscreenLine) (DovecotLmtpDelivery, postscreenLine, bool) {
+	l, ok := l.literal("lmtp(")
+	if !ok {
+		return DovecotLmtpDelivery{}, nil, false
+	}
+
+	end := bytes.IndexByte(l, ')')
+	if end == -1 {
+		return DovecotLmtpDelivery{}, nil, false
+	}
+
+	inParenthesis, l := l[:end], l[end+1:]
+
+	r := DovecotLmtpDelivery{}
+
+	if comma := bytes.Index(inParenthesis, []byte(", ")); comma != -1 {
+		r.User = inParenthesis[comma+len(", "):]
+
+		if l, ok = l.literal(": "); !ok {
+			return DovecotLmtpDelivery{}, nil, false
+		}
+
+		if r.Session, l, ok = dovecotField(l); !ok {
+			return DovecotLmtpDelivery{}, nil, false
+		}
+
+		return r, l, true
+	}
+
+	r.User = inParenthesis
+
+	if r.Session, l, ok = dovecotSessionInBrackets(l); !ok {
+		return DovecotLmtpDelivery{}, nil, false
+	}
+
+	if l, ok = l.literal(": "); !ok {
+		return DovecotLmtpDelivery{}, nil, false
+	}
+
+	return r, l, true
+}
+
+// Dovecot lines are simple enough to not need a ragel grammar
+func parseDovecotLmtpDelivery(data []byte) (DovecotLmtpDelivery, bool) {
+	r, l, ok := parseDovecotLmtpPrefix(postscreenLine(data))
+	if !ok {
+		return DovecotLmtpDelivery{}, false
+	}
+
+	// the log level is part of the message, and sieve adds its own prefix
+	if rest, ok := l.literal("Error: "); ok {
+		l = rest
+	}
+
+	if rest, ok := l.literal("sieve: "); ok {
+		l = rest
+	}
+
+	if rest, ok := l.literal("msgid="); ok {
+		var msgid []byte
+
+		if msgid, l, ok = dovecotField(rest); !ok {
+			return DovecotLmtpDelivery{}, false
+		}
+
+		if len(msgid) >= 2 && msgid[0] == '<' && msgid[len(msgid)-1] == '>' {
+			r.MessageId = msgid[1 : len(msgid)-1]
+		}
+	}
+
+	if mailbox, ok := l.literal("saved mail to "); ok {
+		r.Mailbox = mailbox
+		return r, len(mailbox) > 0
+	}
+
+	if rest, ok := l.literal("stored mail into mailbox '"); ok {
+		end := bytes.LastIndexByte(rest, '\'')
+		if end <= 0 {
+			return DovecotLmtpDelivery{}, false
+		}
+
+		r.Mailbox = rest[:end]
+
+		return r, true
+	}
+
+	if rest, ok := l.literal("save failed to "); ok {
+		if r.Mailbox, r.Reason, ok = dovecotField(rest); !ok {
+			return DovecotLmtpDelivery{}, false
+		}
+
+		return r, len(r.Mailbox) > 0
+	}
+
+	if rest, ok := l.literal("failed to store into mailbox '"); ok {
+		end := bytes.Index(rest, []byte("': "))
+		if end <= 0 {
+			return DovecotLmtpDelivery{}, false
+		}
+
+		r.Mailbox, r.Reason = rest[:end], rest[end+len("': "):]
+
+		return r, true
+	}
+
+	return DovecotLmtpDelivery{}, false
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("opendkim", "", parseOpenDkimPayload)
+}
+
+// OpenDkimSignature is logged by the OpenDKIM milter when it signs a message, as in
+// `407032C4FF6A: DKIM-Signature field added (s=mail, d=example.com)`
+type OpenDkimSignature struct {
+	Queue    []byte
+	Selector []byte
+	Domain   []byte
+}
+
+func parseOpenDkimPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parseOpenDkimSignature(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:       PayloadTypeOpenDkimSignature,
+			OpenDkimSignature: s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+// milters log the queue id of the message they are processing, as in `407032C4FF6A: `
+func milterQueue(data []byte) ([]byte, postscreenLine, bool) {
+	end := bytes.Index(data, []byte(": "))
+	if end <= 0 || bytes.IndexByte(data[:end], ' ') != -1 {
+		return nil, nil, false
+	}
+
+	return data[:end], postscreenLine(data[end+len(": "):]), true
+}
+
+func parseOpenDkimSignature(data []byte) (OpenDkimSignature, bool) {
+	queue, l, ok := milterQueue(data)
+	if !ok {
+		return OpenDkimSignature{}, false
+	}
+
+	if l, ok = l.literal("DKIM-Signature field added (s="); !ok {
+		return OpenDkimSignature{}, false
+	}
+
+	end := bytes.Index(l, []byte(", d="))
+	if end <= 0 {
+		return OpenDkimSignature{}, false
+	}
+
+	selector, l := l[:end], l[end+len(", d="):]
+
+	end = bytes.IndexByte(l, ')')
+	if end <= 0 {
+		return OpenDkimSignature{}, false
+	}
+
+	return OpenDkimSignature{Queue: queue, Selector: selector, Domain: l[:end]}, true
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("opendmarc", "", parseOpenDmarcPayload)
+}
+
+// OpenDmarcResult is logged by the OpenDMARC milter once it evaluates the policy
+// of the domain in the From header of a message, as in `407032C4FF6A: example.com pass`
+type OpenDmarcResult struct {
+	Queue  []byte
+	Domain []byte
+
+	// `pass`, `fail`, `none` or `bestguesspass`
+	Result []byte
+}
+
+func parseOpenDmarcPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parseOpenDmarcResult(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:     PayloadTypeOpenDmarcResult,
+			OpenDmarcResult: s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+var openDmarcResults = [][]byte{
+	[]byte("pass"),
+	[]byte("fail"),
+	[]byte("none"),
+	[]byte("bestguesspass"),
+}
+
+func parseOpenDmarcResult(data []byte) (OpenDmarcResult, bool) {
+	queue, l, ok := milterQueue(data)
+	if !ok {
+		return OpenDmarcResult{}, false
+	}
+
+	fields := bytes.Split(l, []byte(" "))
+
+	// other lines logged with the queue, as failures to parse headers, have more words
+	if len(fields) != 2 || len(fields[0]) == 0 {
+		return OpenDmarcResult{}, false
+	}
+
+	for _, result := range openDmarcResults {
+		if bytes.Equal(fields[1], result) {
+			return OpenDmarcResult{Queue: queue, Domain: fields[0], Result: fields[1]}, true
+		}
+	}
+
+	return OpenDmarcResult{}, false
+}
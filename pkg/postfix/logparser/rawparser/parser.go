@@ -17,6 +17,7 @@ package rawparser
 import (
 	"bytes"
 	"errors"
+	"strings"
 )
 
 //nolint:deadcode,unused
@@ -94,6 +95,13 @@ func registerHandler(process, daemon string, handler func(RawHeader, []byte) (Ra
 	payloadHandlers[payloadHandlerKey{process: process, daemon: daemon}] = handler
 }
 
+// IsPostfixInstance tells whether the process logs as a postfix instance, which is "postfix" for
+// the default instance and, by convention, "postfix-" followed by the instance name for
+// the ones managed by postmulti, as in "postfix-in" or "postfix-out"
+func IsPostfixInstance(process string) bool {
+	return process == "postfix" || (strings.HasPrefix(process, "postfix-") && len(process) > len("postfix-"))
+}
+
 func Parse(logLine []byte) (RawHeader, RawPayload, error) {
 	// Remove leading 0x0
 	start := bytes.IndexFunc(logLine, func(r rune) bool {
@@ -110,16 +118,35 @@ func Parse(logLine []byte) (RawHeader, RawPayload, error) {
 		return RawHeader{}, RawPayload{}, err
 	}
 
+	isPostfix := IsPostfixInstance(string(header.Process))
+
 	handler, found := payloadHandlers[payloadHandlerKey{
 		daemon:  string(header.Daemon),
 		process: string(header.Process),
 	}]
 
-	if !found {
-		return header, RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+	// all postfix instances log the same way, regardless of their name
+	if !found && isPostfix {
+		handler, found = payloadHandlers[payloadHandlerKey{daemon: string(header.Daemon), process: "postfix"}]
+	}
+
+	p, err := func() (RawPayload, error) {
+		if !found {
+			return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+		}
+
+		return handler(header, payloadLine)
+	}()
+
+	// warnings and errors are logged by any postfix daemon, including the ones without their own handler,
+	// but some of them, as failed SASL authentications, are understood by the daemon handler
+	if errors.Is(err, ErrUnsupportedLogLine) && isPostfix {
+		if s, parsed := parseSystemMessage(payloadLine); parsed {
+			return header, RawPayload{PayloadType: PayloadTypeSystemMessage, SystemMessage: s, Content: payloadLine}, nil
+		}
 	}
 
-	p, err := handler(header, payloadLine)
+	p.Content = payloadLine
 
 	return header, p, err
 }
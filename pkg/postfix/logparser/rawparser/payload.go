@@ -12,17 +12,31 @@ package rawparser
 // so, although this struct will grow as newer payloads are supported,
 // copying will perform better than using virtual calls
 type RawPayload struct {
-	PayloadType           PayloadType
-	RawSmtpSentStatus     RawSmtpSentStatus
-	QmgrReturnedToSender  QmgrReturnedToSender
-	QmgrMailQueued        QmgrMailQueued
-	QmgrRemoved           QmgrRemoved
-	SmtpdConnect          SmtpdConnect
-	SmtpdDisconnect       SmtpdDisconnect
-	SmtpdMailAccepted     SmtpdMailAccepted
-	SmtpdReject           SmtpdReject
-	CleanupMesageAccepted CleanupMessageAccepted
-	CleanupMilterReject   CleanupMilterReject
-	BounceCreated         BounceCreated
-	Pickup                Pickup
+	PayloadType              PayloadType
+	RawSmtpSentStatus        RawSmtpSentStatus
+	QmgrReturnedToSender     QmgrReturnedToSender
+	QmgrMailQueued           QmgrMailQueued
+	QmgrRemoved              QmgrRemoved
+	SmtpdConnect             SmtpdConnect
+	SmtpdDisconnect          SmtpdDisconnect
+	SmtpdMailAccepted        SmtpdMailAccepted
+	SmtpdReject              SmtpdReject
+	CleanupMesageAccepted    CleanupMessageAccepted
+	CleanupMilterReject      CleanupMilterReject
+	BounceCreated            BounceCreated
+	Pickup                   Pickup
+	Postscreen               Postscreen
+	SmtpdSaslAuthFailed      SmtpdSaslAuthFailed
+	TlsConnectionEstablished TlsConnectionEstablished
+	DovecotLmtpDelivery      DovecotLmtpDelivery
+	SystemMessage            SystemMessage
+	SmtpConnectionFailure    SmtpConnectionFailure
+	AmavisVerdict            AmavisVerdict
+	SpamdResult              SpamdResult
+	OpenDkimSignature        OpenDkimSignature
+	OpenDmarcResult          OpenDmarcResult
+
+	// What comes after the header, so that lines not understood
+	// by any handler can still be matched or sampled by other means
+	Content []byte
 }
@@ -20,6 +20,16 @@ const (
 	PayloadTypeBounceCreated
 	PayloadTypePickup
 	PayloadTypeCleanupMilterReject
+	PayloadTypePostscreen
+	PayloadTypeSmtpdSaslAuthFailed
+	PayloadTypeTlsConnectionEstablished
+	PayloadTypeDovecotLmtpDelivery
+	PayloadTypeSystemMessage
+	PayloadTypeSmtpConnectionFailure
+	PayloadTypeAmavisVerdict
+	PayloadTypeSpamdResult
+	PayloadTypeOpenDkimSignature
+	PayloadTypeOpenDmarcResult
 
 	// types for SmtpMessageStatus extra message
 	PayloadTypeSmtpMessageStatusSentQueued
@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("postfix", "postscreen", parsePostscreenPayload)
+}
+
+type Postscreen struct {
+	// The event as logged by postscreen, as `PASS NEW`, `DNSBL` or `NOQUEUE: reject`
+	Event []byte
+
+	IP   []byte
+	Port []byte
+
+	// DNSBL rank or the number of bytes sent by a client on PREGREET
+	Value []byte
+
+	// seconds since the client connected, on PREGREET and HANGUP
+	Delay []byte
+
+	// SMTP stage of a rejection, or the command after which a command violation happened
+	Stage []byte
+
+	// Free-form text, as the data sent on PREGREET or the rejection reason
+	Detail []byte
+}
+
+func parsePostscreenPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parsePostscreen(payloadLine); parsed {
+		return RawPayload{
+			PayloadType: PayloadTypePostscreen,
+			Postscreen:  s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+type postscreenLine []byte
+
+func (l postscreenLine) literal(s string) (postscreenLine, bool) {
+	if !bytes.HasPrefix(l, []byte(s)) {
+		return nil, false
+	}
+
+	return l[len(s):], true
+}
+
+// a decimal number, optionally with a fractional part
+func (l postscreenLine) number() ([]byte, postscreenLine, bool) {
+	i := 0
+
+	for i < len(l) && ((l[i] >= '0' && l[i] <= '9') || (i > 0 && l[i] == '.')) {
+		i++
+	}
+
+	if i == 0 {
+		return nil, nil, false
+	}
+
+	return l[:i], l[i:], true
+}
+
+// a word until a space, colon or the end of the line
+func (l postscreenLine) word() ([]byte, postscreenLine, bool) {
+	i := 0
+
+	for i < len(l) && l[i] != ' ' && l[i] != ':' {
+		i++
+	}
+
+	if i == 0 {
+		return nil, nil, false
+	}
+
+	return l[:i], l[i:], true
+}
+
+// [1.2.3.4]:5678 or [2001:db8::1]:5678
+func (l postscreenLine) address() ([]byte, []byte, postscreenLine, bool) {
+	if len(l) == 0 || l[0] != '[' {
+		return nil, nil, nil, false
+	}
+
+	end := bytes.IndexByte(l, ']')
+	if end == -1 {
+		return nil, nil, nil, false
+	}
+
+	ip := l[1:end]
+
+	rest, ok := l[end+1:].literal(":")
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	port, rest, ok := rest.number()
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	return ip, port, rest, true
+}
+
+// `[ip]:port`, possibly followed by anything else, as the local address on CONNECT
+func parsePostscreenClientOnly(event []byte, l postscreenLine) (Postscreen, bool) {
+	ip, port, _, ok := l.address()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	return Postscreen{Event: event, IP: ip, Port: port}, true
+}
+
+// `rank 3 for [ip]:port`
+func parsePostscreenDNSBL(event []byte, l postscreenLine) (Postscreen, bool) {
+	l, ok := l.literal("rank ")
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	rank, l, ok := l.number()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	if l, ok = l.literal(" for "); !ok {
+		return Postscreen{}, false
+	}
+
+	ip, port, _, ok := l.address()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	return Postscreen{Event: event, IP: ip, Port: port, Value: rank}, true
+}
+
+// `11 after 0.15 from [ip]:port: EHLO example.com\r\n`
+func parsePostscreenPregreet(event []byte, l postscreenLine) (Postscreen, bool) {
+	count, l, ok := l.number()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	if l, ok = l.literal(" "); !ok {
+		return Postscreen{}, false
+	}
+
+	r, ok := parsePostscreenHangup(event, l)
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	r.Value = count
+
+	return r, true
+}
+
+// `after 0.15 from [ip]:port in tests after SMTP handshake`, also used by PREGREET,
+// which has `: <data>` instead
+func parsePostscreenHangup(event []byte, l postscreenLine) (Postscreen, bool) {
+	l, ok := l.literal("after ")
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	delay, l, ok := l.number()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	if l, ok = l.literal(" from "); !ok {
+		return Postscreen{}, false
+	}
+
+	ip, port, l, ok := l.address()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	detail := []byte(l)
+
+	if rest, ok := l.literal(": "); ok {
+		detail = rest
+	} else if rest, ok := l.literal(" in "); ok {
+		detail = rest
+	}
+
+	return Postscreen{Event: event, IP: ip, Port: port, Delay: delay, Detail: detail}, true
+}
+
+// `from [ip]:port after EHLO: QUIT\r\n` or `from [ip]:port after CONNECT`
+func parsePostscreenCommand(event []byte, l postscreenLine) (Postscreen, bool) {
+	l, ok := l.literal("from ")
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	ip, port, l, ok := l.address()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	r := Postscreen{Event: event, IP: ip, Port: port}
+
+	if l, ok = l.literal(" after "); !ok {
+		return r, true
+	}
+
+	stage, l, ok := l.word()
+	if !ok {
+		return r, true
+	}
+
+	r.Stage = stage
+
+	if detail, ok := l.literal(": "); ok {
+		r.Detail = detail
+	}
+
+	return r, true
+}
+
+// `RCPT from [ip]:port: 550 5.7.1 Service unavailable; client [ip] blocked using zen.spamhaus.org; from=<...>`
+func parsePostscreenReject(event []byte, l postscreenLine) (Postscreen, bool) {
+	stage, l, ok := l.word()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	if l, ok = l.literal(" from "); !ok {
+		return Postscreen{}, false
+	}
+
+	ip, port, l, ok := l.address()
+	if !ok {
+		return Postscreen{}, false
+	}
+
+	if l, ok = l.literal(": "); !ok {
+		return Postscreen{}, false
+	}
+
+	return Postscreen{Event: event, IP: ip, Port: port, Stage: stage, Detail: l}, true
+}
+
+type postscreenEventParser struct {
+	// includes the space that separates it from the rest of the line
+	prefix string
+	parse  func([]byte, postscreenLine) (Postscreen, bool)
+}
+
+// Postfix 3.6 renamed whitelist and blacklist to allowlist and denylist
+var postscreenEventParsers = []postscreenEventParser{
+	{"CONNECT from ", parsePostscreenClientOnly},
+	{"PASS NEW ", parsePostscreenClientOnly},
+	{"PASS OLD ", parsePostscreenClientOnly},
+	{"WHITELISTED ", parsePostscreenClientOnly},
+	{"ALLOWLISTED ", parsePostscreenClientOnly},
+	{"WHITELIST VETO ", parsePostscreenClientOnly},
+	{"ALLOWLIST VETO ", parsePostscreenClientOnly},
+	{"BLACKLISTED ", parsePostscreenClientOnly},
+	{"DENYLISTED ", parsePostscreenClientOnly},
+	{"DISCONNECT ", parsePostscreenClientOnly},
+	{"DNSBL ", parsePostscreenDNSBL},
+	{"PREGREET ", parsePostscreenPregreet},
+	{"HANGUP ", parsePostscreenHangup},
+	{"COMMAND PIPELINING ", parsePostscreenCommand},
+	{"COMMAND TIME LIMIT ", parsePostscreenCommand},
+	{"COMMAND COUNT LIMIT ", parsePostscreenCommand},
+	{"COMMAND LENGTH LIMIT ", parsePostscreenCommand},
+	{"NON-SMTP COMMAND ", parsePostscreenCommand},
+	{"BARE NEWLINE ", parsePostscreenCommand},
+	{"NOQUEUE: reject: ", parsePostscreenReject},
+}
+
+// Postscreen lines are simple enough to not need a ragel grammar
+func parsePostscreen(data []byte) (Postscreen, bool) {
+	for _, p := range postscreenEventParsers {
+		if rest, ok := postscreenLine(data).literal(p.prefix); ok {
+			event := data[:len(p.prefix)-1]
+
+			// CONNECT is followed by `from`, which is not part of the event name
+			if p.prefix == "CONNECT from " {
+				event = data[:len("CONNECT")]
+			}
+
+			return p.parse(event, rest)
+		}
+	}
+
+	return Postscreen{}, false
+}
@@ -8,6 +8,8 @@ func init() {
 	registerHandler("postfix", "smtp", parseSmtpPayload)
 	registerHandler("postfix", "lmtp", parseSmtpPayload)
 	registerHandler("postfix", "pipe", parseSmtpPayload)
+	registerHandler("postfix", "local", parseSmtpPayload)
+	registerHandler("postfix", "virtual", parseSmtpPayload)
 }
 
 type RawSmtpSentStatus struct {
@@ -42,6 +44,20 @@ func parseSmtpPayload(header RawHeader, payloadLine []byte) (RawPayload, error)
 	r, parsed := parseSmtpSentStatus(payloadLine)
 
 	if !parsed {
+		if s, parsed := parseTlsConnectionEstablished(payloadLine); parsed {
+			return RawPayload{
+				PayloadType:              PayloadTypeTlsConnectionEstablished,
+				TlsConnectionEstablished: s,
+			}, nil
+		}
+
+		if s, parsed := parseSmtpConnectionFailure(payloadLine); parsed {
+			return RawPayload{
+				PayloadType:           PayloadTypeSmtpConnectionFailure,
+				SmtpConnectionFailure: s,
+			}, nil
+		}
+
 		return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
 	}
 
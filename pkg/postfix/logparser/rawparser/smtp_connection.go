@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+// SmtpConnectionFailure is logged by smtp when it cannot talk to a remote server, as in
+// `connect to mx.example.com[1.2.3.4]:25: Connection timed out`,
+// `4BCA2E0CBB: lost connection with mx.example.com[1.2.3.4] while receiving the initial server greeting`,
+// `4BCA2E0CBB: conversation with mx.example.com[1.2.3.4] timed out while sending end of data -- message may be sent more than once`
+// or `SSL_connect error to mx.example.com[1.2.3.4]:25: lost connection`
+type SmtpConnectionFailure struct {
+	// Only known once the connection is established
+	Queue []byte
+
+	// `connect to`, `lost connection with`, `conversation with` or `SSL_connect error to`
+	Kind []byte
+
+	Host []byte
+	IP   []byte
+
+	// Only logged when the connection is not established
+	Port []byte
+
+	// What went wrong, as `Connection timed out`, or what was being done
+	// when the connection was lost, as `receiving the initial server greeting`
+	Reason []byte
+}
+
+type smtpConnectionFailureKind struct {
+	prefix []byte
+
+	// what comes between the address and the reason
+	separator []byte
+}
+
+var smtpConnectionFailureKinds = []smtpConnectionFailureKind{
+	{[]byte("connect to "), []byte(": ")},
+	{[]byte("SSL_connect error to "), []byte(": ")},
+	{[]byte("lost connection with "), []byte(" while ")},
+	{[]byte("conversation with "), []byte(" timed out while ")},
+}
+
+// `host[ip]` or `host[ip]:port`, returning the rest of the line
+func parseSmtpConnectionPeer(data []byte) ([]byte, []byte, []byte, []byte, bool) {
+	open := bytes.IndexByte(data, '[')
+	if open <= 0 {
+		return nil, nil, nil, nil, false
+	}
+
+	closing := bytes.IndexByte(data[open:], ']')
+	if closing == -1 {
+		return nil, nil, nil, nil, false
+	}
+
+	closing += open
+
+	host, ip, rest := data[:open], data[open+1:closing], data[closing+1:]
+
+	if len(rest) == 0 || rest[0] != ':' || bytes.HasPrefix(rest, []byte(": ")) {
+		return host, ip, nil, rest, true
+	}
+
+	end := 1
+
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+
+	if end == 1 {
+		return nil, nil, nil, nil, false
+	}
+
+	return host, ip, rest[1:end], rest[end:], true
+}
+
+// This parser is hand written, as the lines have no ambiguities that would justify a ragel grammar
+func parseSmtpConnectionFailure(data []byte) (SmtpConnectionFailure, bool) {
+	r := SmtpConnectionFailure{}
+
+	// the queue is logged only when the failure happens during a delivery
+	if end := bytes.Index(data, []byte(": ")); end > 0 && bytes.IndexByte(data[:end], ' ') == -1 {
+		r.Queue = data[:end]
+		data = data[end+len(": "):]
+	}
+
+	for _, kind := range smtpConnectionFailureKinds {
+		if !bytes.HasPrefix(data, kind.prefix) {
+			continue
+		}
+
+		r.Kind = kind.prefix[:len(kind.prefix)-1]
+
+		host, ip, port, rest, ok := parseSmtpConnectionPeer(data[len(kind.prefix):])
+		if !ok || !bytes.HasPrefix(rest, kind.separator) {
+			return SmtpConnectionFailure{}, false
+		}
+
+		r.Host, r.IP, r.Port, r.Reason = host, ip, port, rest[len(kind.separator):]
+
+		if len(r.Reason) == 0 {
+			return SmtpConnectionFailure{}, false
+		}
+
+		return r, true
+	}
+
+	return SmtpConnectionFailure{}, false
+}
@@ -635,7 +635,7 @@ const smtpdMailAccepted_en_main int = 1
 
 //line smtpd.rl:78
 
-// TODO: accept additional metadata (sasl_method and sasl_username)
+// The SASL metadata that might follow the client is parsed by parseSmtpdSaslMetadata
 func parseSmtpdMailAccepted(data []byte) (SmtpdMailAccepted, bool) {
 	cs, p, pe, eof := 0, 0, len(data), len(data)
 	tokBeg := 0
@@ -6,6 +6,10 @@
 
 package rawparser
 
+import (
+	"bytes"
+)
+
 func init() {
 	// from the standard postfix setup
 	registerHandler("postfix", "submission/smtpd", parseSmtpdPayload) // for remote connection
@@ -31,6 +35,18 @@ type SmtpdMailAccepted struct {
 	Host  []byte
 	IP    []byte
 	Queue []byte
+
+	// Set only when the client has authenticated
+	SaslMethod   []byte
+	SaslUsername []byte
+}
+
+type SmtpdSaslAuthFailed struct {
+	Host     []byte
+	IP       []byte
+	Method   []byte
+	Reason   []byte
+	Username []byte
 }
 
 func parseSmtpdPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
@@ -49,6 +65,8 @@ func parseSmtpdPayload(header RawHeader, payloadLine []byte) (RawPayload, error)
 	}
 
 	if s, parsed := parseSmtpdMailAccepted(payloadLine); parsed {
+		s.SaslMethod, s.SaslUsername = parseSmtpdSaslMetadata(payloadLine)
+
 		return RawPayload{
 			PayloadType:       PayloadTypeSmtpdMailAccepted,
 			SmtpdMailAccepted: s,
@@ -62,10 +80,167 @@ func parseSmtpdPayload(header RawHeader, payloadLine []byte) (RawPayload, error)
 		}, nil
 	}
 
+	if s, parsed := parseSmtpdRejectWithoutQueueOrByMilter(payloadLine); parsed {
+		return RawPayload{
+			PayloadType: PayloadTypeSmtpdReject,
+			SmtpdReject: s,
+		}, nil
+	}
+
+	if s, parsed := parseSmtpdSaslAuthFailed(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:         PayloadTypeSmtpdSaslAuthFailed,
+			SmtpdSaslAuthFailed: s,
+		}, nil
+	}
+
+	if s, parsed := parseTlsConnectionEstablished(payloadLine); parsed {
+		return RawPayload{
+			PayloadType:              PayloadTypeTlsConnectionEstablished,
+			TlsConnectionEstablished: s,
+		}, nil
+	}
+
 	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
 }
 
 type SmtpdReject struct {
 	Queue        []byte
 	ExtraMessage []byte
+
+	// Set when the rejection is caused by a milter (milter-reject),
+	// instead of by a smtpd restriction
+	Milter bool
+}
+
+var (
+	smtpdNoQueue               = []byte("NOQUEUE")
+	smtpdRejectSeparator       = []byte(": reject: ")
+	smtpdMilterRejectSeparator = []byte(": milter-reject: ")
+)
+
+// Handles the rejection forms not covered by the ragel grammar:
+// `NOQUEUE: reject: ...`, `NOQUEUE: milter-reject: ...` and `<queue>: milter-reject: ...`,
+// the two last ones emitted when a milter rejects the message still on the smtp session.
+func parseSmtpdRejectWithoutQueueOrByMilter(data []byte) (SmtpdReject, bool) {
+	tryWithSeparator := func(separator []byte, milter bool) (SmtpdReject, bool) {
+		index := bytes.Index(data, separator)
+
+		if index == -1 {
+			return SmtpdReject{}, false
+		}
+
+		queue := data[:index]
+
+		if !bytes.Equal(queue, smtpdNoQueue) && !isQueueId(queue) {
+			return SmtpdReject{}, false
+		}
+
+		extraMessage := data[index+len(separator):]
+
+		if len(extraMessage) == 0 {
+			return SmtpdReject{}, false
+		}
+
+		return SmtpdReject{Queue: queue, ExtraMessage: extraMessage, Milter: milter}, true
+	}
+
+	if r, ok := tryWithSeparator(smtpdRejectSeparator, false); ok {
+		return r, true
+	}
+
+	return tryWithSeparator(smtpdMilterRejectSeparator, true)
+}
+
+func isQueueId(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	for _, c := range b {
+		isHexDigit := (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+		if !isHexDigit {
+			return false
+		}
+	}
+
+	return true
+}
+
+var (
+	smtpdSaslMethodKey   = []byte(", sasl_method=")
+	smtpdSaslUsernameKey = []byte(", sasl_username=")
+)
+
+// value of `, key=value`, which ends on the next comma or on the end of the line
+func smtpdMetadataValue(data []byte, key []byte) []byte {
+	index := bytes.Index(data, key)
+	if index == -1 {
+		return nil
+	}
+
+	value := data[index+len(key):]
+
+	if end := bytes.IndexByte(value, ','); end != -1 {
+		value = value[:end]
+	}
+
+	if len(value) == 0 {
+		return nil
+	}
+
+	return value
+}
+
+// Obtains the SASL metadata appended to `client=` when the client authenticates, as in
+// `client=host[1.2.3.4], sasl_method=PLAIN, sasl_username=user@example.com`
+func parseSmtpdSaslMetadata(data []byte) ([]byte, []byte) {
+	return smtpdMetadataValue(data, smtpdSaslMethodKey), smtpdMetadataValue(data, smtpdSaslUsernameKey)
+}
+
+var (
+	smtpdWarningPrefix       = []byte("warning: ")
+	smtpdSaslPrefix          = []byte("]: SASL ")
+	smtpdSaslFailedSeparator = []byte(" authentication failed: ")
+)
+
+// Handles `warning: host[1.2.3.4]: SASL LOGIN authentication failed: <reason>`,
+// where newer postfix versions append `, sasl_username=<user>` when it's known.
+func parseSmtpdSaslAuthFailed(data []byte) (SmtpdSaslAuthFailed, bool) {
+	if !bytes.HasPrefix(data, smtpdWarningPrefix) {
+		return SmtpdSaslAuthFailed{}, false
+	}
+
+	data = data[len(smtpdWarningPrefix):]
+
+	open := bytes.IndexByte(data, '[')
+	if open == -1 {
+		return SmtpdSaslAuthFailed{}, false
+	}
+
+	closing := bytes.Index(data, smtpdSaslPrefix)
+	if closing == -1 || closing < open {
+		return SmtpdSaslAuthFailed{}, false
+	}
+
+	rest := data[closing+len(smtpdSaslPrefix):]
+
+	separator := bytes.Index(rest, smtpdSaslFailedSeparator)
+	if separator <= 0 {
+		return SmtpdSaslAuthFailed{}, false
+	}
+
+	r := SmtpdSaslAuthFailed{
+		Host:   data[:open],
+		IP:     data[open+1 : closing],
+		Method: rest[:separator],
+		Reason: rest[separator+len(smtpdSaslFailedSeparator):],
+	}
+
+	if index := bytes.LastIndex(r.Reason, smtpdSaslUsernameKey); index != -1 {
+		r.Username = r.Reason[index+len(smtpdSaslUsernameKey):]
+		r.Reason = r.Reason[:index]
+	}
+
+	return r, true
 }
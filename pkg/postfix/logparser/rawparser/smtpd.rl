@@ -76,7 +76,7 @@ func parseSmtpdDisconnect(data []byte) (SmtpdDisconnect, bool) {
 %% machine smtpdMailAccepted;
 %% write data;
 
-// TODO: accept additional metadata (sasl_method and sasl_username)
+// The SASL metadata that might follow the client is parsed by parseSmtpdSaslMetadata
 func parseSmtpdMailAccepted(data []byte) (SmtpdMailAccepted, bool) {
 	cs, p, pe, eof := 0, 0, len(data), len(data)
 	tokBeg := 0
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+func init() {
+	registerHandler("spamd", "", parseSpamdPayload)
+}
+
+// SpamdResult is logged by the SpamAssassin daemon for every message it checks, as in
+// `spamd: result: Y 15 - BAYES_99,HTML_MESSAGE scantime=0.5,size=1234,user=amavis,uid=110,` +
+// `required_score=5.0,rhost=localhost,raddr=127.0.0.1,rport=45418,mid=<id@example.com>,autolearn=no`
+type SpamdResult struct {
+	// `Y` for spam, `.` otherwise
+	Flag []byte
+
+	// Rounded to an integer
+	Score []byte
+
+	// Without the angle brackets
+	MessageId []byte
+}
+
+func parseSpamdPayload(header RawHeader, payloadLine []byte) (RawPayload, error) {
+	if s, parsed := parseSpamdResult(payloadLine); parsed {
+		return RawPayload{
+			PayloadType: PayloadTypeSpamdResult,
+			SpamdResult: s,
+		}, nil
+	}
+
+	return RawPayload{PayloadType: PayloadTypeUnsupported}, ErrUnsupportedLogLine
+}
+
+// The result line has a fixed format, not needing a ragel grammar
+func parseSpamdResult(data []byte) (SpamdResult, bool) {
+	l, ok := postscreenLine(data).literal("spamd: result: ")
+	if !ok || len(l) < 2 || (l[0] != 'Y' && l[0] != '.') || l[1] != ' ' {
+		return SpamdResult{}, false
+	}
+
+	r := SpamdResult{Flag: l[:1]}
+
+	l = l[2:]
+
+	end := bytes.IndexByte(l, ' ')
+	if end <= 0 {
+		return SpamdResult{}, false
+	}
+
+	r.Score = l[:end]
+
+	start := bytes.Index(l, []byte("mid=<"))
+	if start == -1 {
+		return SpamdResult{}, false
+	}
+
+	l = l[start+len("mid=<"):]
+
+	end = bytes.IndexByte(l, '>')
+	if end <= 0 {
+		return SpamdResult{}, false
+	}
+
+	r.MessageId = l[:end]
+
+	return r, true
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+// SystemMessage is any line logged by postfix with a severity, as in
+// `warning: hostname mx.example.com does not resolve to address 1.2.3.4`
+// or `fatal: open database /etc/postfix/virtual.db: No such file or directory`,
+// that is not understood by the parser of the daemon that logged it
+type SystemMessage struct {
+	// warning, error, fatal or panic
+	Severity []byte
+
+	Message []byte
+}
+
+var systemMessageSeverities = [][]byte{
+	[]byte("warning"),
+	[]byte("error"),
+	[]byte("fatal"),
+	[]byte("panic"),
+}
+
+// The severity is logged by all daemons in the same way, so there's no need for a ragel grammar
+func parseSystemMessage(data []byte) (SystemMessage, bool) {
+	for _, severity := range systemMessageSeverities {
+		if !bytes.HasPrefix(data, severity) {
+			continue
+		}
+
+		rest := data[len(severity):]
+
+		if !bytes.HasPrefix(rest, []byte(": ")) {
+			return SystemMessage{}, false
+		}
+
+		message := rest[len(": "):]
+
+		if len(message) == 0 {
+			return SystemMessage{}, false
+		}
+
+		return SystemMessage{Severity: data[:len(severity)], Message: message}, true
+	}
+
+	return SystemMessage{}, false
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package rawparser
+
+import (
+	"bytes"
+)
+
+// TlsConnectionEstablished is logged by both smtp and smtpd when a TLS session is negotiated, as in
+// `Verified TLS connection established to mx.example.com[1.2.3.4]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits)`
+// or `Anonymous TLS connection established from unknown[1.2.3.4]: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)`
+type TlsConnectionEstablished struct {
+	// Anonymous, Untrusted, Trusted or Verified
+	Trust []byte
+
+	// `to` on smtp, `from` on smtpd
+	Direction []byte
+
+	Host []byte
+	IP   []byte
+
+	// Only logged by smtp
+	Port []byte
+
+	Protocol []byte
+	Cipher   []byte
+}
+
+var (
+	tlsEstablishedSeparator = []byte(" TLS connection established ")
+	tlsCipherSeparator      = []byte(" with cipher ")
+	tlsDirectionTo          = []byte("to ")
+	tlsDirectionFrom        = []byte("from ")
+)
+
+// This parser is hand written, as the line has no ambiguities that would justify a ragel grammar
+func parseTlsConnectionEstablished(data []byte) (TlsConnectionEstablished, bool) {
+	separator := bytes.Index(data, tlsEstablishedSeparator)
+	if separator <= 0 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	r := TlsConnectionEstablished{Trust: data[:separator]}
+
+	if bytes.IndexByte(r.Trust, ' ') != -1 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	data = data[separator+len(tlsEstablishedSeparator):]
+
+	switch {
+	case bytes.HasPrefix(data, tlsDirectionTo):
+		r.Direction = data[:len(tlsDirectionTo)-1]
+		data = data[len(tlsDirectionTo):]
+	case bytes.HasPrefix(data, tlsDirectionFrom):
+		r.Direction = data[:len(tlsDirectionFrom)-1]
+		data = data[len(tlsDirectionFrom):]
+	default:
+		return TlsConnectionEstablished{}, false
+	}
+
+	open := bytes.IndexByte(data, '[')
+	if open == -1 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	closing := bytes.IndexByte(data[open:], ']')
+	if closing == -1 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	closing += open
+
+	r.Host = data[:open]
+	r.IP = data[open+1 : closing]
+
+	data = data[closing+1:]
+
+	// the port is optional, and the peer information ends with a colon
+	if bytes.HasPrefix(data, []byte(":")) && !bytes.HasPrefix(data, []byte(": ")) {
+		end := bytes.Index(data, []byte(": "))
+		if end == -1 {
+			return TlsConnectionEstablished{}, false
+		}
+
+		r.Port = data[1:end]
+		data = data[end:]
+	}
+
+	if !bytes.HasPrefix(data, []byte(": ")) {
+		return TlsConnectionEstablished{}, false
+	}
+
+	data = data[len(": "):]
+
+	cipherIndex := bytes.Index(data, tlsCipherSeparator)
+	if cipherIndex <= 0 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	r.Protocol = data[:cipherIndex]
+	r.Cipher = data[cipherIndex+len(tlsCipherSeparator):]
+
+	if end := bytes.IndexByte(r.Cipher, ' '); end != -1 {
+		r.Cipher = r.Cipher[:end]
+	}
+
+	if len(r.Cipher) == 0 {
+		return TlsConnectionEstablished{}, false
+	}
+
+	return r, true
+}
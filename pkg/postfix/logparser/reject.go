@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RejectInfo contains the information postfix logs when it rejects a message,
+// either on `reject` (by smtpd) or on `milter-reject`
+type RejectInfo struct {
+	// The SMTP stage where the rejection happened, as CONNECT, RCPT, DATA or END-OF-MESSAGE
+	Stage string
+	Host  string
+	IP    net.IP
+
+	// Reply code, as 550. Not always present on milter rejections.
+	Code int
+	Dsn  string
+
+	// The human readable rejection reason, as "Recipient address rejected: User unknown in virtual mailbox table"
+	Reason string
+
+	SenderLocalPart     string
+	SenderDomainPart    string
+	RecipientLocalPart  string
+	RecipientDomainPart string
+	Helo                string
+}
+
+var (
+	// END-OF-MESSAGE from h-ca74a0a011076cd81347f8f11e[254.65.43.194]: 4.7.1 Try again later
+	rejectPrefixRegexp = regexp.MustCompile(`^([A-Z-]+) from ([^\[]+)\[([^\]]*)\](?::\d+)?: (?:(\d{3}) )?(?:(\d\.\d{1,3}\.\d{1,3}) )?(.*)$`)
+
+	// <h-c715634009216@h-14dc4a6d.com>: Recipient address rejected: User unknown
+	rejectReasonRecipientPrefixRegexp = regexp.MustCompile(`^<[^>]*>: `)
+)
+
+const rejectMetadataSeparator = "; from=<"
+
+func splitEmailAddress(s string) (string, string) {
+	index := strings.LastIndex(s, "@")
+
+	if index == -1 {
+		return s, ""
+	}
+
+	return s[:index], s[index+1:]
+}
+
+// parses the key=<value> pairs that postfix appends to the rejection messages,
+// as in `from=<a@example.com> to=<b@example.com> proto=ESMTP helo=<mail.example.com>`
+func parseRejectMetadata(s string, info *RejectInfo) {
+	valueFor := func(key string) (string, bool) {
+		prefix := key + "=<"
+
+		begin := strings.Index(s, prefix)
+		if begin == -1 {
+			return "", false
+		}
+
+		value := s[begin+len(prefix):]
+
+		end := strings.Index(value, ">")
+		if end == -1 {
+			return "", false
+		}
+
+		return value[:end], true
+	}
+
+	if from, ok := valueFor("from"); ok {
+		info.SenderLocalPart, info.SenderDomainPart = splitEmailAddress(strings.Trim(from, `"`))
+	}
+
+	if to, ok := valueFor("to"); ok {
+		info.RecipientLocalPart, info.RecipientDomainPart = splitEmailAddress(strings.Trim(to, `"`))
+	}
+
+	if helo, ok := valueFor("helo"); ok {
+		info.Helo = helo
+	}
+}
+
+// ParseRejectInfo obtains the structured information from the free-form text that follows
+// `reject:` and `milter-reject:`. It's lenient and returns false only if the message
+// does not look like a rejection at all, leaving unknown fields empty.
+func ParseRejectInfo(extraMessage string) (RejectInfo, bool) {
+	message, metadata := extraMessage, ""
+
+	if index := strings.LastIndex(extraMessage, rejectMetadataSeparator); index != -1 {
+		message, metadata = extraMessage[:index], extraMessage[index+2:]
+	} else if index := strings.LastIndex(extraMessage, "; proto="); index != -1 {
+		message, metadata = extraMessage[:index], extraMessage[index+2:]
+	}
+
+	matches := rejectPrefixRegexp.FindStringSubmatch(message)
+	if matches == nil {
+		return RejectInfo{}, false
+	}
+
+	info := RejectInfo{
+		Stage:  matches[1],
+		Host:   matches[2],
+		Dsn:    matches[5],
+		Reason: rejectReasonRecipientPrefixRegexp.ReplaceAllString(matches[6], ""),
+	}
+
+	if ip, err := parseIP([]byte(matches[3])); err == nil {
+		info.IP = ip
+	}
+
+	if len(matches[4]) > 0 {
+		// it's always a three digits number, due the regexp
+		info.Code, _ = strconv.Atoi(matches[4])
+	}
+
+	parseRejectMetadata(metadata, &info)
+
+	return info, true
+}
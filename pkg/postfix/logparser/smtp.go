@@ -25,9 +25,11 @@ type SmtpStatus int
 
 var (
 	smtpStatusHumanForm = map[SmtpStatus]string{
-		DeferredStatus: "deferred",
-		BouncedStatus:  "bounced",
-		SentStatus:     "sent",
+		DeferredStatus:   "deferred",
+		BouncedStatus:    "bounced",
+		SentStatus:       "sent",
+		ExpiredStatus:    "expired",
+		IncompleteStatus: "incomplete",
 	}
 )
 
@@ -35,10 +37,29 @@ func (s SmtpStatus) String() string {
 	return smtpStatusHumanForm[s]
 }
 
+// ParseSmtpStatus is the inverse of SmtpStatus.String()
+func ParseSmtpStatus(s string) (SmtpStatus, bool) {
+	for status, humanForm := range smtpStatusHumanForm {
+		if humanForm == s {
+			return status, true
+		}
+	}
+
+	return 0, false
+}
+
 const (
 	SentStatus     SmtpStatus = 0
 	BouncedStatus  SmtpStatus = 1
 	DeferredStatus SmtpStatus = 2
+
+	// Not logged by smtp, but by qmgr, for messages returned to the sender
+	// after being deferred for longer than the maximal queue lifetime
+	ExpiredStatus SmtpStatus = 3
+
+	// Not logged at all, but given by the tracker to the recipients of a message
+	// whose outcome has been lost, as the log lines about it are missing
+	IncompleteStatus SmtpStatus = 4
 )
 
 type SmtpSentStatus struct {
@@ -83,6 +104,8 @@ func parseStatus(s []byte) SmtpStatus {
 		return SentStatus
 	case "bounced":
 		return BouncedStatus
+	case "expired":
+		return ExpiredStatus
 	}
 
 	panic("Ahhh, invalid status!!!" + string(s))
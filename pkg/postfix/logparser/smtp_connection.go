@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"net"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeSmtpConnectionFailure, convertSmtpConnectionFailure)
+}
+
+type SmtpConnectionFailureKind int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+
+	// The connection could not be established, as on a timeout or refused connection
+	SmtpConnectFailure SmtpConnectionFailureKind = iota
+
+	// The remote server closed the connection
+	SmtpLostConnection
+
+	// The remote server stopped responding
+	SmtpConversationTimeout
+
+	// The TLS handshake failed
+	SmtpTlsFailure
+)
+
+var smtpConnectionFailureKinds = map[string]SmtpConnectionFailureKind{
+	"connect to":           SmtpConnectFailure,
+	"lost connection with": SmtpLostConnection,
+	"conversation with":    SmtpConversationTimeout,
+	"SSL_connect error to": SmtpTlsFailure,
+}
+
+func (k SmtpConnectionFailureKind) String() string {
+	switch k {
+	case SmtpConnectFailure:
+		return "connect"
+	case SmtpLostConnection:
+		return "lost_connection"
+	case SmtpConversationTimeout:
+		return "timeout"
+	case SmtpTlsFailure:
+		return "tls"
+	}
+
+	return "unknown"
+}
+
+// SmtpConnectionFailure is logged by smtp when a remote server cannot be reached,
+// or stops responding, before the delivery of a message is attempted or during it
+type SmtpConnectionFailure struct {
+	// Empty when the failure is not related to a message
+	Queue string
+
+	Kind SmtpConnectionFailureKind
+	Host string
+	IP   net.IP
+
+	// Zero when not logged
+	Port int
+
+	Reason string
+}
+
+func (SmtpConnectionFailure) isPayload() {
+	// required by Payload interface
+}
+
+var ErrUnknownSmtpConnectionFailureKind = errors.New("Unknown SMTP connection failure kind")
+
+func convertSmtpConnectionFailure(r rawparser.RawPayload) (Payload, error) {
+	p := r.SmtpConnectionFailure
+
+	kind, ok := smtpConnectionFailureKinds[string(p.Kind)]
+	if !ok {
+		return nil, ErrUnknownSmtpConnectionFailureKind
+	}
+
+	ip, err := parseIP(p.IP)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	port := 0
+
+	if len(p.Port) > 0 {
+		if port, err = atoi(p.Port); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
+	return SmtpConnectionFailure{
+		Queue:  string(p.Queue),
+		Kind:   kind,
+		Host:   string(p.Host),
+		IP:     ip,
+		Port:   port,
+		Reason: string(p.Reason),
+	}, nil
+}
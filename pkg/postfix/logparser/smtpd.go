@@ -14,6 +14,7 @@ func init() {
 	registerHandler(rawparser.PayloadTypeSmtpdDisconnect, convertSmtpdDisconnect)
 	registerHandler(rawparser.PayloadTypeSmtpdMailAccepted, convertSmtpdMailAccepted)
 	registerHandler(rawparser.PayloadTypeSmtpdReject, convertSmtpdReject)
+	registerHandler(rawparser.PayloadTypeSmtpdSaslAuthFailed, convertSmtpdSaslAuthFailed)
 }
 
 type SmtpdConnect struct {
@@ -68,6 +69,10 @@ type SmtpdMailAccepted struct {
 	Queue string
 	Host  string
 	IP    net.IP
+
+	// Set only when the client has authenticated
+	SaslMethod   string
+	SaslUsername string
 }
 
 func (SmtpdMailAccepted) isPayload() {
@@ -83,15 +88,20 @@ func convertSmtpdMailAccepted(r rawparser.RawPayload) (Payload, error) {
 	}
 
 	return SmtpdMailAccepted{
-		Host:  string(p.Host),
-		IP:    ip,
-		Queue: string(p.Queue),
+		Host:         string(p.Host),
+		IP:           ip,
+		Queue:        string(p.Queue),
+		SaslMethod:   string(p.SaslMethod),
+		SaslUsername: string(p.SaslUsername),
 	}, nil
 }
 
 type SmtpdReject struct {
+	// Queue is "NOQUEUE" when the message is rejected before any queue is assigned to it
 	Queue        string
 	ExtraMessage string
+	Milter       bool
+	Info         RejectInfo
 }
 
 func (SmtpdReject) isPayload() {
@@ -101,8 +111,46 @@ func (SmtpdReject) isPayload() {
 func convertSmtpdReject(r rawparser.RawPayload) (Payload, error) {
 	p := r.SmtpdReject
 
+	extraMessage := string(p.ExtraMessage)
+
+	info, _ := ParseRejectInfo(extraMessage)
+
 	return SmtpdReject{
 		Queue:        string(p.Queue),
-		ExtraMessage: string(p.ExtraMessage),
+		ExtraMessage: extraMessage,
+		Milter:       p.Milter,
+		Info:         info,
+	}, nil
+}
+
+// SmtpdSaslAuthFailed is a failed authentication attempt by a client
+type SmtpdSaslAuthFailed struct {
+	Host   string
+	IP     net.IP
+	Method string
+	Reason string
+
+	// Not logged by older postfix versions
+	Username string
+}
+
+func (SmtpdSaslAuthFailed) isPayload() {
+	// required by Payload interface
+}
+
+func convertSmtpdSaslAuthFailed(r rawparser.RawPayload) (Payload, error) {
+	p := r.SmtpdSaslAuthFailed
+
+	ip, err := parseIP(p.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	return SmtpdSaslAuthFailed{
+		Host:     string(p.Host),
+		IP:       ip,
+		Method:   string(p.Method),
+		Reason:   string(p.Reason),
+		Username: string(p.Username),
 	}, nil
 }
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeSpamdResult, convertSpamdResult)
+}
+
+// SpamdResult is logged by SpamAssassin for every message it checks.
+// It's related to the message only by its Message-ID header
+type SpamdResult struct {
+	MessageId string
+	Verdict   ContentFilterVerdict
+	Score     int
+}
+
+func (SpamdResult) isPayload() {
+	// required by Payload interface
+}
+
+func convertSpamdResult(r rawparser.RawPayload) (Payload, error) {
+	p := r.SpamdResult
+
+	score, err := atoi(p.Score)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	verdict := ContentFilterClean
+
+	if string(p.Flag) == "Y" {
+		verdict = ContentFilterSpam
+	}
+
+	return SpamdResult{
+		MessageId: string(p.MessageId),
+		Verdict:   verdict,
+		Score:     score,
+	}, nil
+}
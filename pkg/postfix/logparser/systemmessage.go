@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeSystemMessage, convertSystemMessage)
+}
+
+type SystemMessageSeverity int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+
+	// Something is wrong, but postfix keeps working, as a database older than its source file
+	SystemMessageWarning SystemMessageSeverity = iota
+
+	// A non fatal error, that can stop the daemon after happening too often
+	SystemMessageError
+
+	// The daemon stopped, as on a missing configuration file
+	SystemMessageFatal
+
+	// A bug in postfix, as a failed internal consistency check
+	SystemMessagePanic
+)
+
+var systemMessageSeverities = map[string]SystemMessageSeverity{
+	"warning": SystemMessageWarning,
+	"error":   SystemMessageError,
+	"fatal":   SystemMessageFatal,
+	"panic":   SystemMessagePanic,
+}
+
+func (s SystemMessageSeverity) String() string {
+	for k, v := range systemMessageSeverities {
+		if v == s {
+			return k
+		}
+	}
+
+	return "unknown"
+}
+
+// SystemMessage is a warning or error logged by any postfix daemon,
+// which usually points to a misconfiguration or an operating system issue
+type SystemMessage struct {
+	Severity SystemMessageSeverity
+	Message  string
+}
+
+func (SystemMessage) isPayload() {
+	// required by Payload interface
+}
+
+var ErrUnknownSystemMessageSeverity = errors.New("Unknown system message severity")
+
+func convertSystemMessage(r rawparser.RawPayload) (Payload, error) {
+	p := r.SystemMessage
+
+	severity, ok := systemMessageSeverities[string(p.Severity)]
+	if !ok {
+		return nil, ErrUnknownSystemMessageSeverity
+	}
+
+	return SystemMessage{Severity: severity, Message: string(p.Message)}, nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parser
+
+import (
+	"errors"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser/rawparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"net"
+)
+
+func init() {
+	registerHandler(rawparser.PayloadTypeTlsConnectionEstablished, convertTlsConnectionEstablished)
+}
+
+type TlsTrust int
+
+const (
+	// NOTE: those values are stored in the database,
+	// therefore never change their order or remove elements.
+	// You can add new elements at the end, though.
+
+	// The peer sent no certificate
+	TlsTrustAnonymous TlsTrust = iota
+
+	// The certificate chain could not be verified
+	TlsTrustUntrusted
+
+	// The certificate chain is valid, but the name was not checked or did not match
+	TlsTrustTrusted
+
+	// The certificate chain is valid and matches the peer name
+	TlsTrustVerified
+)
+
+var tlsTrustLevels = map[string]TlsTrust{
+	"Anonymous": TlsTrustAnonymous,
+	"Untrusted": TlsTrustUntrusted,
+	"Trusted":   TlsTrustTrusted,
+	"Verified":  TlsTrustVerified,
+}
+
+func (t TlsTrust) String() string {
+	switch t {
+	case TlsTrustAnonymous:
+		return "anonymous"
+	case TlsTrustUntrusted:
+		return "untrusted"
+	case TlsTrustTrusted:
+		return "trusted"
+	case TlsTrustVerified:
+		return "verified"
+	}
+
+	return "unknown"
+}
+
+// TlsConnectionEstablished is logged by smtp, for outbound connections,
+// and by smtpd, for inbound ones, once the TLS handshake succeeds
+type TlsConnectionEstablished struct {
+	Outbound bool
+	Trust    TlsTrust
+	Host     string
+	IP       net.IP
+
+	// Only known on outbound connections
+	Port int
+
+	// As TLSv1.3
+	Protocol string
+	Cipher   string
+}
+
+func (TlsConnectionEstablished) isPayload() {
+	// required by Payload interface
+}
+
+var ErrUnknownTlsTrust = errors.New("Unknown TLS trust level")
+
+func convertTlsConnectionEstablished(r rawparser.RawPayload) (Payload, error) {
+	p := r.TlsConnectionEstablished
+
+	trust, ok := tlsTrustLevels[string(p.Trust)]
+	if !ok {
+		return nil, ErrUnknownTlsTrust
+	}
+
+	ip, err := parseIP(p.IP)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	port := 0
+
+	if len(p.Port) > 0 {
+		if port, err = atoi(p.Port); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
+	return TlsConnectionEstablished{
+		Outbound: string(p.Direction) == "to",
+		Trust:    trust,
+		Host:     string(p.Host),
+		IP:       ip,
+		Port:     port,
+		Protocol: string(p.Protocol),
+		Cipher:   string(p.Cipher),
+	}, nil
+}
@@ -12,6 +12,11 @@ import (
 type RecordLocation struct {
 	Line     uint64
 	Filename string
+
+	// Byte offset of the line in the original file, when informed by a log shipper.
+	// Only meaningful if HasOffset is true.
+	Offset    uint64
+	HasOffset bool
 }
 
 type Record struct {
@@ -19,6 +24,9 @@ type Record struct {
 	Header   parser.Header
 	Location RecordLocation
 	Payload  parser.Payload
+
+	// The line as read from the log, before being parsed
+	RawLine []byte
 }
 
 type Publisher interface {
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package retention
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/meta"
+	"gitlab.com/lightmeter/controlcenter/pkg/runner"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"time"
+)
+
+// Purger is implemented by the databases that can have old data removed.
+// The methods should do a small amount of work on each call, so that other writers are not blocked.
+type Purger interface {
+	// PurgeBatch removes at most batchSize entries older than `before`, returning how many were removed
+	PurgeBatch(ctx context.Context, before time.Time, batchSize int) (int64, error)
+
+	// CollectGarbageBatch removes some rows not used anymore, returning whether there's still more work to do
+	CollectGarbageBatch(ctx context.Context, batchSize int) (bool, error)
+
+	// IncrementalVacuum returns at most `pages` unused pages to the filesystem, returning how many were freed
+	IncrementalVacuum(ctx context.Context, pages int) (int, error)
+}
+
+type Target struct {
+	Name   string
+	Purger Purger
+
+	// For how long the data should be kept, according to the settings. Zero means forever.
+	Period func(Settings) time.Duration
+}
+
+func DeliveriesPeriod(s Settings) time.Duration {
+	return Days(s.DeliveriesDays)
+}
+
+func InsightsPeriod(s Settings) time.Duration {
+	return Days(s.InsightsDays)
+}
+
+type Options struct {
+	// How often the retention policy is applied
+	CheckInterval time.Duration
+
+	BatchSize int
+
+	// Gives the other writers some room between batches
+	PauseBetweenBatches time.Duration
+
+	// Maximum number of pages freed in a single vacuum step
+	VacuumPages int
+}
+
+var DefaultOptions = Options{
+	CheckInterval:       time.Hour,
+	BatchSize:           1000,
+	PauseBetweenBatches: 100 * time.Millisecond,
+	VacuumPages:         1000,
+}
+
+type Runner struct {
+	runner.CancelableRunner
+
+	reader  *meta.Reader
+	clock   timeutil.Clock
+	targets []Target
+	options Options
+}
+
+func New(reader *meta.Reader, clock timeutil.Clock, targets []Target, options Options) *Runner {
+	r := &Runner{
+		reader:  reader,
+		clock:   clock,
+		targets: targets,
+		options: options,
+	}
+
+	r.CancelableRunner = runner.NewCancelableRunner(func(done runner.DoneChan, cancel runner.CancelChan) {
+		ctx, cancelCtx := context.WithCancel(context.Background())
+
+		go func() {
+			<-cancel
+			cancelCtx()
+		}()
+
+		go func() {
+			r.loop(ctx)
+			done <- nil
+		}()
+	})
+
+	return r
+}
+
+func (r *Runner) loop(ctx context.Context) {
+	for {
+		if err := r.cycle(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			errorutil.LogErrorf(err, "Applying data retention policy")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.options.CheckInterval):
+		}
+	}
+}
+
+func (r *Runner) pause(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return errorutil.Wrap(ctx.Err())
+	case <-time.After(r.options.PauseBetweenBatches):
+		return nil
+	}
+}
+
+func (r *Runner) cycle(ctx context.Context) error {
+	settings, err := GetSettings(ctx, r.reader)
+
+	if err != nil && errors.Is(err, meta.ErrNoSuchKey) {
+		// no retention policy set, keep everything
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	for _, t := range r.targets {
+		period := t.Period(*settings)
+
+		if period == 0 {
+			continue
+		}
+
+		if err := r.applyOnTarget(ctx, t, r.clock.Now().Add(-period)); err != nil {
+			return errorutil.Wrap(err, "target: ", t.Name)
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) applyOnTarget(ctx context.Context, t Target, before time.Time) error {
+	var removed int64
+
+	for {
+		n, err := t.Purger.PurgeBatch(ctx, before, r.options.BatchSize)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if n == 0 {
+			break
+		}
+
+		removed += n
+
+		if err := r.pause(ctx); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	if removed == 0 {
+		return nil
+	}
+
+	log.Info().Msgf("Removed %d entries older than %v from %s", removed, before, t.Name)
+
+	for {
+		more, err := t.Purger.CollectGarbageBatch(ctx, r.options.BatchSize)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		if !more {
+			break
+		}
+
+		if err := r.pause(ctx); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	freed := 0
+
+	for {
+		n, err := t.Purger.IncrementalVacuum(ctx, r.options.VacuumPages)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		freed += n
+
+		if n < r.options.VacuumPages {
+			break
+		}
+
+		if err := r.pause(ctx); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	log.Info().Msgf("Freed %d pages from %s", freed, t.Name)
+
+	return nil
+}
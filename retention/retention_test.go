@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package retention
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/meta"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
+	"testing"
+	"time"
+)
+
+var (
+	dummyContext = context.Background()
+)
+
+func init() {
+	lmsqlite3.Initialize(lmsqlite3.Options{})
+}
+
+type fakePurger struct {
+	entries      []time.Time
+	garbage      int
+	unusedPages  int
+	purgedBefore time.Time
+	gcCalls      int
+	vacuumCalls  int
+}
+
+func (p *fakePurger) PurgeBatch(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	p.purgedBefore = before
+
+	kept := []time.Time{}
+	removed := int64(0)
+
+	for _, e := range p.entries {
+		if e.Before(before) && removed < int64(batchSize) {
+			removed++
+			continue
+		}
+
+		kept = append(kept, e)
+	}
+
+	p.entries = kept
+
+	return removed, nil
+}
+
+func (p *fakePurger) CollectGarbageBatch(ctx context.Context, batchSize int) (bool, error) {
+	p.gcCalls++
+
+	if p.garbage > batchSize {
+		p.garbage -= batchSize
+		return true, nil
+	}
+
+	p.garbage = 0
+
+	return false, nil
+}
+
+func (p *fakePurger) IncrementalVacuum(ctx context.Context, pages int) (int, error) {
+	p.vacuumCalls++
+
+	if p.unusedPages > pages {
+		p.unusedPages -= pages
+		return pages, nil
+	}
+
+	freed := p.unusedPages
+	p.unusedPages = 0
+
+	return freed, nil
+}
+
+func TestRetention(t *testing.T) {
+	Convey("Retention", t, func() {
+		conn, closeConn := testutil.TempDBConnection(t)
+		defer closeConn()
+
+		m, err := meta.NewHandler(conn, "master")
+		So(err, ShouldBeNil)
+
+		defer func() { errorutil.MustSucceed(m.Close()) }()
+
+		metaRunner := meta.NewRunner(m)
+		writer := metaRunner.Writer()
+		done, cancel := metaRunner.Run()
+
+		defer func() { cancel(); So(done(), ShouldBeNil) }()
+
+		clock := &timeutil.FakeClock{Time: testutil.MustParseTime(`2020-06-01 00:00:00 +0000`)}
+
+		deliveries := &fakePurger{
+			entries: []time.Time{
+				testutil.MustParseTime(`2020-01-01 00:00:00 +0000`),
+				testutil.MustParseTime(`2020-02-01 00:00:00 +0000`),
+				testutil.MustParseTime(`2020-02-02 00:00:00 +0000`),
+				testutil.MustParseTime(`2020-05-30 00:00:00 +0000`),
+			},
+			garbage:     5,
+			unusedPages: 7,
+		}
+
+		insights := &fakePurger{
+			entries: []time.Time{
+				testutil.MustParseTime(`2019-01-01 00:00:00 +0000`),
+			},
+		}
+
+		options := Options{CheckInterval: time.Hour, BatchSize: 2, VacuumPages: 3}
+
+		r := New(m.Reader, clock, []Target{
+			{Name: "deliveries", Purger: deliveries, Period: DeliveriesPeriod},
+			{Name: "insights", Purger: insights, Period: InsightsPeriod},
+		}, options)
+
+		Convey("No settings, nothing is removed", func() {
+			So(r.cycle(dummyContext), ShouldBeNil)
+			So(len(deliveries.entries), ShouldEqual, 4)
+			So(len(insights.entries), ShouldEqual, 1)
+			So(deliveries.gcCalls, ShouldEqual, 0)
+		})
+
+		Convey("Only deliveries have a retention period", func() {
+			So(SetSettings(dummyContext, writer, Settings{DeliveriesDays: 90}), ShouldBeNil)
+
+			So(r.cycle(dummyContext), ShouldBeNil)
+
+			So(deliveries.purgedBefore, ShouldResemble, testutil.MustParseTime(`2020-03-03 00:00:00 +0000`))
+			So(deliveries.entries, ShouldResemble, []time.Time{testutil.MustParseTime(`2020-05-30 00:00:00 +0000`)})
+
+			// collected in batches until there's no garbage left
+			So(deliveries.garbage, ShouldEqual, 0)
+			So(deliveries.gcCalls, ShouldEqual, 3)
+
+			// vacuumed until fewer pages than requested are freed
+			So(deliveries.unusedPages, ShouldEqual, 0)
+			So(deliveries.vacuumCalls, ShouldEqual, 3)
+
+			// insights are kept forever
+			So(len(insights.entries), ShouldEqual, 1)
+
+			Convey("Nothing else to remove, no garbage collection is done", func() {
+				deliveries.garbage = 10
+
+				So(r.cycle(dummyContext), ShouldBeNil)
+
+				So(deliveries.garbage, ShouldEqual, 10)
+				So(deliveries.gcCalls, ShouldEqual, 3)
+			})
+		})
+	})
+}
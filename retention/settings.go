@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package retention
+
+import (
+	"context"
+	"gitlab.com/lightmeter/controlcenter/meta"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+const (
+	SettingKey = "retention"
+)
+
+// Settings define for how many days data is kept. Zero means forever.
+type Settings struct {
+	DeliveriesDays int `json:"deliveries_days"`
+	InsightsDays   int `json:"insights_days"`
+}
+
+func Days(n int) time.Duration {
+	return time.Duration(n) * time.Hour * 24
+}
+
+func SetSettings(ctx context.Context, writer *meta.AsyncWriter, settings Settings) error {
+	if err := writer.StoreJsonSync(ctx, SettingKey, settings); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func GetSettings(ctx context.Context, reader *meta.Reader) (*Settings, error) {
+	var settings Settings
+
+	err := reader.RetrieveJson(ctx, SettingKey, &settings)
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return &settings, nil
+}
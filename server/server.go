@@ -75,6 +75,14 @@ func (s *HttpServer) Start() error {
 	api.HttpDashboard(auth, mux, s.Timezone, dashboard)
 	api.HttpInsights(auth, mux, s.Timezone, s.Workspace.InsightsFetcher())
 	api.HttpInsightsProgress(auth, mux, s.Workspace.InsightsProgressFetcher())
+	api.HttpMessageLookup(auth, mux, s.Timezone, s.Workspace.MessageLookup())
+	api.HttpParserCoverage(auth, mux, s.Workspace.ParserCoverage())
+	api.HttpInFlight(auth, mux, s.Workspace.InFlightFetcher())
+	api.HttpTrackerGC(auth, mux, s.Workspace.TrackerGCStatsFetcher())
+
+	if fetcher := s.Workspace.LogArchiveFetcher(); fetcher != nil {
+		api.HttpLogArchive(auth, mux, fetcher, s.Workspace.MessageLookup())
+	}
 
 	setup.HttpSetup(mux, auth)
 
@@ -15,6 +15,9 @@ import (
 	"time"
 )
 
+// used by postfix on messages rejected before they get a queue assigned
+const noQueue = "NOQUEUE"
+
 var emptyActionDataPair = actionDataPair{connectionActionData: nil, resultActionData: nil}
 
 func actionTypeForRecord(r postfix.Record) (ActionType, actionDataPair) {
@@ -51,6 +54,18 @@ func actionTypeForRecord(r postfix.Record) (ActionType, actionDataPair) {
 		return MilterRejectActionType, emptyActionDataPair
 	case parser.SmtpdReject:
 		return RejectActionType, emptyActionDataPair
+	case parser.TlsConnectionEstablished:
+		return TlsConnectionActionType, emptyActionDataPair
+	case parser.QmgrReturnedToSender:
+		return MailExpiredActionType, emptyActionDataPair
+	case parser.AmavisVerdict:
+		return AmavisVerdictActionType, emptyActionDataPair
+	case parser.SpamdResult:
+		return SpamdResultActionType, emptyActionDataPair
+	case parser.OpenDkimSignature:
+		return DkimSignatureActionType, emptyActionDataPair
+	case parser.OpenDmarcResult:
+		return DmarcResultActionType, emptyActionDataPair
 	}
 
 	return UnsupportedActionType, emptyActionDataPair
@@ -76,7 +91,7 @@ func insertConnectionWithPid(tracker *Tracker, tx *sql.Tx, pidId int64) (int64,
 	return connectionId, nil
 }
 
-func insertPid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, error) {
+func insertPid(tracker *Tracker, tx *sql.Tx, pid int, host, instance string) (int64, error) {
 	// TODO: check if there's already a connection there, as it should not be
 	// in case there be, it means some message has been lost in the way
 	stmt := tx.Stmt(tracker.stmts[insertPidOnConnection])
@@ -85,7 +100,7 @@ func insertPid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, error
 		errorutil.MustSucceed(stmt.Close())
 	}()
 
-	result, err := stmt.Exec(pid, host)
+	result, err := stmt.Exec(pid, host, instance)
 	if err != nil {
 		return 0, errorutil.Wrap(err)
 	}
@@ -98,7 +113,7 @@ func insertPid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, error
 	return pidId, nil
 }
 
-func acquirePid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, error) {
+func acquirePid(tracker *Tracker, tx *sql.Tx, pid int, host, instance string) (int64, error) {
 	stmt := tx.Stmt(tracker.stmts[selectPidForPidAndHost])
 
 	defer func() {
@@ -110,7 +125,7 @@ func acquirePid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, erro
 	err := stmt.QueryRow(pid, host).Scan(&pidId)
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		// Create new pid
-		pidId, err := insertPid(tracker, tx, pid, host)
+		pidId, err := insertPid(tracker, tx, pid, host, instance)
 
 		if err != nil {
 			return 0, errorutil.Wrap(err)
@@ -133,7 +148,7 @@ func acquirePid(tracker *Tracker, tx *sql.Tx, pid int, host string) (int64, erro
 }
 
 func createConnection(tracker *Tracker, tx *sql.Tx, r postfix.Record) (int64, error) {
-	pidId, err := acquirePid(tracker, tx, r.Header.PID, r.Header.Host)
+	pidId, err := acquirePid(tracker, tx, r.Header.PID, r.Header.Host, r.Header.Instance())
 	if err != nil {
 		return 0, errorutil.Wrap(err)
 	}
@@ -293,6 +308,23 @@ func cloneAction(tracker *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair
 		return errorutil.Wrap(err)
 	}
 
+	if len(p.SaslUsername) == 0 {
+		return nil
+	}
+
+	// the client authenticates once per connection, but it's logged for each message it sends
+	stmt := tx.Stmt(tracker.stmts[insertConnectionDataIfMissing])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	for _, v := range []kvData{{key: ConnectionSaslMethodKey, value: p.SaslMethod}, {key: ConnectionSaslUsernameKey, value: p.SaslUsername}} {
+		if _, err := stmt.Exec(connectionId, v.key, v.value); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
 	return nil
 }
 
@@ -384,7 +416,7 @@ func findQueueIdFromQueueValue(tx *sql.Tx, t *Tracker, h parser.Header, queue st
 	}()
 
 	err := stmt.QueryRow(
-		h.Host, queue).Scan(&queueId)
+		h.Host, queue, h.Instance()).Scan(&queueId)
 
 	if err != nil {
 		return 0, errorutil.Wrap(err, "No queue id for queue: ", queue)
@@ -393,6 +425,24 @@ func findQueueIdFromQueueValue(tx *sql.Tx, t *Tracker, h parser.Header, queue st
 	return queueId, nil
 }
 
+// The queue a message has been relayed to, as in "queued as", can belong to another instance,
+// when it's re-injected by a content filter, or to another host, when it's relayed to it.
+func findRelayedQueueId(tx *sql.Tx, t *Tracker, h parser.Header, queue string) (int64, error) {
+	var queueId int64
+
+	stmt := tx.Stmt(t.stmts[selectQueueIdForRelayedQueue])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if err := stmt.QueryRow(queue, h.Host).Scan(&queueId); err != nil {
+		return 0, errorutil.Wrap(err, "No relayed queue id for queue: ", queue)
+	}
+
+	return queueId, nil
+}
+
 func mailQueuedAction(tracker *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
 	// I have the queue id and need to set the e-mail sender, size and nrcpt
 	p := r.Payload.(parser.QmgrMailQueued)
@@ -515,7 +565,7 @@ func mailSentAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair act
 		return nil
 	}
 
-	newQueueId, err := findQueueIdFromQueueValue(tx, t, r.Header, e.Queue)
+	newQueueId, err := findRelayedQueueId(tx, t, r.Header, e.Queue)
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		log.Warn().Msgf("Queue has been lost forever and will be ignored: %v, on %v:%v at %v", e.Queue, r.Location.Filename, r.Location.Line, r.Time)
 		return nil
@@ -607,16 +657,22 @@ func commitAction(tracker *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair
 	return nil
 }
 
-func addResultData(tracker *Tracker, tx *sql.Tx, time time.Time, loc postfix.RecordLocation, h parser.Header, p parser.SmtpSentStatus, resultId int64) error {
-	direction := func() MessageDirection {
-		if strings.HasSuffix(h.Daemon, "lmtp") || strings.HasSuffix(h.Daemon, "pipe") {
+func messageDirectionForDaemon(daemon string) MessageDirection {
+	// final deliveries into the local mailboxes
+	for _, d := range []string{"lmtp", "pipe", "local", "virtual"} {
+		if strings.HasSuffix(daemon, d) {
 			return MessageDirectionIncoming
 		}
+	}
 
-		return MessageDirectionOutbound
-	}()
+	return MessageDirectionOutbound
+}
 
-	stmt := tx.Stmt(tracker.stmts[insertResultData15Rows])
+func addResultData(
+	tracker *Tracker, tx *sql.Tx, time time.Time, loc postfix.RecordLocation,
+	h parser.Header, p parser.SmtpSentStatus, direction MessageDirection, resultId int64,
+) error {
+	stmt := tx.Stmt(tracker.stmts[insertResultData16Rows])
 
 	defer func() {
 		errorutil.MustSucceed(stmt.Close())
@@ -638,6 +694,7 @@ func addResultData(tracker *Tracker, tx *sql.Tx, time time.Time, loc postfix.Rec
 		resultId, ResultDeliveryFileLineKey, loc.Line,
 		resultId, ResultDeliveryTimeKey, time.Unix(),
 		resultId, ResultMessageDirectionKey, direction,
+		resultId, ResultExtraMessageKey, p.ExtraMessage,
 	)
 
 	if err != nil {
@@ -665,6 +722,53 @@ func addResultData(tracker *Tracker, tx *sql.Tx, time time.Time, loc postfix.Rec
 		return errorutil.Wrap(err)
 	}
 
+	if err := addResultTlsData(tracker, tx, h, p, resultId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// The relay session is known only if the smtp process established it with the same relay.
+// Otherwise the message has been sent in cleartext
+func addResultTlsData(tracker *Tracker, tx *sql.Tx, h parser.Header, p parser.SmtpSentStatus, resultId int64) error {
+	var (
+		protocol string
+		cipher   string
+		trust    int64
+	)
+
+	stmt := tx.Stmt(tracker.stmts[selectSmtpTlsSession])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	err := stmt.QueryRow(h.Host, h.PID, p.RelayIP, p.RelayPort).Scan(&protocol, &cipher, &trust)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	stmt = tx.Stmt(tracker.stmts[insertResultData3Rows])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	_, err = stmt.Exec(
+		resultId, ResultTlsProtocolKey, protocol,
+		resultId, ResultTlsCipherKey, cipher,
+		resultId, ResultTlsTrustKey, trust,
+	)
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
 	return nil
 }
 
@@ -676,8 +780,39 @@ func createResult(tracker *Tracker, tx *sql.Tx, r postfix.Record) (resultInfo, e
 		return resultInfo{}, errorutil.Wrap(err)
 	}
 
+	direction := messageDirectionForDaemon(r.Header.Daemon)
+
+	info, err := createResultForQueue(tracker, tx, queueId, r.Time, r.Location, r.Header, p, direction)
+	if err != nil {
+		return resultInfo{}, errorutil.Wrap(err)
+	}
+
+	attempt, firstDeferral, err := updateDeferredRecipient(tracker, tx, queueId, r.Time, p, direction)
+	if err != nil {
+		return resultInfo{}, errorutil.Wrap(err)
+	}
+
+	if err := insertResultDataValue(tx, tracker.stmts, info.id, ResultDeliveryAttemptKey, attempt); err != nil {
+		return resultInfo{}, errorutil.Wrap(err)
+	}
+
+	if firstDeferral.IsZero() {
+		return info, nil
+	}
+
+	if err := insertResultDataValue(tx, tracker.stmts, info.id, ResultFirstDeferralTimeKey, firstDeferral.Unix()); err != nil {
+		return resultInfo{}, errorutil.Wrap(err)
+	}
+
+	return info, nil
+}
+
+func createResultForQueue(
+	tracker *Tracker, tx *sql.Tx, queueId int64, time time.Time, loc postfix.RecordLocation,
+	h parser.Header, p parser.SmtpSentStatus, direction MessageDirection,
+) (resultInfo, error) {
 	// Increment usage of queue, as there's one more result using it
-	err = incrementQueueUsage(tx, tracker.stmts, queueId)
+	err := incrementQueueUsage(tx, tracker.stmts, queueId)
 	if err != nil {
 		return resultInfo{}, errorutil.Wrap(err)
 	}
@@ -698,12 +833,93 @@ func createResult(tracker *Tracker, tx *sql.Tx, r postfix.Record) (resultInfo, e
 		return resultInfo{}, errorutil.Wrap(err)
 	}
 
-	err = addResultData(tracker, tx, r.Time, r.Location, r.Header, p, resultId)
+	err = addResultData(tracker, tx, time, loc, h, p, direction, resultId)
 	if err != nil {
 		return resultInfo{}, errorutil.Wrap(err)
 	}
 
-	return resultInfo{id: resultId, loc: r.Location}, nil
+	return resultInfo{id: resultId, loc: loc}, nil
+}
+
+// A recipient is kept while its delivery is being deferred, as it's needed
+// to know which recipients expire, should the message stay in the queue for too long.
+// Returns the number of this delivery attempt for the recipient and, if it has been deferred before,
+// when it happened for the first time, so that retries can be linked to their final outcome
+func updateDeferredRecipient(tracker *Tracker, tx *sql.Tx, queueId int64, attemptTime time.Time, p parser.SmtpSentStatus, direction MessageDirection) (int64, time.Time, error) {
+	if p.Status != parser.DeferredStatus {
+		attempts, firstDeferral, err := deferredRecipientAttempts(tracker, tx, queueId, p)
+		if err != nil {
+			return 0, time.Time{}, errorutil.Wrap(err)
+		}
+
+		stmt := tx.Stmt(tracker.stmts[deleteDeferredRecipient])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(queueId, p.RecipientLocalPart, p.RecipientDomainPart); err != nil {
+			return 0, time.Time{}, errorutil.Wrap(err)
+		}
+
+		return attempts + 1, firstDeferral, nil
+	}
+
+	stmt := tx.Stmt(tracker.stmts[upsertDeferredRecipient])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(
+		queueId,
+		p.RecipientLocalPart,
+		p.RecipientDomainPart,
+		p.OrigRecipientLocalPart,
+		p.OrigRecipientDomainPart,
+		direction,
+		p.Dsn,
+		p.ExtraMessage,
+		attemptTime.Unix(),
+		attemptTime.Unix(),
+	); err != nil {
+		return 0, time.Time{}, errorutil.Wrap(err)
+	}
+
+	attempts, firstDeferral, err := deferredRecipientAttempts(tracker, tx, queueId, p)
+	if err != nil {
+		return 0, time.Time{}, errorutil.Wrap(err)
+	}
+
+	return attempts, firstDeferral, nil
+}
+
+// how many times the recipient has been deferred, and when for the first time.
+// The time is zero if the recipient has never been deferred, or has been deferred before it was known
+func deferredRecipientAttempts(tracker *Tracker, tx *sql.Tx, queueId int64, p parser.SmtpSentStatus) (int64, time.Time, error) {
+	stmt := tx.Stmt(tracker.stmts[selectDeferredRecipientAttempts])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	var attempts, firstAttemptTs int64
+
+	err := stmt.QueryRow(queueId, p.RecipientLocalPart, p.RecipientDomainPart).Scan(&attempts, &firstAttemptTs)
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, nil
+	}
+
+	if err != nil {
+		return 0, time.Time{}, errorutil.Wrap(err)
+	}
+
+	if firstAttemptTs == 0 {
+		return attempts, time.Time{}, nil
+	}
+
+	return attempts, time.Unix(firstAttemptTs, 0).In(time.UTC), nil
 }
 
 func mailBouncedAction(tracker *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
@@ -764,6 +980,182 @@ func bounceCreatedAction(tracker *Tracker, tx *sql.Tx, r postfix.Record, actionD
 	return nil
 }
 
+type deferredRecipient struct {
+	localPart      string
+	domainPart     string
+	origLocalPart  string
+	origDomainPart string
+	direction      MessageDirection
+	attempts       int64
+	dsn            string
+	extraMessage   string
+	firstAttemptTs int64
+}
+
+//nolint:rowserrcheck
+func deferredRecipientsForQueue(tx *sql.Tx, stmts trackerStmts, queueId int64) ([]deferredRecipient, error) {
+	stmt := tx.Stmt(stmts[selectDeferredRecipientsByQueueId])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	rows, err := stmt.Query(queueId)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() {
+		errorutil.MustSucceed(rows.Close())
+	}()
+
+	recipients := []deferredRecipient{}
+
+	for rows.Next() {
+		var d deferredRecipient
+
+		if err := rows.Scan(&d.localPart, &d.domainPart, &d.origLocalPart, &d.origDomainPart,
+			&d.direction, &d.attempts, &d.dsn, &d.extraMessage, &d.firstAttemptTs); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		recipients = append(recipients, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return recipients, nil
+}
+
+// the queue might have been created before the tracker started
+func queueBeginTime(tx *sql.Tx, stmts trackerStmts, queueId int64) (time.Time, bool, error) {
+	stmt := tx.Stmt(stmts[selectQueueDataValue])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	var ts int64
+
+	err := stmt.QueryRow(queueId, QueueBeginKey).Scan(&ts)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+
+	if err != nil {
+		return time.Time{}, false, errorutil.Wrap(err)
+	}
+
+	return time.Unix(ts, 0), true, nil
+}
+
+// qmgr gives up on a message that has been deferred for longer than maximal_queue_lifetime,
+// returning it to the sender. Every recipient still being deferred gets an expired result
+func mailExpiredAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.QmgrReturnedToSender)
+
+	queueId, err := findQueueIdFromQueueValue(tx, t, r.Header, p.Queue)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Msgf("Could not find expired queue %v, therefore ignoring it! On %v:%v", p.Queue, r.Location.Filename, r.Location.Line)
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if _, err := createResultsForDeferredRecipients(t, tx, queueId, p.Queue, r.Time, r.Location, r.Header, parser.ExpiredStatus); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// Every recipient still being deferred gets a result with the given status, the last deferral reason,
+// the number of attempts and, as delay, the time spent in the queue.
+// Returns how many results have been created
+func createResultsForDeferredRecipients(
+	t *Tracker, tx *sql.Tx, queueId int64, queue string, time time.Time, loc postfix.RecordLocation,
+	h parser.Header, status parser.SmtpStatus,
+) (int, error) {
+	recipients, err := deferredRecipientsForQueue(tx, t.stmts, queueId)
+	if err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	begin, beginKnown, err := queueBeginTime(tx, t.stmts, queueId)
+	if err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	delay := float32(0)
+
+	if beginKnown {
+		delay = float32(time.Sub(begin).Seconds())
+	}
+
+	for _, d := range recipients {
+		payload := parser.SmtpSentStatus{
+			Queue:                   queue,
+			RecipientLocalPart:      d.localPart,
+			RecipientDomainPart:     d.domainPart,
+			OrigRecipientLocalPart:  d.origLocalPart,
+			OrigRecipientDomainPart: d.origDomainPart,
+			Delay:                   delay,
+			Dsn:                     d.dsn,
+			Status:                  status,
+			ExtraMessage:            d.extraMessage,
+		}
+
+		info, err := createResultForQueue(t, tx, queueId, time, loc, h, payload, d.direction)
+		if err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		if err := insertResultDataValue(tx, t.stmts, info.id, ResultDeferralAttemptsKey, d.attempts); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+
+		if d.firstAttemptTs != 0 {
+			if err := insertResultDataValue(tx, t.stmts, info.id, ResultFirstDeferralTimeKey, d.firstAttemptTs); err != nil {
+				return 0, errorutil.Wrap(err)
+			}
+		}
+
+		if err := markResultToBeNotified(t, tx, info); err != nil {
+			return 0, errorutil.Wrap(err)
+		}
+	}
+
+	stmt := tx.Stmt(t.stmts[deleteDeferredRecipientsByQueueId])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(queueId); err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	return len(recipients), nil
+}
+
+func insertResultDataValue(tx *sql.Tx, stmts trackerStmts, resultId int64, key uint, value interface{}) error {
+	stmt := tx.Stmt(stmts[insertResultDataRow])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(resultId, key, value); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
 // Mail submitted locally on the machine via sendmail is being picked up
 func pickupAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
 	p := r.Payload.(parser.Pickup)
@@ -793,8 +1185,9 @@ func pickupAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actio
 }
 
 // a milter rejects a message
+// NOTE: the rejection itself is stored by the deliverydb RejectionsPublisher,
+// here we only release the queue, which will never be delivered
 func milterRejectAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
-	// TODO: notify this rejection to someone!!!
 	p := r.Payload.(parser.CleanupMilterReject)
 
 	log.Warn().Msgf("Mail rejected by milter, queue: %s on %s:%v", p.Queue, r.Location.Filename, r.Location.Line)
@@ -811,11 +1204,64 @@ func milterRejectAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair
 	return nil
 }
 
+// a TLS session is established either by smtpd, with a client, or by smtp, with a relay.
+// On smtpd, it belongs to the current connection, and on smtp it's used by the following
+// deliveries done by the same process, while the connection is kept open.
+func tlsConnectionAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.TlsConnectionEstablished)
+
+	if p.Outbound {
+		stmt := tx.Stmt(t.stmts[replaceSmtpTlsSession])
+
+		defer func() {
+			errorutil.MustSucceed(stmt.Close())
+		}()
+
+		if _, err := stmt.Exec(r.Header.Host, r.Header.PID, p.IP, p.Port, p.Protocol, p.Cipher, p.Trust); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+
+	connectionId, _, err := findConnectionIdAndUsageCounter(tx, t, r.Header)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Msgf("Connection for TLS session on line %v not found", r.Location)
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	stmt := tx.Stmt(t.stmts[insertConnectionData])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	for _, v := range []kvData{
+		{key: ConnectionTlsProtocolKey, value: p.Protocol},
+		{key: ConnectionTlsCipherKey, value: p.Cipher},
+		{key: ConnectionTlsTrustKey, value: p.Trust},
+	} {
+		if _, err := stmt.Exec(connectionId, v.key, v.value); err != nil {
+			return errorutil.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
 func rejectAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
-	// TODO: Notify someone about the rejected message
 	// FIXME: this is almost copy&paste from milterRejectAction!!!
 	p := r.Payload.(parser.SmtpdReject)
 
+	// Rejected before any queue had been created, so there's nothing to be released
+	if p.Queue == noQueue {
+		return nil
+	}
+
 	queueId, err := findQueueIdFromQueueValue(tx, t, r.Header, p.Queue)
 
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
@@ -833,3 +1279,82 @@ func rejectAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actio
 
 	return nil
 }
+
+func findQueueIdFromMessageId(tx *sql.Tx, t *Tracker, h parser.Header, messageId string) (int64, error) {
+	var queueId int64
+
+	stmt := tx.Stmt(t.stmts[selectQueueIdForMessageId])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if err := stmt.QueryRow(messageId, h.Host).Scan(&queueId); err != nil {
+		return 0, errorutil.Wrap(err, "No queue id for message id: ", messageId)
+	}
+
+	return queueId, nil
+}
+
+// Content filters and milters run outside of postfix, logging the queue they check,
+// or, when they don't know it, the Message-ID header. Their results are then stored in the queue,
+// reaching the results of the message through the queue parenting.
+func insertContentCheckData(t *Tracker, tx *sql.Tx, r postfix.Record, queue, messageId string, values ...kvData) error {
+	queueId, err := func() (int64, error) {
+		if len(queue) > 0 {
+			return findQueueIdFromQueueValue(tx, t, r.Header, queue)
+		}
+
+		return findQueueIdFromMessageId(tx, t, r.Header, messageId)
+	}()
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Msgf("Could not find queue %v (message-id: %v) checked by %v, therefore ignoring it! On %v:%v",
+			queue, messageId, r.Header.Process, r.Location.Filename, r.Location.Line)
+
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if err := insertQueueDataValues(tx, t.stmts, queueId, values...); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func amavisVerdictAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.AmavisVerdict)
+
+	values := []kvData{{key: QueueContentFilterVerdictKey, value: p.Verdict}}
+
+	if p.HasScore {
+		values = append(values, kvData{key: QueueContentFilterScoreKey, value: float64(p.Score)})
+	}
+
+	return insertContentCheckData(t, tx, r, p.Queue, p.MessageId, values...)
+}
+
+func spamdResultAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.SpamdResult)
+
+	return insertContentCheckData(t, tx, r, "", p.MessageId,
+		kvData{key: QueueContentFilterVerdictKey, value: p.Verdict},
+		kvData{key: QueueContentFilterScoreKey, value: float64(p.Score)},
+	)
+}
+
+func dkimSignatureAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.OpenDkimSignature)
+
+	return insertContentCheckData(t, tx, r, p.Queue, "", kvData{key: QueueDkimSigningDomainKey, value: p.Domain})
+}
+
+func dmarcResultAction(t *Tracker, tx *sql.Tx, r postfix.Record, actionDataPair actionDataPair) error {
+	p := r.Payload.(parser.OpenDmarcResult)
+
+	return insertContentCheckData(t, tx, r, p.Queue, "", kvData{key: QueueDmarcResultKey, value: p.Result})
+}
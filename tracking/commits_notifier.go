@@ -60,7 +60,7 @@ var notifierStmtsText = map[notifierStmtKey]string{
 	selectQueueIdFromResult: `select queue_id from results where id = ?`,
 	selectPidHostByQueue: `
 			select
-				pids.host
+				pids.host, pids.instance
 			from
 				queues join connections on queues.connection_id == connections.id
 				join pids on connections.pid_id == pids.id
@@ -130,7 +130,22 @@ func prepareCommitterConnection(conn *dbconn.RoPooledConn) error {
 	return nil
 }
 
+// A message can be relayed many times before being delivered, as between postfix instances
+// via a content filter, or to other hosts, and bounces relayed as well,
+// so the parenting is followed up to the queue the message was received on.
+// It's bound so that queue names that have been reused cannot make it loop forever
+const maxQueueParentingDepth = 16
+
 func findConnectionAndDeliveryQueue(conn *dbconn.RoPooledConn, queueId int64, loc postfix.RecordLocation) (connQueueId int64, deliveryQueueId int64, err error) {
+	return findConnectionAndDeliveryQueueWithDepth(conn, queueId, loc, 0)
+}
+
+func findConnectionAndDeliveryQueueWithDepth(conn *dbconn.RoPooledConn, queueId int64, loc postfix.RecordLocation, depth int) (connQueueId int64, deliveryQueueId int64, err error) {
+	if depth == maxQueueParentingDepth {
+		log.Warn().Msgf("Queue parenting too deep for queue id %v, on %v:%v", queueId, loc.Filename, loc.Line)
+		return queueId, queueId, nil
+	}
+
 	origQueue, parentingType, err := findOrigQueueForQueueParenting(conn, queueId)
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
@@ -144,12 +159,16 @@ func findConnectionAndDeliveryQueue(conn *dbconn.RoPooledConn, queueId int64, lo
 	}
 
 	if parentingType == queueParentingRelayType {
-		return origQueue, queueId, nil
+		connQueueId, _, err := findConnectionAndDeliveryQueueWithDepth(conn, origQueue, loc, depth+1)
+		if err != nil {
+			return 0, 0, errorutil.Wrap(err)
+		}
+
+		return connQueueId, queueId, nil
 	}
 
 	// this is a bounce parenting relationship. I need to find the original one from it.
-	// This is a, ugly recursive call, but we expect it to be execute at most twice, so that's ok.
-	return findConnectionAndDeliveryQueue(conn, origQueue, loc)
+	return findConnectionAndDeliveryQueueWithDepth(conn, origQueue, loc, depth+1)
 }
 
 func collectConnectionKeyValueResults(conn *dbconn.RoPooledConn, queueId int64) (Result, error) {
@@ -217,9 +236,14 @@ func buildAndPublishResult(
 		return resultInfo, errorutil.Wrap(err, resultInfo.loc)
 	}
 
-	var deliveryServer string
+	var deliveryServer, deliveryInstance, receivingServer, receivingInstance string
+
+	err = conn.Stmts[selectPidHostByQueue].QueryRow(deliveryQueueId).Scan(&deliveryServer, &deliveryInstance)
+	if err != nil {
+		return resultInfo, errorutil.Wrap(err, resultInfo.loc)
+	}
 
-	err = conn.Stmts[selectPidHostByQueue].QueryRow(deliveryQueueId).Scan(&deliveryServer)
+	err = conn.Stmts[selectPidHostByQueue].QueryRow(connQueueId).Scan(&receivingServer, &receivingInstance)
 	if err != nil {
 		return resultInfo, errorutil.Wrap(err, resultInfo.loc)
 	}
@@ -257,6 +281,9 @@ func buildAndPublishResult(
 	mergedResults := mergeResults(resultResult, queueResult, connResult, deliveryQueueResult)
 
 	mergedResults[ResultDeliveryServerKey] = ResultEntryText(deliveryServer)
+	mergedResults[ResultDeliveryInstanceKey] = ResultEntryText(deliveryInstance)
+	mergedResults[ResultReceivingServerKey] = ResultEntryText(receivingServer)
+	mergedResults[ResultReceivingInstanceKey] = ResultEntryText(receivingInstance)
 
 	pub.Publish(mergedResults)
 
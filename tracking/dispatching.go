@@ -20,12 +20,16 @@ type resultInfos struct {
 	values  [resultInfosCapacity]int64
 }
 
-func tryToDispatchAndReset(resultInfos *resultInfos, resultsToNotify chan<- resultInfos) {
-	if resultInfos.size > 0 {
-		resultsToNotify <- *resultInfos
-		resultInfos.size = 0
-		resultInfos.id++
+func tryToDispatchAndReset(resultInfos *resultInfos, resultsToNotify chan<- resultInfos) bool {
+	if resultInfos.size == 0 {
+		return false
 	}
+
+	resultsToNotify <- *resultInfos
+	resultInfos.size = 0
+	resultInfos.id++
+
+	return true
 }
 
 func dispatchAllResults(tracker *Tracker, resultsToNotify chan<- resultInfos, tx *sql.Tx, batchId int64) error {
@@ -58,8 +62,8 @@ func dispatchAllResults(tracker *Tracker, resultsToNotify chan<- resultInfos, tx
 	resultInfos := resultInfos{batchId: batchId}
 
 	for {
-		if resultInfos.size == resultInfosCapacity {
-			tryToDispatchAndReset(&resultInfos, resultsToNotify)
+		if resultInfos.size == resultInfosCapacity && tryToDispatchAndReset(&resultInfos, resultsToNotify) {
+			tracker.batchesBeingNotified++
 		}
 
 		if !rows.Next() {
@@ -91,7 +95,9 @@ func dispatchAllResults(tracker *Tracker, resultsToNotify chan<- resultInfos, tx
 		resultInfos.size++
 	}
 
-	tryToDispatchAndReset(&resultInfos, resultsToNotify)
+	if tryToDispatchAndReset(&resultInfos, resultsToNotify) {
+		tracker.batchesBeingNotified++
+	}
 
 	if count > 0 {
 		log.Debug().Msgf("Dispatched a total of %v on batch %v in %v", count, batchId, time.Since(start))
@@ -0,0 +1,387 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tracking
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+// When log lines are lost (log rotation races, restarts, gaps in rsync...), connections and queues
+// are never completed and would stay in the tracker database forever.
+// They are periodically expired by a garbage collector.
+type GCOptions struct {
+	// Connections, queues and results with no activity for longer than it are expired.
+	// It must be longer than the maximal_queue_lifetime of postfix, as deferred messages are still active.
+	// Zero disables the garbage collection
+	Horizon time.Duration
+
+	// How often the garbage is collected
+	Interval time.Duration
+}
+
+// Both durations are in log time, and not in wall clock time, so importing old logs
+// expires data just as following them does
+var DefaultGCOptions = GCOptions{
+	Horizon:  7 * 24 * time.Hour,
+	Interval: time.Hour,
+}
+
+// GCRun is what a garbage collection has expired
+type GCRun struct {
+	Time time.Time `json:"time"`
+
+	// Anything with no activity since then has been expired
+	Horizon time.Time `json:"horizon"`
+
+	Connections int64 `json:"connections"`
+	Queues      int64 `json:"queues"`
+	Results     int64 `json:"results"`
+
+	// Recipients still deferred on expired queues, notified with the incomplete status
+	IncompleteDeliveries int64 `json:"incomplete_deliveries"`
+}
+
+// GCStats tells how lossy the log pipeline is, as everything expired
+// comes from log lines that have never been read
+type GCStats struct {
+	Runs                 int64   `json:"runs"`
+	Connections          int64   `json:"connections"`
+	Queues               int64   `json:"queues"`
+	Results              int64   `json:"results"`
+	IncompleteDeliveries int64   `json:"incomplete_deliveries"`
+	LastRuns             []GCRun `json:"last_runs"`
+}
+
+const DefaultGCLastRuns = 10
+
+type GCStatsFetcher interface {
+	// Totals since ever, and the last garbage collections, the most recent first
+	GCStats(ctx context.Context, lastRuns int) (GCStats, error)
+}
+
+func (t *Tracker) GCStats(ctx context.Context, lastRuns int) (GCStats, error) {
+	conn, release := t.dbconn.RoConnPool.Acquire()
+
+	defer release()
+
+	var stats GCStats
+
+	if err := conn.QueryRowContext(ctx, `
+		select
+			count(*), total(connections), total(queues), total(results), total(incomplete_deliveries)
+		from
+			gc_runs`,
+	).Scan(&stats.Runs, &stats.Connections, &stats.Queues, &stats.Results, &stats.IncompleteDeliveries); err != nil {
+		return GCStats{}, errorutil.Wrap(err)
+	}
+
+	runs, err := lastGCRuns(ctx, conn.DB, lastRuns)
+	if err != nil {
+		return GCStats{}, errorutil.Wrap(err)
+	}
+
+	stats.LastRuns = runs
+
+	return stats, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func lastGCRuns(ctx context.Context, db *sql.DB, limit int) ([]GCRun, error) {
+	query, err := db.QueryContext(ctx, `
+		select
+			ts, horizon_ts, connections, queues, results, incomplete_deliveries
+		from
+			gc_runs
+		order by
+			id desc
+		limit ?`, limit)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() {
+		errorutil.MustSucceed(query.Close())
+	}()
+
+	runs := []GCRun{}
+
+	for query.Next() {
+		var (
+			r         GCRun
+			ts        int64
+			horizonTs int64
+		)
+
+		if err := query.Scan(&ts, &horizonTs, &r.Connections, &r.Queues, &r.Results, &r.IncompleteDeliveries); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		r.Time = time.Unix(ts, 0).In(time.UTC)
+		r.Horizon = time.Unix(horizonTs, 0).In(time.UTC)
+
+		runs = append(runs, r)
+	}
+
+	if err := query.Err(); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return runs, nil
+}
+
+// Called by the tracker on every log line, as the garbage collection
+// follows the time of the logs
+func collectGarbageIfNeeded(tx *sql.Tx, t *Tracker, logTime time.Time) (*sql.Tx, error) {
+	if t.gcOptions.Horizon == 0 {
+		return tx, nil
+	}
+
+	if t.lastGCTime.IsZero() {
+		t.lastGCTime = logTime
+		return tx, nil
+	}
+
+	if logTime.Sub(t.lastGCTime) < t.gcOptions.Interval {
+		return tx, nil
+	}
+
+	// the results being notified cannot be told apart from the ones whose notification failed,
+	// so the collection waits until the notifier is done with them
+	if t.batchesBeingNotified > 0 {
+		return tx, nil
+	}
+
+	t.lastGCTime = logTime
+
+	tx, err := startTransactionIfNeeded(t.dbconn.RwConn, tx)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	run, err := collectGarbage(t, tx, logTime)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	if run.Connections > 0 || run.Queues > 0 || run.Results > 0 {
+		log.Info().Msgf("Tracking expired %v connections, %v queues and %v results with no activity since %v, with %v incomplete deliveries",
+			run.Connections, run.Queues, run.Results, run.Horizon, run.IncompleteDeliveries)
+	}
+
+	return tx, nil
+}
+
+func collectGarbage(t *Tracker, tx *sql.Tx, now time.Time) (GCRun, error) {
+	horizon := now.Add(-t.gcOptions.Horizon)
+
+	run := GCRun{Time: now, Horizon: horizon}
+
+	queueIds, err := selectIds(tx, t.stmts[selectOrphanQueues], horizon.Unix())
+	if err != nil {
+		return GCRun{}, errorutil.Wrap(err)
+	}
+
+	for _, queueId := range queueIds {
+		if err := expireQueue(t, tx, queueId, now, &run); err != nil {
+			return GCRun{}, errorutil.Wrap(err)
+		}
+	}
+
+	// results whose queue has gone, where notifying them failed
+	resultIds, err := selectIds(tx, t.stmts[selectOrphanResults])
+	if err != nil {
+		return GCRun{}, errorutil.Wrap(err)
+	}
+
+	for _, resultId := range resultIds {
+		if err := deleteExpiredResult(tx, t.stmts, resultId); err != nil {
+			return GCRun{}, errorutil.Wrap(err)
+		}
+
+		run.Results++
+	}
+
+	// connections with no disconnection and no queue, or whose usage counter has got lost
+	connectionIds, err := selectIds(tx, t.stmts[selectOrphanConnections], horizon.Unix())
+	if err != nil {
+		return GCRun{}, errorutil.Wrap(err)
+	}
+
+	for _, connectionId := range connectionIds {
+		if err := deleteExpiredConnection(tx, t.stmts, connectionId); err != nil {
+			return GCRun{}, errorutil.Wrap(err)
+		}
+
+		run.Connections++
+	}
+
+	if err := execStmt(tx, t.stmts[deleteOrphanPids]); err != nil {
+		return GCRun{}, errorutil.Wrap(err)
+	}
+
+	if err := execStmt(tx, t.stmts[insertGCRun],
+		run.Time.Unix(), run.Horizon.Unix(), run.Connections, run.Queues, run.Results, run.IncompleteDeliveries,
+	); err != nil {
+		return GCRun{}, errorutil.Wrap(err)
+	}
+
+	return run, nil
+}
+
+// The recipients still being deferred are all that is known about the outcome of the message,
+// so they are notified as incomplete, and the queue is deleted once all of them have been notified.
+// Otherwise the queue, and everything depending on it, is deleted straight away
+func expireQueue(t *Tracker, tx *sql.Tx, queueId int64, now time.Time, run *GCRun) error {
+	var queue string
+
+	stmt := tx.Stmt(t.stmts[selectQueueById])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	err := stmt.QueryRow(queueId).Scan(&queue)
+
+	// deleted together with a queue created from it
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	resultIds, err := selectIds(tx, t.stmts[selectResultIdsByQueueId], queueId)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	for _, resultId := range resultIds {
+		if err := deleteExpiredResult(tx, t.stmts, resultId); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		run.Results++
+	}
+
+	run.Queues++
+
+	count, err := createResultsForDeferredRecipients(t, tx, queueId, queue, now, postfix.RecordLocation{}, parser.Header{}, parser.IncompleteStatus)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if count > 0 {
+		run.IncompleteDeliveries += int64(count)
+
+		// each notified result releases the queue once, regardless of what has been lost from its usage
+		if err := execStmt(tx, t.stmts[setQueueUsageById], count, queueId); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		return nil
+	}
+
+	err = deleteQueueRec(tx, t.stmts, queueId)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return errorutil.Wrap(err)
+	}
+
+	// the connection has already gone, so the queue is deleted on its own
+	if err := deleteQueue(tx, t.stmts, queueId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func deleteExpiredResult(tx *sql.Tx, stmts trackerStmts, resultId int64) error {
+	if err := deleteResultAction(tx, stmts, resultInfo{id: resultId}); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if err := execStmt(tx, stmts[deleteNotificationQueueByResultId], resultId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// the pids left without connections are deleted afterwards
+func deleteExpiredConnection(tx *sql.Tx, stmts trackerStmts, connectionId int64) error {
+	if err := execStmt(tx, stmts[deleteConnectionDataByConnectionId], connectionId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	if err := execStmt(tx, stmts[deleteConnectionById], connectionId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func execStmt(tx *sql.Tx, s *sql.Stmt, args ...interface{}) error {
+	stmt := tx.Stmt(s)
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(args...); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+// all ids are read before anything is deleted
+//nolint:rowserrcheck
+func selectIds(tx *sql.Tx, s *sql.Stmt, args ...interface{}) ([]int64, error) {
+	stmt := tx.Stmt(s)
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	defer func() {
+		errorutil.MustSucceed(rows.Close())
+	}()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	return ids, nil
+}
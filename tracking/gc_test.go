@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tracking
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+)
+
+// The lines about what happened to the first two messages, and the disconnection, have been lost
+const lossyLogBeforeRestart = `Dec  1 10:00:00 mail postfix/pickup[1000]: AAAAAAAAAA01: uid=0 from=<sender1@example.com>
+Dec  1 10:00:00 mail postfix/cleanup[1001]: AAAAAAAAAA01: message-id=<msg1@example.com>
+Dec  1 10:00:00 mail postfix/qmgr[1002]: AAAAAAAAAA01: from=<sender1@example.com>, size=1000, nrcpt=1 (queue active)
+Dec  1 10:00:01 mail postfix/smtp[1003]: AAAAAAAAAA01: to=<a@dst1.example.com>, relay=mx.dst1.example.com[11.22.33.44]:25, delay=1, delays=0/0/0.5/0.5, dsn=4.7.1, status=deferred (host mx.dst1.example.com[11.22.33.44] said: 451 4.7.1 Greylisted)
+Dec  1 11:00:00 mail postfix/smtpd[2000]: connect from unknown[55.66.77.88]
+Dec  1 12:00:00 mail postfix/pickup[1000]: BBBBBBBBBB02: uid=0 from=<sender2@example.com>
+Dec  1 12:00:00 mail postfix/cleanup[1001]: BBBBBBBBBB02: message-id=<msg2@example.com>
+Dec  1 12:00:00 mail postfix/qmgr[1002]: BBBBBBBBBB02: from=<sender2@example.com>, size=2000, nrcpt=1 (queue active)
+Dec  1 12:30:00 mail postfix/pickup[1000]: DDDDDDDDDD04: uid=0 from=<sender4@example.com>
+Dec  1 12:30:00 mail postfix/cleanup[1001]: DDDDDDDDDD04: message-id=<msg4@example.com>
+Dec  1 12:30:00 mail postfix/qmgr[1002]: DDDDDDDDDD04: from=<sender4@example.com>, size=4000, nrcpt=1 (queue active)
+Dec  1 12:30:01 mail postfix/smtp[1003]: DDDDDDDDDD04: to=<d@dst4.example.com>, relay=none, delay=1, delays=0/0/1/0, dsn=4.4.1, status=deferred (connect to mx.dst4.example.com[55.66.77.99]:25: Connection timed out)
+`
+
+const lossyLogAfterRestart = `Dec  8 12:00:00 mail postfix/qmgr[1002]: DDDDDDDDDD04: from=<sender4@example.com>, size=4000, nrcpt=1 (queue active)
+Dec  8 12:00:01 mail postfix/smtp[1003]: DDDDDDDDDD04: to=<d@dst4.example.com>, relay=none, delay=1, delays=0/0/1/0, dsn=4.4.1, status=deferred (connect to mx.dst4.example.com[55.66.77.99]:25: Connection timed out)
+Dec  9 13:00:00 mail postfix/pickup[1000]: CCCCCCCCCC03: uid=0 from=<sender3@example.com>
+Dec  9 13:00:00 mail postfix/cleanup[1001]: CCCCCCCCCC03: message-id=<msg3@example.com>
+Dec  9 13:00:00 mail postfix/qmgr[1002]: CCCCCCCCCC03: from=<sender3@example.com>, size=3000, nrcpt=1 (queue active)
+Dec  9 13:00:01 mail postfix/smtp[1003]: CCCCCCCCCC03: to=<c@dst3.example.com>, relay=mx.dst3.example.com[11.22.33.45]:25, delay=1, delays=0/0/0.5/0.5, dsn=2.0.0, status=sent (250 2.0.0 Ok)
+Dec  9 13:00:01 mail postfix/qmgr[1002]: CCCCCCCCCC03: removed
+`
+
+func readWithTracker(dir string, pub ResultPublisher, options GCOptions, content string) *Tracker {
+	tracker, err := New(dir, pub, options)
+	So(err, ShouldBeNil)
+
+	done, cancel := tracker.Run()
+	readFromTestContent(content, tracker.Publisher())
+	cancel()
+	So(done(), ShouldBeNil)
+
+	return tracker
+}
+
+func TestGarbageCollection(t *testing.T) {
+	Convey("Garbage collection", t, func() {
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		pub := &fakeResultPublisher{}
+
+		ctx := context.Background()
+
+		// the garbage is collected every hour of logs, at 11h and 12h, but nothing is old enough
+		tracker := readWithTracker(dir, pub, DefaultGCOptions, lossyLogBeforeRestart)
+
+		stats, err := tracker.GCStats(ctx, DefaultGCLastRuns)
+		So(err, ShouldBeNil)
+		So(stats.Runs, ShouldEqual, 2)
+		So(stats.Queues, ShouldEqual, 0)
+
+		So(tracker.Close(), ShouldBeNil)
+
+		tracker = readWithTracker(dir, pub, DefaultGCOptions, lossyLogAfterRestart)
+		defer func() { So(tracker.Close(), ShouldBeNil) }()
+
+		countRows := func(table string) int {
+			conn, release := tracker.dbconn.RoConnPool.Acquire()
+			defer release()
+
+			var count int
+			So(conn.QueryRow(`select count(*) from `+table).Scan(&count), ShouldBeNil)
+
+			return count
+		}
+
+		// deferred a, deferred d twice, incomplete a and sent c
+		So(len(pub.results), ShouldEqual, 5)
+
+		incomplete := pub.results[3]
+		So(incomplete[ResultStatusKey].Int64(), ShouldEqual, parser.IncompleteStatus)
+		So(incomplete[ResultRecipientLocalPartKey].Text(), ShouldEqual, "a")
+		So(incomplete[ResultRecipientDomainPartKey].Text(), ShouldEqual, "dst1.example.com")
+		So(incomplete[QueueSenderLocalPartKey].Text(), ShouldEqual, "sender1")
+		So(incomplete[QueueDeliveryNameKey].Text(), ShouldEqual, "AAAAAAAAAA01")
+		So(incomplete[ResultDeliveryServerKey].Text(), ShouldEqual, "mail")
+		So(incomplete[ResultDeferralAttemptsKey].Int64(), ShouldEqual, 1)
+		So(incomplete[ResultFirstDeferralTimeKey].Int64(), ShouldEqual, testutil.MustParseTime(`2020-12-01 10:00:01 +0000`).Unix())
+		So(incomplete[ResultDeliveryTimeKey].Int64(), ShouldEqual, testutil.MustParseTime(`2020-12-09 13:00:00 +0000`).Unix())
+		So(incomplete[ResultExtraMessageKey].Text(), ShouldEqual, "(host mx.dst1.example.com[11.22.33.44] said: 451 4.7.1 Greylisted)")
+
+		So(pub.results[4][ResultStatusKey].Int64(), ShouldEqual, parser.SentStatus)
+
+		stats, err = tracker.GCStats(ctx, 1)
+		So(err, ShouldBeNil)
+		So(stats, ShouldResemble, GCStats{
+			Runs:                 3,
+			Connections:          1,
+			Queues:               2,
+			IncompleteDeliveries: 1,
+			LastRuns: []GCRun{
+				{
+					Time:                 testutil.MustParseTime(`2020-12-09 13:00:00 +0000`),
+					Horizon:              testutil.MustParseTime(`2020-12-02 13:00:00 +0000`),
+					Connections:          1,
+					Queues:               2,
+					IncompleteDeliveries: 1,
+				},
+			},
+		})
+
+		// only the message deferred a day ago is still in the queue
+		inFlight, err := tracker.InFlightQueues(ctx, testutil.MustParseTime(`2020-12-09 14:00:00 +0000`), InFlightOptions{})
+		So(err, ShouldBeNil)
+		So(inFlight.Total, ShouldEqual, 1)
+		So(inFlight.Queues[0].Queue, ShouldEqual, "DDDDDDDDDD04")
+
+		So(countRows(`queues`), ShouldEqual, 1)
+		So(countRows(`connections`), ShouldEqual, 1)
+		So(countRows(`pids`), ShouldEqual, 1)
+		So(countRows(`results`), ShouldEqual, 0)
+		So(countRows(`deferred_recipients`), ShouldEqual, 1)
+	})
+}
+
+func TestGarbageCollectionDisabled(t *testing.T) {
+	Convey("Garbage collection disabled", t, func() {
+		pub := &fakeResultPublisher{}
+
+		dir, clearDir := testutil.TempDir(t)
+		defer clearDir()
+
+		tracker := readWithTracker(dir, pub, GCOptions{}, lossyLogBeforeRestart+lossyLogAfterRestart)
+		defer func() { So(tracker.Close(), ShouldBeNil) }()
+
+		// no incomplete result
+		So(len(pub.results), ShouldEqual, 4)
+
+		stats, err := tracker.GCStats(context.Background(), DefaultGCLastRuns)
+		So(err, ShouldBeNil)
+		So(stats.Runs, ShouldEqual, 0)
+	})
+}
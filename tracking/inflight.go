@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tracking
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"time"
+)
+
+// InFlightQueue is a message accepted by postfix, but not yet removed from its queue,
+// either waiting to be delivered, or deferred and waiting for a new attempt
+type InFlightQueue struct {
+	Queue  string `json:"queue"`
+	Host   string `json:"host"`
+	Sender string `json:"sender"`
+
+	// Only the deferred recipients are known, as postfix logs them only on delivery attempts
+	Recipients []string `json:"recipients"`
+
+	QueuedAt time.Time `json:"queued_at"`
+
+	// In seconds
+	Age float64 `json:"age"`
+
+	// How many delivery attempts have been deferred, for the most deferred recipient
+	Attempts int `json:"attempts"`
+
+	// Empty if the message has not been deferred
+	LastDeferralReason string `json:"last_deferral_reason"`
+}
+
+type InFlightQueues struct {
+	Total  int             `json:"total"`
+	Queues []InFlightQueue `json:"queues"`
+}
+
+type InFlightOrder int
+
+const (
+	InFlightOldestFirst InFlightOrder = iota
+	InFlightNewestFirst
+)
+
+const DefaultInFlightLimit = 100
+
+type InFlightOptions struct {
+	Order InFlightOrder
+
+	// DefaultInFlightLimit if zero
+	Limit int
+}
+
+// InFlightFetcher gives a read only view of the messages the tracker is still waiting for, similar to mailq
+type InFlightFetcher interface {
+	InFlightQueues(ctx context.Context, now time.Time, options InFlightOptions) (InFlightQueues, error)
+
+	// How many messages, queued before a given time, have been deferred and are still in the queue
+	CountDeferredQueuedBefore(ctx context.Context, t time.Time) (int, error)
+}
+
+type inFlightStmtKey uint
+
+const (
+	selectInFlightQueuesOldestFirst inFlightStmtKey = iota
+	selectInFlightQueuesNewestFirst
+	countInFlightQueues
+	selectInFlightDeferredRecipients
+	countDeferredQueuedBefore
+)
+
+// Queues get the sender once they reach qmgr, and the end when they are removed from the queue
+var inFlightQueueCondition = fmt.Sprintf(`
+	exists (select 1 from queue_data where queue_id = queues.id and key = %d)
+	and not exists (select 1 from queue_data where queue_id = queues.id and key = %d)`,
+	QueueSenderDomainPartKey, QueueEndKey)
+
+func selectInFlightQueuesText(order string) string {
+	return fmt.Sprintf(`
+	select
+		queues.id, queues.queue, pids.host, begin_data.value,
+		ifnull((select value from queue_data where queue_id = queues.id and key = %[1]d order by id desc limit 1), ''),
+		ifnull((select value from queue_data where queue_id = queues.id and key = %[2]d order by id desc limit 1), '')
+	from
+		queues join connections on queues.connection_id = connections.id
+		join pids on connections.pid_id = pids.id
+		join queue_data begin_data on begin_data.queue_id = queues.id and begin_data.key = %[3]d
+	where %[4]s
+	order by
+		begin_data.value %[5]s, queues.id %[5]s
+	limit ?`, QueueSenderLocalPartKey, QueueSenderDomainPartKey, QueueBeginKey, inFlightQueueCondition, order)
+}
+
+var inFlightStmtsText = map[inFlightStmtKey]string{
+	selectInFlightQueuesOldestFirst: selectInFlightQueuesText("asc"),
+	selectInFlightQueuesNewestFirst: selectInFlightQueuesText("desc"),
+	countInFlightQueues:             `select count(*) from queues where ` + inFlightQueueCondition,
+	selectInFlightDeferredRecipients: `
+	select
+		recipient_local_part, recipient_domain_part, attempts, extra_message
+	from
+		deferred_recipients
+	where
+		queue_id = ?
+	order by
+		last_attempt_ts desc, id desc`,
+	countDeferredQueuedBefore: fmt.Sprintf(`
+	select
+		count(distinct deferred_recipients.queue_id)
+	from
+		deferred_recipients join queue_data on deferred_recipients.queue_id = queue_data.queue_id and queue_data.key = %d
+	where
+		queue_data.value < ?
+		and not exists (select 1 from queue_data where queue_id = deferred_recipients.queue_id and key = %d)`,
+		QueueBeginKey, QueueEndKey),
+}
+
+func prepareInFlightConnection(conn *dbconn.RoPooledConn) error {
+	for k, v := range inFlightStmtsText {
+		//nolint:sqlclosecheck
+		stmt, err := conn.Prepare(v)
+		if err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		conn.Stmts[k] = stmt
+
+		conn.Closers.Add(stmt)
+	}
+
+	return nil
+}
+
+func (t *Tracker) InFlightQueues(ctx context.Context, now time.Time, options InFlightOptions) (InFlightQueues, error) {
+	conn, release := t.dbconn.RoConnPool.Acquire()
+
+	defer release()
+
+	r := InFlightQueues{Queues: []InFlightQueue{}}
+
+	if err := conn.Stmts[countInFlightQueues].QueryRowContext(ctx).Scan(&r.Total); err != nil {
+		return InFlightQueues{}, errorutil.Wrap(err)
+	}
+
+	stmt := conn.Stmts[selectInFlightQueuesOldestFirst]
+
+	if options.Order == InFlightNewestFirst {
+		stmt = conn.Stmts[selectInFlightQueuesNewestFirst]
+	}
+
+	limit := options.Limit
+
+	if limit == 0 {
+		limit = DefaultInFlightLimit
+	}
+
+	ids, queues, err := listInFlightQueues(ctx, stmt, now, limit)
+	if err != nil {
+		return InFlightQueues{}, errorutil.Wrap(err)
+	}
+
+	for i, id := range ids {
+		if err := collectInFlightDeferredRecipients(ctx, conn.Stmts[selectInFlightDeferredRecipients], id, &queues[i]); err != nil {
+			return InFlightQueues{}, errorutil.Wrap(err)
+		}
+	}
+
+	r.Queues = queues
+
+	return r, nil
+}
+
+func (t *Tracker) CountDeferredQueuedBefore(ctx context.Context, before time.Time) (int, error) {
+	conn, release := t.dbconn.RoConnPool.Acquire()
+
+	defer release()
+
+	var count int
+
+	if err := conn.Stmts[countDeferredQueuedBefore].QueryRowContext(ctx, before.Unix()).Scan(&count); err != nil {
+		return 0, errorutil.Wrap(err)
+	}
+
+	return count, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func listInFlightQueues(ctx context.Context, stmt *sql.Stmt, now time.Time, limit int) ([]int64, []InFlightQueue, error) {
+	query, err := stmt.QueryContext(ctx, limit)
+	if err != nil {
+		return nil, nil, errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	ids := []int64{}
+	queues := []InFlightQueue{}
+
+	for query.Next() {
+		var (
+			id               int64
+			queuedAt         int64
+			senderLocalPart  string
+			senderDomainPart string
+		)
+
+		q := InFlightQueue{Recipients: []string{}}
+
+		if err := query.Scan(&id, &q.Queue, &q.Host, &queuedAt, &senderLocalPart, &senderDomainPart); err != nil {
+			return nil, nil, errorutil.Wrap(err)
+		}
+
+		// bounce notifications have no sender
+		if len(senderLocalPart) > 0 || len(senderDomainPart) > 0 {
+			q.Sender = senderLocalPart + "@" + senderDomainPart
+		}
+
+		q.QueuedAt = time.Unix(queuedAt, 0).In(time.UTC)
+		q.Age = now.Sub(q.QueuedAt).Seconds()
+
+		ids = append(ids, id)
+		queues = append(queues, q)
+	}
+
+	if err := query.Err(); err != nil {
+		return nil, nil, errorutil.Wrap(err)
+	}
+
+	return ids, queues, nil
+}
+
+// rowserrcheck is buggy and unable to see that the query errors are being checked
+// when query.Close() is inside a closure
+//nolint:rowserrcheck
+func collectInFlightDeferredRecipients(ctx context.Context, stmt *sql.Stmt, queueId int64, q *InFlightQueue) error {
+	query, err := stmt.QueryContext(ctx, queueId)
+	if err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	defer func() { errorutil.MustSucceed(query.Close()) }()
+
+	for query.Next() {
+		var (
+			localPart    string
+			domainPart   string
+			attempts     int
+			extraMessage string
+		)
+
+		if err := query.Scan(&localPart, &domainPart, &attempts, &extraMessage); err != nil {
+			return errorutil.Wrap(err)
+		}
+
+		// the most recently deferred recipient comes first
+		if len(q.Recipients) == 0 {
+			q.LastDeferralReason = extraMessage
+		}
+
+		q.Recipients = append(q.Recipients, localPart+"@"+domainPart)
+
+		if attempts > q.Attempts {
+			q.Attempts = attempts
+		}
+	}
+
+	if err := query.Err(); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
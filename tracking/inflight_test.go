@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tracking
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/lightmeter/controlcenter/util/testutil"
+	"testing"
+	"time"
+)
+
+const inFlightLog = `Dec  7 13:00:00 mail postfix/pickup[1000]: AAAAAAAAAA01: uid=0 from=<sender1@example.com>
+Dec  7 13:00:00 mail postfix/cleanup[1001]: AAAAAAAAAA01: message-id=<msg1@example.com>
+Dec  7 13:00:00 mail postfix/qmgr[1002]: AAAAAAAAAA01: from=<sender1@example.com>, size=1000, nrcpt=2 (queue active)
+Dec  7 13:00:01 mail postfix/smtp[1003]: AAAAAAAAAA01: to=<a@dst1.example.com>, relay=mx.dst1.example.com[11.22.33.44]:25, delay=1, delays=0/0/0.5/0.5, dsn=4.7.1, status=deferred (host mx.dst1.example.com[11.22.33.44] said: 451 4.7.1 Greylisted)
+Dec  7 13:00:01 mail postfix/smtp[1003]: AAAAAAAAAA01: to=<b@dst2.example.com>, relay=none, delay=1, delays=0/0/1/0, dsn=4.4.1, status=deferred (connect to mx.dst2.example.com[55.66.77.88]:25: Connection timed out)
+Dec  7 14:00:00 mail postfix/qmgr[1002]: AAAAAAAAAA01: from=<sender1@example.com>, size=1000, nrcpt=2 (queue active)
+Dec  7 14:00:01 mail postfix/smtp[1003]: AAAAAAAAAA01: to=<a@dst1.example.com>, relay=mx.dst1.example.com[11.22.33.44]:25, delay=3601, delays=3600/0/0.5/0.5, dsn=4.7.1, status=deferred (host mx.dst1.example.com[11.22.33.44] said: 451 4.7.1 Still greylisted)
+Dec  7 15:00:00 mail postfix/pickup[1000]: BBBBBBBBBB02: uid=0 from=<sender2@example.com>
+Dec  7 15:00:00 mail postfix/cleanup[1001]: BBBBBBBBBB02: message-id=<msg2@example.com>
+Dec  7 15:00:00 mail postfix/qmgr[1002]: BBBBBBBBBB02: from=<sender2@example.com>, size=2000, nrcpt=1 (queue active)
+Dec  7 16:00:00 mail postfix/pickup[1000]: CCCCCCCCCC03: uid=0 from=<sender3@example.com>
+Dec  7 16:00:00 mail postfix/cleanup[1001]: CCCCCCCCCC03: message-id=<msg3@example.com>
+Dec  7 16:00:00 mail postfix/qmgr[1002]: CCCCCCCCCC03: from=<sender3@example.com>, size=3000, nrcpt=1 (queue active)
+Dec  7 16:00:01 mail postfix/smtp[1003]: CCCCCCCCCC03: to=<c@dst3.example.com>, relay=mx.dst3.example.com[11.22.33.45]:25, delay=1, delays=0/0/0.5/0.5, dsn=2.0.0, status=sent (250 2.0.0 Ok)
+Dec  7 16:00:01 mail postfix/qmgr[1002]: CCCCCCCCCC03: removed
+`
+
+func TestInFlightQueues(t *testing.T) {
+	Convey("In flight queues", t, func() {
+		_, tracker, clear := buildPublisherAndTempTracker(t)
+		defer clear()
+
+		ctx := context.Background()
+
+		now := testutil.MustParseTime(`2020-12-07 17:00:00 +0000`)
+
+		Convey("Nothing read", func() {
+			done, cancel := tracker.Run()
+			cancel()
+			So(done(), ShouldBeNil)
+
+			r, err := tracker.InFlightQueues(ctx, now, InFlightOptions{})
+			So(err, ShouldBeNil)
+			So(r, ShouldResemble, InFlightQueues{Total: 0, Queues: []InFlightQueue{}})
+
+			count, err := tracker.CountDeferredQueuedBefore(ctx, now)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("One deferred message, one waiting in the queue and one delivered", func() {
+			done, cancel := tracker.Run()
+			readFromTestContent(inFlightLog, tracker.Publisher())
+			cancel()
+			So(done(), ShouldBeNil)
+
+			deferred := InFlightQueue{
+				Queue:              "AAAAAAAAAA01",
+				Host:               "mail",
+				Sender:             "sender1@example.com",
+				Recipients:         []string{"a@dst1.example.com", "b@dst2.example.com"},
+				QueuedAt:           testutil.MustParseTime(`2020-12-07 13:00:00 +0000`),
+				Age:                (4 * time.Hour).Seconds(),
+				Attempts:           2,
+				LastDeferralReason: "(host mx.dst1.example.com[11.22.33.44] said: 451 4.7.1 Still greylisted)",
+			}
+
+			waiting := InFlightQueue{
+				Queue:      "BBBBBBBBBB02",
+				Host:       "mail",
+				Sender:     "sender2@example.com",
+				Recipients: []string{},
+				QueuedAt:   testutil.MustParseTime(`2020-12-07 15:00:00 +0000`),
+				Age:        (2 * time.Hour).Seconds(),
+			}
+
+			Convey("Oldest first", func() {
+				r, err := tracker.InFlightQueues(ctx, now, InFlightOptions{Order: InFlightOldestFirst})
+				So(err, ShouldBeNil)
+				So(r, ShouldResemble, InFlightQueues{Total: 2, Queues: []InFlightQueue{deferred, waiting}})
+			})
+
+			Convey("Newest first, limited", func() {
+				r, err := tracker.InFlightQueues(ctx, now, InFlightOptions{Order: InFlightNewestFirst, Limit: 1})
+				So(err, ShouldBeNil)
+				So(r, ShouldResemble, InFlightQueues{Total: 2, Queues: []InFlightQueue{waiting}})
+			})
+
+			Convey("Count deferred messages", func() {
+				count, err := tracker.CountDeferredQueuedBefore(ctx, testutil.MustParseTime(`2020-12-07 14:00:00 +0000`))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+
+				count, err = tracker.CountDeferredQueuedBefore(ctx, testutil.MustParseTime(`2020-12-07 12:00:00 +0000`))
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "10_gc_runs.go", upGCRuns, downGCRuns)
+}
+
+// What each garbage collection of the connections, queues and results that never got completed
+// has expired, as a measure of how many log lines are being lost.
+// The indexes make finding the data that belongs to nothing else cheap
+func upGCRuns(tx *sql.Tx) error {
+	sql := `
+create table gc_runs (
+	id integer primary key,
+	ts integer not null,
+	horizon_ts integer not null,
+	connections integer not null,
+	queues integer not null,
+	results integer not null,
+	incomplete_deliveries integer not null
+);
+
+create index gc_runs_ts_index on gc_runs(ts);
+
+create index results_queue_id_index on results(queue_id);
+create index queues_connection_id_index on queues(connection_id);
+create index notification_queues_result_id_index on notification_queues(result_id);
+`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downGCRuns(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "11_pid_instances.go", upPidInstances, downPidInstances)
+}
+
+// The postfix instance of a process, as several instances, managed by postmulti,
+// can run on the same host. The processes known before it are from the default instance
+func upPidInstances(tx *sql.Tx) error {
+	sql := `alter table pids add column instance text not null default 'postfix'`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downPidInstances(tx *sql.Tx) error {
+	return nil
+}
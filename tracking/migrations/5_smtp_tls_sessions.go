@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "5_smtp_tls_sessions.go", upCreateSmtpTlsSessions, downCreateSmtpTlsSessions)
+}
+
+// The last TLS session established by each smtp process, which is reused
+// by the following deliveries to the same relay, as long as the connection is cached.
+// There's at most one session per process, so the table is bounded by the number of pids
+func upCreateSmtpTlsSessions(tx *sql.Tx) error {
+	sql := `
+create table smtp_tls_sessions (
+	id integer primary key,
+	host text not null,
+	pid integer not null,
+	peer_ip blob not null,
+	peer_port integer not null,
+	protocol text not null,
+	cipher text not null,
+	trust integer not null
+);
+
+create unique index smtp_tls_sessions_pid_index on smtp_tls_sessions(host, pid);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateSmtpTlsSessions(tx *sql.Tx) error {
+	return nil
+}
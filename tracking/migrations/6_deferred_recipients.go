@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "6_deferred_recipients.go", upCreateDeferredRecipients, downCreateDeferredRecipients)
+}
+
+// The recipients of a queue whose last delivery attempt has been deferred,
+// kept until the message is delivered, bounced or expires.
+// The last deferral is used to describe why the message expired
+func upCreateDeferredRecipients(tx *sql.Tx) error {
+	sql := `
+create table deferred_recipients (
+	id integer primary key,
+	queue_id integer not null,
+	recipient_local_part text not null,
+	recipient_domain_part text not null,
+	orig_recipient_local_part text not null,
+	orig_recipient_domain_part text not null,
+	direction integer not null,
+	attempts integer not null,
+	dsn text not null,
+	extra_message text not null
+);
+
+create unique index deferred_recipients_index on deferred_recipients(queue_id, recipient_local_part, recipient_domain_part);
+`
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downCreateDeferredRecipients(tx *sql.Tx) error {
+	return nil
+}
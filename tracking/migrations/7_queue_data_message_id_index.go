@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "7_queue_data_message_id_index.go", upQueueDataMessageIdIndex, downQueueDataMessageIdIndex)
+}
+
+// Content filters as SpamAssassin know messages only by their Message-ID header,
+// which is stored in queue_data with the key 12 (tracking.QueueMessageIDKey)
+func upQueueDataMessageIdIndex(tx *sql.Tx) error {
+	sql := `create index queue_data_message_id_index on queue_data(value) where key = 12`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downQueueDataMessageIdIndex(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "8_deferred_recipients_last_attempt.go", upDeferredRecipientsLastAttempt, downDeferredRecipientsLastAttempt)
+}
+
+// When the last delivery attempt to a deferred recipient happened,
+// telling which of the recipients of a queue has been deferred most recently.
+// Zero for the recipients deferred before this migration
+func upDeferredRecipientsLastAttempt(tx *sql.Tx) error {
+	sql := `alter table deferred_recipients add column last_attempt_ts integer not null default 0`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downDeferredRecipientsLastAttempt(tx *sql.Tx) error {
+	return nil
+}
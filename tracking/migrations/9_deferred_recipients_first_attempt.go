@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 Lightmeter <hello@lightmeter.io>
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package migrations
+
+import (
+	"database/sql"
+	"gitlab.com/lightmeter/controlcenter/lmsqlite3/migrator"
+	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+)
+
+func init() {
+	migrator.AddMigration("logtracker", "9_deferred_recipients_first_attempt.go", upDeferredRecipientsFirstAttempt, downDeferredRecipientsFirstAttempt)
+}
+
+// When a recipient has been deferred for the first time, to know how long it took
+// until its final delivery. Zero for the recipients deferred before this migration
+func upDeferredRecipientsFirstAttempt(tx *sql.Tx) error {
+	sql := `alter table deferred_recipients add column first_attempt_ts integer not null default 0`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return errorutil.Wrap(err)
+	}
+
+	return nil
+}
+
+func downDeferredRecipientsFirstAttempt(tx *sql.Tx) error {
+	return nil
+}
@@ -62,6 +62,33 @@ const (
 
 	MessageIdIsCorruptedKey
 
+	ResultExtraMessageKey
+
+	ConnectionSaslMethodKey
+	ConnectionSaslUsernameKey
+
+	ConnectionTlsProtocolKey
+	ConnectionTlsCipherKey
+	ConnectionTlsTrustKey
+
+	ResultTlsProtocolKey
+	ResultTlsCipherKey
+	ResultTlsTrustKey
+
+	ResultDeferralAttemptsKey
+
+	QueueContentFilterVerdictKey
+	QueueContentFilterScoreKey
+	QueueDkimSigningDomainKey
+	QueueDmarcResultKey
+
+	ResultDeliveryAttemptKey
+	ResultFirstDeferralTimeKey
+
+	ResultDeliveryInstanceKey
+	ResultReceivingServerKey
+	ResultReceivingInstanceKey
+
 	lasResulttKey
 )
 
@@ -116,5 +143,32 @@ var (
 		MessageIdFilenameKey:     "messageid_filename",
 		MessageIdLineKey:         "messageid_line",
 		MessageIdIsCorruptedKey:  "messageid_is_corrupted",
+
+		ResultExtraMessageKey: "extra_message",
+
+		ConnectionSaslMethodKey:   "sasl_method",
+		ConnectionSaslUsernameKey: "sasl_username",
+
+		ConnectionTlsProtocolKey: "client_tls_protocol",
+		ConnectionTlsCipherKey:   "client_tls_cipher",
+		ConnectionTlsTrustKey:    "client_tls_trust",
+
+		ResultTlsProtocolKey: "relay_tls_protocol",
+		ResultTlsCipherKey:   "relay_tls_cipher",
+		ResultTlsTrustKey:    "relay_tls_trust",
+
+		ResultDeferralAttemptsKey: "deferral_attempts",
+
+		QueueContentFilterVerdictKey: "content_filter_verdict",
+		QueueContentFilterScoreKey:   "content_filter_score",
+		QueueDkimSigningDomainKey:    "dkim_signing_domain",
+		QueueDmarcResultKey:          "dmarc_result",
+
+		ResultDeliveryAttemptKey:   "delivery_attempt",
+		ResultFirstDeferralTimeKey: "first_deferral_ts",
+
+		ResultDeliveryInstanceKey:  "delivery_instance",
+		ResultReceivingServerKey:   "receiving_server",
+		ResultReceivingInstanceKey: "receiving_instance",
 	}
 )
@@ -5,6 +5,7 @@
 package tracking
 
 import (
+	"fmt"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
 )
@@ -19,6 +20,7 @@ const (
 	insertConnectionOnConnection
 	insertConnectionDataFourRows
 	insertConnectionData
+	insertConnectionDataIfMissing
 	selectConnectionAndUsageCounterForPid
 	insertQueueForConnection
 	incrementQueueUsageById
@@ -27,13 +29,14 @@ const (
 	insertQueueData
 	updateQueueWithMessageId
 	selectQueueIdForQueue
+	selectQueueIdForRelayedQueue
 	insertQueueParenting
 	insertNotificationQueue
 	countNewQueueFromParenting
 	selectQueueFromParentingNewQueue
 	deleteQueueParentingById
 	selectQueueById
-	insertResultData15Rows
+	insertResultData16Rows
 	insertResultData3Rows
 	insertResult
 	deleteFromNotificationQueues
@@ -56,15 +59,35 @@ const (
 	incrementPidUsageById
 	decrementPidUsageById
 	selectPidForPidAndHost
+	replaceSmtpTlsSession
+	selectSmtpTlsSession
+	insertResultDataRow
+	upsertDeferredRecipient
+	deleteDeferredRecipient
+	selectDeferredRecipientAttempts
+	selectDeferredRecipientsByQueueId
+	deleteDeferredRecipientsByQueueId
+	selectQueueDataValue
+	selectQueueIdForMessageId
+	selectOrphanQueues
+	selectResultIdsByQueueId
+	deleteNotificationQueueByResultId
+	setQueueUsageById
+	selectOrphanResults
+	selectOrphanConnections
+	deleteOrphanPids
+	insertGCRun
 
 	lastTrackerStmtKey
 )
 
 var trackerStmtsText = map[trackerStmtKey]string{
-	insertPidOnConnection:        `insert into pids(pid, host, usage_counter) values(?, ?, 1)`,
+	insertPidOnConnection:        `insert into pids(pid, host, instance, usage_counter) values(?, ?, ?, 1)`,
 	insertConnectionOnConnection: `insert into connections(pid_id, usage_counter) values(?, 0)`,
 	insertConnectionDataFourRows: `insert into connection_data(connection_id, key, value) values(?, ?, ?), (?, ?, ?), (?, ?, ?), (?, ?, ?)`,
 	insertConnectionData:         `insert into connection_data(connection_id, key, value) values(?, ?, ?)`,
+	insertConnectionDataIfMissing: `insert into connection_data(connection_id, key, value)
+		select ?1, ?2, ?3 where not exists (select 1 from connection_data where connection_id = ?1 and key = ?2)`,
 	selectConnectionAndUsageCounterForPid: `select
 		connections.id, connections.usage_counter
 	from
@@ -83,13 +106,26 @@ var trackerStmtsText = map[trackerStmtKey]string{
 	queueUsageCounter:        `select usage_counter from queues where id = ?`,
 	insertQueueData:          `insert into queue_data(queue_id, key, value) values(?, ?, ?)`,
 	updateQueueWithMessageId: `update queues set messageid_id = ? where queues.id = ?`,
+	// the instance is unknown for the lines logged by the content filters and milters
 	selectQueueIdForQueue: `select
 		queues.id
 	from
 		queues join connections on queues.connection_id = connections.id
 		join pids on connections.pid_id = pids.id
 	where
-		pids.host = ? and queues.queue = ?`,
+		pids.host = ?1 and queues.queue = ?2 and (?3 = '' or pids.instance = ?3)`,
+	// a message relayed to another instance, possibly on another host, prefers the ones
+	// on the same host, and the most recent ones, as queue names are eventually reused
+	selectQueueIdForRelayedQueue: `select
+		queues.id
+	from
+		queues join connections on queues.connection_id = connections.id
+		join pids on connections.pid_id = pids.id
+	where
+		queues.queue = ?1
+	order by
+		pids.host = ?2 desc, queues.id desc
+	limit 1`,
 	insertQueueParenting: `insert into queue_parenting(orig_queue_id, new_queue_id, parenting_type) values(?, ?, ?)`,
 	// TODO: perform a migration that remove filename and line fields
 	insertNotificationQueue:          `insert into notification_queues(result_id, filename, line) values(?, '', 0)`,
@@ -97,7 +133,7 @@ var trackerStmtsText = map[trackerStmtKey]string{
 	selectQueueFromParentingNewQueue: `select id, orig_queue_id from queue_parenting where new_queue_id = ?`,
 	deleteQueueParentingById:         `delete from queue_parenting where id = ?`,
 	selectQueueById:                  `select queue from queues where id = ?`,
-	insertResultData15Rows: `insert into result_data(result_id, key, value)
+	insertResultData16Rows: `insert into result_data(result_id, key, value)
 		values(?, ?, ?),
 					(?, ?, ?),
 					(?, ?, ?),
@@ -112,6 +148,7 @@ var trackerStmtsText = map[trackerStmtKey]string{
 					(?, ?, ?),
 					(?, ?, ?),
 					(?, ?, ?),
+					(?, ?, ?),
 					(?, ?, ?)`,
 	insertResultData3Rows: `insert into result_data(result_id, key, value)
 		values(?, ?, ?),
@@ -138,6 +175,76 @@ var trackerStmtsText = map[trackerStmtKey]string{
 	incrementPidUsageById:              `update pids set usage_counter = usage_counter + 1 where id = ?`,
 	decrementPidUsageById:              `update pids set usage_counter = usage_counter - 1 where id = ?`,
 	selectPidForPidAndHost:             `select id from pids where pid = ? and host = ?`,
+	replaceSmtpTlsSession: `insert or replace into smtp_tls_sessions(host, pid, peer_ip, peer_port, protocol, cipher, trust)
+		values(?, ?, ?, ?, ?, ?, ?)`,
+	selectSmtpTlsSession: `select protocol, cipher, trust from smtp_tls_sessions
+		where host = ? and pid = ? and peer_ip = ? and peer_port = ?`,
+	insertResultDataRow: `insert into result_data(result_id, key, value) values(?, ?, ?)`,
+	upsertDeferredRecipient: `insert into deferred_recipients(queue_id, recipient_local_part, recipient_domain_part,
+		orig_recipient_local_part, orig_recipient_domain_part, direction, attempts, dsn, extra_message, last_attempt_ts, first_attempt_ts)
+		values(?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+		on conflict(queue_id, recipient_local_part, recipient_domain_part)
+		do update set attempts = attempts + 1, dsn = excluded.dsn, extra_message = excluded.extra_message,
+			last_attempt_ts = excluded.last_attempt_ts`,
+	deleteDeferredRecipient: `delete from deferred_recipients
+		where queue_id = ? and recipient_local_part = ? and recipient_domain_part = ?`,
+	selectDeferredRecipientAttempts: `select attempts, first_attempt_ts from deferred_recipients
+		where queue_id = ? and recipient_local_part = ? and recipient_domain_part = ?`,
+	selectDeferredRecipientsByQueueId: `select
+		recipient_local_part, recipient_domain_part, orig_recipient_local_part, orig_recipient_domain_part,
+		direction, attempts, dsn, extra_message, first_attempt_ts
+	from
+		deferred_recipients
+	where
+		queue_id = ?
+	order by
+		id`,
+	deleteDeferredRecipientsByQueueId: `delete from deferred_recipients where queue_id = ?`,
+	selectQueueDataValue:              `select value from queue_data where queue_id = ? and key = ? order by id desc limit 1`,
+	// the key is not a parameter, so that the partial index on message ids is used
+	selectQueueIdForMessageId: fmt.Sprintf(`select
+		queues.id
+	from
+		queue_data join queues on queue_data.queue_id = queues.id
+		join connections on queues.connection_id = connections.id
+		join pids on connections.pid_id = pids.id
+	where
+		queue_data.key = %d and queue_data.value = ? and pids.host = ?
+	order by
+		queue_data.id desc
+	limit 1`, QueueMessageIDKey),
+	// queues with no activity since the horizon and no result waiting to be notified.
+	// The original queue of a relay or bounce is deleted only together with the queue created from it
+	selectOrphanQueues: fmt.Sprintf(`select
+		queues.id
+	from
+		queues
+	where
+		not exists (select 1 from queue_parenting where queue_parenting.orig_queue_id = queues.id)
+		and ifnull((select max(value) from queue_data where queue_data.queue_id = queues.id and queue_data.key in (%d, %d)), 0) < ?1
+		and ifnull((select max(last_attempt_ts) from deferred_recipients where deferred_recipients.queue_id = queues.id), 0) < ?1
+		and ifnull((select max(result_data.value) from results join result_data on result_data.result_id = results.id
+			where results.queue_id = queues.id and result_data.key = %d), 0) < ?1
+		and not exists (select 1 from results join notification_queues on notification_queues.result_id = results.id
+			where results.queue_id = queues.id)`, QueueBeginKey, QueueEndKey, ResultDeliveryTimeKey),
+	selectResultIdsByQueueId:          `select id from results where queue_id = ?`,
+	deleteNotificationQueueByResultId: `delete from notification_queues where result_id = ?`,
+	setQueueUsageById:                 `update queues set usage_counter = ? where id = ?`,
+	selectOrphanResults: `select id from results
+		where
+			not exists (select 1 from queues where queues.id = results.queue_id)
+			and not exists (select 1 from notification_queues where notification_queues.result_id = results.id)`,
+	selectOrphanConnections: fmt.Sprintf(`select
+		connections.id
+	from
+		connections
+	where
+		not exists (select 1 from queues where queues.connection_id = connections.id)
+		and ifnull((select max(value) from connection_data
+			where connection_data.connection_id = connections.id and connection_data.key in (%d, %d)), 0) < ?`, ConnectionBeginKey, ConnectionEndKey),
+	deleteOrphanPids: `delete from pids where not exists (select 1 from connections where connections.pid_id = pids.id)`,
+	insertGCRun: `insert into gc_runs(ts, horizon_ts, connections, queues, results, incomplete_deliveries)
+		values(?, ?, ?, ?, ?, ?)`,
 }
 
 // TODO: close such statements when the tracker is deleted!!!
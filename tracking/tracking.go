@@ -54,6 +54,12 @@ const (
 	PickupActionType
 	MilterRejectActionType
 	RejectActionType
+	TlsConnectionActionType
+	MailExpiredActionType
+	AmavisVerdictActionType
+	SpamdResultActionType
+	DkimSignatureActionType
+	DmarcResultActionType
 )
 
 type actionTuple struct {
@@ -108,6 +114,12 @@ var actions = map[ActionType]actionRecord{
 	PickupActionType:            {impl: pickupAction},
 	MilterRejectActionType:      {impl: milterRejectAction},
 	RejectActionType:            {impl: rejectAction},
+	TlsConnectionActionType:     {impl: tlsConnectionAction},
+	MailExpiredActionType:       {impl: mailExpiredAction},
+	AmavisVerdictActionType:     {impl: amavisVerdictAction},
+	SpamdResultActionType:       {impl: spamdResultAction},
+	DkimSignatureActionType:     {impl: dkimSignatureAction},
+	DmarcResultActionType:       {impl: dmarcResultAction},
 }
 
 type trackerStmts [lastTrackerStmtKey]*sql.Stmt
@@ -142,6 +154,11 @@ type Tracker struct {
 	txActions        <-chan txActions
 	resultsToNotify  chan resultInfos
 	resultsNotifiers resultsNotifiers
+	gcOptions        GCOptions
+
+	// only used by the tracker goroutine
+	lastGCTime           time.Time
+	batchesBeingNotified int
 }
 
 func (t *Tracker) MostRecentLogTime() (time.Time, error) {
@@ -255,7 +272,7 @@ func buildResultsNotifier(
 
 const numberOfNotifiers = 1
 
-func New(workspaceDir string, pub ResultPublisher) (*Tracker, error) {
+func New(workspaceDir string, pub ResultPublisher, gcOptions GCOptions) (*Tracker, error) {
 	conn, err := dbconn.Open(path.Join(workspaceDir, "logtracker.db"), numberOfNotifiers+5)
 
 	if err != nil {
@@ -284,6 +301,11 @@ func New(workspaceDir string, pub ResultPublisher) (*Tracker, error) {
 		return nil, errorutil.Wrap(err)
 	}
 
+	err = conn.RoConnPool.ForEach(prepareInFlightConnection)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
 	txActions := make(chan txActions, 1024*10)
 	resultsToNotify := make(chan resultInfos, 1024*10)
 	trackerActions := make(chan actionTuple, 1024*1000)
@@ -298,6 +320,7 @@ func New(workspaceDir string, pub ResultPublisher) (*Tracker, error) {
 		actions:         trackerActions,
 		txActions:       txActions,
 		resultsToNotify: resultsToNotify,
+		gcOptions:       gcOptions,
 	}
 
 	// it should be refactored ASAP!!!!
@@ -473,6 +496,9 @@ func handleTxAction(tx *sql.Tx, t *Tracker, ok bool, recv reflect.Value) (*sql.T
 		return nil, false, errorutil.Wrap(err)
 	}
 
+	// each batch of results dispatched to the notifier gets back as a single txActions
+	t.batchesBeingNotified--
+
 	txActions := recv.Interface().(txActions)
 
 	for i := uint(0); i < txActions.size; i++ {
@@ -572,6 +598,10 @@ loop:
 				errorutil.MustSucceed(err)
 				return errorutil.Wrap(err)
 			}
+
+			if tx, err = collectGarbageIfNeeded(tx, t, actionTuple.record.Time); err != nil {
+				return errorutil.Wrap(err)
+			}
 		default:
 			panic("Read wrong select index!!!")
 		}
@@ -76,7 +76,7 @@ func buildPublisherAndTempTracker(t *testing.T) (*fakeResultPublisher, *Tracker,
 	pub := &fakeResultPublisher{}
 
 	dir, clearDir := testutil.TempDir(t)
-	tracker, err := New(dir, pub)
+	tracker, err := New(dir, pub, DefaultGCOptions)
 	So(err, ShouldBeNil)
 
 	return pub, tracker, func() {
@@ -272,6 +272,8 @@ func TestTrackingFromFiles(t *testing.T) {
 					So(pub.results[0][ResultRecipientDomainPartKey].Text(), ShouldEqual, "example.com")
 					So(pub.results[0][ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionOutbound)
 					So(pub.results[0][ResultStatusKey].Int64(), ShouldEqual, parser.BouncedStatus)
+					So(pub.results[0][ResultExtraMessageKey].Text(), ShouldEqual,
+						`(host mx.example.com[11.22.33.44] said: 550 5.1.1 <invalid.email@example.com> User unknown (in reply to RCPT TO command))`)
 
 					So(countQueues(), ShouldEqual, 0)
 					So(countQueueData(), ShouldEqual, 0)
@@ -355,6 +357,13 @@ func TestTrackingFromFiles(t *testing.T) {
 
 					So(pub.results[1][ResultStatusKey].Int64(), ShouldEqual, parser.SentStatus)
 					So(pub.results[1][ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionOutbound)
+
+					// the retry is linked to the first deferral
+					firstDeferral := testutil.MustParseTime(`2020-12-07 13:28:02 +0000`).Unix()
+					So(pub.results[0][ResultDeliveryAttemptKey].Int64(), ShouldEqual, 1)
+					So(pub.results[0][ResultFirstDeferralTimeKey].Int64(), ShouldEqual, firstDeferral)
+					So(pub.results[1][ResultDeliveryAttemptKey].Int64(), ShouldEqual, 2)
+					So(pub.results[1][ResultFirstDeferralTimeKey].Int64(), ShouldEqual, firstDeferral)
 				})
 
 				Convey("Log with only connections and disconnections. No queues are created", func() {
@@ -406,6 +415,8 @@ func TestTrackingFromFiles(t *testing.T) {
 					So(len(pub.results), ShouldEqual, 1)
 
 					So(pub.results[0][ConnectionClientHostnameKey].Text(), ShouldEqual, "client.example.com")
+					So(pub.results[0][ConnectionSaslMethodKey].Text(), ShouldEqual, "PLAIN")
+					So(pub.results[0][ConnectionSaslUsernameKey].Text(), ShouldEqual, "sender@mydomain.com")
 					So(pub.results[0][QueueSenderLocalPartKey].Text(), ShouldEqual, "sender")
 					So(pub.results[0][QueueSenderDomainPartKey].Text(), ShouldEqual, "mydomain.com")
 					So(pub.results[0][QueueMessageIDKey].Text(), ShouldEqual, "264dc34c-ad52-466c-6d41-6622dfced3b8@mydomain.com")
@@ -573,6 +584,176 @@ func TestTrackingFromFiles(t *testing.T) {
 					So(countPids(), ShouldEqual, 0)
 				})
 
+				Convey("Message rejected by smtpd before a queue is created", func() {
+					readFromTestFile("test_files/18-smtpd-noqueue-reject.log", t.Publisher())
+					cancel()
+					done()
+
+					So(len(pub.results), ShouldEqual, 0)
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
+				Convey("TLS sessions with the client and with the relays", func() {
+					readFromTestFile("test_files/19_tls_sessions.log", t.Publisher())
+					cancel()
+					done()
+
+					So(len(pub.results), ShouldEqual, 2)
+
+					So(pub.results[0][ConnectionTlsProtocolKey].Text(), ShouldEqual, "TLSv1.3")
+					So(pub.results[0][ConnectionTlsCipherKey].Text(), ShouldEqual, "TLS_AES_256_GCM_SHA384")
+					So(pub.results[0][ConnectionTlsTrustKey].Int64(), ShouldEqual, parser.TlsTrustAnonymous)
+
+					// the session was established with this relay
+					So(pub.results[0][ResultRecipientDomainPartKey].Text(), ShouldEqual, "gmail.com")
+					So(pub.results[0][ResultTlsProtocolKey].Text(), ShouldEqual, "TLSv1.3")
+					So(pub.results[0][ResultTlsCipherKey].Text(), ShouldEqual, "TLS_AES_256_GCM_SHA384")
+					So(pub.results[0][ResultTlsTrustKey].Int64(), ShouldEqual, parser.TlsTrustVerified)
+
+					// sent in cleartext, as there was no session with this relay
+					So(pub.results[1][ResultRecipientDomainPartKey].Text(), ShouldEqual, "example.com")
+					So(pub.results[1][ConnectionTlsProtocolKey].Text(), ShouldEqual, "TLSv1.3")
+					So(pub.results[1][ResultTlsProtocolKey].IsNone(), ShouldBeTrue)
+					So(pub.results[1][ResultTlsTrustKey].IsNone(), ShouldBeTrue)
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
+				Convey("Messages delivered by local and virtual", func() {
+					readFromTestFile("test_files/20_local_and_virtual_delivery.log", t.Publisher())
+					cancel()
+					done()
+
+					// the last one is the non delivery notification
+					So(len(pub.results), ShouldEqual, 3)
+
+					So(pub.results[0][ResultRecipientLocalPartKey].Text(), ShouldEqual, "user1")
+					So(pub.results[0][ResultStatusKey].Int64(), ShouldEqual, parser.SentStatus)
+					So(pub.results[0][ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionIncoming)
+
+					So(pub.results[1][ResultRecipientLocalPartKey].Text(), ShouldEqual, "user2")
+					So(pub.results[1][ResultStatusKey].Int64(), ShouldEqual, parser.BouncedStatus)
+					So(pub.results[1][ResultDeliveryServerKey].Text(), ShouldEqual, "mail")
+					So(pub.results[1][ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionIncoming)
+
+					So(pub.results[2][ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionOutbound)
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
+				Convey("Message expires after being deferred for too long", func() {
+					readFromTestFile("test_files/21_expired_message.log", t.Publisher())
+					cancel()
+					done()
+
+					// the last one is the non delivery notification
+					So(len(pub.results), ShouldEqual, 6)
+
+					So(pub.results[2][ResultRecipientLocalPartKey].Text(), ShouldEqual, "user1")
+					So(pub.results[2][ResultStatusKey].Int64(), ShouldEqual, parser.DeferredStatus)
+
+					So(pub.results[3][ResultRecipientLocalPartKey].Text(), ShouldEqual, "user2")
+					So(pub.results[3][ResultStatusKey].Int64(), ShouldEqual, parser.SentStatus)
+					So(pub.results[3][ResultDeliveryAttemptKey].Int64(), ShouldEqual, 2)
+
+					// user2 has already been delivered, so only user1 expires
+					expired := pub.results[4]
+					So(expired[ResultRecipientLocalPartKey].Text(), ShouldEqual, "user1")
+					So(expired[ResultRecipientDomainPartKey].Text(), ShouldEqual, "unreachable.com")
+					So(expired[ResultStatusKey].Int64(), ShouldEqual, parser.ExpiredStatus)
+					So(expired[ResultDSNKey].Text(), ShouldEqual, "4.4.1")
+					So(expired[ResultExtraMessageKey].Text(), ShouldEqual, pub.results[2][ResultExtraMessageKey].Text())
+					So(expired[ResultDeferralAttemptsKey].Int64(), ShouldEqual, 2)
+					So(expired[ResultFirstDeferralTimeKey].Int64(), ShouldEqual, pub.results[0][ResultDeliveryTimeKey].Int64())
+					So(expired[ResultDelayKey].Float64(), ShouldEqual, 5*24*60*60)
+					So(expired[ResultMessageDirectionKey].Int64(), ShouldEqual, MessageDirectionOutbound)
+					So(expired[QueueMessageIDKey].Text(), ShouldEqual, "expired-message@example.com")
+
+					So(pub.results[5][ResultRecipientLocalPartKey].Text(), ShouldEqual, "sender")
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
+				Convey("Verdicts of content filters and milters", func() {
+					readFromTestFile("test_files/22_content_filters_and_milters.log", t.Publisher())
+					cancel()
+					done()
+
+					So(len(pub.results), ShouldEqual, 3)
+
+					// checked and signed on the queue the message was received on, before being reinjected by amavis
+					outbound := pub.results[0]
+					So(outbound[ResultRecipientDomainPartKey].Text(), ShouldEqual, "dst1.example.com")
+					So(outbound[QueueContentFilterVerdictKey].Int64(), ShouldEqual, parser.ContentFilterClean)
+					So(outbound[QueueContentFilterScoreKey].Float64(), ShouldAlmostEqual, -1.2, 0.0001)
+					So(outbound[QueueDkimSigningDomainKey].Text(), ShouldEqual, "mydomain.com")
+					So(outbound[QueueDmarcResultKey].IsNone(), ShouldBeTrue)
+
+					// spamd knows the message only by its message-id
+					inbound := pub.results[1]
+					So(inbound[ResultRecipientLocalPartKey].Text(), ShouldEqual, "user")
+					So(inbound[QueueContentFilterVerdictKey].Int64(), ShouldEqual, parser.ContentFilterSpam)
+					So(inbound[QueueContentFilterScoreKey].Float64(), ShouldEqual, 7)
+					So(inbound[QueueDmarcResultKey].Int64(), ShouldEqual, parser.DmarcPass)
+					So(inbound[QueueDkimSigningDomainKey].IsNone(), ShouldBeTrue)
+
+					// blocked by amavis, not logging the queue
+					infected := pub.results[2]
+					So(infected[QueueMessageIDKey].Text(), ShouldEqual, "infected-message@example.net")
+					So(infected[QueueContentFilterVerdictKey].Int64(), ShouldEqual, parser.ContentFilterInfected)
+					So(infected[QueueContentFilterScoreKey].IsNone(), ShouldBeTrue)
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
+				Convey("Message relayed between postfix instances and then to another host", func() {
+					readFromTestFile("test_files/23_postmulti_instances.log", t.Publisher())
+					cancel()
+					done()
+
+					So(len(pub.results), ShouldEqual, 1)
+
+					r := pub.results[0]
+
+					// the connection the message was received on, before being relayed twice
+					So(r[ConnectionClientHostnameKey].Text(), ShouldEqual, "sender.example.com")
+					So(r[QueueSenderLocalPartKey].Text(), ShouldEqual, "sender")
+					So(r[QueueDeliveryNameKey].Text(), ShouldEqual, "3CCCCCCCCC03")
+					So(r[ResultRelayNameKey].Text(), ShouldEqual, "mx.remote.example.com")
+
+					So(r[ResultReceivingServerKey].Text(), ShouldEqual, "mail")
+					So(r[ResultReceivingInstanceKey].Text(), ShouldEqual, "postfix-in")
+					So(r[ResultDeliveryServerKey].Text(), ShouldEqual, "relay")
+					So(r[ResultDeliveryInstanceKey].Text(), ShouldEqual, "postfix")
+
+					So(countQueues(), ShouldEqual, 0)
+					So(countQueueData(), ShouldEqual, 0)
+					So(countConnections(), ShouldEqual, 0)
+					So(countConnectionData(), ShouldEqual, 0)
+					So(countPids(), ShouldEqual, 0)
+				})
+
 				Convey("Message rejected by smtpd before milter-reject", func() {
 					// I don't know why, probably it was an attack, as the messageid can be set by the smtp client
 					// or maybe syslog just failed to log the right message?!
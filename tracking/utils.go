@@ -402,6 +402,16 @@ func deleteQueue(tx *sql.Tx, trackerStmts trackerStmts, queueId int64) error {
 		return errorutil.Wrap(err)
 	}
 
+	stmt = tx.Stmt(trackerStmts[deleteDeferredRecipientsByQueueId])
+
+	defer func() {
+		errorutil.MustSucceed(stmt.Close())
+	}()
+
+	if _, err := stmt.Exec(queueId); err != nil {
+		return errorutil.Wrap(err)
+	}
+
 	return nil
 }
 
@@ -36,7 +36,8 @@ func ParseTimeInterval(fromStr string, toStr string, location *time.Location) (T
 		return TimeInterval{}, errorutil.Wrap(err)
 	}
 
-	to = to.Add(23 * time.Hour).Add(59 * time.Minute).Add(59 * time.Second)
+	// days might not have 24h when the daylight saving time changes
+	to = time.Date(to.Year(), to.Month(), to.Day(), 23, 59, 59, 0, location)
 
 	if from.After(to) {
 		return TimeInterval{}, ErrOutOfOrderTimeInterval
@@ -30,6 +30,15 @@ func TestTimeInterval(t *testing.T) {
 			So(interval.To.Unix(), ShouldEqual, 1589760000-1) // next day at midnight - 1
 		})
 
+		Convey("Interval ending when the daylight saving time changes", func() {
+			location, err := time.LoadLocation("Europe/Berlin")
+			So(err, ShouldBeNil)
+
+			interval, err := ParseTimeInterval("2020-03-29", "2020-03-29", location)
+			So(err, ShouldBeNil)
+			So(interval.To.Sub(interval.From), ShouldEqual, 23*time.Hour-time.Second)
+		})
+
 		Convey("Fail to parse out of order Interval", func() {
 			_, err := ParseTimeInterval("2020-05-17", "2020-03-23", time.UTC)
 			So(err, ShouldEqual, ErrOutOfOrderTimeInterval)
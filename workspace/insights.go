@@ -6,12 +6,17 @@ package workspace
 
 import (
 	"gitlab.com/lightmeter/controlcenter/dashboard"
+	bruteforceinsight "gitlab.com/lightmeter/controlcenter/insights/bruteforce"
 	insightscore "gitlab.com/lightmeter/controlcenter/insights/core"
+	expireddomainsinsight "gitlab.com/lightmeter/controlcenter/insights/expireddomains"
 	highrateinsight "gitlab.com/lightmeter/controlcenter/insights/highrate"
 	localrblinsight "gitlab.com/lightmeter/controlcenter/insights/localrbl"
+	longdeferredinsight "gitlab.com/lightmeter/controlcenter/insights/longdeferred"
 	mailinactivityinsight "gitlab.com/lightmeter/controlcenter/insights/mailinactivity"
 	messagerblinsight "gitlab.com/lightmeter/controlcenter/insights/messagerbl"
 	newsfeedinsight "gitlab.com/lightmeter/controlcenter/insights/newsfeed"
+	systemhealthinsight "gitlab.com/lightmeter/controlcenter/insights/systemhealth"
+	unreachabledomaininsight "gitlab.com/lightmeter/controlcenter/insights/unreachabledomain"
 	"gitlab.com/lightmeter/controlcenter/localrbl"
 	"gitlab.com/lightmeter/controlcenter/messagerbl"
 	"time"
@@ -23,7 +28,7 @@ const (
 	oneWeek = oneDay * 7
 )
 
-func insightsOptions(dashboard dashboard.Dashboard, rblChecker localrbl.Checker, rblDetector messagerbl.Stepper) insightscore.Options {
+func insightsOptions(dashboard dashboard.Dashboard, rblChecker localrbl.Checker, rblDetector messagerbl.Stepper, deferredCounter longdeferredinsight.Counter) insightscore.Options {
 	return insightscore.Options{
 		"dashboard":      dashboard,
 		"highrate":       highrateinsight.Options{BaseBounceRateThreshold: 0.3},
@@ -47,5 +52,38 @@ func insightsOptions(dashboard dashboard.Dashboard, rblChecker localrbl.Checker,
 			RetryTime:      time.Minute * 10,
 			TimeLimit:      oneDay * 2,
 		},
+
+		"bruteforce": bruteforceinsight.Options{
+			LookupRange:                 time.Hour,
+			FailuresPerClientThreshold:  50,
+			ClientsPerUsernameThreshold: 10,
+			MinTimeToGenerateNewInsight: time.Hour * 6,
+		},
+
+		"systemhealth": systemhealthinsight.Options{
+			LookupRange:                 time.Hour,
+			RecurringWarningThreshold:   100,
+			MinTimeToGenerateNewInsight: oneDay,
+		},
+
+		"unreachabledomain": unreachabledomaininsight.Options{
+			LookupRange:                 time.Hour * 6,
+			MinUnreachableTime:          time.Hour,
+			MinTimeToGenerateNewInsight: oneDay,
+		},
+
+		"expireddomains": expireddomainsinsight.Options{
+			LookupRange:                 oneDay,
+			MinExpired:                  5,
+			GrowthFactor:                2,
+			MinTimeToGenerateNewInsight: oneDay,
+		},
+
+		"longdeferred": longdeferredinsight.Options{
+			Counter:                     deferredCounter,
+			MinAge:                      time.Hour * 6,
+			MinMessages:                 10,
+			MinTimeToGenerateNewInsight: oneDay,
+		},
 	}
 }
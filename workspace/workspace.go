@@ -6,6 +6,7 @@ package workspace
 
 import (
 	"gitlab.com/lightmeter/controlcenter/auth"
+	"gitlab.com/lightmeter/controlcenter/bounceclass"
 	"gitlab.com/lightmeter/controlcenter/dashboard"
 	"gitlab.com/lightmeter/controlcenter/deliverydb"
 	"gitlab.com/lightmeter/controlcenter/domainmapping"
@@ -14,19 +15,25 @@ import (
 	insightsCore "gitlab.com/lightmeter/controlcenter/insights/core"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3/dbconn"
 	"gitlab.com/lightmeter/controlcenter/localrbl"
+	"gitlab.com/lightmeter/controlcenter/logarchive"
 	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
+	"gitlab.com/lightmeter/controlcenter/messagelookup"
 	"gitlab.com/lightmeter/controlcenter/messagerbl"
 	"gitlab.com/lightmeter/controlcenter/meta"
 	"gitlab.com/lightmeter/controlcenter/notification"
 	"gitlab.com/lightmeter/controlcenter/notification/email"
 	"gitlab.com/lightmeter/controlcenter/notification/slack"
+	"gitlab.com/lightmeter/controlcenter/parsercoverage"
 	"gitlab.com/lightmeter/controlcenter/pkg/postfix"
+	parser "gitlab.com/lightmeter/controlcenter/pkg/postfix/logparser"
 	"gitlab.com/lightmeter/controlcenter/pkg/runner"
 	"gitlab.com/lightmeter/controlcenter/po"
+	"gitlab.com/lightmeter/controlcenter/retention"
 	"gitlab.com/lightmeter/controlcenter/settings/globalsettings"
 	"gitlab.com/lightmeter/controlcenter/tracking"
 	"gitlab.com/lightmeter/controlcenter/util/closeutil"
 	"gitlab.com/lightmeter/controlcenter/util/errorutil"
+	"gitlab.com/lightmeter/controlcenter/util/timeutil"
 	"os"
 	"path"
 	"time"
@@ -42,34 +49,76 @@ type Workspace struct {
 	rblDetector    *messagerbl.Detector
 	rblChecker     localrbl.Checker
 
-	dashboard dashboard.Dashboard
+	dashboard      dashboard.Dashboard
+	messageLookup  messagelookup.Lookup
+	parserCoverage *parsercoverage.Collector
+	logArchive     *logarchive.Archive
 
 	NotificationCenter *notification.Center
 
 	settingsMetaHandler *meta.Handler
 	settingsRunner      *meta.Runner
+	retentionRunner     *retention.Runner
 
 	importAnnouncer *announcer.SynchronizingAnnouncer
 
 	closes closeutil.Closers
 }
 
-func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
+type Options struct {
+	TrackerGC tracking.GCOptions
+
+	// Optional, as it takes disk space. If nil, the raw log lines are not archived
+	LogArchive *logarchive.Options
+}
+
+var DefaultOptions = Options{
+	TrackerGC: tracking.DefaultGCOptions,
+}
+
+func NewWorkspace(workspaceDirectory string, options Options) (*Workspace, error) {
 	if err := os.MkdirAll(workspaceDirectory, os.ModePerm); err != nil {
 		return nil, errorutil.Wrap(err, "Error creating working directory ", workspaceDirectory)
 	}
 
-	deliveries, err := deliverydb.New(workspaceDirectory, &domainmapping.DefaultMapping)
+	bounceRules, err := bounceclass.LoadRules(workspaceDirectory)
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	bounceClassifier := bounceclass.New(messagerbl.BounceClassifier(), bounceRules)
 
+	parserRules, err := parser.LoadCustomRules(workspaceDirectory)
 	if err != nil {
 		return nil, errorutil.Wrap(err)
 	}
 
-	tracker, err := tracking.New(workspaceDirectory, deliveries.ResultsPublisher())
+	parser.SetCustomRules(parserRules)
+
+	parserCoverage := parsercoverage.New()
+
+	parser.SetObserver(parserCoverage.Observe)
+
+	deliveries, err := deliverydb.New(workspaceDirectory, &domainmapping.DefaultMapping, bounceClassifier)
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
+	tracker, err := tracking.New(workspaceDirectory, deliveries.ResultsPublisher(), options.TrackerGC)
 	if err != nil {
 		return nil, errorutil.Wrap(err)
 	}
 
+	var logArchive *logarchive.Archive
+
+	if options.LogArchive != nil {
+		logArchive, err = logarchive.New(workspaceDirectory, *options.LogArchive)
+		if err != nil {
+			return nil, errorutil.Wrap(err)
+		}
+	}
+
 	auth, err := auth.NewAuth(workspaceDirectory, auth.Options{})
 
 	if err != nil {
@@ -100,6 +149,12 @@ func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
 		return nil, errorutil.Wrap(err)
 	}
 
+	messageLookup, err := messagelookup.New(deliveries.ConnPool())
+
+	if err != nil {
+		return nil, errorutil.Wrap(err)
+	}
+
 	translators := translator.New(po.DefaultCatalog)
 
 	notificationPolicies := notification.Policies{insights.DefaultNotificationPolicy{}}
@@ -126,15 +181,33 @@ func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
 		return nil, errorutil.Wrap(err)
 	}
 
-	insightsEngine, err := insights.NewEngine(insightsAcessor, notificationCenter, insightsOptions(dashboard, rblChecker, rblDetector))
+	insightsEngine, err := insights.NewEngine(insightsAcessor, notificationCenter, insightsOptions(dashboard, rblChecker, rblDetector, tracker))
 	if err != nil {
 		return nil, errorutil.Wrap(err)
 	}
 
 	logsRunner := newLogsRunner(tracker, deliveries)
 
+	retentionRunner := retention.New(m.Reader, &timeutil.RealClock{}, []retention.Target{
+		{Name: "deliveries", Purger: deliveries, Period: retention.DeliveriesPeriod},
+		{Name: "insights", Purger: insightsEngine, Period: retention.InsightsPeriod},
+	}, retention.DefaultOptions)
+
 	importAnnouncer := announcer.NewSynchronizingAnnouncer(insightsEngine.ImportAnnouncer(), deliveries.MostRecentLogTime, tracker.MostRecentLogTime)
 
+	closes := closeutil.New(
+		auth,
+		tracker,
+		deliveries,
+		insightsEngine,
+		m,
+		insightsAcessor,
+	)
+
+	if logArchive != nil {
+		closes.Add(logArchive)
+	}
+
 	ws := &Workspace{
 		deliveries:          deliveries,
 		tracker:             tracker,
@@ -143,18 +216,15 @@ func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
 		rblDetector:         rblDetector,
 		rblChecker:          rblChecker,
 		dashboard:           dashboard,
+		messageLookup:       messageLookup,
+		parserCoverage:      parserCoverage,
+		logArchive:          logArchive,
 		settingsMetaHandler: m,
 		settingsRunner:      settingsRunner,
+		retentionRunner:     retentionRunner,
 		importAnnouncer:     importAnnouncer,
-		closes: closeutil.New(
-			auth,
-			tracker,
-			deliveries,
-			insightsEngine,
-			m,
-			insightsAcessor,
-		),
-		NotificationCenter: notificationCenter,
+		closes:              closes,
+		NotificationCenter:  notificationCenter,
 	}
 
 	ws.CancelableRunner = runner.NewCancelableRunner(func(done runner.DoneChan, cancel runner.CancelChan) {
@@ -165,6 +235,7 @@ func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
 		doneSettings, cancelSettings := ws.settingsRunner.Run()
 		doneMsgRbl, cancelMsgRbl := ws.rblDetector.Run()
 		doneLogsRunner, cancelLogsRunner := logsRunner.Run()
+		doneRetention, cancelRetention := ws.retentionRunner.Run()
 
 		// We don't need to explicitly ends the importer, as it'll
 		// end when the import process finished, as it's a single-shot process!
@@ -172,6 +243,12 @@ func NewWorkspace(workspaceDirectory string) (*Workspace, error) {
 
 		go func() {
 			<-cancel
+
+			// the retention runner writes via the logs and insights runners,
+			// therefore it must finish before them
+			cancelRetention()
+			errorutil.MustSucceed(doneRetention())
+
 			cancelLogsRunner()
 			cancelMsgRbl()
 			cancelSettings()
@@ -211,6 +288,31 @@ func (ws *Workspace) Dashboard() dashboard.Dashboard {
 	return ws.dashboard
 }
 
+func (ws *Workspace) MessageLookup() messagelookup.Lookup {
+	return ws.messageLookup
+}
+
+func (ws *Workspace) ParserCoverage() *parsercoverage.Collector {
+	return ws.parserCoverage
+}
+
+func (ws *Workspace) InFlightFetcher() tracking.InFlightFetcher {
+	return ws.tracker
+}
+
+func (ws *Workspace) TrackerGCStatsFetcher() tracking.GCStatsFetcher {
+	return ws.tracker
+}
+
+// LogArchiveFetcher returns nil if the raw log lines are not archived
+func (ws *Workspace) LogArchiveFetcher() logarchive.Fetcher {
+	if ws.logArchive == nil {
+		return nil
+	}
+
+	return ws.logArchive
+}
+
 func (ws *Workspace) ImportAnnouncer() announcer.ImportAnnouncer {
 	return ws.importAnnouncer
 }
@@ -238,7 +340,22 @@ func (ws *Workspace) MostRecentLogTime() (time.Time, error) {
 }
 
 func (ws *Workspace) NewPublisher() postfix.Publisher {
-	return postfix.ComposedPublisher{ws.tracker.Publisher(), ws.rblDetector.NewPublisher()}
+	pub := postfix.ComposedPublisher{
+		ws.tracker.Publisher(),
+		ws.rblDetector.NewPublisher(),
+		ws.deliveries.RejectionsPublisher(),
+		ws.deliveries.MessageEventsPublisher(),
+		ws.deliveries.PostscreenPublisher(),
+		ws.deliveries.SaslAuthFailuresPublisher(),
+		ws.deliveries.SystemMessagesPublisher(),
+		ws.deliveries.ConnectionFailuresPublisher(),
+	}
+
+	if ws.logArchive != nil {
+		pub = append(pub, ws.logArchive.Publisher())
+	}
+
+	return pub
 }
 
 func (ws *Workspace) Close() error {
@@ -7,6 +7,7 @@ package workspace
 import (
 	. "github.com/smartystreets/goconvey/convey"
 	"gitlab.com/lightmeter/controlcenter/lmsqlite3"
+	"gitlab.com/lightmeter/controlcenter/logarchive"
 	"gitlab.com/lightmeter/controlcenter/logeater/announcer"
 	"gitlab.com/lightmeter/controlcenter/util/testutil"
 	"testing"
@@ -20,7 +21,7 @@ func TestWorkspaceCreation(t *testing.T) {
 	Convey("Creation fails on several scenarios", t, func() {
 		Convey("No Permission on workspace", func() {
 			// FIXME: this is relying on linux properties, as /proc is a read-only directory
-			_, err := NewWorkspace("/proc/lalala")
+			_, err := NewWorkspace("/proc/lalala", DefaultOptions)
 			So(err, ShouldNotBeNil)
 		})
 	})
@@ -30,7 +31,7 @@ func TestWorkspaceCreation(t *testing.T) {
 			dir, clearDir := testutil.TempDir(t)
 			defer clearDir()
 
-			ws, err := NewWorkspace(dir)
+			ws, err := NewWorkspace(dir, DefaultOptions)
 			So(err, ShouldBeNil)
 
 			defer ws.Close()
@@ -41,7 +42,7 @@ func TestWorkspaceCreation(t *testing.T) {
 			dir, clearDir := testutil.TempDir(t)
 			defer clearDir()
 
-			ws, err := NewWorkspace(dir)
+			ws, err := NewWorkspace(dir, DefaultOptions)
 			So(err, ShouldBeNil)
 			So(ws.HasLogs(), ShouldBeFalse)
 			So(ws.Close(), ShouldBeNil)
@@ -51,14 +52,32 @@ func TestWorkspaceCreation(t *testing.T) {
 			dir, clearDir := testutil.TempDir(t)
 			defer clearDir()
 
-			ws1, err := NewWorkspace(dir)
+			ws1, err := NewWorkspace(dir, DefaultOptions)
 			So(err, ShouldBeNil)
 			ws1.Close()
 
-			ws2, err := NewWorkspace(dir)
+			ws2, err := NewWorkspace(dir, DefaultOptions)
 			So(err, ShouldBeNil)
 			ws2.Close()
 		})
+
+		Convey("Raw log lines are archived only if enabled", func() {
+			dir, clearDir := testutil.TempDir(t)
+			defer clearDir()
+
+			ws1, err := NewWorkspace(dir, DefaultOptions)
+			So(err, ShouldBeNil)
+			So(ws1.LogArchiveFetcher(), ShouldBeNil)
+			So(ws1.Close(), ShouldBeNil)
+
+			options := DefaultOptions
+			options.LogArchive = &logarchive.DefaultOptions
+
+			ws2, err := NewWorkspace(dir, options)
+			So(err, ShouldBeNil)
+			So(ws2.LogArchiveFetcher(), ShouldNotBeNil)
+			So(ws2.Close(), ShouldBeNil)
+		})
 	})
 }
 
@@ -68,7 +87,7 @@ func TestWorkspaceExecution(t *testing.T) {
 			dir, clearDir := testutil.TempDir(t)
 			defer clearDir()
 
-			ws, err := NewWorkspace(dir)
+			ws, err := NewWorkspace(dir, DefaultOptions)
 			So(err, ShouldBeNil)
 
 			defer ws.Close()